@@ -0,0 +1,269 @@
+// Package client talks to a running nameport daemon over its HTTP API.
+//
+// It is meant for tools that want to list or manage services without
+// hand-rolling requests to /api/*, and is also used by the nameport CLI.
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultURLs are the daemon addresses tried by Discover: port 80, then the
+// high-port (--dev) mode.
+var DefaultURLs = []string{"http://127.0.0.1:80", "http://127.0.0.1:8080"}
+
+// Client is a daemon API client
+type Client struct {
+	BaseURL    string       // e.g. "http://127.0.0.1:80"
+	Token      string       // API token for privileged endpoints (optional)
+	HTTPClient *http.Client // Defaults to a client with a short timeout
+}
+
+// Service is a service record as the daemon reports it from /api/records.
+// Auth tokens are never included.
+type Service struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Port        int       `json:"port"`
+	TargetHost  string    `json:"target_host,omitempty"` // Empty means 127.0.0.1
+	PID         int       `json:"pid"`
+	ExePath     string    `json:"exe_path"`
+	Args        []string  `json:"args"`
+	UserDefined bool      `json:"user_defined"` // The name was set by the user
+	IsActive    bool      `json:"is_active"`
+	LastSeen    time.Time `json:"last_seen"`
+	Keep        bool      `json:"keep"` // Kept while inactive
+	Group       string    `json:"group,omitempty"`
+	UseTLS      bool      `json:"use_tls,omitempty"`
+	Source      string    `json:"source,omitempty"` // discovered, manual, compose or docker
+	HealthPath  string    `json:"health_path,omitempty"`
+	Color       string    `json:"color,omitempty"`
+	Icon        string    `json:"icon,omitempty"`
+}
+
+// BlacklistResult is the daemon's reply to a new blacklist entry
+type BlacklistResult struct {
+	ID      string   `json:"id"`
+	Removed []string `json:"removed"` // Active services dropped by the entry
+}
+
+// NameSuggestion is a service the daemon's current naming rules would name
+// differently
+type NameSuggestion struct {
+	Name      string `json:"name"`
+	Suggested string `json:"suggested"`
+}
+
+// MetricsSnapshot is the traffic of one proxied service, from /api/metrics
+type MetricsSnapshot struct {
+	ServiceName          string        `json:"service_name"`
+	ActiveConns          int64         `json:"active_conns"`
+	TotalRequests        int64         `json:"total_requests"`
+	TotalBytesIn         int64         `json:"total_bytes_in"`
+	TotalBytesOut        int64         `json:"total_bytes_out"`
+	P50ResponseMs        float64       `json:"p50_response_ms"`
+	P95ResponseMs        float64       `json:"p95_response_ms"`
+	P99ResponseMs        float64       `json:"p99_response_ms"`
+	StatusCodes          map[int]int64 `json:"status_codes"`
+	RequestsPerSec       float64       `json:"requests_per_sec"` // Average since the service was first seen
+	TLSHandshakeFailures int64         `json:"tls_handshake_failures,omitempty"`
+}
+
+// APIError is a request the daemon received but refused
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("daemon returned %d: %s", e.StatusCode, e.Message)
+}
+
+// Stats describes the running daemon, from /api/debug/stats
+type Stats struct {
+	Version    string `json:"version"`
+	Services   int    `json:"services"`
+	Goroutines int    `json:"goroutines"`
+	HTTPPort   int    `json:"http_port"`
+	HTTPSPort  int    `json:"https_port"`
+	TLSEnabled bool   `json:"tls_enabled"`
+}
+
+// New creates a client for the daemon at baseURL
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		HTTPClient: &http.Client{Timeout: 2 * time.Second},
+	}
+}
+
+// URLs returns the base URLs to try when looking for a daemon.
+// NAMEPORT_DAEMON_URL overrides DefaultURLs.
+func URLs() []string {
+	if u := os.Getenv("NAMEPORT_DAEMON_URL"); u != "" {
+		return []string{strings.TrimSuffix(u, "/")}
+	}
+	return DefaultURLs
+}
+
+// Discover returns a client for the first reachable daemon in URLs
+func Discover() (*Client, error) {
+	var lastErr error
+	for _, base := range URLs() {
+		c := New(base)
+		if _, err := c.ListServices(); err != nil {
+			lastErr = err
+			continue
+		}
+		return c, nil
+	}
+	return nil, fmt.Errorf("daemon not reachable: %w", lastErr)
+}
+
+// ListServices returns the daemon's in-memory service records
+func (c *Client) ListServices() ([]*Service, error) {
+	var records []*Service
+	if err := c.do(http.MethodGet, "/api/records", nil, &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// Rename changes the name of a service. A missing .localhost suffix on
+// newName is added by the daemon.
+func (c *Client) Rename(oldName, newName string) error {
+	body := map[string]string{"oldName": oldName, "newName": newName}
+	return c.do(http.MethodPost, "/api/rename", body, nil)
+}
+
+// SetKeep sets whether a service is kept while inactive
+func (c *Client) SetKeep(name string, keep bool) error {
+	body := map[string]interface{}{"name": name, "keep": keep}
+	return c.do(http.MethodPost, "/api/keep", body, nil)
+}
+
+// Blacklist adds a blacklist entry. entryType is "pid", "path" or "pattern".
+func (c *Client) Blacklist(entryType, value string) (*BlacklistResult, error) {
+	body := map[string]string{"type": entryType, "value": value}
+	var result BlacklistResult
+	if err := c.do(http.MethodPost, "/api/blacklist", body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Reload makes the daemon re-read its store and blacklist from disk and
+// returns the number of services loaded
+func (c *Client) Reload() (int, error) {
+	var result struct {
+		Services int `json:"services"`
+	}
+	if err := c.do(http.MethodPost, "/api/reload", nil, &result); err != nil {
+		return 0, err
+	}
+	return result.Services, nil
+}
+
+// ReloadRules makes the daemon re-read the naming rules and returns the
+// number of rules loaded. Only services discovered afterwards are named by
+// them; see NameSuggestions for the existing ones.
+func (c *Client) ReloadRules() (int, error) {
+	var result struct {
+		Rules int `json:"rules"`
+	}
+	if err := c.do(http.MethodPost, "/api/rules/reload", nil, &result); err != nil {
+		return 0, err
+	}
+	return result.Rules, nil
+}
+
+// NameSuggestions lists the discovered services the current naming rules
+// would rename
+func (c *Client) NameSuggestions() ([]NameSuggestion, error) {
+	var suggestions []NameSuggestion
+	if err := c.do(http.MethodGet, "/api/rules/suggestions", nil, &suggestions); err != nil {
+		return nil, err
+	}
+	return suggestions, nil
+}
+
+// ApplyNameSuggestions renames every service listed by NameSuggestions and
+// returns the renames made
+func (c *Client) ApplyNameSuggestions() ([]NameSuggestion, error) {
+	var applied []NameSuggestion
+	if err := c.do(http.MethodPost, "/api/rules/apply", nil, &applied); err != nil {
+		return nil, err
+	}
+	return applied, nil
+}
+
+// Metrics returns traffic metrics for every service the daemon has proxied
+func (c *Client) Metrics() ([]*MetricsSnapshot, error) {
+	var snapshots []*MetricsSnapshot
+	if err := c.do(http.MethodGet, "/api/metrics", nil, &snapshots); err != nil {
+		return nil, err
+	}
+	return snapshots, nil
+}
+
+// Stats returns the daemon's version, ports and runtime counters
+func (c *Client) Stats() (*Stats, error) {
+	var stats Stats
+	if err := c.do(http.MethodGet, "/api/debug/stats", nil, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// do sends a request with an optional JSON body and decodes the JSON
+// response into out when out is non-nil
+func (c *Client) do(method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.BaseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		return &APIError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(msg))}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("invalid response from %s: %w", c.BaseURL, err)
+	}
+	return nil
+}
@@ -0,0 +1,274 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"nameport/internal/metrics"
+	"nameport/internal/storage"
+)
+
+// recordedRequest captures what the fake daemon received.
+type recordedRequest struct {
+	Method string
+	Path   string
+	Auth   string
+	Body   map[string]interface{}
+}
+
+// fakeDaemon serves reply as JSON for every request and records the request.
+func fakeDaemon(t *testing.T, reply interface{}) (*Client, *recordedRequest) {
+	t.Helper()
+	got := &recordedRequest{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got.Method = r.Method
+		got.Path = r.URL.Path
+		got.Auth = r.Header.Get("Authorization")
+		if r.ContentLength > 0 {
+			if err := json.NewDecoder(r.Body).Decode(&got.Body); err != nil {
+				t.Errorf("request body is not JSON: %v", err)
+			}
+		}
+		json.NewEncoder(w).Encode(reply)
+	}))
+	t.Cleanup(srv.Close)
+	return New(srv.URL), got
+}
+
+func TestListServices(t *testing.T) {
+	c, got := fakeDaemon(t, []*storage.ServiceRecord{
+		{ID: "id1", Name: "app.localhost", Port: 3000, Source: storage.SourceDiscovered},
+	})
+
+	records, err := c.ListServices()
+	if err != nil {
+		t.Fatalf("ListServices: %v", err)
+	}
+	if got.Method != http.MethodGet || got.Path != "/api/records" {
+		t.Errorf("request = %s %s, want GET /api/records", got.Method, got.Path)
+	}
+	if len(records) != 1 || records[0].Name != "app.localhost" || records[0].Port != 3000 {
+		t.Errorf("records = %+v", records)
+	}
+}
+
+func TestListServices_DecodesRecordFields(t *testing.T) {
+	c, _ := fakeDaemon(t, []*storage.ServiceRecord{{
+		ID: "id1", Name: "app.localhost", Port: 3000, TargetHost: "10.0.0.2", Keep: true,
+		Group: "app", UseTLS: true, Source: storage.SourceManual, HealthPath: "/app", Icon: "🦙",
+	}})
+
+	records, err := c.ListServices()
+	if err != nil {
+		t.Fatalf("ListServices: %v", err)
+	}
+	want := Service{
+		ID: "id1", Name: "app.localhost", Port: 3000, TargetHost: "10.0.0.2", Keep: true,
+		Group: "app", UseTLS: true, Source: storage.SourceManual, HealthPath: "/app", Icon: "🦙",
+	}
+	if len(records) != 1 || !reflect.DeepEqual(*records[0], want) {
+		t.Errorf("records = %+v, want %+v", records, want)
+	}
+}
+
+// TestAPIHasNoInternalTypes keeps the package usable outside the module:
+// its exported API must not mention nameport/internal types.
+func TestAPIHasNoInternalTypes(t *testing.T) {
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, file, nil, parser.ImportsOnly)
+		if err != nil {
+			t.Fatalf("parse %s: %v", file, err)
+		}
+		for _, imp := range f.Imports {
+			if strings.Contains(imp.Path.Value, "nameport/internal/") {
+				t.Errorf("%s imports %s", file, imp.Path.Value)
+			}
+		}
+	}
+}
+
+func TestRename(t *testing.T) {
+	c, got := fakeDaemon(t, map[string]string{"status": "ok"})
+
+	if err := c.Rename("old.localhost", "new.localhost"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	if got.Method != http.MethodPost || got.Path != "/api/rename" {
+		t.Errorf("request = %s %s, want POST /api/rename", got.Method, got.Path)
+	}
+	if got.Body["oldName"] != "old.localhost" || got.Body["newName"] != "new.localhost" {
+		t.Errorf("body = %v", got.Body)
+	}
+}
+
+func TestSetKeep(t *testing.T) {
+	c, got := fakeDaemon(t, map[string]string{"status": "ok"})
+
+	if err := c.SetKeep("app.localhost", true); err != nil {
+		t.Fatalf("SetKeep: %v", err)
+	}
+	if got.Method != http.MethodPost || got.Path != "/api/keep" {
+		t.Errorf("request = %s %s, want POST /api/keep", got.Method, got.Path)
+	}
+	if got.Body["name"] != "app.localhost" || got.Body["keep"] != true {
+		t.Errorf("body = %v", got.Body)
+	}
+}
+
+func TestBlacklist(t *testing.T) {
+	c, got := fakeDaemon(t, map[string]interface{}{
+		"status":  "ok",
+		"id":      "bl-1",
+		"removed": []string{"app.localhost"},
+	})
+
+	result, err := c.Blacklist("path", "/opt/app")
+	if err != nil {
+		t.Fatalf("Blacklist: %v", err)
+	}
+	if got.Method != http.MethodPost || got.Path != "/api/blacklist" {
+		t.Errorf("request = %s %s, want POST /api/blacklist", got.Method, got.Path)
+	}
+	if got.Body["type"] != "path" || got.Body["value"] != "/opt/app" {
+		t.Errorf("body = %v", got.Body)
+	}
+	if result.ID != "bl-1" || len(result.Removed) != 1 || result.Removed[0] != "app.localhost" {
+		t.Errorf("result = %+v", result)
+	}
+}
+
+func TestReload(t *testing.T) {
+	c, got := fakeDaemon(t, map[string]interface{}{"status": "ok", "services": 4})
+
+	n, err := c.Reload()
+	if err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if got.Method != http.MethodPost || got.Path != "/api/reload" {
+		t.Errorf("request = %s %s, want POST /api/reload", got.Method, got.Path)
+	}
+	if n != 4 {
+		t.Errorf("services = %d, want 4", n)
+	}
+}
+
+func TestReloadRules(t *testing.T) {
+	c, got := fakeDaemon(t, map[string]interface{}{"status": "ok", "rules": 31})
+
+	n, err := c.ReloadRules()
+	if err != nil {
+		t.Fatalf("ReloadRules: %v", err)
+	}
+	if got.Method != http.MethodPost || got.Path != "/api/rules/reload" {
+		t.Errorf("request = %s %s, want POST /api/rules/reload", got.Method, got.Path)
+	}
+	if n != 31 {
+		t.Errorf("rules = %d, want 31", n)
+	}
+}
+
+func TestNameSuggestions(t *testing.T) {
+	reply := []NameSuggestion{{Name: "server.localhost", Suggested: "acme.localhost"}}
+
+	c, got := fakeDaemon(t, reply)
+	suggestions, err := c.NameSuggestions()
+	if err != nil {
+		t.Fatalf("NameSuggestions: %v", err)
+	}
+	if got.Method != http.MethodGet || got.Path != "/api/rules/suggestions" {
+		t.Errorf("request = %s %s, want GET /api/rules/suggestions", got.Method, got.Path)
+	}
+	if len(suggestions) != 1 || suggestions[0] != reply[0] {
+		t.Errorf("suggestions = %+v, want %+v", suggestions, reply)
+	}
+
+	c, got = fakeDaemon(t, reply)
+	applied, err := c.ApplyNameSuggestions()
+	if err != nil {
+		t.Fatalf("ApplyNameSuggestions: %v", err)
+	}
+	if got.Method != http.MethodPost || got.Path != "/api/rules/apply" {
+		t.Errorf("request = %s %s, want POST /api/rules/apply", got.Method, got.Path)
+	}
+	if len(applied) != 1 || applied[0] != reply[0] {
+		t.Errorf("applied = %+v, want %+v", applied, reply)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	c, got := fakeDaemon(t, []*metrics.MetricsSnapshot{
+		{ServiceName: "app.localhost", TotalRequests: 12, StatusCodes: map[int]int64{200: 12}},
+	})
+
+	snapshots, err := c.Metrics()
+	if err != nil {
+		t.Fatalf("Metrics: %v", err)
+	}
+	if got.Method != http.MethodGet || got.Path != "/api/metrics" {
+		t.Errorf("request = %s %s, want GET /api/metrics", got.Method, got.Path)
+	}
+	if len(snapshots) != 1 || snapshots[0].TotalRequests != 12 || snapshots[0].StatusCodes[200] != 12 {
+		t.Errorf("snapshots = %+v", snapshots)
+	}
+}
+
+func TestStats(t *testing.T) {
+	c, got := fakeDaemon(t, map[string]interface{}{
+		"version": "v1.2.0", "services": 3, "http_port": 8080, "https_port": 8443, "tls_enabled": true,
+	})
+
+	stats, err := c.Stats()
+	if err != nil {
+		t.Fatalf("Stats: %v", err)
+	}
+	if got.Method != http.MethodGet || got.Path != "/api/debug/stats" {
+		t.Errorf("request = %s %s, want GET /api/debug/stats", got.Method, got.Path)
+	}
+	if stats.Version != "v1.2.0" || stats.HTTPPort != 8080 || stats.HTTPSPort != 8443 || !stats.TLSEnabled {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestTokenSentAsBearer(t *testing.T) {
+	c, got := fakeDaemon(t, []*storage.ServiceRecord{})
+	c.Token = "secret"
+
+	if _, err := c.ListServices(); err != nil {
+		t.Fatalf("ListServices: %v", err)
+	}
+	if got.Auth != "Bearer secret" {
+		t.Errorf("Authorization = %q, want %q", got.Auth, "Bearer secret")
+	}
+}
+
+func TestErrorStatusReturnsAPIError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Service not found", http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	err := New(srv.URL).SetKeep("missing.localhost", true)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("err = %v, want *APIError", err)
+	}
+	if apiErr.StatusCode != http.StatusNotFound || apiErr.Message != "Service not found" {
+		t.Errorf("APIError = %+v", apiErr)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Exit codes. Scripts can rely on these; they are listed in the help output.
+const (
+	exitFailure  = 1 // The operation failed
+	exitUsage    = 2 // Invalid usage: unknown command, missing or malformed arguments
+	exitNotFound = 3 // The named service, entry or file does not exist
+	exitConflict = 4 // The name or entry is already in use
+)
+
+// exitError is an error that selects the CLI's exit code
+type exitError struct {
+	code int
+	msg  string
+}
+
+func (e *exitError) Error() string { return e.msg }
+
+// usageError reports invalid usage (exit code 2)
+func usageError(format string, args ...interface{}) error {
+	return &exitError{code: exitUsage, msg: fmt.Sprintf(format, args...)}
+}
+
+// notFoundError reports a missing service or entry (exit code 3)
+func notFoundError(format string, args ...interface{}) error {
+	return &exitError{code: exitNotFound, msg: fmt.Sprintf(format, args...)}
+}
+
+// conflictError reports a name or entry that is already taken (exit code 4)
+func conflictError(format string, args ...interface{}) error {
+	return &exitError{code: exitConflict, msg: fmt.Sprintf(format, args...)}
+}
+
+// errFailed is a general failure whose details were already printed
+var errFailed = &exitError{code: exitFailure}
+
+// exitCode returns the process exit code for err: 0 for nil, the code of an
+// exitError, and exitFailure for anything else.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var e *exitError
+	if errors.As(err, &e) {
+		return e.code
+	}
+	return exitFailure
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"nameport/internal/storage"
+)
+
+// runCLI runs the CLI against a store in a temporary home directory
+func runCLI(t *testing.T, storePath string, args ...string) error {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	return run(append([]string{"nameport", "--config", storePath}, args...))
+}
+
+func TestRun_ExitCodes(t *testing.T) {
+	storePath := filepath.Join(t.TempDir(), "services.json")
+	store, err := storage.NewStore(storePath)
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	for i, name := range []string{"web.localhost", "api.localhost"} {
+		if _, err := store.AddManualService(name, 3000+i, ""); err != nil {
+			t.Fatalf("AddManualService: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"success", []string{"keep", "web", "true"}, 0},
+		{"unknown command", []string{"frobnicate"}, exitUsage},
+		{"missing arguments", []string{"rename", "web"}, exitUsage},
+		{"malformed argument", []string{"throttle", "web", "fast"}, exitUsage},
+		{"unknown source", []string{"list", "--source", "nowhere"}, exitUsage},
+		{"list flag without value", []string{"list", "--sort"}, exitUsage},
+		{"list stray argument", []string{"list", "web"}, exitUsage},
+		{"prune flag without value", []string{"prune", "--source"}, exitUsage},
+		{"prune stray arguments", []string{"prune", "foo", "bar"}, exitUsage},
+		{"service flag without value", []string{"service", "status", "--daemon"}, exitUsage},
+		{"service not found", []string{"rename", "missing", "other"}, exitNotFound},
+		{"remove not found", []string{"remove", "missing"}, exitNotFound},
+		{"name in use", []string{"rename", "web", "api"}, exitConflict},
+		{"target in use", []string{"add", "copy", "3000"}, exitConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exitCode(runCLI(t, storePath, tt.args...)); got != tt.want {
+				t.Errorf("nameport %v exited %d, want %d", tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExitCode_GeneralFailure(t *testing.T) {
+	if got := exitCode(errors.New("boom")); got != exitFailure {
+		t.Errorf("exitCode(plain error) = %d, want %d", got, exitFailure)
+	}
+	if got := exitCode(nil); got != 0 {
+		t.Errorf("exitCode(nil) = %d, want 0", got)
+	}
+}
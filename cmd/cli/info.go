@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"nameport/client"
+	"nameport/internal/naming"
+	"nameport/internal/notify"
+	"nameport/internal/storage"
+	"nameport/internal/system"
+	"nameport/internal/tls/ca"
+	"nameport/internal/tls/trust"
+	"nameport/internal/version"
+)
+
+// installInfo is the summary printed by nameport info
+type installInfo struct {
+	Version       string        `json:"version"`
+	Daemon        daemonInfo    `json:"daemon"`
+	Services      serviceCounts `json:"services"`
+	TLS           tlsInfo       `json:"tls"`
+	Notifications notifyInfo    `json:"notifications"`
+	Paths         infoPaths     `json:"paths"`
+}
+
+// daemonInfo combines the service manager's view with the daemon's own
+type daemonInfo struct {
+	Installed  bool   `json:"installed"` // Installed as a system or user service
+	ServicePID int    `json:"service_pid,omitempty"`
+	Running    bool   `json:"running"` // Answering its API
+	URL        string `json:"url,omitempty"`
+	Version    string `json:"version,omitempty"`
+	HTTPPort   int    `json:"http_port,omitempty"`
+	HTTPSPort  int    `json:"https_port,omitempty"`
+	TLSEnabled bool   `json:"tls_enabled"`
+}
+
+type serviceCounts struct {
+	Total    int `json:"total"`
+	Active   int `json:"active"`
+	Inactive int `json:"inactive"`
+	Kept     int `json:"kept"`
+}
+
+type tlsInfo struct {
+	Initialized         bool       `json:"initialized"`
+	Trusted             bool       `json:"trusted"`
+	RootExpires         *time.Time `json:"root_expires,omitempty"`
+	IntermediateExpires *time.Time `json:"intermediate_expires,omitempty"`
+	Error               string     `json:"error,omitempty"`
+}
+
+type notifyInfo struct {
+	Enabled bool   `json:"enabled"`
+	Error   string `json:"error,omitempty"`
+}
+
+type infoPaths struct {
+	Store        string `json:"store"`
+	Blacklist    string `json:"blacklist"`
+	NamingRules  string `json:"naming_rules"`
+	NotifyConfig string `json:"notify_config"`
+	CAStore      string `json:"ca_store"`
+}
+
+// infoSources are where gatherInfo looks; tests point them at fixtures
+type infoSources struct {
+	store          *storage.Store
+	paths          infoPaths
+	services       system.ServiceManager
+	trustor        trust.Trustor
+	discoverDaemon func() (*client.Client, error)
+}
+
+// defaultInfoSources returns the sources of the local install
+func defaultInfoSources(store *storage.Store, storePath, blacklistPath string) infoSources {
+	return infoSources{
+		store: store,
+		paths: infoPaths{
+			Store:        storePath,
+			Blacklist:    blacklistPath,
+			NamingRules:  naming.UserRulesPath(),
+			NotifyConfig: notify.DefaultConfigPath(),
+			CAStore:      caStorePath(),
+		},
+		services:       system.NewServiceManager(),
+		trustor:        trust.NewPlatformTrustor(),
+		discoverDaemon: client.Discover,
+	}
+}
+
+// gatherInfo collects the install summary. Parts that can't be read are
+// reported in the summary rather than failing it.
+func gatherInfo(src infoSources) installInfo {
+	info := installInfo{
+		Version: version.String(),
+		Paths:   src.paths,
+	}
+
+	if src.services != nil {
+		if status, err := src.services.Status(); err == nil {
+			info.Daemon.Installed = status.Installed
+			info.Daemon.ServicePID = status.PID
+		}
+	}
+	if src.discoverDaemon != nil {
+		if c, err := src.discoverDaemon(); err == nil {
+			info.Daemon.Running = true
+			info.Daemon.URL = c.BaseURL
+			if stats, err := c.Stats(); err == nil {
+				info.Daemon.Version = stats.Version
+				info.Daemon.HTTPPort = stats.HTTPPort
+				info.Daemon.HTTPSPort = stats.HTTPSPort
+				info.Daemon.TLSEnabled = stats.TLSEnabled
+			}
+		}
+	}
+
+	for _, r := range src.store.List() {
+		info.Services.Total++
+		if r.IsActive {
+			info.Services.Active++
+		} else {
+			info.Services.Inactive++
+		}
+		if r.Keep {
+			info.Services.Kept++
+		}
+	}
+
+	if tlsCA, err := ca.NewCA(src.paths.CAStore); err != nil {
+		info.TLS.Error = err.Error()
+	} else if tlsCA.IsInitialized() {
+		info.TLS.Initialized = true
+		rootExpires, interExpires := tlsCA.RootCert.NotAfter, tlsCA.InterCert.NotAfter
+		info.TLS.RootExpires = &rootExpires
+		info.TLS.IntermediateExpires = &interExpires
+		if src.trustor != nil {
+			info.TLS.Trusted = src.trustor.IsInstalled(tlsCA.RootCertPEM())
+		}
+	}
+
+	if cfg, err := notify.LoadConfig(src.paths.NotifyConfig); err != nil {
+		info.Notifications.Error = err.Error()
+	} else {
+		info.Notifications.Enabled = cfg.Enabled
+	}
+
+	return info
+}
+
+// cmdInfo prints a summary of the whole install
+func cmdInfo(src infoSources, asJSON bool) error {
+	info := gatherInfo(src)
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(info)
+	}
+
+	fmt.Printf("nameport %s\n\n", info.Version)
+
+	switch {
+	case info.Daemon.Running:
+		fmt.Printf("Daemon:          running at %s", info.Daemon.URL)
+		if info.Daemon.Version != "" {
+			fmt.Printf(" (%s)", info.Daemon.Version)
+		}
+		fmt.Println()
+		if info.Daemon.HTTPPort > 0 {
+			if info.Daemon.TLSEnabled {
+				fmt.Printf("  Ports:         HTTP %d, HTTPS %d\n", info.Daemon.HTTPPort, info.Daemon.HTTPSPort)
+			} else {
+				fmt.Printf("  Ports:         HTTP %d (TLS disabled)\n", info.Daemon.HTTPPort)
+			}
+		}
+	default:
+		fmt.Println("Daemon:          not running")
+	}
+	if info.Daemon.Installed {
+		if info.Daemon.ServicePID > 0 {
+			fmt.Printf("  Service:       installed (PID %d)\n", info.Daemon.ServicePID)
+		} else {
+			fmt.Println("  Service:       installed")
+		}
+	} else {
+		fmt.Println("  Service:       not installed ('nameport service install')")
+	}
+
+	fmt.Printf("Services:        %d (%d active, %d inactive, %d kept)\n",
+		info.Services.Total, info.Services.Active, info.Services.Inactive, info.Services.Kept)
+
+	switch {
+	case info.TLS.Error != "":
+		fmt.Printf("TLS CA:          error (%s)\n", info.TLS.Error)
+	case !info.TLS.Initialized:
+		fmt.Println("TLS CA:          not initialized ('nameport tls init')")
+	default:
+		trusted := "trusted"
+		if !info.TLS.Trusted {
+			trusted = "NOT trusted by the OS"
+		}
+		fmt.Printf("TLS CA:          initialized, %s\n", trusted)
+		fmt.Printf("  Root expires:  %s\n", info.TLS.RootExpires.Format("2006-01-02"))
+		fmt.Printf("  Inter expires: %s\n", info.TLS.IntermediateExpires.Format("2006-01-02"))
+	}
+
+	switch {
+	case info.Notifications.Error != "":
+		fmt.Printf("Notifications:   error (%s)\n", info.Notifications.Error)
+	case info.Notifications.Enabled:
+		fmt.Println("Notifications:   enabled")
+	default:
+		fmt.Println("Notifications:   disabled")
+	}
+
+	fmt.Println()
+	fmt.Println("Paths:")
+	fmt.Printf("  Store:         %s\n", info.Paths.Store)
+	fmt.Printf("  Blacklist:     %s\n", info.Paths.Blacklist)
+	fmt.Printf("  Naming rules:  %s\n", info.Paths.NamingRules)
+	fmt.Printf("  Notify config: %s\n", info.Paths.NotifyConfig)
+	fmt.Printf("  CA store:      %s\n", info.Paths.CAStore)
+	return nil
+}
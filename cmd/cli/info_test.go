@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"nameport/client"
+	"nameport/internal/notify"
+	"nameport/internal/system"
+	"nameport/internal/tls/ca"
+)
+
+// fakeServiceManager reports a fixed status
+type fakeServiceManager struct{ status system.ServiceStatus }
+
+func (f fakeServiceManager) Install(string) error                  { return nil }
+func (f fakeServiceManager) Uninstall() error                      { return nil }
+func (f fakeServiceManager) Status() (system.ServiceStatus, error) { return f.status, nil }
+func (f fakeServiceManager) Start() error                          { return nil }
+func (f fakeServiceManager) Stop() error                           { return nil }
+
+// fakeTrustor reports whether the root is trusted
+type fakeTrustor struct{ installed bool }
+
+func (f fakeTrustor) Install([]byte) error    { return nil }
+func (f fakeTrustor) Uninstall() error        { return nil }
+func (f fakeTrustor) IsInstalled([]byte) bool { return f.installed }
+func (f fakeTrustor) NeedsElevation() bool    { return false }
+
+func TestGatherInfo(t *testing.T) {
+	dir := t.TempDir()
+	store := newTestStore(t)
+	for i, name := range []string{"web.localhost", "api.localhost"} {
+		if _, err := store.AddManualService(name, 3000+i, ""); err != nil {
+			t.Fatalf("AddManualService: %v", err)
+		}
+	}
+	record, _ := store.GetByName("web.localhost")
+	record.IsActive = true
+	record.Keep = false
+	store.Save(record)
+
+	caPath := filepath.Join(dir, "ca")
+	c, err := ca.NewCA(caPath)
+	if err != nil {
+		t.Fatalf("NewCA: %v", err)
+	}
+	if err := c.Init(); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+
+	notifyPath := filepath.Join(dir, "notify.json")
+	if err := notify.SaveConfig(notifyPath, notify.Config{Enabled: false}); err != nil {
+		t.Fatalf("SaveConfig: %v", err)
+	}
+
+	daemon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(client.Stats{Version: "v9.9.9", HTTPPort: 8080, HTTPSPort: 8443, TLSEnabled: true})
+	}))
+	defer daemon.Close()
+
+	info := gatherInfo(infoSources{
+		store:          store,
+		paths:          infoPaths{CAStore: caPath, NotifyConfig: notifyPath},
+		services:       fakeServiceManager{system.ServiceStatus{Installed: true, Running: true, PID: 42}},
+		trustor:        fakeTrustor{installed: true},
+		discoverDaemon: func() (*client.Client, error) { return client.New(daemon.URL), nil },
+	})
+
+	if want := (serviceCounts{Total: 2, Active: 1, Inactive: 1, Kept: 1}); info.Services != want {
+		t.Errorf("services = %+v, want %+v", info.Services, want)
+	}
+	if !info.TLS.Initialized || !info.TLS.Trusted || info.TLS.RootExpires == nil {
+		t.Errorf("tls = %+v, want initialized and trusted", info.TLS)
+	}
+	if !info.Daemon.Installed || info.Daemon.ServicePID != 42 || !info.Daemon.Running {
+		t.Errorf("daemon = %+v, want installed and running", info.Daemon)
+	}
+	if info.Daemon.Version != "v9.9.9" || info.Daemon.HTTPPort != 8080 || info.Daemon.HTTPSPort != 8443 {
+		t.Errorf("daemon = %+v, want version and ports from its stats", info.Daemon)
+	}
+	if info.Notifications.Enabled {
+		t.Error("notifications reported enabled")
+	}
+}
+
+func TestGatherInfo_NothingSetUp(t *testing.T) {
+	dir := t.TempDir()
+	info := gatherInfo(infoSources{
+		store: newTestStore(t),
+		paths: infoPaths{CAStore: filepath.Join(dir, "ca"), NotifyConfig: filepath.Join(dir, "notify.json")},
+	})
+
+	if info.Services != (serviceCounts{}) {
+		t.Errorf("services = %+v, want none", info.Services)
+	}
+	if info.TLS.Initialized || info.TLS.Error != "" {
+		t.Errorf("tls = %+v, want not initialized", info.TLS)
+	}
+	if info.Daemon.Running || info.Daemon.Installed {
+		t.Errorf("daemon = %+v, want neither installed nor running", info.Daemon)
+	}
+	if !info.Notifications.Enabled {
+		t.Error("notifications should default to enabled without a config file")
+	}
+}
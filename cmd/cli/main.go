@@ -1,8 +1,10 @@
 package main
 
 import (
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"net"
 	"os"
 	"path/filepath"
 	"sort"
@@ -10,9 +12,15 @@ import (
 	"strings"
 	"time"
 
+	"nameport/client"
 	"nameport/internal/naming"
 	"nameport/internal/notify"
+	"nameport/internal/portscan"
+	"nameport/internal/probe"
+	"nameport/internal/proxyproto"
 	"nameport/internal/storage"
+	"nameport/internal/system"
+	"nameport/internal/throttle"
 	"nameport/internal/tls/ca"
 	"nameport/internal/tls/issuer"
 	"nameport/internal/tls/policy"
@@ -20,145 +28,234 @@ import (
 )
 
 func main() {
-	if len(os.Args) < 2 {
+	if err := run(os.Args); err != nil {
+		if msg := err.Error(); msg != "" {
+			fmt.Fprintln(os.Stderr, msg)
+		}
+		os.Exit(exitCode(err))
+	}
+}
+
+// run executes the command line args (including the program name, as in
+// os.Args). The returned error determines the exit code; see exitCode.
+func run(args []string) error {
+	if len(args) < 2 {
 		printUsage()
-		os.Exit(1)
+		return usageError("Missing command")
 	}
+	args = append([]string(nil), args...)
 
 	storePath := storage.DefaultStorePath()
 	blacklistPath := storage.DefaultBlacklistPath()
 
 	// Check for custom store path
-	for i, arg := range os.Args {
-		if arg == "--config" && i+1 < len(os.Args) {
-			storePath = os.Args[i+1]
+	for i, arg := range args {
+		if arg == "--config" && i+1 < len(args) {
+			storePath = args[i+1]
 			// Remove these args
-			os.Args = append(os.Args[:i], os.Args[i+2:]...)
+			args = append(args[:i], args[i+2:]...)
 			break
 		}
 	}
 
 	store, err := storage.NewStore(storePath)
 	if err != nil {
-		log.Fatalf("Failed to open store: %v", err)
+		return fmt.Errorf("Failed to open store: %v", err)
 	}
 
 	blacklistStore, err := storage.NewBlacklistStore(blacklistPath)
 	if err != nil {
-		log.Fatalf("Failed to open blacklist store: %v", err)
+		return fmt.Errorf("Failed to open blacklist store: %v", err)
 	}
 
-	command := os.Args[1]
+	command := args[1]
 
 	switch command {
 	case "list", "ls":
-		cmdList(store)
+		source, sortBy, err := parseListArgs(args[2:])
+		if err != nil {
+			return err
+		}
+		return cmdList(store, source, sortBy)
 	case "rename", "mv":
-		if len(os.Args) < 4 {
-			fmt.Fprintf(os.Stderr, "Usage: nameport rename <old-name> <new-name>\n")
-			os.Exit(1)
+		if len(args) < 4 {
+			return usageError("Usage: nameport rename <old-name> <new-name>")
 		}
-		cmdRename(store, os.Args[2], os.Args[3])
+		return cmdRename(store, args[2], args[3])
 	case "keep":
-		if len(os.Args) < 3 {
-			fmt.Fprintf(os.Stderr, "Usage: nameport keep <name> [true|false]\n")
-			os.Exit(1)
+		if len(args) < 3 {
+			return usageError("Usage: nameport keep <name> [true|false]")
 		}
 		keepVal := true
-		if len(os.Args) > 3 {
-			keepVal = strings.ToLower(os.Args[3]) == "true" || os.Args[3] == "1"
+		if len(args) > 3 {
+			keepVal = strings.ToLower(args[3]) == "true" || args[3] == "1"
 		}
-		cmdKeep(store, os.Args[2], keepVal)
+		return cmdKeep(store, args[2], keepVal)
 	case "blacklist":
-		if len(os.Args) < 3 {
-			fmt.Fprintf(os.Stderr, "Usage: nameport blacklist <subcommand>\n")
-			fmt.Fprintf(os.Stderr, "  blacklist <type> <value>     Add to blacklist (type: pid|path|pattern)\n")
-			fmt.Fprintf(os.Stderr, "  blacklist list               List all blacklist entries\n")
-			fmt.Fprintf(os.Stderr, "  blacklist remove <id>        Remove a blacklist entry\n")
-			os.Exit(1)
-		}
-		subCmd := os.Args[2]
+		if len(args) < 3 {
+			return usageError("Usage: nameport blacklist <subcommand>\n  blacklist <type> <value>     Add to blacklist (type: pid|path|pattern)\n  blacklist list               List all blacklist entries\n  blacklist remove <id>        Remove a blacklist entry")
+		}
+		subCmd := args[2]
 		switch subCmd {
 		case "list":
-			cmdBlacklistList(blacklistStore)
+			return cmdBlacklistList(blacklistStore)
 		case "remove":
-			if len(os.Args) < 4 {
-				fmt.Fprintf(os.Stderr, "Usage: nameport blacklist remove <id>\n")
-				os.Exit(1)
+			if len(args) < 4 {
+				return usageError("Usage: nameport blacklist remove <id>")
 			}
-			cmdBlacklistRemove(blacklistStore, os.Args[3])
+			return cmdBlacklistRemove(blacklistStore, args[3])
 		default:
 			// Treat as blacklist add: blacklist <type> <value>
-			if len(os.Args) < 4 {
-				fmt.Fprintf(os.Stderr, "Usage: nameport blacklist <type> <value>\n")
-				fmt.Fprintf(os.Stderr, "  type: pid|path|pattern\n")
-				os.Exit(1)
+			if len(args) < 4 {
+				return usageError("Usage: nameport blacklist <type> <value>\n  type: pid|path|pattern")
+			}
+			return cmdBlacklistAdd(blacklistStore, args[2], args[3])
+		}
+	case "diff":
+		return cmdDiff(store, storePath)
+	case "doctor":
+		return cmdDoctor(store, storePath)
+	case "info":
+		asJSON := false
+		for _, arg := range args[2:] {
+			if arg != "--json" {
+				return usageError("Usage: nameport info [--json]")
 			}
-			cmdBlacklistAdd(blacklistStore, os.Args[2], os.Args[3])
+			asJSON = true
+		}
+		return cmdInfo(defaultInfoSources(store, storePath, blacklistPath), asJSON)
+	case "service":
+		if len(args) < 3 {
+			return usageError("Usage: nameport service <install|uninstall|status|start|stop> [--user] [--daemon <path>]\n  --user: rootless systemd user unit (high ports, no sudo)")
+		}
+		return cmdService(args[2], args[3:])
+	case "throttle":
+		if len(args) < 4 {
+			return usageError("Usage: nameport throttle <name> <rate|off>\n  rate: e.g. 256kbps, 1mbps, 3.5mbps")
+		}
+		return cmdThrottle(store, args[2], args[3])
+	case "timeout":
+		if len(args) < 4 {
+			return usageError("Usage: nameport timeout <name> <duration|off>\n  duration: e.g. 5s, 2m (off = use the daemon default)")
 		}
+		return cmdTimeout(store, args[2], args[3])
+	case "health-path":
+		if len(args) < 4 {
+			return usageError("Usage: nameport health-path <name> </path|off>\n  Extra path tried when probing the service (e.g. /app)")
+		}
+		return cmdHealthPath(store, args[2], args[3])
+	case "override":
+		if len(args) < 4 {
+			return usageError("Usage: nameport override <name> [host:]<port> [--ttl 30m]\n       nameport override clear <name>\n  Proxies to the given target until the TTL passes or the override is cleared")
+		}
+		return cmdOverride(store, args[2:])
+	case "flush":
+		if len(args) < 4 {
+			return usageError("Usage: nameport flush <name> <interval|immediate|off>\n  interval: e.g. 100ms (immediate or -1 = flush after every write)")
+		}
+		return cmdFlush(store, args[2], args[3])
+	case "auth":
+		if len(args) < 4 || (args[3] == "bearer" && len(args) < 5) {
+			return usageError("Usage: nameport auth <name> bearer <token|env:VAR>\n       nameport auth <name> off\n  env:VAR reads the token from the daemon's environment instead of storing it")
+		}
+		return cmdAuth(store, args[2], args[3:])
+	case "color":
+		if len(args) < 4 {
+			return usageError("Usage: nameport color <name> <#rrggbb|off>")
+		}
+		return cmdColor(store, args[2], args[3])
+	case "icon":
+		if len(args) < 4 {
+			return usageError("Usage: nameport icon <name> <emoji|off>")
+		}
+		return cmdIcon(store, args[2], args[3])
+	case "host":
+		if len(args) < 4 {
+			return usageError("Usage: nameport host <name> <host|preserve|off>\n  host: fixed Host header sent to the backend (e.g. myapp.test)\n  preserve: send the .localhost name the browser used")
+		}
+		return cmdHost(store, args[2], args[3])
+	case "proxy-protocol":
+		if len(args) < 4 {
+			return usageError("Usage: nameport proxy-protocol <name> <v1|v2|off>")
+		}
+		return cmdProxyProtocol(store, args[2], args[3])
+	case "scheme":
+		if len(args) < 4 {
+			return usageError("Usage: nameport scheme <name> <https|http|auto>\n  https: link only over HTTPS (for services that require it)\n  auto: HTTPS first when the daemon has TLS enabled")
+		}
+		return cmdScheme(store, args[2], args[3])
 	case "rules":
-		if len(os.Args) < 3 {
-			fmt.Fprintf(os.Stderr, "Usage: nameport rules <list|export|import> [file]\n")
-			os.Exit(1)
+		if len(args) < 3 {
+			return usageError("Usage: nameport rules <list|export|import|reload|suggest> [file]")
 		}
-		cmdRules(os.Args[2:])
+		return cmdRules(args[2:])
 	case "notify":
-		if len(os.Args) < 3 {
-			fmt.Fprintf(os.Stderr, "Usage: nameport notify <status|enable|disable|events>\n")
-			os.Exit(1)
+		if len(args) < 3 {
+			return usageError("Usage: nameport notify <status|enable|disable|events>")
 		}
-		cmdNotify(os.Args[2:])
+		return cmdNotify(args[2:])
 	case "tls":
-		if len(os.Args) < 3 {
-			fmt.Fprintf(os.Stderr, "Usage: nameport tls <init|status|ensure|list|revoke|rotate|export|untrust>\n")
-			os.Exit(1)
+		if len(args) < 3 {
+			return usageError("Usage: nameport tls <init|status|ensure|list|revoke|rotate|export|untrust>")
 		}
-		cmdTLS(os.Args[2:])
+		return cmdTLS(args[2:])
 	case "cleanup":
-		cmdCleanup()
+		return cmdCleanup()
+	case "prune":
+		source, err := parsePruneArgs(args[2:])
+		if err != nil {
+			return err
+		}
+		return cmdPrune(store, source)
 	case "remove", "rm":
-		if len(os.Args) < 3 {
-			fmt.Fprintf(os.Stderr, "Usage: nameport remove <name>\n")
-			os.Exit(1)
+		if len(args) < 3 {
+			return usageError("Usage: nameport remove <name>")
 		}
-		cmdRemove(store, os.Args[2])
+		return cmdRemove(store, args[2])
 	case "add":
-		if len(os.Args) < 4 {
-			fmt.Fprintf(os.Stderr, "Usage: nameport add <name> [host:]<port>\n")
-			os.Exit(1)
-		}
-		target := os.Args[3]
-		var targetHost string
-		var port int
-		if idx := strings.LastIndex(target, ":"); idx != -1 {
-			// host:port format
-			targetHost = target[:idx]
-			port, err = strconv.Atoi(target[idx+1:])
-			if err != nil {
-				log.Fatalf("Invalid port number in %s", target)
+		force := false
+		useTLS := false
+		addArgs := make([]string, 0, len(args))
+		for _, arg := range args[2:] {
+			switch arg {
+			case "--force":
+				force = true
+				continue
+			case "--tls":
+				useTLS = true
+				continue
 			}
-		} else {
-			// port only, default to 127.0.0.1
-			port, err = strconv.Atoi(target)
-			if err != nil {
-				log.Fatalf("Invalid port number: %s", target)
+			addArgs = append(addArgs, arg)
+		}
+		if len(addArgs) < 2 {
+			return usageError("Usage: nameport add <name> [http[s]://][host:]<port> [--tls] [--force]\n  --tls:   the target speaks HTTPS (same as an https:// prefix)\n  --force: add even if nothing answers HTTP/HTTPS on the target")
+		}
+		scheme, targetHost, port, err := parseAddTarget(addArgs[1])
+		if err != nil {
+			return usageError("%v", err)
+		}
+		if useTLS {
+			if scheme == "http" {
+				return usageError("--tls conflicts with the http:// scheme in %s", addArgs[1])
 			}
+			scheme = "https"
 		}
-		cmdAdd(store, os.Args[2], port, targetHost)
+		return cmdAdd(store, addArgs[0], port, targetHost, scheme, force)
 	case "help", "-h", "--help":
 		printUsage()
 	default:
-		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", command)
 		printUsage()
-		os.Exit(1)
+		return usageError("Unknown command: %s", command)
 	}
+	return nil
 }
 
 func printUsage() {
 	fmt.Println("nameport - Manage local service DNS names")
 	fmt.Println()
 	fmt.Println("Usage:")
-	fmt.Println("  nameport list                          List all registered services")
+	fmt.Println("  nameport list [--source <source>]      List registered services (optionally by source)")
+	fmt.Println("  nameport list --sort <key>             Sort by traffic: requests, rps, p95 (or name)")
 	fmt.Println("  nameport rename <old> <new>            Rename a service")
 	fmt.Println("  nameport keep <name> [true|false]      Toggle keep status (default: true)")
 	fmt.Println("  nameport blacklist <type> <value>      Add to blacklist")
@@ -166,9 +263,27 @@ func printUsage() {
 	fmt.Println("  nameport blacklist remove <id>         Remove a blacklist entry")
 	fmt.Println("  nameport rules list                    List naming rules")
 	fmt.Println("  nameport rules export                  Export rules as JSON")
-	fmt.Println("  nameport rules import <file>           Import user rules from file")
+	fmt.Println("  nameport rules import <file> [--yes]   Import user rules from file (--yes to replace existing ones)")
+	fmt.Println("  nameport rules reload                  Make the daemon re-read the naming rules")
+	fmt.Println("  nameport rules suggest [--apply]       Show (or apply) renames the current rules suggest")
 	fmt.Println("  nameport remove <name>                 Remove a service entry")
-	fmt.Println("  nameport add <name> [host:]<port>      Add manual service entry")
+	fmt.Println("  nameport prune [--source <source|all>] Remove inactive, non-kept entries (default: discovered)")
+	fmt.Println("  nameport add <name> [https://][host:]<port>  Add manual service entry (--tls for HTTPS, --force if not reachable)")
+	fmt.Println("  nameport throttle <name> <rate|off>    Cap response bandwidth (e.g. 256kbps)")
+	fmt.Println("  nameport timeout <name> <dur|off>      Set upstream response timeout (e.g. 30s)")
+	fmt.Println("  nameport health-path <name> </path|off> Set an extra path tried when probing (e.g. /app)")
+	fmt.Println("  nameport override <name> [host:]<port> [--ttl 30m] Temporarily proxy to another target")
+	fmt.Println("  nameport override clear <name>         Return to the original target")
+	fmt.Println("  nameport flush <name> <dur|immediate|off> Set proxy flush interval (e.g. 100ms)")
+	fmt.Println("  nameport host <name> <host|preserve|off> Set the Host header sent to the backend")
+	fmt.Println("  nameport auth <name> bearer <token|env:VAR> Inject an Authorization header (off to remove)")
+	fmt.Println("  nameport proxy-protocol <name> <v1|v2|off> Send a PROXY protocol header to the backend")
+	fmt.Println("  nameport scheme <name> <https|http|auto> Set the scheme of a service's dashboard link")
+	fmt.Println("  nameport color <name> <#rrggbb|off>    Set the dashboard color of a service")
+	fmt.Println("  nameport icon <name> <emoji|off>       Set the dashboard icon of a service")
+	fmt.Println("  nameport diff                          Compare running daemon state with the store")
+	fmt.Println("  nameport doctor                        Check that discovery, the daemon and TLS are set up")
+	fmt.Println("  nameport info [--json]                 Summarize the daemon, services, TLS, notifications and paths")
 	fmt.Println("  nameport notify status                 Show notification config")
 	fmt.Println("  nameport notify enable                 Enable notifications")
 	fmt.Println("  nameport notify disable                Disable notifications")
@@ -179,15 +294,25 @@ func printUsage() {
 	fmt.Println("  nameport tls status                    Show CA and trust status")
 	fmt.Println("  nameport tls ensure <domain>           Issue/return cert for domain")
 	fmt.Println("  nameport tls list                      List issued certificates")
+	fmt.Println("  nameport tls audit                     Show the certificate issuance log")
 	fmt.Println("  nameport tls rotate                    Rotate intermediate CA")
 	fmt.Println("  nameport tls export <format> <domain>  Export cert config (nginx|caddy|traefik)")
 	fmt.Println("  nameport tls untrust                   Remove CA from OS trust store")
 	fmt.Println()
 	fmt.Println("System Commands:")
+	fmt.Println("  nameport service install [--user]      Run the daemon as a system (or user) service")
+	fmt.Println("  nameport service <status|start|stop|uninstall> [--user]")
 	fmt.Println("  nameport cleanup                       Remove all nameport data and trust entries")
 	fmt.Println()
 	fmt.Println("  nameport --config <path>               Use custom config path")
 	fmt.Println()
+	fmt.Println("Exit codes:")
+	fmt.Println("  0  success")
+	fmt.Println("  1  the operation failed")
+	fmt.Println("  2  invalid usage (unknown command, missing or malformed arguments)")
+	fmt.Println("  3  the named service, entry or file was not found")
+	fmt.Println("  4  the name is already in use")
+	fmt.Println()
 	fmt.Println("Examples:")
 	fmt.Println("  nameport list")
 	fmt.Println("  nameport rename myapp.localhost api.localhost")
@@ -197,43 +322,124 @@ func printUsage() {
 	fmt.Println("  nameport cleanup")
 }
 
-func cmdList(store *storage.Store) {
+// validSources lists the accepted values for --source
+var validSources = []string{storage.SourceDiscovered, storage.SourceManual, storage.SourceCompose, storage.SourceDocker}
+
+// checkSource returns a usage error if source is not a known record source
+func checkSource(source string) error {
+	for _, s := range validSources {
+		if source == s {
+			return nil
+		}
+	}
+	return usageError("Unknown source: %s (expected one of: %s)", source, strings.Join(validSources, ", "))
+}
+
+// listSortKeys lists the accepted values for list --sort
+var listSortKeys = []string{"requests", "rps", "p95", "name"}
+
+// parseListArgs parses the flags of "nameport list". A flag without a value
+// or any other argument is a usage error.
+func parseListArgs(args []string) (source, sortBy string, err error) {
+	usage := usageError("Usage: nameport list [--source <source>] [--sort <%s>]", strings.Join(listSortKeys, "|"))
+	for i := 0; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			return "", "", usage
+		}
+		switch args[i] {
+		case "--source":
+			source = args[i+1]
+		case "--sort":
+			sortBy = args[i+1]
+		default:
+			return "", "", usage
+		}
+	}
+	return source, sortBy, nil
+}
+
+// parsePruneArgs parses the flags of "nameport prune". The source defaults to
+// discovered; a flag without a value or any other argument is a usage error.
+func parsePruneArgs(args []string) (source string, err error) {
+	usage := usageError("Usage: nameport prune [--source <source|all>]")
+	source = storage.SourceDiscovered
+	for i := 0; i < len(args); i += 2 {
+		if args[i] != "--source" || i+1 == len(args) {
+			return "", usage
+		}
+		source = args[i+1]
+	}
+	return source, nil
+}
+
+func cmdList(store *storage.Store, source, sortBy string) error {
+	if sortBy != "" {
+		known := false
+		for _, k := range listSortKeys {
+			known = known || sortBy == k
+		}
+		if !known {
+			return usageError("Unknown sort key: %s (expected one of: %s)", sortBy, strings.Join(listSortKeys, ", "))
+		}
+	}
+
 	records := store.List()
+	if source != "" {
+		if err := checkSource(source); err != nil {
+			return err
+		}
+		records = store.ListBySource(source)
+	}
 
 	if len(records) == 0 {
+		if source != "" {
+			fmt.Printf("No %s services registered.\n", source)
+			return nil
+		}
 		fmt.Println("No services registered.")
 		fmt.Println("Start the daemon and run some local HTTP services.")
-		return
+		return nil
+	}
+
+	if sortBy != "" {
+		cmdListByTraffic(records, sortBy)
+		return nil
 	}
 
-	// Backfill group for records that don't have one
+	// Backfill group for records that don't have one; sub.group.localhost
+	// names are always grouped under their group
 	for _, r := range records {
-		if r.Group == "" {
-			r.Group = naming.ExtractGroup(r.Name)
-		}
+		r.Group = naming.GroupFor(r.Name, r.Group)
 	}
 
-	// Sort by group, then by name
+	// Sort by group, then group root, flat names and subdomains
 	sort.Slice(records, func(i, j int) bool {
 		if records[i].Group != records[j].Group {
 			return records[i].Group < records[j].Group
 		}
-		return records[i].Name < records[j].Name
+		return naming.GroupedLess(records[i].Name, records[j].Name, records[i].Group)
 	})
 
-	// Build group counts
+	// Groups with 2+ members or subdomains are shown nested under a header
 	groupCounts := make(map[string]int)
+	nestedGroups := make(map[string]bool)
 	for _, r := range records {
 		groupCounts[r.Group]++
+		if groupCounts[r.Group] > 1 {
+			nestedGroups[r.Group] = true
+		}
+		if _, _, ok := naming.SplitSubdomain(r.Name); ok {
+			nestedGroups[r.Group] = true
+		}
 	}
 
-	fmt.Printf("%-30s %-22s %-8s %-6s %s\n", "NAME", "TARGET", "PID", "KEEP", "COMMAND")
+	fmt.Printf("%-30s %-22s %-11s %-8s %-6s %s\n", "NAME", "TARGET", "SOURCE", "PID", "KEEP", "COMMAND")
 	fmt.Println(strings.Repeat("-", 110))
 
 	lastGroup := ""
 	for _, r := range records {
 		// Show group header for groups with 2+ members
-		if r.Group != lastGroup && groupCounts[r.Group] > 1 {
+		if r.Group != lastGroup && nestedGroups[r.Group] {
 			fmt.Printf("\n  [%s] (%d services)\n", r.Group, groupCounts[r.Group])
 		}
 		lastGroup = r.Group
@@ -259,51 +465,121 @@ func cmdList(store *storage.Store) {
 			keepStr = "YES"
 		}
 
-		target := fmt.Sprintf("%s:%d", r.EffectiveTargetHost(), r.Port)
+		target := r.TargetAddr()
 
-		// Indent grouped services
+		// Indent grouped services, and subdomains one level deeper
 		nameStr := r.Name
-		if groupCounts[r.Group] > 1 {
+		if nestedGroups[r.Group] {
 			nameStr = "  " + r.Name
+			if _, _, ok := naming.SplitSubdomain(r.Name); ok {
+				nameStr = "    " + r.Name
+			}
 		}
 
-		fmt.Printf("%-30s %-22s %-8d %-6s %s%s\n", nameStr, target, r.PID, keepStr, markers, cmd)
+		fmt.Printf("%-30s %-22s %-11s %-8d %-6s %s%s\n", nameStr, target, r.Source, r.PID, keepStr, markers, cmd)
 	}
 
 	fmt.Println()
 	fmt.Println("* = user-defined name, K = kept, YES = keep enabled")
+	return nil
+}
+
+// cmdListByTraffic prints a flat service list ordered by a traffic metric
+// from the running daemon, or by name when no metrics are available
+func cmdListByTraffic(records []*storage.ServiceRecord, sortBy string) {
+	snapshots := make(map[string]*client.MetricsSnapshot)
+	if sortBy != "name" {
+		var list []*client.MetricsSnapshot
+		c, err := client.Discover()
+		if err == nil {
+			list, err = c.Metrics()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Metrics unavailable (%v); sorting by name\n", err)
+			sortBy = "name"
+		}
+		for _, m := range list {
+			snapshots[m.ServiceName] = m
+		}
+	}
+
+	sortByTraffic(records, snapshots, sortBy)
+
+	fmt.Printf("%-30s %-22s %-10s %-8s %s\n", "NAME", "TARGET", "REQUESTS", "RPS", "P95")
+	fmt.Println(strings.Repeat("-", 84))
+	for _, r := range records {
+		target := r.TargetAddr()
+		m, ok := snapshots[r.Name]
+		if !ok {
+			fmt.Printf("%-30s %-22s %-10s %-8s %s\n", r.Name, target, "-", "-", "-")
+			continue
+		}
+		fmt.Printf("%-30s %-22s %-10d %-8.2f %.0fms\n", r.Name, target, m.TotalRequests, m.RequestsPerSec, m.P95ResponseMs)
+	}
+}
+
+// sortByTraffic orders records busiest (or slowest, for p95) first by the
+// given key, with services that have no metrics last. Ties and the "name"
+// key sort by name.
+func sortByTraffic(records []*storage.ServiceRecord, snapshots map[string]*client.MetricsSnapshot, key string) {
+	value := func(r *storage.ServiceRecord) float64 {
+		m, ok := snapshots[r.Name]
+		if !ok {
+			return -1
+		}
+		switch key {
+		case "requests":
+			return float64(m.TotalRequests)
+		case "rps":
+			return m.RequestsPerSec
+		case "p95":
+			return m.P95ResponseMs
+		}
+		return 0
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		if key != "name" {
+			if vi, vj := value(records[i]), value(records[j]); vi != vj {
+				return vi > vj
+			}
+		}
+		return records[i].Name < records[j].Name
+	})
 }
 
-func cmdRename(store *storage.Store, oldName, newName string) {
+func cmdRename(store *storage.Store, oldName, newName string) error {
 	// Ensure .localhost suffix
 	if !strings.HasSuffix(oldName, ".localhost") {
 		oldName = oldName + ".localhost"
 	}
-	if !strings.HasSuffix(newName, ".localhost") {
-		newName = newName + ".localhost"
+	newName, err := naming.NormalizeName(newName)
+	if err != nil {
+		return usageError("Cannot rename: %v", err)
 	}
 
 	// Find the service
 	record, ok := store.GetByName(oldName)
 	if !ok {
-		log.Fatalf("Service not found: %s", oldName)
+		return notFoundError("Service not found: %s", oldName)
 	}
 
 	// Check if new name is available
 	if _, exists := store.GetByName(newName); exists {
-		log.Fatalf("Name already in use: %s", newName)
+		return conflictError("Name already in use: %s", newName)
 	}
 
 	// Perform rename
 	if err := store.UpdateName(record.ID, newName); err != nil {
-		log.Fatalf("Failed to rename: %v", err)
+		return fmt.Errorf("Failed to rename: %v", err)
 	}
 
 	fmt.Printf("Renamed %s -> %s\n", oldName, newName)
-	fmt.Println("Note: You may need to restart the daemon for changes to take effect.")
+	reloadDaemon()
+	return nil
 }
 
-func cmdKeep(store *storage.Store, name string, keep bool) {
+func cmdKeep(store *storage.Store, name string, keep bool) error {
 	// Ensure .localhost suffix
 	if !strings.HasSuffix(name, ".localhost") {
 		name = name + ".localhost"
@@ -312,12 +588,12 @@ func cmdKeep(store *storage.Store, name string, keep bool) {
 	// Find the service
 	record, ok := store.GetByName(name)
 	if !ok {
-		log.Fatalf("Service not found: %s", name)
+		return notFoundError("Service not found: %s", name)
 	}
 
 	// Update keep status
 	if err := store.UpdateKeep(record.ID, keep); err != nil {
-		log.Fatalf("Failed to update keep status: %v", err)
+		return fmt.Errorf("Failed to update keep status: %v", err)
 	}
 
 	status := "enabled"
@@ -325,26 +601,41 @@ func cmdKeep(store *storage.Store, name string, keep bool) {
 		status = "disabled"
 	}
 	fmt.Printf("Keep %s for %s\n", status, name)
-	fmt.Println("Note: You may need to restart the daemon for changes to take effect.")
+	reloadDaemon()
+	return nil
 }
 
-func cmdBlacklistAdd(blacklistStore *storage.BlacklistStore, blacklistType, value string) {
+func cmdBlacklistAdd(blacklistStore *storage.BlacklistStore, blacklistType, value string) error {
+	// Prefer the running daemon so matching services are dropped right away
+	if c, err := client.Discover(); err == nil {
+		result, err := c.Blacklist(blacklistType, value)
+		if err != nil {
+			return fmt.Errorf("Failed to add blacklist entry: %v", err)
+		}
+		fmt.Printf("Added blacklist entry: [%s] %s = %s\n", result.ID, blacklistType, value)
+		for _, name := range result.Removed {
+			fmt.Printf("Removed active service: %s\n", name)
+		}
+		return nil
+	}
+
 	entry, err := blacklistStore.Add(blacklistType, value)
 	if err != nil {
-		log.Fatalf("Failed to add blacklist entry: %v", err)
+		return fmt.Errorf("Failed to add blacklist entry: %v", err)
 	}
 
 	fmt.Printf("Added blacklist entry: [%s] %s = %s\n", entry.ID, entry.Type, entry.Value)
 	fmt.Println("Note: The daemon will pick up this change on its next scan cycle.")
+	return nil
 }
 
-func cmdBlacklistList(blacklistStore *storage.BlacklistStore) {
+func cmdBlacklistList(blacklistStore *storage.BlacklistStore) error {
 	entries := blacklistStore.List()
 
 	if len(entries) == 0 {
 		fmt.Println("No user-defined blacklist entries.")
 		fmt.Println("(Built-in system blacklist rules are always active.)")
-		return
+		return nil
 	}
 
 	fmt.Printf("%-18s %-10s %-40s %s\n", "ID", "TYPE", "VALUE", "CREATED")
@@ -353,51 +644,865 @@ func cmdBlacklistList(blacklistStore *storage.BlacklistStore) {
 	for _, e := range entries {
 		fmt.Printf("%-18s %-10s %-40s %s\n", e.ID, e.Type, e.Value, e.CreatedAt.Format("2006-01-02 15:04:05"))
 	}
+	return nil
 }
 
-func cmdBlacklistRemove(blacklistStore *storage.BlacklistStore, id string) {
+func cmdBlacklistRemove(blacklistStore *storage.BlacklistStore, id string) error {
+	found := false
+	for _, e := range blacklistStore.List() {
+		found = found || e.ID == id
+	}
+	if !found {
+		return notFoundError("Blacklist entry not found: %s", id)
+	}
+
 	if err := blacklistStore.Remove(id); err != nil {
-		log.Fatalf("Failed to remove blacklist entry: %v", err)
+		return fmt.Errorf("Failed to remove blacklist entry: %v", err)
 	}
 
 	fmt.Printf("Removed blacklist entry: %s\n", id)
+	return nil
+}
+
+// parseAddTarget splits an add target of the form [scheme://][host:]port.
+// IPv6 hosts are bracketed, as in [::1]:8080 or [fe80::1%eth0]:8080, and
+// returned without the brackets. The scheme is "" when not given, so that it
+// is detected by probing.
+func parseAddTarget(target string) (scheme, host string, port int, err error) {
+	if before, after, found := strings.Cut(target, "://"); found {
+		scheme = strings.ToLower(before)
+		if scheme != "http" && scheme != "https" {
+			return "", "", 0, fmt.Errorf("Unsupported scheme %q in %s (want http or https)", before, target)
+		}
+		target = after
+	}
+	portStr := target
+	switch {
+	case strings.HasPrefix(target, "["), strings.Count(target, ":") > 1:
+		// IPv6 literal; without brackets its last group could be a port
+		h, p, splitErr := net.SplitHostPort(target)
+		if splitErr != nil || strings.Count(h, ":") < 1 {
+			return "", "", 0, fmt.Errorf("Invalid target %s: put IPv6 addresses in brackets, e.g. [::1]:8080", target)
+		}
+		host, portStr = h, p
+	case strings.Contains(target, ":"):
+		// host:port format
+		host, portStr, _ = strings.Cut(target, ":")
+	}
+	// port only defaults to 127.0.0.1
+	port, err = strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 {
+		return "", "", 0, fmt.Errorf("Invalid port number in %s", target)
+	}
+	return scheme, host, port, nil
 }
 
-func cmdAdd(store *storage.Store, name string, port int, targetHost string) {
+func cmdAdd(store *storage.Store, name string, port int, targetHost, scheme string, force bool) error {
 	// Ensure .localhost suffix
 	if !strings.HasSuffix(name, ".localhost") {
 		name = name + ".localhost"
 	}
 
+	if _, exists := store.GetByName(name); exists {
+		return conflictError("Name already in use: %s", name)
+	}
+
 	// Add the manual service
-	record, err := store.AddManualService(name, port, targetHost)
+	record, warning, err := addService(store, name, port, targetHost, scheme, force)
 	if err != nil {
-		log.Fatalf("Failed to add service: %v", err)
+		return fmt.Errorf("Failed to add service: %w", err)
+	}
+	if warning != nil {
+		for _, line := range strings.Split(warning.Error(), "\n") {
+			fmt.Printf("Warning: %s\n", line)
+		}
 	}
 
-	fmt.Printf("Added manual service: %s -> %s:%d\n", record.Name, record.EffectiveTargetHost(), record.Port)
+	scheme = "http"
+	if record.UseTLS {
+		scheme = "https"
+	}
+	fmt.Printf("Added manual service: %s -> %s://%s\n", record.Name, scheme, record.TargetAddr())
 	fmt.Println("Note: This service will be kept even when not running.")
-	fmt.Println("      Restart the daemon to activate the proxy.")
+	reloadDaemon()
+	return nil
+}
+
+// addService probes the target before creating a manual record, so a typo in
+// the port doesn't leave a dead entry. A target that doesn't answer HTTP or
+// HTTPS is an error unless force is set, in which case it is returned as a
+// warning. So is a target that another service already points at. An
+// explicit scheme ("http" or "https") sets UseTLS; otherwise the detected
+// protocol does.
+func addService(store *storage.Store, name string, port int, targetHost, scheme string, force bool) (record *storage.ServiceRecord, warning error, err error) {
+	host := targetHost
+	if host == "" {
+		host = "127.0.0.1"
+	}
+
+	var dupErr error
+	if dups := store.FindByTarget(host, port); len(dups) > 0 {
+		names := make([]string, len(dups))
+		for i, d := range dups {
+			names[i] = d.Name
+		}
+		dupErr = fmt.Errorf("%s is already the target of %s", net.JoinHostPort(host, strconv.Itoa(port)), strings.Join(names, ", "))
+		if !force {
+			return nil, nil, conflictError("%v (use --force to add it anyway)", dupErr)
+		}
+	}
+
+	detection, probeErr := probeAddTarget(host, port)
+	if probeErr != nil && !force {
+		return nil, nil, fmt.Errorf("%w (use --force to add it anyway)", probeErr)
+	}
+
+	record, err = store.AddManualService(name, port, targetHost)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	warning = probeErr
+	if probeErr == nil {
+		record.UseTLS = detection.Protocol == probe.ProtoHTTPS
+		record.ProbePath = detection.Path
+		if scheme != "" && scheme != detection.Protocol.String() {
+			warning = fmt.Errorf("%s answered %s, but %s was requested", net.JoinHostPort(host, strconv.Itoa(port)), detection.Protocol, scheme)
+		}
+	}
+	if scheme != "" {
+		record.UseTLS = scheme == "https"
+	}
+	if probeErr == nil || scheme != "" {
+		if err := store.Save(record); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return record, errors.Join(dupErr, warning), nil
+}
+
+// probeAddTarget checks that host:port accepts connections and speaks HTTP
+// or HTTPS
+func probeAddTarget(host string, port int) (probe.Detection, error) {
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	conn, err := net.DialTimeout("tcp", addr, time.Second)
+	if err != nil {
+		return probe.Detection{}, fmt.Errorf("nothing is listening on %s", addr)
+	}
+	conn.Close()
+
+	detection := probe.DetectProtocolPaths(host, port, probe.DefaultCandidatePaths)
+	if detection.Protocol == probe.ProtoNone {
+		return detection, fmt.Errorf("%s does not answer HTTP or HTTPS", addr)
+	}
+	return detection, nil
 }
 
-func cmdRemove(store *storage.Store, name string) {
+func cmdRemove(store *storage.Store, name string) error {
 	if !strings.HasSuffix(name, ".localhost") {
 		name = name + ".localhost"
 	}
 
 	if _, ok := store.GetByName(name); !ok {
-		log.Fatalf("Service not found: %s", name)
+		return notFoundError("Service not found: %s", name)
 	}
 
 	if err := store.RemoveByName(name); err != nil {
-		log.Fatalf("Failed to remove service: %v", err)
+		return fmt.Errorf("Failed to remove service: %v", err)
 	}
 
 	fmt.Printf("Removed %s\n", name)
-	fmt.Println("Note: You may need to restart the daemon for changes to take effect.")
+	reloadDaemon()
+	return nil
+}
+
+func cmdPrune(store *storage.Store, source string) error {
+	records := store.List()
+	if source != "all" {
+		if err := checkSource(source); err != nil {
+			return err
+		}
+		records = store.ListBySource(source)
+	}
+
+	removed := 0
+	for _, r := range records {
+		if r.IsActive || r.Keep {
+			continue
+		}
+		if err := store.Remove(r.ID); err != nil {
+			return fmt.Errorf("Failed to remove %s: %v", r.Name, err)
+		}
+		fmt.Printf("Removed %s (%s)\n", r.Name, r.Source)
+		removed++
+	}
+
+	if removed == 0 {
+		fmt.Println("Nothing to prune.")
+		return nil
+	}
+	fmt.Printf("Pruned %d service(s).\n", removed)
+	reloadDaemon()
+	return nil
+}
+
+func cmdThrottle(store *storage.Store, name, rate string) error {
+	if !strings.HasSuffix(name, ".localhost") {
+		name = name + ".localhost"
+	}
+
+	bytesPerSec, err := throttle.ParseRate(rate)
+	if err != nil {
+		return usageError("Invalid rate: %v", err)
+	}
+
+	record, ok := store.GetByName(name)
+	if !ok {
+		return notFoundError("Service not found: %s", name)
+	}
+
+	record.BandwidthLimit = bytesPerSec
+	if err := store.Save(record); err != nil {
+		return fmt.Errorf("Failed to update bandwidth limit: %v", err)
+	}
+
+	if bytesPerSec == 0 {
+		fmt.Printf("Bandwidth limit removed for %s\n", name)
+	} else {
+		fmt.Printf("Bandwidth for %s limited to %s\n", name, throttle.FormatRate(bytesPerSec))
+	}
+	reloadDaemon()
+	return nil
+}
+
+func cmdTimeout(store *storage.Store, name, value string) error {
+	if !strings.HasSuffix(name, ".localhost") {
+		name = name + ".localhost"
+	}
+
+	var timeout time.Duration
+	if value != "off" && value != "0" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			return usageError("Invalid duration: %s", value)
+		}
+		timeout = d
+	}
+
+	record, ok := store.GetByName(name)
+	if !ok {
+		return notFoundError("Service not found: %s", name)
+	}
+
+	record.UpstreamTimeout = timeout
+	if err := store.Save(record); err != nil {
+		return fmt.Errorf("Failed to update upstream timeout: %v", err)
+	}
+
+	if timeout == 0 {
+		fmt.Printf("Upstream timeout for %s reset to the daemon default\n", name)
+	} else {
+		fmt.Printf("Upstream timeout for %s set to %s\n", name, timeout)
+	}
+	reloadDaemon()
+	return nil
+}
+
+func cmdHealthPath(store *storage.Store, name, value string) error {
+	if !strings.HasSuffix(name, ".localhost") {
+		name = name + ".localhost"
+	}
+
+	path := value
+	if value == "off" {
+		path = ""
+	} else if !strings.HasPrefix(value, "/") || strings.ContainsAny(value, " ?#") {
+		return usageError("Invalid health path: %s (must start with /, e.g. /app)", value)
+	}
+
+	record, ok := store.GetByName(name)
+	if !ok {
+		return notFoundError("Service not found: %s", name)
+	}
+
+	record.HealthPath = path
+	if err := store.Save(record); err != nil {
+		return fmt.Errorf("Failed to update health path: %v", err)
+	}
+
+	if path == "" {
+		fmt.Printf("Health path for %s removed\n", name)
+	} else {
+		fmt.Printf("Health path for %s set to %s\n", name, path)
+	}
+	reloadDaemon()
+	return nil
+}
+
+// defaultOverrideTTL is how long an override lasts without --ttl
+const defaultOverrideTTL = 30 * time.Minute
+
+// setOverride points the named service at target until now+ttl
+func setOverride(store *storage.Store, name, target string, ttl time.Duration, now time.Time) (*storage.ServiceRecord, error) {
+	scheme, host, port, err := parseAddTarget(target)
+	if err != nil {
+		return nil, usageError("%v", err)
+	}
+	if scheme != "" {
+		return nil, usageError("Override targets use the service's scheme; drop %s://", scheme)
+	}
+	if host == "" || host == "localhost" {
+		host = "127.0.0.1"
+	}
+
+	record, ok := store.GetByName(name)
+	if !ok {
+		return nil, notFoundError("Service not found: %s", name)
+	}
+	record.Override = &storage.TargetOverride{Host: host, Port: port, Expires: now.Add(ttl)}
+	if err := store.Save(record); err != nil {
+		return nil, fmt.Errorf("Failed to set override: %v", err)
+	}
+	return record, nil
+}
+
+// clearOverride removes the named service's override, if any
+func clearOverride(store *storage.Store, name string) error {
+	record, ok := store.GetByName(name)
+	if !ok {
+		return notFoundError("Service not found: %s", name)
+	}
+	record.Override = nil
+	if err := store.Save(record); err != nil {
+		return fmt.Errorf("Failed to clear override: %v", err)
+	}
+	return nil
+}
+
+func cmdOverride(store *storage.Store, args []string) error {
+	if args[0] == "clear" {
+		name := args[1]
+		if !strings.HasSuffix(name, ".localhost") {
+			name = name + ".localhost"
+		}
+		if err := clearOverride(store, name); err != nil {
+			return err
+		}
+		fmt.Printf("Override removed for %s\n", name)
+		reloadDaemon()
+		return nil
+	}
+
+	name, target := args[0], args[1]
+	if !strings.HasSuffix(name, ".localhost") {
+		name = name + ".localhost"
+	}
+	ttl := defaultOverrideTTL
+	for i := 2; i < len(args); i++ {
+		if args[i] != "--ttl" || i+1 >= len(args) {
+			return usageError("Usage: nameport override <name> [host:]<port> [--ttl 30m]")
+		}
+		d, err := time.ParseDuration(args[i+1])
+		if err != nil || d <= 0 {
+			return usageError("Invalid TTL: %s", args[i+1])
+		}
+		ttl = d
+		i++
+	}
+
+	record, err := setOverride(store, name, target, ttl, time.Now())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s now proxies to %s until %s (was %s)\n", name,
+		net.JoinHostPort(record.Override.Host, strconv.Itoa(record.Override.Port)),
+		record.Override.Expires.Format("15:04:05"), record.TargetAddr())
+	reloadDaemon()
+	return nil
 }
 
-func cmdRules(args []string) {
+// reloadDaemon asks a running daemon to pick up store changes, saying so
+// when there is none to ask
+func reloadDaemon() {
+	c, err := client.Discover()
+	if err != nil {
+		fmt.Println("Note: The daemon is not running; the change applies when it starts.")
+		return
+	}
+	if _, err := c.Reload(); err != nil {
+		fmt.Printf("Warning: Failed to reload the daemon: %v\n", err)
+	}
+}
+
+func cmdAuth(store *storage.Store, name string, args []string) error {
+	if !strings.HasSuffix(name, ".localhost") {
+		name = name + ".localhost"
+	}
+
+	record, ok := store.GetByName(name)
+	if !ok {
+		return notFoundError("Service not found: %s", name)
+	}
+
+	switch args[0] {
+	case "off":
+		record.AuthToken = ""
+		record.AuthTokenEnv = ""
+	case "bearer":
+		value := args[1]
+		if env, ok := strings.CutPrefix(value, "env:"); ok {
+			if env == "" {
+				return usageError("Missing environment variable name in %s", value)
+			}
+			record.AuthToken = ""
+			record.AuthTokenEnv = env
+		} else {
+			record.AuthToken = value
+			record.AuthTokenEnv = ""
+		}
+	default:
+		return usageError("Unknown auth type: %s (supported: bearer, off)", args[0])
+	}
+
+	if err := store.Save(record); err != nil {
+		return fmt.Errorf("Failed to update auth: %v", err)
+	}
+
+	switch {
+	case record.AuthTokenEnv != "":
+		fmt.Printf("Requests to %s get a bearer token from $%s (read by the daemon)\n", name, record.AuthTokenEnv)
+	case record.AuthToken != "":
+		fmt.Printf("Requests to %s get a bearer token\n", name)
+		fmt.Println("Warning: the token is stored in plaintext in the service store.")
+		fmt.Println("         Use env:VAR to keep it out of the file.")
+	default:
+		fmt.Printf("Auth injection removed for %s\n", name)
+	}
+	reloadDaemon()
+	return nil
+}
+
+func cmdColor(store *storage.Store, name, value string) error {
+	if !strings.HasSuffix(name, ".localhost") {
+		name = name + ".localhost"
+	}
+
+	if value == "off" {
+		value = ""
+	} else if err := storage.ValidateColor(value); err != nil {
+		return usageError("%v", err)
+	}
+
+	record, ok := store.GetByName(name)
+	if !ok {
+		return notFoundError("Service not found: %s", name)
+	}
+
+	record.Color = value
+	if err := store.Save(record); err != nil {
+		return fmt.Errorf("Failed to update color: %v", err)
+	}
+
+	if value == "" {
+		fmt.Printf("Color removed for %s\n", name)
+	} else {
+		fmt.Printf("Color for %s set to %s\n", name, value)
+	}
+	reloadDaemon()
+	return nil
+}
+
+func cmdIcon(store *storage.Store, name, value string) error {
+	if !strings.HasSuffix(name, ".localhost") {
+		name = name + ".localhost"
+	}
+
+	if value == "off" {
+		value = ""
+	} else if err := storage.ValidateIcon(value); err != nil {
+		return usageError("%v", err)
+	}
+
+	record, ok := store.GetByName(name)
+	if !ok {
+		return notFoundError("Service not found: %s", name)
+	}
+
+	record.Icon = value
+	if err := store.Save(record); err != nil {
+		return fmt.Errorf("Failed to update icon: %v", err)
+	}
+
+	if value == "" {
+		fmt.Printf("Icon removed for %s\n", name)
+	} else {
+		fmt.Printf("Icon for %s set to %s\n", name, value)
+	}
+	reloadDaemon()
+	return nil
+}
+
+func cmdHost(store *storage.Store, name, value string) error {
+	if !strings.HasSuffix(name, ".localhost") {
+		name = name + ".localhost"
+	}
+
+	record, ok := store.GetByName(name)
+	if !ok {
+		return notFoundError("Service not found: %s", name)
+	}
+
+	switch value {
+	case "off":
+		record.HostHeader = ""
+		record.PreserveHost = false
+	case "preserve":
+		record.HostHeader = ""
+		record.PreserveHost = true
+	default:
+		if strings.ContainsAny(value, " /\t") {
+			return usageError("Invalid host: %s", value)
+		}
+		record.HostHeader = value
+		record.PreserveHost = false
+	}
+
+	if err := store.Save(record); err != nil {
+		return fmt.Errorf("Failed to update host header: %v", err)
+	}
+
+	switch {
+	case record.HostHeader != "":
+		fmt.Printf("Requests to %s are sent with Host: %s\n", name, record.HostHeader)
+	case record.PreserveHost:
+		fmt.Printf("Requests to %s keep their original Host header\n", name)
+	default:
+		fmt.Printf("Requests to %s are sent with the backend address as Host\n", name)
+	}
+	reloadDaemon()
+	return nil
+}
+
+func cmdProxyProtocol(store *storage.Store, name, version string) error {
+	if !strings.HasSuffix(name, ".localhost") {
+		name = name + ".localhost"
+	}
+
+	record, ok := store.GetByName(name)
+	if !ok {
+		return notFoundError("Service not found: %s", name)
+	}
+
+	switch {
+	case version == "off":
+		record.ProxyProtocol = ""
+	case proxyproto.Valid(version):
+		record.ProxyProtocol = version
+	default:
+		return usageError("Invalid PROXY protocol version: %s (expected v1, v2 or off)", version)
+	}
+
+	if err := store.Save(record); err != nil {
+		return fmt.Errorf("Failed to update PROXY protocol: %v", err)
+	}
+
+	if record.ProxyProtocol == "" {
+		fmt.Printf("Connections to %s no longer start with a PROXY header\n", name)
+	} else {
+		fmt.Printf("Connections to %s start with a PROXY protocol %s header\n", name, record.ProxyProtocol)
+	}
+	reloadDaemon()
+	return nil
+}
+
+func cmdScheme(store *storage.Store, name, scheme string) error {
+	if !strings.HasSuffix(name, ".localhost") {
+		name = name + ".localhost"
+	}
+
+	record, ok := store.GetByName(name)
+	if !ok {
+		return notFoundError("Service not found: %s", name)
+	}
+
+	switch scheme {
+	case "auto", "off":
+		record.PreferredScheme = ""
+	case storage.SchemeHTTPS, storage.SchemeHTTP:
+		record.PreferredScheme = scheme
+	default:
+		return usageError("Invalid scheme: %s (expected https, http or auto)", scheme)
+	}
+
+	if err := store.Save(record); err != nil {
+		return fmt.Errorf("Failed to update preferred scheme: %v", err)
+	}
+
+	switch record.PreferredScheme {
+	case storage.SchemeHTTPS:
+		fmt.Printf("Dashboard links for %s always use HTTPS\n", name)
+	case storage.SchemeHTTP:
+		fmt.Printf("Dashboard links for %s prefer HTTP\n", name)
+	default:
+		fmt.Printf("Dashboard links for %s follow the daemon's TLS setting\n", name)
+	}
+	reloadDaemon()
+	return nil
+}
+
+func cmdFlush(store *storage.Store, name, value string) error {
+	if !strings.HasSuffix(name, ".localhost") {
+		name = name + ".localhost"
+	}
+
+	var interval time.Duration
+	switch value {
+	case "off", "0":
+	case "immediate", "-1":
+		interval = -1
+	default:
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return usageError("Invalid flush interval: %s", value)
+		}
+		interval = d
+	}
+
+	record, ok := store.GetByName(name)
+	if !ok {
+		return notFoundError("Service not found: %s", name)
+	}
+
+	record.FlushInterval = interval
+	if err := store.Save(record); err != nil {
+		return fmt.Errorf("Failed to update flush interval: %v", err)
+	}
+
+	switch {
+	case interval == 0:
+		fmt.Printf("Response buffering for %s reset to the default\n", name)
+	case interval < 0:
+		fmt.Printf("Responses for %s are flushed immediately\n", name)
+	default:
+		fmt.Printf("Responses for %s are flushed every %s\n", name, interval)
+	}
+	reloadDaemon()
+	return nil
+}
+
+// cmdService installs and controls the daemon as an OS service
+// parseServiceArgs parses the flags of "nameport service <action>". A
+// --daemon without a path or any other argument is a usage error.
+func parseServiceArgs(args []string) (user bool, daemonPath string, err error) {
+	usage := usageError("Usage: nameport service <install|uninstall|status|start|stop> [--user] [--daemon <path>]")
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--user":
+			user = true
+		case "--daemon":
+			if i+1 == len(args) {
+				return false, "", usage
+			}
+			i++
+			daemonPath = args[i]
+		default:
+			return false, "", usage
+		}
+	}
+	return user, daemonPath, nil
+}
+
+func cmdService(action string, args []string) error {
+	user, daemonPath, err := parseServiceArgs(args)
+	if err != nil {
+		return err
+	}
+
+	mgr := system.NewServiceManager()
+	if user {
+		if mgr, err = system.NewUserServiceManager(); err != nil {
+			return err
+		}
+	}
+
+	switch action {
+	case "install":
+		if daemonPath == "" {
+			// The daemon is expected next to this binary
+			exe, err := os.Executable()
+			if err != nil {
+				return fmt.Errorf("Cannot locate nameport-daemon (use --daemon <path>): %v", err)
+			}
+			daemonPath = filepath.Join(filepath.Dir(exe), "nameport-daemon")
+		}
+		if _, err := os.Stat(daemonPath); err != nil {
+			return notFoundError("Daemon binary not found: %v (use --daemon <path>)", err)
+		}
+		if err := mgr.Install(daemonPath); err != nil {
+			return fmt.Errorf("Failed to install service: %v", err)
+		}
+		fmt.Println("Service installed. Start it with 'nameport service start" + userFlag(user) + "'.")
+		if user {
+			fmt.Println("The daemon runs in high-port mode: http://localhost:8080/")
+		}
+	case "uninstall":
+		if err := mgr.Uninstall(); err != nil {
+			return fmt.Errorf("Failed to uninstall service: %v", err)
+		}
+		fmt.Println("Service uninstalled.")
+	case "start":
+		if err := mgr.Start(); err != nil {
+			return fmt.Errorf("Failed to start service: %v", err)
+		}
+		fmt.Println("Service started.")
+	case "stop":
+		if err := mgr.Stop(); err != nil {
+			return fmt.Errorf("Failed to stop service: %v", err)
+		}
+		fmt.Println("Service stopped.")
+	case "status":
+		status, err := mgr.Status()
+		if err != nil {
+			return fmt.Errorf("Failed to get service status: %v", err)
+		}
+		fmt.Printf("Installed: %v\n", status.Installed)
+		fmt.Printf("Running:   %v\n", status.Running)
+		if status.PID > 0 {
+			fmt.Printf("PID:       %d\n", status.PID)
+		}
+	default:
+		return usageError("Unknown service command: %s", action)
+	}
+	return nil
+}
+
+// userFlag returns " --user" when user is set, for echoing commands back
+func userFlag(user bool) string {
+	if user {
+		return " --user"
+	}
+	return ""
+}
+
+// cmdDoctor checks the pieces nameport depends on and explains how to fix
+// any that are missing. It exits non-zero when a required check fails.
+func cmdDoctor(store *storage.Store, storePath string) error {
+	failed := false
+
+	if err := portscan.Check(); err != nil {
+		failed = true
+		fmt.Println("Port scanner:    FAIL")
+		fmt.Printf("  %v\n", err)
+	} else {
+		fmt.Println("Port scanner:    OK")
+	}
+
+	fmt.Printf("Store:           OK (%s, %d records)\n", storePath, len(store.List()))
+
+	if c, err := client.Discover(); err != nil {
+		failed = true
+		fmt.Println("Daemon:          NOT RUNNING")
+		fmt.Println("  Start it with 'sudo nameport-daemon' (or 'nameport-daemon --dev' for port 8080).")
+	} else if records, err := c.ListServices(); err != nil {
+		failed = true
+		fmt.Printf("Daemon:          FAIL (%s: %v)\n", c.BaseURL, err)
+	} else {
+		fmt.Printf("Daemon:          OK (%s, %d services)\n", c.BaseURL, len(records))
+	}
+
+	if tlsCA, err := ca.NewCA(caStorePath()); err != nil {
+		fmt.Printf("TLS CA:          FAIL (%v)\n", err)
+		failed = true
+	} else if !tlsCA.IsInitialized() {
+		fmt.Println("TLS CA:          NOT INITIALIZED (optional)")
+		fmt.Println("  Run 'nameport tls init' to enable HTTPS.")
+	} else {
+		fmt.Println("TLS CA:          OK")
+	}
+
+	if failed {
+		return errFailed
+	}
+	return nil
+}
+
+func cmdDiff(store *storage.Store, storePath string) error {
+	c, err := client.Discover()
+	if err != nil {
+		return fmt.Errorf("Failed to query daemon: %v\nIs the daemon running? Set NAMEPORT_DAEMON_URL if it uses a custom port.", err)
+	}
+	running, err := c.ListServices()
+	if err != nil {
+		return fmt.Errorf("Failed to query daemon: %v\nIs the daemon running? Set NAMEPORT_DAEMON_URL if it uses a custom port.", err)
+	}
+
+	diffs := storage.DiffRecords(daemonRecords(running), store.List())
+	if len(diffs) == 0 {
+		fmt.Printf("Daemon state matches %s\n", storePath)
+		return nil
+	}
+
+	fmt.Printf("%-14s %-30s %s\n", "DIFF", "NAME", "DETAILS")
+	fmt.Println(strings.Repeat("-", 80))
+
+	for _, d := range diffs {
+		switch d.Kind {
+		case storage.DiffOnlyRunning:
+			fmt.Printf("%-14s %-30s %s\n", "daemon only", d.Name, "not in store on disk")
+		case storage.DiffOnlyStored:
+			fmt.Printf("%-14s %-30s %s\n", "disk only", d.Name, "not loaded by daemon")
+		case storage.DiffChanged:
+			details := make([]string, 0, len(d.Fields))
+			for _, f := range d.Fields {
+				switch f {
+				case "name":
+					details = append(details, fmt.Sprintf("name %s -> %s", d.Running.Name, d.Stored.Name))
+				case "port":
+					details = append(details, fmt.Sprintf("port %d -> %d", d.Running.Port, d.Stored.Port))
+				case "keep":
+					details = append(details, fmt.Sprintf("keep %v -> %v", d.Running.Keep, d.Stored.Keep))
+				}
+			}
+			fmt.Printf("%-14s %-30s %s\n", "changed", d.Name, strings.Join(details, ", "))
+		}
+	}
+
+	fmt.Println()
+	fmt.Printf("%d difference(s) between the daemon and %s (daemon -> disk).\n", len(diffs), storePath)
+	fmt.Println("The daemon re-reads the store on POST /api/reload, which every nameport command that changes a service sends.")
+	return nil
+}
+
+// daemonRecords turns the services reported by the daemon into records that
+// can be compared with the store
+func daemonRecords(services []*client.Service) []*storage.ServiceRecord {
+	records := make([]*storage.ServiceRecord, 0, len(services))
+	for _, svc := range services {
+		records = append(records, &storage.ServiceRecord{
+			ID:          svc.ID,
+			Name:        svc.Name,
+			Port:        svc.Port,
+			TargetHost:  svc.TargetHost,
+			PID:         svc.PID,
+			ExePath:     svc.ExePath,
+			Args:        svc.Args,
+			UserDefined: svc.UserDefined,
+			IsActive:    svc.IsActive,
+			LastSeen:    svc.LastSeen,
+			Keep:        svc.Keep,
+			Group:       svc.Group,
+			UseTLS:      svc.UseTLS,
+			Source:      svc.Source,
+			HealthPath:  svc.HealthPath,
+			Color:       svc.Color,
+			Icon:        svc.Icon,
+		})
+	}
+	return records
+}
+
+func cmdRules(args []string) error {
 	subCmd := args[0]
 	engine := naming.NewRuleEngine()
 
@@ -414,55 +1519,147 @@ func cmdRules(args []string) {
 	case "export":
 		data, err := engine.ExportRulesJSON()
 		if err != nil {
-			log.Fatalf("Failed to export rules: %v", err)
+			return fmt.Errorf("Failed to export rules: %v", err)
 		}
 		fmt.Println(string(data))
 
 	case "import":
 		if len(args) < 2 {
-			fmt.Fprintf(os.Stderr, "Usage: nameport rules import <file>\n")
-			os.Exit(1)
+			return usageError("Usage: nameport rules import <file> [--yes]")
 		}
 		srcFile := args[1]
+		yes := false
+		for _, arg := range args[2:] {
+			if arg != "--yes" && arg != "-y" {
+				return usageError("Usage: nameport rules import <file> [--yes]")
+			}
+			yes = true
+		}
 
 		// Validate the source file is valid JSON rules
-		_, err := naming.LoadUserRules(srcFile)
+		userRules, err := naming.LoadUserRules(srcFile)
+		if os.IsNotExist(err) {
+			return notFoundError("Rules file not found: %s", srcFile)
+		}
 		if err != nil {
-			log.Fatalf("Invalid rules file: %v", err)
+			return usageError("Invalid rules file: %v", err)
 		}
 
+		printImportSummary(naming.SummarizeUserRules(naming.LoadBuiltinRules(), userRules))
+
 		// Read source
 		data, err := os.ReadFile(srcFile)
 		if err != nil {
-			log.Fatalf("Failed to read file: %v", err)
+			return fmt.Errorf("Failed to read file: %v", err)
 		}
 
-		// Ensure destination directory exists
+		// Never replace existing user rules by accident
 		destPath := naming.UserRulesPath()
+		if _, err := os.Stat(destPath); err == nil && !yes {
+			return conflictError("User rules already exist at %s; rerun with --yes to replace them", destPath)
+		}
+
+		// Ensure destination directory exists
 		if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
-			log.Fatalf("Failed to create config directory: %v", err)
+			return fmt.Errorf("Failed to create config directory: %v", err)
 		}
 
 		// Write to user config
 		if err := os.WriteFile(destPath, data, 0644); err != nil {
-			log.Fatalf("Failed to write user rules: %v", err)
+			return fmt.Errorf("Failed to write user rules: %v", err)
 		}
 
 		fmt.Printf("Imported rules to %s\n", destPath)
-		fmt.Println("Note: Rules will take effect on next daemon restart.")
+		if c, err := client.Discover(); err != nil {
+			fmt.Println("Note: The daemon is not running; the rules apply when it starts.")
+		} else if _, err := c.ReloadRules(); err != nil {
+			fmt.Printf("Warning: Failed to reload the daemon's rules: %v\n", err)
+		} else {
+			fmt.Println("The daemon now names new services with these rules; see 'nameport rules suggest' for existing ones.")
+		}
+
+	case "reload":
+		c, err := client.Discover()
+		if err != nil {
+			return fmt.Errorf("Failed to reach the daemon: %v", err)
+		}
+		count, err := c.ReloadRules()
+		if err != nil {
+			return fmt.Errorf("Failed to reload rules: %v", err)
+		}
+		fmt.Printf("Daemon reloaded %d naming rules\n", count)
+
+	case "suggest":
+		apply := false
+		for _, arg := range args[1:] {
+			if arg != "--apply" {
+				return usageError("Usage: nameport rules suggest [--apply]")
+			}
+			apply = true
+		}
+		return cmdRulesSuggest(apply)
 
 	default:
-		fmt.Fprintf(os.Stderr, "Unknown rules command: %s\n", subCmd)
-		fmt.Fprintf(os.Stderr, "Usage: nameport rules <list|export|import> [file]\n")
-		os.Exit(1)
+		return usageError("Unknown rules command: %s\nUsage: nameport rules <list|export|import|reload|suggest> [file]", subCmd)
 	}
+	return nil
 }
 
-func cmdNotify(args []string) {
+// cmdRulesSuggest lists the services the daemon's naming rules would rename,
+// and with apply renames them
+func cmdRulesSuggest(apply bool) error {
+	c, err := client.Discover()
+	if err != nil {
+		return fmt.Errorf("Failed to reach the daemon: %v", err)
+	}
+
+	var suggestions []client.NameSuggestion
+	if apply {
+		suggestions, err = c.ApplyNameSuggestions()
+	} else {
+		suggestions, err = c.NameSuggestions()
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to get name suggestions: %v", err)
+	}
+
+	if len(suggestions) == 0 {
+		fmt.Println("All discovered services already have the names the rules give them.")
+		return nil
+	}
+	for _, sg := range suggestions {
+		fmt.Printf("  %-30s -> %s\n", sg.Name, sg.Suggested)
+	}
+	if apply {
+		fmt.Printf("Renamed %d services\n", len(suggestions))
+	} else {
+		fmt.Println("Run 'nameport rules suggest --apply' to rename them (services you renamed yourself are left alone).")
+	}
+	return nil
+}
+
+// printImportSummary reports what imported rules change relative to the
+// builtin rules
+func printImportSummary(summary naming.ImportSummary) {
+	fmt.Printf("%d rules to import: %d new, %d override builtins\n", summary.Total, len(summary.New), len(summary.Overrides))
+	if len(summary.Overrides) > 0 {
+		fmt.Printf("  Overridden builtins: %s\n", strings.Join(summary.Overrides, ", "))
+	}
+	if len(summary.New) > 0 {
+		fmt.Printf("  New rules:           %s\n", strings.Join(summary.New, ", "))
+	}
+	if len(summary.Shadowed) > 0 {
+		fmt.Printf("  Shadowed builtins:   %s (an earlier imported rule matches everything they do)\n", strings.Join(summary.Shadowed, ", "))
+	} else {
+		fmt.Println("  No builtin rules are shadowed")
+	}
+}
+
+func cmdNotify(args []string) error {
 	configPath := notify.DefaultConfigPath()
 	cfg, err := notify.LoadConfig(configPath)
 	if err != nil {
-		log.Fatalf("Failed to load notification config: %v", err)
+		return fmt.Errorf("Failed to load notification config: %v", err)
 	}
 
 	subCmd := args[0]
@@ -488,7 +1685,7 @@ func cmdNotify(args []string) {
 	case "enable":
 		cfg.Enabled = true
 		if err := notify.SaveConfig(configPath, cfg); err != nil {
-			log.Fatalf("Failed to save config: %v", err)
+			return fmt.Errorf("Failed to save config: %v", err)
 		}
 		fmt.Println("Notifications enabled.")
 		fmt.Println("Note: Restart the daemon for changes to take effect.")
@@ -496,19 +1693,18 @@ func cmdNotify(args []string) {
 	case "disable":
 		cfg.Enabled = false
 		if err := notify.SaveConfig(configPath, cfg); err != nil {
-			log.Fatalf("Failed to save config: %v", err)
+			return fmt.Errorf("Failed to save config: %v", err)
 		}
 		fmt.Println("Notifications disabled.")
 		fmt.Println("Note: Restart the daemon for changes to take effect.")
 
 	case "events":
 		if len(args) < 3 {
-			fmt.Fprintf(os.Stderr, "Usage: nameport notify events <type> on|off\n")
-			fmt.Fprintf(os.Stderr, "\nEvent types:\n")
+			usage := "Usage: nameport notify events <type> on|off\n\nEvent types:"
 			for _, e := range notify.AllEvents() {
-				fmt.Fprintf(os.Stderr, "  %s\n", e)
+				usage += fmt.Sprintf("\n  %s", e)
 			}
-			os.Exit(1)
+			return usageError("%s", usage)
 		}
 		eventType := notify.EventType(args[1])
 		toggle := args[2]
@@ -522,7 +1718,7 @@ func cmdNotify(args []string) {
 			}
 		}
 		if !valid {
-			log.Fatalf("Unknown event type: %s", eventType)
+			return usageError("Unknown event type: %s", eventType)
 		}
 
 		switch toggle {
@@ -531,20 +1727,19 @@ func cmdNotify(args []string) {
 		case "off":
 			cfg.EventFilter[eventType] = false
 		default:
-			log.Fatalf("Expected 'on' or 'off', got: %s", toggle)
+			return usageError("Expected 'on' or 'off', got: %s", toggle)
 		}
 
 		if err := notify.SaveConfig(configPath, cfg); err != nil {
-			log.Fatalf("Failed to save config: %v", err)
+			return fmt.Errorf("Failed to save config: %v", err)
 		}
 		fmt.Printf("Event %s set to %s.\n", eventType, toggle)
 		fmt.Println("Note: Restart the daemon for changes to take effect.")
 
 	default:
-		fmt.Fprintf(os.Stderr, "Unknown notify command: %s\n", subCmd)
-		fmt.Fprintf(os.Stderr, "Usage: nameport notify <status|enable|disable|events>\n")
-		os.Exit(1)
+		return usageError("Unknown notify command: %s\nUsage: nameport notify <status|enable|disable|events>", subCmd)
 	}
+	return nil
 }
 
 // caStorePath returns the expanded CA store directory.
@@ -556,50 +1751,85 @@ func caStorePath() string {
 	return filepath.Join(home, ".localtls")
 }
 
-func cmdTLS(args []string) {
+func cmdTLS(args []string) error {
 	subCmd := args[0]
 
 	switch subCmd {
 	case "init":
-		cmdTLSInit()
+		return cmdTLSInit()
 	case "status":
-		cmdTLSStatus()
+		return cmdTLSStatus()
 	case "ensure":
 		if len(args) < 2 {
-			fmt.Fprintf(os.Stderr, "Usage: nameport tls ensure <domain>\n")
-			os.Exit(1)
+			return usageError("Usage: nameport tls ensure <domain>")
 		}
-		cmdTLSEnsure(args[1])
+		return cmdTLSEnsure(args[1])
 	case "list":
-		cmdTLSList()
+		return cmdTLSList()
+	case "audit":
+		return cmdTLSAudit()
 	case "rotate":
-		cmdTLSRotate()
+		return cmdTLSRotate()
 	case "export":
 		if len(args) < 3 {
-			fmt.Fprintf(os.Stderr, "Usage: nameport tls export <nginx|caddy|traefik> <domain>\n")
-			os.Exit(1)
+			return usageError("Usage: nameport tls export <nginx|caddy|traefik> <domain>")
 		}
-		cmdTLSExport(args[1], args[2])
+		return cmdTLSExport(args[1], args[2])
 	case "untrust":
-		cmdTLSUntrust()
+		return cmdTLSUntrust()
 	default:
-		fmt.Fprintf(os.Stderr, "Unknown tls command: %s\n", subCmd)
-		fmt.Fprintf(os.Stderr, "Usage: nameport tls <init|status|ensure|list|rotate|export|untrust>\n")
-		os.Exit(1)
+		return usageError("Unknown tls command: %s\nUsage: nameport tls <init|status|ensure|list|audit|rotate|export|untrust>", subCmd)
 	}
 }
 
-func cmdTLSInit() {
+func cmdTLSAudit() error {
+	auditPath := filepath.Join(caStorePath(), issuer.AuditFileName)
+	entries, err := issuer.ReadAudit(auditPath)
+	if err != nil {
+		return fmt.Errorf("Failed to read audit log: %v", err)
+	}
+	if len(entries) == 0 {
+		fmt.Printf("No certificates recorded in %s.\n", auditPath)
+		return nil
+	}
+	writeAudit(os.Stdout, entries)
+	return nil
+}
+
+// writeAudit prints audit entries as a table, oldest first
+func writeAudit(w io.Writer, entries []issuer.AuditEntry) {
+	fmt.Fprintf(w, "%-20s %-34s %-10s %s\n", "ISSUED", "SERIAL", "LIFETIME", "NAMES")
+	fmt.Fprintln(w, strings.Repeat("-", 100))
+	for _, e := range entries {
+		names := strings.Join(append(append([]string{}, e.DNSNames...), e.IPs...), ", ")
+		serial := e.Serial
+		if len(serial) > 32 {
+			serial = serial[:29] + "..."
+		}
+		fmt.Fprintf(w, "%-20s %-34s %-10s %s\n", e.Time.Local().Format("2006-01-02 15:04:05"), serial, e.Lifetime, names)
+	}
+}
+
+// caError describes a CA store failure, including a remediation hint when
+// the store is not readable or writable.
+func caError(msg string, err error) error {
+	if hint := ca.Remediation(err); hint != "" {
+		return fmt.Errorf("%s: %v\n  Hint: %s", msg, err, hint)
+	}
+	return fmt.Errorf("%s: %v", msg, err)
+}
+
+func cmdTLSInit() error {
 	storePath := caStorePath()
 	tlsCA, err := ca.NewCA(storePath)
 	if err != nil {
-		log.Fatalf("Failed to access CA store: %v", err)
+		return caError("Failed to access CA store", err)
 	}
 
 	if !tlsCA.IsInitialized() {
 		fmt.Println("Bootstrapping new certificate authority...")
 		if err := tlsCA.Init(); err != nil {
-			log.Fatalf("Failed to initialize CA: %v", err)
+			return caError("Failed to initialize CA", err)
 		}
 		fmt.Printf("CA created at %s\n", storePath)
 	} else {
@@ -610,7 +1840,7 @@ func cmdTLSInit() {
 	trustor := trust.NewPlatformTrustor()
 	if trustor.IsInstalled(tlsCA.RootCertPEM()) {
 		fmt.Println("Root CA is already trusted by the OS.")
-		return
+		return nil
 	}
 
 	if trustor.NeedsElevation() {
@@ -620,18 +1850,19 @@ func cmdTLSInit() {
 	}
 
 	if err := trustor.Install(tlsCA.RootCertPEM()); err != nil {
-		log.Fatalf("Failed to install CA: %v\nYou may need to run this command with sudo.", err)
+		return fmt.Errorf("Failed to install CA: %v\nYou may need to run this command with sudo.", err)
 	}
 
 	fmt.Println("Root CA installed and trusted.")
 	fmt.Println("HTTPS is now available for all .localhost domains.")
+	return nil
 }
 
-func cmdTLSStatus() {
+func cmdTLSStatus() error {
 	storePath := caStorePath()
 	tlsCA, err := ca.NewCA(storePath)
 	if err != nil {
-		log.Fatalf("Failed to access CA store: %v", err)
+		return caError("Failed to access CA store", err)
 	}
 
 	fmt.Printf("CA Store: %s\n", storePath)
@@ -639,7 +1870,7 @@ func cmdTLSStatus() {
 	if !tlsCA.IsInitialized() {
 		fmt.Println("Status: NOT INITIALIZED")
 		fmt.Println("  Run 'nameport tls init' to bootstrap the CA.")
-		return
+		return nil
 	}
 
 	fmt.Println("Status: INITIALIZED")
@@ -674,9 +1905,10 @@ func cmdTLSStatus() {
 		}
 		fmt.Printf("  Issued certs:    %d\n", certCount)
 	}
+	return nil
 }
 
-func cmdTLSEnsure(domain string) {
+func cmdTLSEnsure(domain string) error {
 	// Ensure .localhost suffix for bare names
 	if !strings.Contains(domain, ".") {
 		domain = domain + ".localhost"
@@ -685,15 +1917,16 @@ func cmdTLSEnsure(domain string) {
 	storePath := caStorePath()
 	tlsCA, err := ca.NewCA(storePath)
 	if err != nil {
-		log.Fatalf("Failed to access CA store: %v", err)
+		return caError("Failed to access CA store", err)
 	}
 
 	if !tlsCA.IsInitialized() {
-		log.Fatalf("CA not initialized. Run 'nameport tls init' first.")
+		return errors.New("CA not initialized. Run 'nameport tls init' first.")
 	}
 
 	pol := policy.NewPolicy()
 	iss := issuer.NewIssuer(tlsCA, pol)
+	iss.SetAuditLog(issuer.NewAuditLog(filepath.Join(storePath, issuer.AuditFileName)))
 
 	// Build DNS names: for wildcards, also include the base domain
 	dnsNames := []string{domain}
@@ -706,34 +1939,31 @@ func cmdTLSEnsure(domain string) {
 		DNSNames: dnsNames,
 	})
 	if err != nil {
-		log.Fatalf("Failed to issue certificate: %v", err)
+		return fmt.Errorf("Failed to issue certificate: %v", err)
 	}
 
-	// Save cert and key to disk
-	certsDir := filepath.Join(storePath, "certs")
+	// Save cert and key to disk, where the daemon also finds them
+	certsDir := filepath.Join(storePath, issuer.CertsDirName)
 	if err := os.MkdirAll(certsDir, 0700); err != nil {
-		log.Fatalf("Failed to create certs directory: %v", err)
+		return fmt.Errorf("Failed to create certs directory: %v", err)
 	}
 
-	// Use sanitized filename
-	safeName := strings.ReplaceAll(strings.ReplaceAll(domain, "*", "_wildcard"), "/", "_")
-	certPath := filepath.Join(certsDir, safeName+".pem")
-	keyPath := filepath.Join(certsDir, safeName+".key")
-
+	certPath, keyPath := issuer.CertFiles(certsDir, domain)
 	if err := os.WriteFile(certPath, cached.CertPEM, 0644); err != nil {
-		log.Fatalf("Failed to write certificate: %v", err)
+		return fmt.Errorf("Failed to write certificate: %v", err)
 	}
 	if err := os.WriteFile(keyPath, cached.KeyPEM, 0600); err != nil {
-		log.Fatalf("Failed to write key: %v", err)
+		return fmt.Errorf("Failed to write key: %v", err)
 	}
 
 	fmt.Printf("Certificate issued for: %s\n", strings.Join(dnsNames, ", "))
 	fmt.Printf("  Cert: %s\n", certPath)
 	fmt.Printf("  Key:  %s\n", keyPath)
 	fmt.Printf("  Expires: %s\n", cached.Expiry.Format("2006-01-02 15:04:05"))
+	return nil
 }
 
-func cmdTLSList() {
+func cmdTLSList() error {
 	storePath := caStorePath()
 	certsDir := filepath.Join(storePath, "certs")
 
@@ -741,9 +1971,9 @@ func cmdTLSList() {
 	if err != nil {
 		if os.IsNotExist(err) {
 			fmt.Println("No certificates issued yet.")
-			return
+			return nil
 		}
-		log.Fatalf("Failed to read certs directory: %v", err)
+		return fmt.Errorf("Failed to read certs directory: %v", err)
 	}
 
 	certFiles := []string{}
@@ -755,7 +1985,7 @@ func cmdTLSList() {
 
 	if len(certFiles) == 0 {
 		fmt.Println("No certificates issued yet.")
-		return
+		return nil
 	}
 
 	fmt.Printf("%-40s %s\n", "DOMAIN", "CERT FILE")
@@ -766,45 +1996,45 @@ func cmdTLSList() {
 		domain = strings.ReplaceAll(domain, "_wildcard", "*")
 		fmt.Printf("%-40s %s\n", domain, filepath.Join(certsDir, f))
 	}
+	return nil
 }
 
-func cmdTLSRotate() {
+func cmdTLSRotate() error {
 	storePath := caStorePath()
 	tlsCA, err := ca.NewCA(storePath)
 	if err != nil {
-		log.Fatalf("Failed to access CA store: %v", err)
+		return caError("Failed to access CA store", err)
 	}
 
 	if !tlsCA.IsInitialized() {
-		log.Fatalf("CA not initialized. Run 'nameport tls init' first.")
+		return errors.New("CA not initialized. Run 'nameport tls init' first.")
 	}
 
 	fmt.Println("Rotating intermediate CA...")
 	if err := tlsCA.RotateIntermediate(); err != nil {
-		log.Fatalf("Failed to rotate intermediate: %v", err)
+		return caError("Failed to rotate intermediate", err)
 	}
 
 	fmt.Println("Intermediate CA rotated successfully.")
 	fmt.Printf("  New expiry: %s\n", tlsCA.InterCert.NotAfter.Format("2006-01-02"))
 	fmt.Println("Note: Existing leaf certificates remain valid until they expire.")
+	return nil
 }
 
-func cmdTLSExport(format, domain string) {
+func cmdTLSExport(format, domain string) error {
 	// Ensure .localhost suffix for bare names
 	if !strings.Contains(domain, ".") {
 		domain = domain + ".localhost"
 	}
 
-	storePath := caStorePath()
-	certsDir := filepath.Join(storePath, "certs")
-	safeName := strings.ReplaceAll(strings.ReplaceAll(domain, "*", "_wildcard"), "/", "_")
-	certPath := filepath.Join(certsDir, safeName+".pem")
-	keyPath := filepath.Join(certsDir, safeName+".key")
+	certPath, keyPath := issuer.CertFiles(filepath.Join(caStorePath(), issuer.CertsDirName), domain)
 
 	// Check if cert exists, issue if not
 	if _, err := os.Stat(certPath); os.IsNotExist(err) {
 		fmt.Printf("No certificate found for %s. Issuing one...\n", domain)
-		cmdTLSEnsure(domain)
+		if err := cmdTLSEnsure(domain); err != nil {
+			return err
+		}
 	}
 
 	switch strings.ToLower(format) {
@@ -833,39 +2063,39 @@ func cmdTLSExport(format, domain string) {
 		fmt.Printf("      keyFile: %s\n", keyPath)
 
 	default:
-		fmt.Fprintf(os.Stderr, "Unknown export format: %s\n", format)
-		fmt.Fprintf(os.Stderr, "Supported formats: nginx, caddy, traefik\n")
-		os.Exit(1)
+		return usageError("Unknown export format: %s\nSupported formats: nginx, caddy, traefik", format)
 	}
+	return nil
 }
 
-func cmdTLSUntrust() {
+func cmdTLSUntrust() error {
 	storePath := caStorePath()
 	tlsCA, err := ca.NewCA(storePath)
 	if err != nil {
-		log.Fatalf("Failed to access CA store: %v", err)
+		return caError("Failed to access CA store", err)
 	}
 
 	if !tlsCA.IsInitialized() {
 		fmt.Println("CA not initialized. Nothing to untrust.")
-		return
+		return nil
 	}
 
 	trustor := trust.NewPlatformTrustor()
 	if !trustor.IsInstalled(tlsCA.RootCertPEM()) {
 		fmt.Println("Root CA is not in the system trust store.")
-		return
+		return nil
 	}
 
 	fmt.Println("Removing root CA from system trust store...")
 	if err := trustor.Uninstall(); err != nil {
-		log.Fatalf("Failed to remove CA: %v\nYou may need to run this command with sudo.", err)
+		return fmt.Errorf("Failed to remove CA: %v\nYou may need to run this command with sudo.", err)
 	}
 
 	fmt.Println("Root CA removed from system trust store.")
+	return nil
 }
 
-func cmdCleanup() {
+func cmdCleanup() error {
 	fmt.Println("nameport cleanup")
 	fmt.Println("This will remove:")
 	fmt.Println("  - Root CA from system trust store")
@@ -914,4 +2144,5 @@ func cmdCleanup() {
 	fmt.Println("Cleanup complete. nameport data has been removed.")
 	fmt.Println("Note: If the daemon is installed as a system service, run:")
 	fmt.Println("  sudo nameport uninstall")
+	return nil
 }
@@ -0,0 +1,500 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"nameport/client"
+	"nameport/internal/storage"
+	"nameport/internal/tls/ca"
+	"nameport/internal/tls/issuer"
+	"nameport/internal/tls/policy"
+)
+
+func newTestStore(t *testing.T) *storage.Store {
+	t.Helper()
+	store, err := storage.NewStore(filepath.Join(t.TempDir(), "services.json"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	return store
+}
+
+// deadPort returns a local port with nothing listening on it.
+func deadPort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+	return port
+}
+
+func TestAddService_ReachableHTTP(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+	port := backend.Listener.Addr().(*net.TCPAddr).Port
+
+	store := newTestStore(t)
+	record, warning, err := addService(store, "web.localhost", port, "", "", false)
+	if err != nil {
+		t.Fatalf("addService: %v", err)
+	}
+	if warning != nil {
+		t.Errorf("warning = %v, want none", warning)
+	}
+	if record.UseTLS {
+		t.Error("UseTLS = true for a plain HTTP backend")
+	}
+	if _, ok := store.GetByName("web.localhost"); !ok {
+		t.Error("record not saved")
+	}
+}
+
+func TestAddService_ReachableHTTPS(t *testing.T) {
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+	port := backend.Listener.Addr().(*net.TCPAddr).Port
+
+	record, _, err := addService(newTestStore(t), "secure.localhost", port, "", "", false)
+	if err != nil {
+		t.Fatalf("addService: %v", err)
+	}
+	if !record.UseTLS {
+		t.Error("UseTLS = false for an HTTPS backend")
+	}
+}
+
+func TestAddService_DeadPortRequiresForce(t *testing.T) {
+	store := newTestStore(t)
+	port := deadPort(t)
+
+	_, _, err := addService(store, "dead.localhost", port, "", "", false)
+	if err == nil || !strings.Contains(err.Error(), "nothing is listening") {
+		t.Fatalf("err = %v, want a nothing-is-listening error", err)
+	}
+	if _, ok := store.GetByName("dead.localhost"); ok {
+		t.Error("record saved without --force")
+	}
+
+	record, warning, err := addService(store, "dead.localhost", port, "", "", true)
+	if err != nil {
+		t.Fatalf("addService with force: %v", err)
+	}
+	if warning == nil {
+		t.Error("expected a warning when forcing a dead port")
+	}
+	if record == nil || record.Port != port {
+		t.Errorf("record = %+v, want port %d", record, port)
+	}
+}
+
+func TestAddService_ExplicitHTTPSScheme(t *testing.T) {
+	store := newTestStore(t)
+	port := deadPort(t)
+
+	record, _, err := addService(store, "api.localhost", port, "", "https", true)
+	if err != nil {
+		t.Fatalf("addService: %v", err)
+	}
+	if !record.UseTLS {
+		t.Error("UseTLS = false with the https scheme")
+	}
+	saved, ok := store.GetByName("api.localhost")
+	if !ok || !saved.UseTLS {
+		t.Errorf("saved record = %+v, want UseTLS", saved)
+	}
+}
+
+func TestAddService_SchemeOverridesDetection(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+	port := backend.Listener.Addr().(*net.TCPAddr).Port
+
+	record, warning, err := addService(newTestStore(t), "web.localhost", port, "", "https", false)
+	if err != nil {
+		t.Fatalf("addService: %v", err)
+	}
+	if !record.UseTLS {
+		t.Error("UseTLS = false with the https scheme")
+	}
+	if warning == nil {
+		t.Error("expected a warning when the backend answers plain HTTP")
+	}
+}
+
+func TestAddService_DuplicateTargetRequiresForce(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+	port := backend.Listener.Addr().(*net.TCPAddr).Port
+
+	store := newTestStore(t)
+	if _, _, err := addService(store, "web.localhost", port, "", "", false); err != nil {
+		t.Fatalf("addService: %v", err)
+	}
+
+	_, _, err := addService(store, "copy.localhost", port, "localhost", "", false)
+	if exitCode(err) != exitConflict || !strings.Contains(err.Error(), "web.localhost") {
+		t.Fatalf("err = %v, want a conflict naming web.localhost", err)
+	}
+	if _, ok := store.GetByName("copy.localhost"); ok {
+		t.Error("duplicate saved without --force")
+	}
+
+	record, warning, err := addService(store, "copy.localhost", port, "localhost", "", true)
+	if err != nil {
+		t.Fatalf("addService with force: %v", err)
+	}
+	if warning == nil || !strings.Contains(warning.Error(), "web.localhost") {
+		t.Errorf("warning = %v, want one naming web.localhost", warning)
+	}
+	if record == nil || record.Name != "copy.localhost" {
+		t.Errorf("record = %+v, want copy.localhost", record)
+	}
+}
+
+func TestParseAddTarget(t *testing.T) {
+	tests := []struct {
+		in      string
+		scheme  string
+		host    string
+		port    int
+		wantErr bool
+	}{
+		{"8080", "", "", 8080, false},
+		{"192.168.0.1:3000", "", "192.168.0.1", 3000, false},
+		{"https://127.0.0.1:8443", "https", "127.0.0.1", 8443, false},
+		{"HTTP://9000", "http", "", 9000, false},
+		{"ftp://host:21", "", "", 0, true},
+		{"https://host:", "", "", 0, true},
+		{"70000", "", "", 0, true},
+		{"[::1]:8080", "", "::1", 8080, false},
+		{"https://[fe80::1%eth0]:8443", "https", "fe80::1%eth0", 8443, false},
+		{"::1", "", "", 0, true},
+		{"fe80::1%eth0", "", "", 0, true},
+		{"[::1]", "", "", 0, true},
+	}
+	for _, tt := range tests {
+		scheme, host, port, err := parseAddTarget(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseAddTarget(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if scheme != tt.scheme || host != tt.host || port != tt.port {
+			t.Errorf("parseAddTarget(%q) = %q, %q, %d; want %q, %q, %d", tt.in, scheme, host, port, tt.scheme, tt.host, tt.port)
+		}
+	}
+}
+
+// fakeReloadDaemon serves just enough of the daemon API for client.Discover
+// and counts the POST /api/reload requests it gets.
+func fakeReloadDaemon(t *testing.T) *int32 {
+	t.Helper()
+	var reloads int32
+	daemon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/records":
+			io.WriteString(w, "[]")
+		case "/api/reload":
+			atomic.AddInt32(&reloads, 1)
+			io.WriteString(w, `{"status":"ok","services":1}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(daemon.Close)
+	t.Setenv("NAMEPORT_DAEMON_URL", daemon.URL)
+	return &reloads
+}
+
+func TestParseListArgs(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		wantSource string
+		wantSort   string
+		wantErr    bool
+	}{
+		{"no flags", nil, "", "", false},
+		{"source", []string{"--source", "docker"}, "docker", "", false},
+		{"sort", []string{"--sort", "requests"}, "", "requests", false},
+		{"both", []string{"--sort", "p95", "--source", "manual"}, "manual", "p95", false},
+		{"trailing sort", []string{"--sort"}, "", "", true},
+		{"value missing after source", []string{"--source", "docker", "--sort"}, "", "", true},
+		{"unknown flag", []string{"--verbose", "yes"}, "", "", true},
+		{"stray argument", []string{"web"}, "", "", true},
+		{"stray argument after flag", []string{"--source", "docker", "web"}, "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, sortBy, err := parseListArgs(tt.args)
+			if tt.wantErr {
+				if exitCode(err) != exitUsage {
+					t.Errorf("parseListArgs(%q) exit code %d, want %d", tt.args, exitCode(err), exitUsage)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseListArgs(%q): %v", tt.args, err)
+			}
+			if source != tt.wantSource || sortBy != tt.wantSort {
+				t.Errorf("parseListArgs(%q) = %q, %q; want %q, %q", tt.args, source, sortBy, tt.wantSource, tt.wantSort)
+			}
+		})
+	}
+}
+
+func TestParsePruneArgs(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		wantSource string
+		wantErr    bool
+	}{
+		{"default", nil, storage.SourceDiscovered, false},
+		{"source", []string{"--source", "docker"}, "docker", false},
+		{"all", []string{"--source", "all"}, "all", false},
+		{"source without value", []string{"--source"}, "", true},
+		{"stray arguments", []string{"foo", "bar"}, "", true},
+		{"stray argument after flag", []string{"--source", "docker", "web"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, err := parsePruneArgs(tt.args)
+			if tt.wantErr {
+				if exitCode(err) != exitUsage {
+					t.Errorf("parsePruneArgs(%q) exit code %d, want %d", tt.args, exitCode(err), exitUsage)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parsePruneArgs(%q): %v", tt.args, err)
+			}
+			if source != tt.wantSource {
+				t.Errorf("parsePruneArgs(%q) = %q, want %q", tt.args, source, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestParseServiceArgs(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		wantUser   bool
+		wantDaemon string
+		wantErr    bool
+	}{
+		{"no flags", nil, false, "", false},
+		{"user", []string{"--user"}, true, "", false},
+		{"daemon", []string{"--daemon", "/opt/nameport-daemon"}, false, "/opt/nameport-daemon", false},
+		{"both", []string{"--daemon", "/opt/nameport-daemon", "--user"}, true, "/opt/nameport-daemon", false},
+		{"daemon without value", []string{"--daemon"}, false, "", true},
+		{"daemon without value after user", []string{"--user", "--daemon"}, false, "", true},
+		{"stray argument", []string{"--user", "now"}, false, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, daemonPath, err := parseServiceArgs(tt.args)
+			if tt.wantErr {
+				if exitCode(err) != exitUsage {
+					t.Errorf("parseServiceArgs(%q) exit code %d, want %d", tt.args, exitCode(err), exitUsage)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseServiceArgs(%q): %v", tt.args, err)
+			}
+			if user != tt.wantUser || daemonPath != tt.wantDaemon {
+				t.Errorf("parseServiceArgs(%q) = %v, %q; want %v, %q", tt.args, user, daemonPath, tt.wantUser, tt.wantDaemon)
+			}
+		})
+	}
+}
+
+func TestSettingCommands_ReloadDaemon(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(store *storage.Store) error
+	}{
+		{"throttle", func(store *storage.Store) error { return cmdThrottle(store, "app", "1mbps") }},
+		{"timeout", func(store *storage.Store) error { return cmdTimeout(store, "app", "2m") }},
+		{"health-path", func(store *storage.Store) error { return cmdHealthPath(store, "app", "/app") }},
+		{"flush", func(store *storage.Store) error { return cmdFlush(store, "app", "immediate") }},
+		{"host", func(store *storage.Store) error { return cmdHost(store, "app", "preserve") }},
+		{"color", func(store *storage.Store) error { return cmdColor(store, "app", "#ff9800") }},
+		{"icon", func(store *storage.Store) error { return cmdIcon(store, "app", "🦙") }},
+		{"auth", func(store *storage.Store) error { return cmdAuth(store, "app", []string{"bearer", "env:API_TOKEN"}) }},
+		{"proxy-protocol", func(store *storage.Store) error { return cmdProxyProtocol(store, "app", "v1") }},
+		{"scheme", func(store *storage.Store) error { return cmdScheme(store, "app", "https") }},
+		{"add", func(store *storage.Store) error { return cmdAdd(store, "web", 3001, "", "", true) }},
+		{"rename", func(store *storage.Store) error { return cmdRename(store, "app", "web") }},
+		{"keep", func(store *storage.Store) error { return cmdKeep(store, "app", false) }},
+		{"remove", func(store *storage.Store) error { return cmdRemove(store, "app") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reloads := fakeReloadDaemon(t)
+			store := newTestStore(t)
+			if _, err := store.AddManualService("app.localhost", 3000, ""); err != nil {
+				t.Fatalf("AddManualService: %v", err)
+			}
+
+			if err := tt.run(store); err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			if n := atomic.LoadInt32(reloads); n != 1 {
+				t.Errorf("daemon got %d reload requests, want 1", n)
+			}
+		})
+	}
+}
+
+func TestCmdHealthPath(t *testing.T) {
+	fakeReloadDaemon(t)
+	store := newTestStore(t)
+	if _, err := store.AddManualService("app.localhost", 3000, ""); err != nil {
+		t.Fatalf("AddManualService: %v", err)
+	}
+
+	if err := cmdHealthPath(store, "app", "/app"); err != nil {
+		t.Fatalf("cmdHealthPath: %v", err)
+	}
+	if record, _ := store.GetByName("app.localhost"); record.HealthPath != "/app" {
+		t.Errorf("HealthPath = %q, want /app", record.HealthPath)
+	}
+	if err := cmdHealthPath(store, "app.localhost", "off"); err != nil {
+		t.Fatalf("cmdHealthPath off: %v", err)
+	}
+	if record, _ := store.GetByName("app.localhost"); record.HealthPath != "" {
+		t.Errorf("HealthPath = %q after off, want empty", record.HealthPath)
+	}
+
+	if err := cmdHealthPath(store, "app", "app"); exitCode(err) != exitUsage {
+		t.Errorf("relative path: exit code %d, want %d", exitCode(err), exitUsage)
+	}
+	if err := cmdHealthPath(store, "missing", "/app"); exitCode(err) != exitNotFound {
+		t.Errorf("unknown service: exit code %d, want %d", exitCode(err), exitNotFound)
+	}
+}
+
+func TestSetOverride(t *testing.T) {
+	store := newTestStore(t)
+	if _, err := store.AddManualService("app.localhost", 3000, ""); err != nil {
+		t.Fatalf("AddManualService: %v", err)
+	}
+
+	now := time.Now()
+	record, err := setOverride(store, "app.localhost", "localhost:4000", 10*time.Minute, now)
+	if err != nil {
+		t.Fatalf("setOverride: %v", err)
+	}
+	want := storage.TargetOverride{Host: "127.0.0.1", Port: 4000, Expires: now.Add(10 * time.Minute)}
+	if record.Override == nil || *record.Override != want {
+		t.Fatalf("Override = %+v, want %+v", record.Override, want)
+	}
+	if record.Port != 3000 {
+		t.Errorf("Port = %d, want the original 3000 kept", record.Port)
+	}
+
+	if _, err := setOverride(store, "app.localhost", "https://127.0.0.1:4000", time.Minute, now); exitCode(err) != exitUsage {
+		t.Errorf("override with a scheme: exit code %d, want %d", exitCode(err), exitUsage)
+	}
+	if _, err := setOverride(store, "missing.localhost", "4000", time.Minute, now); exitCode(err) != exitNotFound {
+		t.Errorf("override of a missing service: exit code %d, want %d", exitCode(err), exitNotFound)
+	}
+
+	if err := clearOverride(store, "app.localhost"); err != nil {
+		t.Fatalf("clearOverride: %v", err)
+	}
+	if r, _ := store.GetByName("app.localhost"); r.Override != nil {
+		t.Errorf("Override = %+v after clear, want nil", r.Override)
+	}
+}
+
+func TestSortByTraffic(t *testing.T) {
+	newRecords := func() []*storage.ServiceRecord {
+		var records []*storage.ServiceRecord
+		for _, name := range []string{"idle.localhost", "web.localhost", "api.localhost", "slow.localhost"} {
+			records = append(records, &storage.ServiceRecord{Name: name})
+		}
+		return records
+	}
+	snapshots := map[string]*client.MetricsSnapshot{
+		"web.localhost":  {ServiceName: "web.localhost", TotalRequests: 500, RequestsPerSec: 2.5, P95ResponseMs: 12},
+		"api.localhost":  {ServiceName: "api.localhost", TotalRequests: 900, RequestsPerSec: 1.5, P95ResponseMs: 40},
+		"slow.localhost": {ServiceName: "slow.localhost", TotalRequests: 10, RequestsPerSec: 0.1, P95ResponseMs: 1800},
+	}
+
+	tests := []struct {
+		key  string
+		want []string
+	}{
+		{"requests", []string{"api.localhost", "web.localhost", "slow.localhost", "idle.localhost"}},
+		{"rps", []string{"web.localhost", "api.localhost", "slow.localhost", "idle.localhost"}},
+		{"p95", []string{"slow.localhost", "api.localhost", "web.localhost", "idle.localhost"}},
+		{"name", []string{"api.localhost", "idle.localhost", "slow.localhost", "web.localhost"}},
+	}
+	for _, tc := range tests {
+		records := newRecords()
+		sortByTraffic(records, snapshots, tc.key)
+
+		var got []string
+		for _, r := range records {
+			got = append(got, r.Name)
+		}
+		if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+			t.Errorf("sort %s = %v, want %v", tc.key, got, tc.want)
+		}
+	}
+}
+
+func TestSortByTraffic_NoMetrics(t *testing.T) {
+	// Without a daemon every service ties and the order falls back to name
+	records := []*storage.ServiceRecord{{Name: "b.localhost"}, {Name: "a.localhost"}}
+	sortByTraffic(records, map[string]*client.MetricsSnapshot{}, "rps")
+	if records[0].Name != "a.localhost" || records[1].Name != "b.localhost" {
+		t.Errorf("order = %s, %s; want a, b", records[0].Name, records[1].Name)
+	}
+}
+
+func TestWriteAudit_ReadsBackIssuedCert(t *testing.T) {
+	c, err := ca.NewCA(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewCA: %v", err)
+	}
+	if err := c.Init(); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	auditPath := filepath.Join(c.StorePath, issuer.AuditFileName)
+	iss := issuer.NewIssuer(c, policy.NewPolicy())
+	iss.SetAuditLog(issuer.NewAuditLog(auditPath))
+	if _, err := iss.Issue(issuer.IssueRequest{DNSNames: []string{"audited.localhost"}}); err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	entries, err := issuer.ReadAudit(auditPath)
+	if err != nil {
+		t.Fatalf("ReadAudit: %v", err)
+	}
+	var out bytes.Buffer
+	writeAudit(&out, entries)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected header, rule and 1 row, got:\n%s", out.String())
+	}
+	if !strings.Contains(lines[2], "audited.localhost") || !strings.Contains(lines[2], "24h0m0s") {
+		t.Errorf("row = %q, want the name and lifetime", lines[2])
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"nameport/internal/discovery/docker"
+	"nameport/internal/metrics"
+	"nameport/internal/notify"
+	"nameport/internal/probe"
+	"nameport/internal/storage"
+)
+
+// DefaultDockerConcurrency is how many container services discover probes
+// and registers at once unless --docker-concurrency says otherwise
+const DefaultDockerConcurrency = 8
+
+// containerResult is what registering one container service gave
+type containerResult struct {
+	name string // Registered name ("" when the port does not speak HTTP)
+	err  error  // Why it was not registered
+}
+
+// containerRecordID is the identity of a container service. It is built from
+// the container name rather than its ID, so a container that compose
+// recreates keeps its record and name.
+func containerRecordID(cs docker.ContainerService) string {
+	return fmt.Sprintf("docker-%s-%d", cs.ContainerName, cs.Port)
+}
+
+// scanContainers lists the services of running Docker containers. ok is
+// false when Docker discovery is on but the daemon could not be asked, in
+// which case the container services already known keep their state.
+func (s *Server) scanContainers() (containers []docker.ContainerService, ok bool) {
+	if s.docker == nil || !s.docker.Available() {
+		return nil, true
+	}
+	containers, err := s.docker.Scan()
+	if err != nil {
+		if msg := err.Error(); msg != s.lastDockerErr {
+			s.lastDockerErr = msg
+			log.Printf("Docker scan failed: %v", err)
+		}
+		return nil, false
+	}
+	if s.lastDockerErr != "" {
+		s.lastDockerErr = ""
+		log.Printf("Docker scan recovered")
+	}
+	return containers, true
+}
+
+// registerContainers probes and registers container services, up to
+// s.dockerConcurrency at a time so a large compose stack does not wait on
+// each backend in turn. It returns the names of the services registered.
+func (s *Server) registerContainers(containers []docker.ContainerService, now time.Time) map[string]bool {
+	limit := s.dockerConcurrency
+	if limit < 1 {
+		limit = 1
+	}
+
+	results := make([]containerResult, len(containers))
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for i, cs := range containers {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, cs docker.ContainerService) {
+			defer wg.Done()
+			results[i].name, results[i].err = s.registerContainer(cs, now)
+			<-sem
+		}(i, cs)
+	}
+	wg.Wait()
+
+	seen := make(map[string]bool, len(containers))
+	for i, r := range results {
+		if r.err != nil {
+			id := containerRecordID(containers[i])
+			if !s.rejected[id] {
+				s.rejected[id] = true
+				log.Printf("Not registering container %s on port %d: %v", containers[i].ContainerName, containers[i].Port, r.err)
+			}
+			continue
+		}
+		if r.name != "" {
+			seen[r.name] = true
+		}
+	}
+	return seen
+}
+
+// registerContainer probes one container service and creates or refreshes
+// its record. It is safe to call concurrently: the store, generator and
+// s.services are all locked. The name is empty when the port does not speak
+// HTTP.
+func (s *Server) registerContainer(cs docker.ContainerService, now time.Time) (string, error) {
+	id := containerRecordID(cs)
+	existing, known := s.store.Get(id)
+	healthPath := ""
+	if known {
+		healthPath = existing.HealthPath
+	}
+
+	// Containers have no PID on this host; their probe results are dropped
+	// when they stop, like those of a listener whose process exited
+	detection := s.probeCache.DetectPaths(cs.TargetHost, cs.Port, 0, probe.CandidatePaths(healthPath))
+	if detection.Protocol == probe.ProtoNone {
+		return "", nil
+	}
+	useTLS := detection.Protocol == probe.ProtoHTTPS
+
+	if known {
+		needsSave := existing.Port != cs.Port || existing.TargetHost != cs.TargetHost ||
+			existing.UseTLS != useTLS || existing.ProbePath != detection.Path || !existing.IsActive
+		if !existing.IsActive {
+			log.Printf("Service reactivated: %s", existing.Name)
+		}
+		existing.Port = cs.Port
+		existing.TargetHost = cs.TargetHost
+		existing.UseTLS = useTLS
+		existing.ProbePath = detection.Path
+		existing.IsActive = true
+		existing.LastSeen = now
+		if needsSave {
+			if err := s.store.Save(existing); err != nil {
+				log.Printf("Failed to update service %s: %v", existing.Name, err)
+			}
+		}
+
+		s.mu.Lock()
+		if svc, exists := s.services[existing.Name]; exists {
+			if svc.Port != cs.Port || svc.TargetHost != cs.TargetHost || svc.UseTLS != useTLS {
+				svc.Proxy = nil // Recreated for the new target or scheme
+			}
+			svc.Port = cs.Port
+			svc.TargetHost = cs.TargetHost
+			svc.UseTLS = useTLS
+			svc.ProbePath = detection.Path
+		}
+		s.mu.Unlock()
+		return existing.Name, nil
+	}
+
+	name, err := s.generator.GenerateName(cs.ContainerName, "", nil)
+	if err != nil {
+		return "", err
+	}
+
+	record := &storage.ServiceRecord{
+		ID:         id,
+		Name:       name,
+		Port:       cs.Port,
+		TargetHost: cs.TargetHost,
+		ExePath:    "docker:" + cs.ImageName,
+		IsActive:   true,
+		LastSeen:   now,
+		Group:      cs.ComposeProject,
+		UseTLS:     useTLS,
+		Source:     storage.SourceDocker,
+		ProbePath:  detection.Path,
+	}
+	if err := s.store.Save(record); err != nil {
+		s.generator.ReleaseName(name)
+		return "", fmt.Errorf("saving record: %w", err)
+	}
+
+	s.mu.Lock()
+	s.services[name] = &Service{
+		ID:         id,
+		Name:       name,
+		Port:       cs.Port,
+		TargetHost: cs.TargetHost,
+		ExePath:    record.ExePath,
+		Group:      record.Group,
+		UseTLS:     useTLS,
+		Source:     storage.SourceDocker,
+		ProbePath:  detection.Path,
+		Recent:     metrics.NewRecentRequests(),
+	}
+	s.mu.Unlock()
+
+	scheme := "http"
+	if useTLS {
+		scheme = "https"
+	}
+	log.Printf("New service: %s -> %s://%s:%d (container %s)", name, scheme, cs.TargetHost, cs.Port, cs.ContainerName)
+
+	if err := s.notifyManager.Notify(notify.Notification{
+		Event:   notify.EventServiceDiscovered,
+		Title:   "Service Discovered",
+		Message: fmt.Sprintf("%s is now available on port %d", name, cs.Port),
+		URL:     s.serviceURL(name),
+	}); err != nil {
+		log.Printf("Notification error: %v", err)
+	}
+	return name, nil
+}
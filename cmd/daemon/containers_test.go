@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"nameport/internal/discovery/docker"
+	"nameport/internal/portscan"
+	"nameport/internal/storage"
+)
+
+// fakeDockerContainer is a container as listed by the Docker API
+type fakeDockerContainer struct {
+	ID     string            `json:"Id"`
+	Names  []string          `json:"Names"`
+	Image  string            `json:"Image"`
+	Labels map[string]string `json:"Labels"`
+	Ports  []fakeDockerPort  `json:"Ports"`
+}
+
+type fakeDockerPort struct {
+	IP          string `json:"IP"`
+	PrivatePort int    `json:"PrivatePort"`
+	PublicPort  int    `json:"PublicPort"`
+	Type        string `json:"Type"`
+}
+
+// startFakeDocker serves the containers returned by list on a Unix socket
+// and returns its path. With a nil list every API call fails.
+func startFakeDocker(t *testing.T, list func() []fakeDockerContainer) string {
+	t.Helper()
+	sockPath := filepath.Join(t.TempDir(), "docker.sock")
+	ln, err := net.Listen("unix", sockPath)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if list == nil {
+			http.Error(w, "daemon unavailable", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list())
+	})}
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+	return sockPath
+}
+
+func TestDiscover_DockerContainersConcurrently(t *testing.T) {
+	const (
+		containerCount = 20
+		concurrency    = 4
+	)
+
+	// Every backend counts the probes in flight to check the bound
+	var inFlight, maxInFlight int32
+	backend := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	var containers []fakeDockerContainer
+	for i := 0; i < containerCount; i++ {
+		c := fakeDockerContainer{
+			ID:     fmt.Sprintf("c%03d", i),
+			Names:  []string{fmt.Sprintf("/app%d", i)},
+			Image:  "web:latest",
+			Labels: map[string]string{"com.docker.compose.project": "stack"},
+		}
+		for _, private := range []int{80, 8080} {
+			b := httptest.NewServer(backend)
+			t.Cleanup(b.Close)
+			c.Ports = append(c.Ports, fakeDockerPort{
+				IP:          "127.0.0.1",
+				PrivatePort: private,
+				PublicPort:  b.Listener.Addr().(*net.TCPAddr).Port,
+				Type:        "tcp",
+			})
+		}
+		containers = append(containers, c)
+	}
+
+	var mu sync.Mutex
+	running := containers
+	sock := startFakeDocker(t, func() []fakeDockerContainer {
+		mu.Lock()
+		defer mu.Unlock()
+		return running
+	})
+
+	srv := newTestServer(t)
+	srv.docker = docker.NewDiscovery(sock)
+	srv.dockerConcurrency = concurrency
+	srv.scan = func() ([]portscan.Listener, error) { return nil, nil }
+
+	srv.discover()
+
+	records := srv.store.ListBySource(storage.SourceDocker)
+	if len(records) != 2*containerCount {
+		t.Fatalf("registered %d container services, want %d", len(records), 2*containerCount)
+	}
+	names := make(map[string]bool)
+	for _, r := range records {
+		if names[r.Name] {
+			t.Errorf("name %s given twice", r.Name)
+		}
+		names[r.Name] = true
+		if srv.services[r.Name] == nil {
+			t.Errorf("%s has no runtime service", r.Name)
+		}
+		if r.Group != "stack" || r.TargetHost != "127.0.0.1" || !r.IsActive {
+			t.Errorf("record = %+v, want an active record in group stack", r)
+		}
+	}
+	if max := atomic.LoadInt32(&maxInFlight); max > concurrency || max < 2 {
+		t.Errorf("at most %d probes ran at once, want 2..%d", max, concurrency)
+	}
+
+	// A container that stopped goes inactive; the others keep their names
+	mu.Lock()
+	running = containers[1:]
+	mu.Unlock()
+	srv.discover()
+
+	if got := len(srv.store.ListBySource(storage.SourceDocker)); got != 2*containerCount {
+		t.Errorf("%d container records after a rescan, want %d", got, 2*containerCount)
+	}
+	for _, r := range srv.store.ListBySource(storage.SourceDocker) {
+		stopped := r.ID == containerRecordID(docker.ContainerService{ContainerName: "app0", Port: r.Port})
+		if r.IsActive == stopped {
+			t.Errorf("%s active = %v, want %v", r.Name, r.IsActive, !stopped)
+		}
+	}
+}
+
+func TestDiscover_PublishedPortsLeftToDocker(t *testing.T) {
+	b := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(b.Close)
+	port := b.Listener.Addr().(*net.TCPAddr).Port
+
+	sock := startFakeDocker(t, func() []fakeDockerContainer {
+		return []fakeDockerContainer{{
+			ID:    "c1",
+			Names: []string{"/shop"},
+			Image: "shop:latest",
+			Ports: []fakeDockerPort{{IP: "0.0.0.0", PrivatePort: 80, PublicPort: port, Type: "tcp"}},
+		}}
+	})
+
+	srv := newTestServer(t)
+	srv.docker = docker.NewDiscovery(sock)
+	srv.dockerConcurrency = DefaultDockerConcurrency
+	srv.scan = func() ([]portscan.Listener, error) {
+		return []portscan.Listener{{Port: port, PID: 100, ExePath: "/usr/bin/docker-proxy", Args: []string{"docker-proxy"}}}, nil
+	}
+	srv.discover()
+
+	records := srv.store.List()
+	if len(records) != 1 || records[0].Source != storage.SourceDocker {
+		t.Fatalf("records = %+v, want only the container", records)
+	}
+}
+
+func TestDiscover_DockerUnreachableKeepsContainers(t *testing.T) {
+	srv := newTestServer(t)
+	srv.scan = func() ([]portscan.Listener, error) { return nil, nil }
+	srv.store.Save(&storage.ServiceRecord{ID: "docker-shop-8080", Name: "shop.localhost", Port: 8080, Source: storage.SourceDocker, IsActive: true})
+	srv.loadServices()
+
+	srv.docker = docker.NewDiscovery(startFakeDocker(t, nil))
+	srv.discover()
+
+	if r, _ := srv.store.GetByName("shop.localhost"); !r.IsActive {
+		t.Error("container marked inactive although Docker did not answer")
+	}
+}
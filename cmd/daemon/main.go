@@ -1,32 +1,49 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/subtle"
 	"crypto/tls"
+	"embed"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"html/template"
+	"io/fs"
 	"log"
+	"net"
 	"net/http"
 	"net/http/httputil"
+	"net/netip"
 	"net/url"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"runtime"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
 	"time"
 
+	"nameport/internal/discovery/docker"
+	"nameport/internal/handoff"
+	"nameport/internal/metrics"
 	"nameport/internal/naming"
 	"nameport/internal/notify"
 	"nameport/internal/portscan"
 	"nameport/internal/probe"
+	"nameport/internal/proxyproto"
 	"nameport/internal/storage"
+	"nameport/internal/throttle"
 	"nameport/internal/tls/ca"
 	"nameport/internal/tls/issuer"
 	"nameport/internal/tls/policy"
 	"nameport/internal/tls/trust"
+	"nameport/internal/version"
 )
 
 // Service represents a discovered HTTP service
@@ -41,13 +58,75 @@ type Service struct {
 	Args       []string
 	Group      string // Service group for visual grouping
 	UseTLS     bool
-	Proxy      *httputil.ReverseProxy
+	Proxy      *httputil.ReverseProxy `json:"-"`
+
+	BandwidthLimit  int64                   // Response bandwidth cap in bytes/sec (0 = unlimited)
+	UpstreamTimeout time.Duration           // Backend response header timeout (0 = server default)
+	ProbePath       string                  // Path that answered the last probe, used for health checks
+	FlushInterval   time.Duration           // Proxy flush interval (0 = buffered, -1 = flush every write)
+	HostHeader      string                  // Fixed Host header for the backend (empty = target:port)
+	PreserveHost    bool                    // Forward the original Host header unchanged
+	Color           string                  // Dashboard accent color (#rgb or #rrggbb)
+	Icon            string                  // Dashboard icon, usually an emoji
+	AuthToken       string                  `json:"-"` // Bearer token added to requests without Authorization
+	AuthTokenEnv    string                  `json:"-"` // Environment variable holding the bearer token
+	ProxyProtocol   string                  // PROXY protocol version sent to the backend ("" = none)
+	PreferredScheme string                  // Scheme of the primary dashboard link and serviceURL ("" = https when TLS is on)
+	Source          string                  // How the service was registered (discovered, manual, ...)
+	HTTP3Advertised bool                    // Backend advertised HTTP/3 via Alt-Svc at the last health check (not proxied)
+	Override        *storage.TargetOverride // Temporary target proxied instead of TargetHost:Port until it expires
+	Recent          *metrics.RecentRequests `json:"-"` // Last few proxied requests
+
+	overrideProxy *httputil.ReverseProxy // Proxy to the override target, created on first use
+}
+
+// upstreamHost returns the Host header sent to the backend for a request
+// that arrived with Host host
+func (svc *Service) upstreamHost(host string) string {
+	switch {
+	case svc.HostHeader != "":
+		return svc.HostHeader
+	case svc.PreserveHost:
+		return host
+	default:
+		targetHost, port := svc.target(time.Now())
+		return net.JoinHostPort(targetHost, strconv.Itoa(port))
+	}
+}
+
+// target returns the backend requests are proxied to at now: the override
+// while it is active, otherwise TargetHost:Port
+func (svc *Service) target(now time.Time) (string, int) {
+	if ov := svc.Override; ov.Active(now) {
+		return ov.Host, ov.Port
+	}
+	return svc.TargetHost, svc.Port
+}
+
+// authToken returns the bearer token to inject for this service, if any. An
+// environment reference is resolved on every request so the token can be
+// rotated by restarting only the process that sets it.
+func (svc *Service) authToken() string {
+	if svc.AuthTokenEnv != "" {
+		return os.Getenv(svc.AuthTokenEnv)
+	}
+	return svc.AuthToken
 }
 
 // ServiceGroup represents a group of related services for dashboard display
 type ServiceGroup struct {
 	Name     string     // Group name (e.g. "ollama")
 	Services []*Service // Services in this group
+	Nested   bool       // Shown with a collapsible header (2+ services or subdomains)
+	Color    string     // Header color, from the first member that sets one
+	Icon     string     // Header icon, from the first member that sets one
+}
+
+// Subdomain returns the subdomain part of a sub.group.localhost name, or ""
+// for flat names
+func (svc *Service) Subdomain() string {
+	sub, _, _ := naming.SplitSubdomain(svc.Name)
+	return sub
 }
 
 // Server manages the discovery and proxying of local services
@@ -56,7 +135,9 @@ type Server struct {
 	blacklistStore *storage.BlacklistStore
 	generator      *naming.Generator
 	notifyManager  *notify.Manager
+	probeCache     *probe.ProbeCache
 	services       map[string]*Service // key = name
+	rejected       map[string]bool     // identity hashes of listeners whose names failed the name policy; only touched by discover()
 	mu             sync.RWMutex
 	pollInterval   time.Duration
 	tlsCA          *ca.CA
@@ -65,11 +146,120 @@ type Server struct {
 	tlsEnabled     bool
 	httpPort       int // HTTP listen port (default 80)
 	httpsPort      int // HTTPS listen port (default 443)
+
+	upstreamTimeout time.Duration // Default backend response header timeout (0 = none)
+	apiToken        string        // Required by privileged endpoints such as /api/tls/rotate
+	exportFile      string        // Optional JSON snapshot of services for other tools
+	lastExport      []byte        // Last content written to exportFile
+	exportMu        sync.Mutex    // Serializes export file writes
+	handedOff       bool          // Listeners went to a new daemon, which now owns the export file; guarded by exportMu
+
+	metrics    *metrics.Collector                  // Per-service traffic metrics, served at /api/metrics
+	handshakes *metrics.HandshakeTracker           // Failed TLS handshakes per server name
+	health     *probe.HealthCache                  // Service health shared by the dashboard and the background checker
+	scan       func() ([]portscan.Listener, error) // Port scanner (defaults to portscan.Scan)
+
+	docker            *docker.Discovery // Docker API client; nil unless --docker is given
+	dockerConcurrency int               // Container services probed and registered at once
+	lastDockerErr     string            // Last Docker scan error, logged once until it changes
+
+	lastScanErr   string                // Last port scan error, logged once until it changes
+	portConflicts map[portConflict]bool // Listeners on our own ports already warned about; only touched by discover()
+
+	resetMetricsOnRestart bool // Clear a service's metrics when its PID changes
+
+	portRanges []portRange // Only listeners in these ranges are registered (empty = all)
+
+	dashboardName string // Reserved hostname that always serves the dashboard
+
+	identity naming.IdentityStrategy // Default identity strategy; naming rules may override it
+
+	healthInterval time.Duration // How often healthLoop re-checks every service
+
+	remoteReadOnly bool // Only loopback clients may call mutating API endpoints
+
+	stop  chan struct{}  // Closed to stop discoveryLoop and healthLoop
+	loops sync.WaitGroup // Running background loops
+}
+
+// DefaultDashboardName is the reserved hostname for the dashboard.
+const DefaultDashboardName = "nameport.localhost"
+
+// portRange is an inclusive range of ports given with --port-range
+type portRange struct {
+	Start int
+	End   int
+}
+
+// parsePortRange parses "start-end" (or a single port) into a portRange
+func parsePortRange(s string) (portRange, error) {
+	startStr, endStr, found := strings.Cut(s, "-")
+	if !found {
+		endStr = startStr
+	}
+	start, err := strconv.Atoi(strings.TrimSpace(startStr))
+	if err != nil {
+		return portRange{}, fmt.Errorf("invalid port range %q: want start-end", s)
+	}
+	end, err := strconv.Atoi(strings.TrimSpace(endStr))
+	if err != nil {
+		return portRange{}, fmt.Errorf("invalid port range %q: want start-end", s)
+	}
+	if start < 1 || end > 65535 || start > end {
+		return portRange{}, fmt.Errorf("invalid port range %q: ports must satisfy 1 <= start <= end <= 65535", s)
+	}
+	return portRange{Start: start, End: end}, nil
+}
+
+// inPortRanges reports whether port should be considered by discover()
+func (s *Server) inPortRanges(port int) bool {
+	if len(s.portRanges) == 0 {
+		return true
+	}
+	for _, r := range s.portRanges {
+		if port >= r.Start && port <= r.End {
+			return true
+		}
+	}
+	return false
+}
+
+// identityFor returns the identity hash of a listener, using the strategy of
+// the first naming rule that sets one, else the --identity strategy
+func (s *Server) identityFor(l portscan.Listener) string {
+	strategy := s.identity
+	if rs, ok := s.generator.RuleEngine().Identity(l.ExePath, l.Cwd, l.Args, l.Port); ok {
+		strategy = rs
+	}
+	return naming.ComputeIdentity(strategy, l.ExePath, l.Args, l.Port)
+}
+
+// portConflict is another process listening on one of the daemon's own ports
+type portConflict struct {
+	Port int
+	PID  int
+}
+
+// ExportedService is one entry of the --export-file snapshot
+type ExportedService struct {
+	Name   string `json:"name"`
+	Target string `json:"target"` // host:port
+	Scheme string `json:"scheme"` // backend scheme: http or https
+	Group  string `json:"group"`
 }
 
 // DefaultCAStorePath is the default location for CA material.
 const DefaultCAStorePath = "~/.localtls"
 
+// DefaultAPITokenPath is where the token for privileged API endpoints is kept.
+const DefaultAPITokenPath = "~/.config/nameport/api-token"
+
+// staticFiles holds the dashboard's icon and other assets, served under
+// /static/ and /favicon.ico on the dashboard host
+//
+//go:embed static
+var staticFiles embed.FS
+
 // expandHome replaces a leading ~ with the user's home directory.
 func expandHome(path string) string {
 	if strings.HasPrefix(path, "~/") {
@@ -80,12 +270,62 @@ func expandHome(path string) string {
 	return path
 }
 
+// loadOrCreateAPIToken returns the API token stored at path, generating and
+// saving a new random token if none exists yet.
+func loadOrCreateAPIToken(path string) (string, error) {
+	if data, err := os.ReadFile(path); err == nil {
+		if token := strings.TrimSpace(string(data)); token != "" {
+			return token, nil
+		}
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, []byte(token+"\n"), 0600); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// logCAHint logs how to fix a CA store that is not readable or writable.
+func logCAHint(err error) {
+	if hint := ca.Remediation(err); hint != "" {
+		log.Printf("  Hint: %s", hint)
+	}
+}
+
 func main() {
 	// Parse flags
 	storePath := storage.DefaultStorePath()
 	httpPort := 80
 	httpsPort := 443
 	highPort := false
+	var upstreamTimeout time.Duration
+	exportFile := ""
+	probeChangedOnly := false
+	certAudit := true
+	renewWindow := ""
+	renewInterval := issuer.DefaultRenewInterval
+	noTLS := false
+	resetMetricsOnRestart := false
+	histogramBuckets := metrics.DefaultBuckets
+	var portRanges []portRange
+	dashboardName := DefaultDashboardName
+	identity := naming.DefaultIdentityStrategy
+	healthInterval := probe.DefaultHealthInterval
+	remoteReadOnly := false
+	dockerSocket := ""
+	dockerEnabled := false
+	dockerConcurrency := DefaultDockerConcurrency
 
 	// Simple arg parsing (no flag package to keep it minimal)
 	args := os.Args[1:]
@@ -103,6 +343,113 @@ func main() {
 				i++
 				fmt.Sscanf(args[i], "%d", &httpsPort)
 			}
+		case "--upstream-timeout":
+			if i+1 < len(args) {
+				i++
+				d, err := time.ParseDuration(args[i])
+				if err != nil {
+					log.Fatalf("Invalid --upstream-timeout: %v", err)
+				}
+				upstreamTimeout = d
+			}
+		case "--export-file":
+			if i+1 < len(args) {
+				i++
+				exportFile = args[i]
+			}
+		case "--probe-changed-only":
+			probeChangedOnly = true
+		case "--no-tls":
+			noTLS = true
+		case "--reset-metrics-on-restart":
+			resetMetricsOnRestart = true
+		case "--remote-read-only":
+			remoteReadOnly = true
+		case "--histogram-buckets":
+			if i+1 < len(args) {
+				i++
+				buckets, err := metrics.ParseBuckets(args[i])
+				if err != nil {
+					log.Fatalf("Invalid --histogram-buckets: %v", err)
+				}
+				histogramBuckets = buckets
+			}
+		case "--dashboard-name":
+			if i+1 < len(args) {
+				i++
+				name, err := naming.NormalizeName(args[i])
+				if err != nil {
+					log.Fatalf("Invalid --dashboard-name: %v", err)
+				}
+				dashboardName = name
+			}
+		case "--health-interval":
+			if i+1 < len(args) {
+				i++
+				d, err := time.ParseDuration(args[i])
+				if err != nil || d <= 0 {
+					log.Fatalf("Invalid --health-interval: %q", args[i])
+				}
+				healthInterval = d
+			}
+		case "--identity":
+			if i+1 < len(args) {
+				i++
+				strategy, err := naming.ParseIdentityStrategy(args[i])
+				if err != nil {
+					log.Fatalf("Invalid --identity: %v", err)
+				}
+				identity = strategy
+			}
+		case "--port-range":
+			if i+1 < len(args) {
+				i++
+				r, err := parsePortRange(args[i])
+				if err != nil {
+					log.Fatalf("Invalid --port-range: %v", err)
+				}
+				portRanges = append(portRanges, r)
+			}
+		case "--docker":
+			dockerEnabled = true
+		case "--docker-socket":
+			if i+1 < len(args) {
+				i++
+				dockerEnabled = true
+				dockerSocket = args[i]
+			}
+		case "--docker-concurrency":
+			if i+1 < len(args) {
+				i++
+				n, err := strconv.Atoi(args[i])
+				if err != nil || n < 1 {
+					log.Fatalf("Invalid --docker-concurrency: %q (want a positive number)", args[i])
+				}
+				dockerConcurrency = n
+			}
+		case "--no-cert-audit":
+			certAudit = false
+		case "--tls-renew-before":
+			if i+1 < len(args) {
+				i++
+				if _, _, err := issuer.ParseRenewWindow(args[i]); err != nil {
+					log.Fatalf("Invalid --tls-renew-before: %v", err)
+				}
+				renewWindow = args[i]
+			}
+		case "--tls-renew-interval":
+			if i+1 < len(args) {
+				i++
+				if args[i] == "off" {
+					renewInterval = 0
+					break
+				}
+				d, err := time.ParseDuration(args[i])
+				if err != nil || d <= 0 {
+					log.Fatalf("Invalid --tls-renew-interval: %q (want a duration or off)", args[i])
+				}
+				renewInterval = d
+			}
 		case "--config":
 			if i+1 < len(args) {
 				i++
@@ -141,97 +488,100 @@ func main() {
 	}
 	notifyMgr := notify.NewManager(notifyCfg, notify.NewPlatformNotifier())
 
+	// With --probe-changed-only, a listener keeps its probe result until its
+	// PID changes or it stops listening
+	probeTTL := probe.DefaultCacheTTL
+	if probeChangedOnly {
+		probeTTL = probe.NoExpiry
+	}
+
 	// Create server
 	srv := &Server{
 		store:          store,
 		blacklistStore: blacklistStore,
 		generator:      naming.NewGenerator(),
 		notifyManager:  notifyMgr,
+		probeCache:     probe.NewProbeCache(probeTTL),
 		services:       make(map[string]*Service),
+		rejected:       make(map[string]bool),
 		pollInterval:   2 * time.Second,
 		httpPort:       httpPort,
 		httpsPort:      httpsPort,
-	}
 
-	// Initialize TLS CA
-	caStorePath := expandHome(DefaultCAStorePath)
-	tlsCA, err := ca.NewCA(caStorePath)
-	if err != nil {
-		log.Printf("Warning: TLS CA initialization failed: %v (HTTPS disabled)", err)
-	} else if !tlsCA.IsInitialized() {
-		log.Println("TLS CA not initialized. Bootstrapping new CA...")
-		if err := tlsCA.Init(); err != nil {
-			log.Printf("Warning: TLS CA bootstrap failed: %v (HTTPS disabled)", err)
-		} else {
-			log.Println("TLS CA initialized successfully.")
-		}
+		upstreamTimeout: upstreamTimeout,
+		metrics:         metrics.NewCollectorWithBuckets(histogramBuckets),
+		handshakes:      metrics.NewHandshakeTracker(),
+		health:          probe.NewHealthCache(2 * healthInterval),
+		exportFile:      exportFile,
+
+		resetMetricsOnRestart: resetMetricsOnRestart,
+
+		portRanges:    portRanges,
+		dashboardName: dashboardName,
+
+		identity: identity,
+
+		healthInterval: healthInterval,
+
+		remoteReadOnly: remoteReadOnly,
+
+		dockerConcurrency: dockerConcurrency,
+	}
+	if dockerEnabled {
+		srv.docker = docker.NewDiscovery(dockerSocket)
 	}
 
-	if tlsCA != nil && tlsCA.IsInitialized() {
-		srv.tlsCA = tlsCA
-		srv.tlsTrustor = trust.NewPlatformTrustor()
-		pol := policy.NewPolicy()
-		srv.tlsIssuer = issuer.NewIssuer(tlsCA, pol)
-		srv.tlsEnabled = true
+	// Discovery needs platform tools (lsof on macOS); say so up front
+	if err := portscan.Check(); err != nil {
+		log.Printf("Warning: service discovery will not work: %v", err)
+	}
 
-		// Check if CA is trusted by the OS
-		if !srv.tlsTrustor.IsInstalled(tlsCA.RootCertPEM()) {
-			if srv.tlsTrustor.NeedsElevation() {
-				log.Println("WARNING: Root CA is not trusted by the OS.")
-				log.Println("  Run 'sudo nameport tls init' to install the CA into the system trust store.")
-				log.Println("  HTTPS will work but browsers will show certificate warnings.")
-			} else {
-				log.Println("Installing root CA into system trust store...")
-				if err := srv.tlsTrustor.Install(tlsCA.RootCertPEM()); err != nil {
-					log.Printf("Warning: failed to install CA: %v", err)
-					log.Println("  HTTPS will work but browsers will show certificate warnings.")
-				} else {
-					log.Println("Root CA installed into system trust store.")
-				}
-			}
-		} else {
-			log.Println("TLS CA is trusted by the OS.")
-		}
+	// Load optional name policy (permissive when absent)
+	if namePolicy, err := naming.LoadNamePolicy(naming.NamePolicyPath()); err == nil {
+		srv.generator.SetPolicy(namePolicy)
+		log.Printf("Name policy loaded from %s", naming.NamePolicyPath())
+	} else if !os.IsNotExist(err) {
+		log.Printf("Warning: %v (using permissive default)", err)
 	}
 
-	// Load existing services into generator to avoid name collisions
-	for _, record := range store.List() {
-		srv.generator.GenerateName(record.ExePath, "", record.Args) // Mark name as used
-		// Backfill group for records that don't have one yet
-		if record.Group == "" {
-			record.Group = naming.ExtractGroupFromExe(record.ExePath, record.Name)
-		}
-		srv.services[record.Name] = &Service{
-			ID:         record.ID,
-			Name:       record.Name,
-			Port:       record.Port,
-			TargetHost: record.EffectiveTargetHost(),
-			PID:        record.PID,
-			ExePath:    record.ExePath,
-			Cwd:        "",
-			Args:       record.Args,
-			Group:      record.Group,
-			UseTLS:     record.UseTLS,
-			Proxy:      nil, // Will be created on first use
-		}
+	// Load the token guarding privileged API endpoints
+	apiTokenPath := expandHome(DefaultAPITokenPath)
+	if token, err := loadOrCreateAPIToken(apiTokenPath); err != nil {
+		log.Printf("Warning: failed to load API token from %s: %v (privileged endpoints disabled)", apiTokenPath, err)
+	} else {
+		srv.apiToken = token
 	}
 
-	// Start discovery loop
-	go srv.discoveryLoop()
+	srv.setupTLS(tlsOptions{
+		disabled:      noTLS,
+		caStorePath:   expandHome(DefaultCAStorePath),
+		audit:         certAudit,
+		renewWindow:   renewWindow,
+		renewInterval: renewInterval,
+	})
+
+	// Never hand out the dashboard's name; loading the existing services
+	// reserves theirs
+	srv.generator.Reserve(srv.dashboardName)
+	srv.loadServices()
+
+	// Write the initial snapshot before discovery starts changing it
+	srv.writeExport()
+
+	// Start discovery and health checking
+	srv.startLoops()
 
 	// Setup HTTP handler
-	mux := http.NewServeMux()
-	mux.HandleFunc("/", srv.handleRequest)
-	mux.HandleFunc("/api/services", srv.handleAPIServices)
-	mux.HandleFunc("/api/rename", srv.handleAPIRename)
-	mux.HandleFunc("/api/blacklist", srv.handleAPIBlacklist)
-	mux.HandleFunc("/api/keep", srv.handleAPIKeep)
+	mux := srv.routes()
 
 	log.Println("nameport daemon starting...")
 	log.Printf("Storage: %s", storePath)
 	if highPort {
 		log.Printf("Running in high-port mode (no root required)")
 	}
+	if remoteReadOnly {
+		log.Printf("Remote clients are read-only (mutating API calls need a loopback client)")
+	}
 
 	httpAddr := fmt.Sprintf(":%d", httpPort)
 	httpsAddr := fmt.Sprintf(":%d", httpsPort)
@@ -243,56 +593,87 @@ func main() {
 	}
 
 	// HTTPS server (if TLS is enabled)
-	var httpsServer *http.Server
-	if srv.tlsEnabled {
-		tlsConfig := &tls.Config{
-			GetCertificate: srv.tlsIssuer.GetCertificate,
-			MinVersion:     tls.VersionTLS12,
-		}
-		httpsServer = &http.Server{
-			Addr:      httpsAddr,
-			Handler:   srv.addForwardedProto(mux),
-			TLSConfig: tlsConfig,
-		}
-	}
+	httpsServer := srv.newHTTPSServer(httpsAddr, mux)
 
 	// Graceful shutdown on SIGINT/SIGTERM
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
+	// Bind (or take over from the process we replace, see SIGUSR2)
+	var handoffs []handoff.Listener
+	httpLn, err := handoff.Listen("http", httpAddr)
+	if err != nil {
+		log.Fatalf("HTTP server error: %v", err)
+	}
+	handoffs = append(handoffs, handoff.Listener{Name: "http", Listener: httpLn})
+
 	// Start HTTP listener
 	go func() {
 		log.Printf("Listening on %s (HTTP)", httpAddr)
-		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := httpServer.Serve(httpLn); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("HTTP server error: %v", err)
 		}
 	}()
 
 	// Start HTTPS listener
 	if httpsServer != nil {
-		go func() {
-			log.Printf("Listening on %s (HTTPS, dynamic certs via local CA)", httpsAddr)
-			if err := httpsServer.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
-				log.Printf("HTTPS server error: %v (HTTPS disabled)", err)
-			}
-		}()
+		if httpsLn, err := handoff.Listen("https", httpsAddr); err != nil {
+			log.Printf("HTTPS server error: %v (HTTPS disabled)", err)
+		} else {
+			handoffs = append(handoffs, handoff.Listener{Name: "https", Listener: httpsLn})
+			go func() {
+				log.Printf("Listening on %s (HTTPS, dynamic certs via local CA)", httpsAddr)
+				if err := httpsServer.ServeTLS(httpsLn, "", ""); err != nil && err != http.ErrServerClosed {
+					log.Printf("HTTPS server error: %v (HTTPS disabled)", err)
+				}
+			}()
+		}
 	}
 
 	// Show dashboard URL
 	if httpPort == 80 {
-		log.Println("Dashboard: http://localhost/ or https://localhost/")
+		if srv.tlsEnabled {
+			log.Println("Dashboard: http://localhost/ or https://localhost/")
+		} else {
+			log.Println("Dashboard: http://localhost/")
+		}
 	} else {
 		log.Printf("Dashboard: http://localhost:%d/", httpPort)
 		if srv.tlsEnabled {
 			log.Printf("           https://localhost:%d/", httpsPort)
 		}
 	}
+	log.Printf("           (also at %s)", srv.serviceURL(srv.dashboardName))
+
+	// Wait for shutdown signal. SIGUSR2 starts a new daemon from the
+	// (possibly upgraded) binary on our listeners, then drains this one.
+	// SIGHUP re-reads the naming rules.
+	restart := make(chan os.Signal, 1)
+	notifyRestart(restart)
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	shutdownTimeout := 5 * time.Second
+	for waiting := true; waiting; {
+		select {
+		case <-ctx.Done():
+			log.Println("Shutting down...")
+			waiting = false
+		case <-hangup:
+			if _, err := srv.reloadRules(); err != nil {
+				log.Printf("Failed to reload naming rules: %v (keeping the current rules)", err)
+			}
+		case <-restart:
+			if err := srv.handOver(func() error { return gracefulRestart(handoffs) }); err != nil {
+				log.Printf("Graceful restart failed: %v (still serving)", err)
+				continue
+			}
+			log.Println("Handed listeners to the new daemon; draining...")
+			shutdownTimeout = restartDrainTimeout
+			waiting = false
+		}
+	}
 
-	// Wait for shutdown signal
-	<-ctx.Done()
-	log.Println("Shutting down...")
-
-	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
 	defer cancel()
 
 	if httpsServer != nil {
@@ -303,6 +684,180 @@ func main() {
 	log.Println("Daemon stopped.")
 }
 
+// restartDrainTimeout bounds how long a daemon replaced by a graceful restart
+// waits for in-flight requests
+const restartDrainTimeout = 30 * time.Second
+
+// handOver stops discovery, health checks and all writes to the store and
+// export file, then calls restart to pass the listeners on, so the draining
+// daemon never writes over the new one's state. If restart fails everything
+// is resumed.
+func (s *Server) handOver(restart func() error) error {
+	s.stopLoops()
+	s.store.SetReadOnly(true)
+	s.exportMu.Lock()
+	s.handedOff = true
+	s.exportMu.Unlock()
+
+	if err := restart(); err != nil {
+		s.exportMu.Lock()
+		s.handedOff = false
+		s.exportMu.Unlock()
+		s.store.SetReadOnly(false)
+		s.startLoops()
+		return err
+	}
+	return nil
+}
+
+// gracefulRestart re-executes the daemon binary with the same arguments,
+// handing it the listening sockets so the ports never close
+func gracefulRestart(listeners []handoff.Listener) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	proc, err := handoff.Restart(exe, os.Args[1:], listeners)
+	if err != nil {
+		return err
+	}
+	log.Printf("Started new daemon (pid %d)", proc.Pid)
+	return nil
+}
+
+// tlsOptions configures the HTTPS side of the daemon
+type tlsOptions struct {
+	disabled    bool   // --no-tls: plain HTTP only, whatever the CA state
+	caStorePath string // CA directory, bootstrapped when empty
+	audit       bool   // Record issued certificates in the audit log
+	renewWindow string // --tls-renew-before value (duration or percentage)
+
+	renewInterval time.Duration // How often cached certificates are renewed in the background (0 = only on access)
+}
+
+// setupTLS loads (or bootstraps) the local CA, prepares the certificate
+// issuer and makes sure the root is trusted. HTTPS stays off when disabled
+// or when the CA cannot be used.
+func (s *Server) setupTLS(opts tlsOptions) {
+	if opts.disabled {
+		log.Println("TLS disabled (--no-tls); serving HTTP only")
+		return
+	}
+
+	tlsCA, err := ca.NewCA(opts.caStorePath)
+	if err != nil {
+		log.Printf("Warning: TLS CA initialization failed: %v (HTTPS disabled)", err)
+		logCAHint(err)
+	} else if !tlsCA.IsInitialized() {
+		log.Println("TLS CA not initialized. Bootstrapping new CA...")
+		if err := tlsCA.Init(); err != nil {
+			log.Printf("Warning: TLS CA bootstrap failed: %v (HTTPS disabled)", err)
+			logCAHint(err)
+		} else {
+			log.Println("TLS CA initialized successfully.")
+		}
+	}
+
+	if tlsCA != nil && tlsCA.IsInitialized() {
+		s.tlsCA = tlsCA
+		s.tlsTrustor = trust.NewPlatformTrustor()
+		pol := policy.NewPolicy()
+		s.tlsIssuer = issuer.NewIssuer(tlsCA, pol)
+		if opts.audit {
+			s.tlsIssuer.SetAuditLog(issuer.NewAuditLog(filepath.Join(tlsCA.StorePath, issuer.AuditFileName)))
+		}
+		// Keep issued certs across restarts, and serve those from 'nameport tls ensure'
+		s.tlsIssuer.SetCertDir(filepath.Join(tlsCA.StorePath, issuer.CertsDirName))
+		if opts.renewWindow != "" {
+			before, fraction, _ := issuer.ParseRenewWindow(opts.renewWindow)
+			if fraction > 0 {
+				s.tlsIssuer.SetRenewFraction(fraction)
+			} else {
+				s.tlsIssuer.SetRenewBefore(before)
+			}
+		}
+		if opts.renewInterval > 0 {
+			go s.tlsIssuer.RunRenewer(context.Background(), opts.renewInterval)
+		}
+		s.tlsEnabled = true
+
+		// Check if CA is trusted by the OS
+		if !s.tlsTrustor.IsInstalled(tlsCA.RootCertPEM()) {
+			if s.tlsTrustor.NeedsElevation() {
+				log.Println("WARNING: Root CA is not trusted by the OS.")
+				log.Println("  Run 'sudo nameport tls init' to install the CA into the system trust store.")
+				log.Println("  HTTPS will work but browsers will show certificate warnings.")
+			} else {
+				log.Println("Installing root CA into system trust store...")
+				if err := s.tlsTrustor.Install(tlsCA.RootCertPEM()); err != nil {
+					log.Printf("Warning: failed to install CA: %v", err)
+					log.Println("  HTTPS will work but browsers will show certificate warnings.")
+				} else {
+					log.Println("Root CA installed into system trust store.")
+				}
+			}
+		} else {
+			log.Println("TLS CA is trusted by the OS.")
+		}
+	}
+}
+
+// newHTTPSServer returns the HTTPS server for handler, or nil when TLS is
+// not enabled
+func (s *Server) newHTTPSServer(addr string, handler http.Handler) *http.Server {
+	if !s.tlsEnabled {
+		return nil
+	}
+	server := &http.Server{
+		Addr:    addr,
+		Handler: s.addForwardedProto(handler),
+		TLSConfig: &tls.Config{
+			GetCertificate: s.tlsIssuer.GetCertificate,
+			MinVersion:     tls.VersionTLS12,
+		},
+	}
+	if s.handshakes != nil {
+		// Remember which name each client asked for, so that the failure
+		// net/http reports through ErrorLog can be attributed to it
+		server.TLSConfig.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			s.handshakes.Hello(hello.Conn.RemoteAddr().String(), hello.ServerName)
+			return nil, nil
+		}
+		server.ConnState = func(c net.Conn, state http.ConnState) {
+			if state == http.StateActive || state == http.StateClosed {
+				s.handshakes.Done(c.RemoteAddr().String())
+			}
+		}
+		server.ErrorLog = log.New(handshakeErrorWriter{s.handshakes}, "", 0)
+	}
+	return server
+}
+
+// tlsHandshakeErrorPrefix starts the line net/http logs for a failed handshake
+const tlsHandshakeErrorPrefix = "http: TLS handshake error from "
+
+// handshakeErrorWriter receives the HTTPS server's error log, counting TLS
+// handshake failures and passing every line on to the standard logger
+type handshakeErrorWriter struct {
+	tracker *metrics.HandshakeTracker
+}
+
+func (w handshakeErrorWriter) Write(p []byte) (int, error) {
+	line := strings.TrimSpace(string(p))
+	if rest, ok := strings.CutPrefix(line, tlsHandshakeErrorPrefix); ok {
+		if addr, reason, ok := strings.Cut(rest, ": "); ok {
+			name := w.tracker.Failed(addr, reason)
+			if name == "" {
+				name = "(no SNI)"
+			}
+			log.Printf("TLS handshake failed for %s from %s: %s", name, addr, reason)
+			return len(p), nil
+		}
+	}
+	log.Print(line)
+	return len(p), nil
+}
+
 // addForwardedProto wraps a handler to add X-Forwarded-Proto: https
 func (s *Server) addForwardedProto(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -311,62 +866,234 @@ func (s *Server) addForwardedProto(next http.Handler) http.Handler {
 	})
 }
 
-// discoveryLoop continuously scans for new services
-func (s *Server) discoveryLoop() {
+// startLoops runs discoveryLoop and healthLoop until stopLoops
+func (s *Server) startLoops() {
+	s.stop = make(chan struct{})
+	s.loops.Add(2)
+	go func() {
+		defer s.loops.Done()
+		s.discoveryLoop(s.stop)
+	}()
+	go func() {
+		defer s.loops.Done()
+		s.healthLoop(s.stop)
+	}()
+}
+
+// stopLoops stops the loops started by startLoops and waits for a scan
+// or health check in progress to finish
+func (s *Server) stopLoops() {
+	close(s.stop)
+	s.loops.Wait()
+}
+
+// discoveryLoop continuously scans for new services until stop is closed
+func (s *Server) discoveryLoop(stop <-chan struct{}) {
 	ticker := time.NewTicker(s.pollInterval)
 	defer ticker.Stop()
 
 	// Run immediately on start
 	s.discover()
 
-	for range ticker.C {
-		s.discover()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			s.discover()
+		}
 	}
 }
 
+// healthLoop keeps the health cache fresh so that dashboard polls are
+// answered from it, until stop is closed
+func (s *Server) healthLoop(stop <-chan struct{}) {
+	ticker := time.NewTicker(s.healthInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			s.refreshHealth()
+		}
+	}
+}
+
+// healthTarget returns what to health-check for svc. Callers must hold s.mu.
+func (s *Server) healthTarget(svc *Service) probe.HealthTarget {
+	host, port := svc.target(time.Now())
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	return probe.HealthTarget{
+		Host:     host,
+		Port:     port,
+		TLS:      svc.UseTLS,
+		Path:     svc.ProbePath,
+		HostName: svc.upstreamHost(svc.Name),
+	}
+}
+
+// refreshHealth re-checks every service and records whether it advertises
+// HTTP/3
+func (s *Server) refreshHealth() {
+	s.mu.RLock()
+	targets := make([]probe.HealthTarget, 0, len(s.services))
+	for _, svc := range s.services {
+		targets = append(targets, s.healthTarget(svc))
+	}
+	s.mu.RUnlock()
+
+	s.health.Refresh(targets)
+
+	s.mu.Lock()
+	for _, svc := range s.services {
+		if st, ok := s.health.Cached(s.healthTarget(svc)); ok {
+			svc.HTTP3Advertised = st.HTTP3
+		}
+	}
+	s.mu.Unlock()
+}
+
+// warnPortConflict explains that listener is skipped because the daemon
+// itself uses its port
+func (s *Server) warnPortConflict(listener portscan.Listener) {
+	flag := "--http-port"
+	if listener.Port == s.httpsPort {
+		flag = "--https-port"
+	}
+	log.Printf("Warning: skipping %s (PID %d) on port %d: nameport itself listens on this port; start nameport with a different %s to proxy it",
+		filepath.Base(listener.ExePath), listener.PID, listener.Port, flag)
+}
+
 // discover scans for listening ports and updates services
 func (s *Server) discover() {
-	listeners, err := portscan.Scan()
+	scan := s.scan
+	if scan == nil {
+		scan = portscan.Scan
+	}
+	listeners, err := scan()
 	if err != nil {
-		log.Printf("Port scan failed: %v", err)
+		// A persistent failure (e.g. lsof missing) is logged once, not
+		// every poll interval
+		if msg := err.Error(); msg != s.lastScanErr {
+			s.lastScanErr = msg
+			log.Printf("Port scan failed: %v", err)
+		}
 		return
 	}
+	if s.lastScanErr != "" {
+		s.lastScanErr = ""
+		log.Printf("Port scan recovered")
+	}
 
 	now := time.Now()
 
-	// Track which services we've seen this scan
-	seenIDs := make(map[string]bool)
-	seenNames := make(map[string]bool)
+	// Track which services we've seen this scan
+	seenIDs := make(map[string]bool)
+	seenNames := make(map[string]bool)
+
+	// Identities still listening, whose records a certificate match must
+	// not take over
+	listening := make(map[string]bool, len(listeners))
+	pids := make(map[int]bool, len(listeners))
+	for _, listener := range listeners {
+		listening[s.identityFor(listener)] = true
+		pids[listener.PID] = true
+	}
+
+	// Published container ports are registered from Docker under the
+	// container's name, not as the process forwarding them on the host.
+	// Container probes use PID 0; their results are dropped when the
+	// container goes away.
+	containers, dockerOK := s.scanContainers()
+	published := make(map[int]bool, len(containers))
+	for _, cs := range containers {
+		listening[containerRecordID(cs)] = true
+		if cs.TargetHost == "127.0.0.1" {
+			published[cs.Port] = true
+		}
+	}
+	if len(containers) > 0 {
+		pids[0] = true
+	}
+	// Forget probe results of processes that stopped listening
+	s.probeCache.Sweep(pids)
+
+	conflicts := make(map[portConflict]bool)
+	defer func() { s.portConflicts = conflicts }()
 
 	for _, listener := range listeners {
-		// Skip our own ports
+		// Skip our own ports. Another process on one of them can't be
+		// proxied, so say why it is missing; each conflict is logged when
+		// it first appears rather than every scan.
 		if listener.Port == s.httpPort || listener.Port == s.httpsPort {
+			if listener.PID != os.Getpid() {
+				key := portConflict{Port: listener.Port, PID: listener.PID}
+				conflicts[key] = true
+				if !s.portConflicts[key] {
+					s.warnPortConflict(listener)
+				}
+			}
 			continue
 		}
 
-		// Skip blacklisted services
-		if s.blacklistStore.IsBlacklisted(listener.ExePath, listener.Args) {
+		// Published container ports are registered from Docker below
+		if published[listener.Port] {
 			continue
 		}
 
-		// Skip PID-blacklisted services
-		if s.blacklistStore.IsBlacklistedPID(listener.PID) {
+		// Skip ports outside --port-range. The scanner still enumerates
+		// every listener; this only saves the probing and registration.
+		if !s.inPortRanges(listener.Port) {
 			continue
 		}
 
-		// Detect protocol (HTTP or HTTPS)
-		proto := probe.DetectProtocol("127.0.0.1", listener.Port)
-		if proto == probe.ProtoNone {
+		// Skip blacklisted services, dropping any that were registered
+		// before they matched the blacklist
+		if s.blacklistStore.IsBlacklisted(listener.ExePath, listener.Args) ||
+			s.blacklistStore.IsBlacklistedPID(listener.PID) {
+			s.unregisterIdentity(s.identityFor(listener))
 			continue
 		}
-		useTLS := proto == probe.ProtoHTTPS
 
 		// Compute identity hash
-		id := naming.ComputeIdentityHash(listener.ExePath, listener.Args)
+		id := s.identityFor(listener)
+
+		// Detect protocol (HTTP or HTTPS) over the candidate paths, including
+		// a configured health path; cached per port and paths, and re-probed
+		// when the TTL expires (never with --probe-changed-only) or the owning
+		// PID changes
+		existing, known := s.store.Get(id)
+		healthPath := ""
+		if known {
+			healthPath = existing.HealthPath
+		}
+		detection := s.probeCache.DetectPaths("127.0.0.1", listener.Port, listener.PID, probe.CandidatePaths(healthPath))
+		if detection.Protocol == probe.ProtoNone {
+			continue
+		}
+		useTLS := detection.Protocol == probe.ProtoHTTPS
+
+		// A TLS backend whose identity changed (e.g. new arguments) but that
+		// presents the same certificate keeps its record and name
+		if !known {
+			if prev := s.matchCertFingerprint(detection.CertFingerprint, listening); prev != nil {
+				if err := s.rekeyService(prev, id); err != nil {
+					log.Printf("Failed to move %s to its new identity: %v", prev.Name, err)
+				} else {
+					log.Printf("Service %s matched by TLS certificate on port %d", prev.Name, listener.Port)
+					existing, known = prev, true
+				}
+			}
+		}
+
 		seenIDs[id] = true
 
 		// Check if we already know this service
-		if existing, ok := s.store.Get(id); ok {
+		if known {
 			seenNames[existing.Name] = true
 
 			// Update if port, PID, or active status changed
@@ -376,13 +1103,27 @@ func (s *Server) discover() {
 				needsSave = true
 			}
 			if existing.PID != listener.PID {
+				// A restart starts the service's metrics afresh, if asked
+				if s.resetMetricsOnRestart && existing.PID != 0 && s.metrics != nil && s.metrics.Reset(existing.Name) {
+					log.Printf("Metrics reset for %s (PID %d -> %d)", existing.Name, existing.PID, listener.PID)
+				}
 				existing.PID = listener.PID
 				needsSave = true
+				// A restarted backend's last health result is stale
+				s.health.Invalidate("127.0.0.1", listener.Port)
 			}
 			if existing.UseTLS != useTLS {
 				existing.UseTLS = useTLS
 				needsSave = true
 			}
+			if existing.ProbePath != detection.Path {
+				existing.ProbePath = detection.Path
+				needsSave = true
+			}
+			if existing.CertFingerprint != detection.CertFingerprint {
+				existing.CertFingerprint = detection.CertFingerprint
+				needsSave = true
+			}
 			if !existing.IsActive {
 				existing.IsActive = true
 				needsSave = true
@@ -400,20 +1141,32 @@ func (s *Server) discover() {
 			// Update runtime service
 			s.mu.Lock()
 			if svc, exists := s.services[existing.Name]; exists {
+				// A proxy built for another target or scheme keeps dialing
+				// it, e.g. after a certificate match on a new port
+				host := existing.EffectiveTargetHost()
+				if svc.Port != listener.Port || svc.TargetHost != host || svc.PID != listener.PID || svc.UseTLS != useTLS {
+					svc.Proxy = nil
+				}
 				svc.Port = listener.Port
+				svc.TargetHost = host
 				svc.PID = listener.PID
 				svc.Cwd = listener.Cwd
-				if svc.UseTLS != useTLS {
-					svc.UseTLS = useTLS
-					svc.Proxy = nil // Reset proxy so it gets recreated with correct scheme
-				}
+				svc.ProbePath = detection.Path
+				svc.UseTLS = useTLS
 			}
 			s.mu.Unlock()
 			continue
 		}
 
-		// Generate name for new service
-		name := s.generator.GenerateName(listener.ExePath, listener.Cwd, listener.Args)
+		// Generate name for new service; names failing the policy are not proxied
+		name, err := s.generator.GenerateName(listener.ExePath, listener.Cwd, listener.Args)
+		if err != nil {
+			if !s.rejected[id] {
+				s.rejected[id] = true
+				log.Printf("Not registering %s on port %d: %v", listener.ExePath, listener.Port, err)
+			}
+			continue
+		}
 
 		// Create record
 		record := &storage.ServiceRecord{
@@ -429,6 +1182,10 @@ func (s *Server) discover() {
 			Keep:        false,
 			Group:       naming.ExtractGroupFromExe(listener.ExePath, name),
 			UseTLS:      useTLS,
+			Source:      storage.SourceDiscovered,
+			ProbePath:   detection.Path,
+
+			CertFingerprint: detection.CertFingerprint,
 		}
 
 		// Save to store
@@ -450,6 +1207,9 @@ func (s *Server) discover() {
 			Args:       listener.Args,
 			Group:      record.Group,
 			UseTLS:     useTLS,
+			Source:     storage.SourceDiscovered,
+			ProbePath:  detection.Path,
+			Recent:     metrics.NewRecentRequests(),
 		}
 		s.mu.Unlock()
 
@@ -470,10 +1230,28 @@ func (s *Server) discover() {
 		}
 	}
 
+	for name := range s.registerContainers(containers, now) {
+		seenNames[name] = true
+	}
+
+	// A rejected listener that went away is logged again if it comes back
+	for id := range s.rejected {
+		if !listening[id] {
+			delete(s.rejected, id)
+		}
+	}
+
 	// Mark services as inactive if not seen
 	s.mu.Lock()
 	for name, svc := range s.services {
+		// Without an answer from Docker, containers keep their state
+		if !dockerOK && svc.Source == storage.SourceDocker {
+			continue
+		}
 		if !seenNames[name] {
+			if svc.Source == storage.SourceDocker {
+				s.probeCache.Invalidate(svc.TargetHost, svc.Port)
+			}
 			if record, ok := s.store.Get(svc.ID); ok && record.IsActive {
 				record.IsActive = false
 				record.LastSeen = now
@@ -492,6 +1270,341 @@ func (s *Server) discover() {
 		}
 	}
 	s.mu.Unlock()
+
+	s.writeExport()
+}
+
+// exportSnapshot returns the JSON snapshot of the current services written
+// to the export file, sorted by name.
+func (s *Server) exportSnapshot() ([]byte, error) {
+	s.mu.RLock()
+	entries := make([]ExportedService, 0, len(s.services))
+	for _, svc := range s.services {
+		scheme := "http"
+		if svc.UseTLS {
+			scheme = "https"
+		}
+		entries = append(entries, ExportedService{
+			Name:   svc.Name,
+			Target: net.JoinHostPort(svc.TargetHost, strconv.Itoa(svc.Port)),
+			Scheme: scheme,
+			Group:  serviceGroup(svc),
+		})
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+
+	data, err := json.MarshalIndent(struct {
+		Services []ExportedService `json:"services"`
+	}{entries}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// writeExport atomically rewrites the export file if the service set changed
+// since the last write. It is a no-op when no export file is configured.
+func (s *Server) writeExport() {
+	if s.exportFile == "" {
+		return
+	}
+
+	s.exportMu.Lock()
+	defer s.exportMu.Unlock()
+	if s.handedOff {
+		return
+	}
+
+	data, err := s.exportSnapshot()
+	if err != nil {
+		log.Printf("Failed to build service export: %v", err)
+		return
+	}
+	if bytes.Equal(data, s.lastExport) {
+		return
+	}
+
+	if err := writeFileAtomic(s.exportFile, data, 0644); err != nil {
+		log.Printf("Failed to write export file %s: %v", s.exportFile, err)
+		return
+	}
+	s.lastExport = data
+}
+
+// writeFileAtomic writes data to a temp file next to path and renames it into
+// place, so readers never observe a partially written file.
+func writeFileAtomic(path string, data []byte, mode os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, ".nameport-export-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpPath := tmp.Name()
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to chmod temp file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to close temp file: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to rename temp file: %w", err)
+	}
+	return nil
+}
+
+// loadServices rebuilds the runtime services from the store. Proxies are
+// recreated on first use so per-service settings take effect; recent requests
+// are kept for services that are still present. Must be called with s.mu held
+// once the server is running.
+func (s *Server) loadServices() {
+	services := make(map[string]*Service)
+	for _, record := range s.store.List() {
+		// Existing names stay taken, even if the name policy would not
+		// generate them now
+		s.generator.Reserve(record.Name)
+
+		// Backfill group for records that don't have one yet
+		if record.Group == "" {
+			record.Group = naming.ExtractGroupFromExe(record.ExePath, record.Name)
+		}
+		svc := &Service{
+			ID:         record.ID,
+			Name:       record.Name,
+			Port:       record.Port,
+			TargetHost: record.EffectiveTargetHost(),
+			PID:        record.PID,
+			ExePath:    record.ExePath,
+			Cwd:        "",
+			Args:       record.Args,
+			Group:      record.Group,
+			UseTLS:     record.UseTLS,
+			Source:     record.Source,
+			Proxy:      nil, // Will be created on first use
+
+			BandwidthLimit:  record.BandwidthLimit,
+			UpstreamTimeout: record.UpstreamTimeout,
+			ProbePath:       record.ProbePath,
+			FlushInterval:   record.FlushInterval,
+			HostHeader:      record.HostHeader,
+			PreserveHost:    record.PreserveHost,
+			Color:           record.Color,
+			Icon:            record.Icon,
+			AuthToken:       record.AuthToken,
+			AuthTokenEnv:    record.AuthTokenEnv,
+			ProxyProtocol:   record.ProxyProtocol,
+			PreferredScheme: record.PreferredScheme,
+			Override:        record.Override,
+			Recent:          metrics.NewRecentRequests(),
+		}
+		if old, ok := s.services[record.Name]; ok && old.ID == record.ID {
+			svc.Cwd = old.Cwd
+			svc.Recent = old.Recent
+		}
+		services[record.Name] = svc
+	}
+	s.services = services
+}
+
+// matchCertFingerprint returns the one discovered record, not currently
+// listening under its own identity, whose backend presented the certificate
+// with the given fingerprint. Several candidates (e.g. apps sharing a
+// certificate) are ambiguous and match nothing.
+func (s *Server) matchCertFingerprint(fingerprint string, listening map[string]bool) *storage.ServiceRecord {
+	var match *storage.ServiceRecord
+	for _, r := range s.store.FindByCertFingerprint(fingerprint) {
+		if listening[r.ID] || r.Source != storage.SourceDiscovered {
+			continue
+		}
+		if match != nil {
+			return nil
+		}
+		match = r
+	}
+	return match
+}
+
+// rekeyService moves a record, and the runtime service proxying it, to a new
+// identity hash
+func (s *Server) rekeyService(record *storage.ServiceRecord, id string) error {
+	oldID := record.ID
+	if err := s.store.ChangeID(oldID, id); err != nil {
+		return err
+	}
+	record.ID = id
+	s.mu.Lock()
+	if svc, ok := s.services[record.Name]; ok && svc.ID == oldID {
+		svc.ID = id
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// reload re-reads the store and blacklist from disk and rebuilds the runtime
+// services, applying changes made with the CLI without a restart
+func (s *Server) reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.store.Reload(); err != nil {
+		return err
+	}
+	if err := s.blacklistStore.Reload(); err != nil {
+		return err
+	}
+
+	previous := s.services
+	s.loadServices()
+	for name := range previous {
+		if _, ok := s.services[name]; !ok {
+			s.generator.ReleaseName(name)
+		}
+	}
+	return nil
+}
+
+// reloadRules re-reads the naming rules, so that services discovered from now
+// on are named by them. Existing services keep their names; nameSuggestions
+// lists the ones the new rules would name differently. It returns the number
+// of rules loaded.
+func (s *Server) reloadRules() (int, error) {
+	engine, err := naming.LoadRuleEngine(naming.UserRulesPath())
+	if err != nil {
+		return 0, err
+	}
+	s.generator.SetRuleEngine(engine)
+	count := len(engine.Rules())
+	log.Printf("Reloaded %d naming rules", count)
+	return count, nil
+}
+
+// NameSuggestion is a discovered service that the current naming rules would
+// name differently
+type NameSuggestion struct {
+	Name      string `json:"name"`
+	Suggested string `json:"suggested"`
+}
+
+// nameSuggestionsLocked lists the discovered, not user-named services whose
+// name the current rules would change, sorted by name. Suggestions that are
+// taken, reserved or rejected by the policy are left out. s.mu must be held.
+func (s *Server) nameSuggestionsLocked() []NameSuggestion {
+	names := make([]string, 0, len(s.services))
+	for name := range s.services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	suggestions := []NameSuggestion{}
+	claimed := make(map[string]bool)
+	policy := s.generator.Policy()
+	for _, name := range names {
+		svc := s.services[name]
+		record, ok := s.store.Get(svc.ID)
+		if !ok || record.UserDefined || record.Source != storage.SourceDiscovered {
+			continue
+		}
+		suggested := s.generator.SuggestName(svc.ExePath, svc.Cwd, svc.Args)
+		if suggested == name || claimed[suggested] || !s.store.IsNameAvailable(suggested) ||
+			s.isDashboardHost(suggested) || policy.Check(suggested) != nil {
+			continue
+		}
+		claimed[suggested] = true
+		suggestions = append(suggestions, NameSuggestion{Name: name, Suggested: suggested})
+	}
+	return suggestions
+}
+
+// applyNameSuggestions renames every service in nameSuggestionsLocked and
+// returns the renames made. The records stay rule-named (not user-defined),
+// so later rule changes can rename them again.
+func (s *Server) applyNameSuggestions() []NameSuggestion {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	applied := []NameSuggestion{}
+	for _, sg := range s.nameSuggestionsLocked() {
+		svc := s.services[sg.Name]
+		if err := s.store.UpdateName(svc.ID, sg.Suggested); err != nil {
+			log.Printf("Failed to rename %s -> %s: %v", sg.Name, sg.Suggested, err)
+			continue
+		}
+		if record, ok := s.store.Get(svc.ID); ok {
+			record.UserDefined = false
+			if err := s.store.Save(record); err != nil {
+				log.Printf("Failed to update service %s: %v", sg.Suggested, err)
+			}
+		}
+
+		delete(s.services, sg.Name)
+		svc.Name = sg.Suggested
+		svc.Group = naming.ExtractGroupFromExe(svc.ExePath, sg.Suggested)
+		s.services[svc.Name] = svc
+		// Hand the old name back and mark the new one as in use
+		s.generator.ReleaseName(sg.Name)
+		s.generator.Reserve(sg.Suggested)
+
+		log.Printf("Renamed %s -> %s (naming rules)", sg.Name, sg.Suggested)
+		applied = append(applied, sg)
+	}
+	return applied
+}
+
+// unregisterIdentity removes the registered service with the given identity
+// hash, if any.
+func (s *Server) unregisterIdentity(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, svc := range s.services {
+		if svc.ID == id {
+			s.removeServiceLocked(svc)
+			return
+		}
+	}
+}
+
+// removeMatchingServices removes every registered service matching entry and
+// returns their names. Used to apply a new blacklist entry immediately.
+func (s *Server) removeMatchingServices(entry *storage.BlacklistEntry) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var removed []string
+	for _, svc := range s.services {
+		if entry.Matches(svc.PID, svc.ExePath, svc.Args) {
+			s.removeServiceLocked(svc)
+			removed = append(removed, svc.Name)
+		}
+	}
+	sort.Strings(removed)
+	return removed
+}
+
+// removeServiceLocked drops a service from the runtime map and the store and
+// frees its name. Must be called with s.mu held.
+func (s *Server) removeServiceLocked(svc *Service) {
+	delete(s.services, svc.Name)
+	if err := s.store.Remove(svc.ID); err != nil {
+		log.Printf("Failed to remove %s from store: %v", svc.Name, err)
+	}
+	s.generator.ReleaseName(svc.Name)
+	s.probeCache.Invalidate(svc.TargetHost, svc.Port)
+	log.Printf("Service removed (blacklisted): %s", svc.Name)
 }
 
 // handleRequest routes HTTP requests to the appropriate service or dashboard
@@ -502,8 +1615,12 @@ func (s *Server) handleRequest(w http.ResponseWriter, r *http.Request) {
 		host = host[:i]
 	}
 
-	// If accessing by IP or localhost without specific subdomain, show dashboard
-	if host == "localhost" || host == "127.0.0.1" || host == "" {
+	// If accessing by IP, localhost without specific subdomain, or the
+	// dashboard's own name, show dashboard
+	if s.isDashboardRequest(r) {
+		if s.serveStatic(w, r) {
+			return
+		}
 		s.serveDashboard(w, r)
 		return
 	}
@@ -513,47 +1630,204 @@ func (s *Server) handleRequest(w http.ResponseWriter, r *http.Request) {
 	s.mu.RUnlock()
 
 	if service == nil {
+		// Browsers still ask the unknown host for its icon
+		if s.serveStatic(w, r) {
+			return
+		}
 		// No service found - show dashboard with message
 		s.serveDashboardWithError(w, r, fmt.Sprintf("No service found for %s", host))
 		return
 	}
 
+	// An active override is proxied through its own proxy; an expired one
+	// is dropped and the original target resumes
+	proxy := &service.Proxy
+	if ov := service.Override; ov != nil {
+		if ov.Active(time.Now()) {
+			proxy = &service.overrideProxy
+		} else {
+			s.expireOverride(service)
+		}
+	}
+
 	// Create proxy on first use
-	if service.Proxy == nil {
-		scheme := "http"
-		if service.UseTLS {
-			scheme = "https"
+	if *proxy == nil {
+		targetHost, port := service.target(time.Now())
+		*proxy = s.newProxy(service, host, targetHost, port)
+	}
+	handler := *proxy
+
+	// Update Host header to match the backend, unless the backend only
+	// accepts a specific Host
+	ctx := context.WithValue(r.Context(), requestStartKey{}, time.Now())
+	if service.ProxyProtocol != "" {
+		if addr, err := netip.ParseAddrPort(r.RemoteAddr); err == nil {
+			ctx = context.WithValue(ctx, clientAddrKey{}, net.TCPAddrFromAddrPort(addr))
 		}
-		targetURL := fmt.Sprintf("%s://%s:%d", scheme, service.TargetHost, service.Port)
-		target, err := url.Parse(targetURL)
-		if err != nil {
-			http.Error(w, "Invalid target URL", http.StatusInternalServerError)
+	}
+	r = r.WithContext(ctx)
+	r.Header.Set("X-Forwarded-Host", r.Host)
+	r.Host = service.upstreamHost(r.Host)
+
+	// Inject configured credentials, never overriding the client's own
+	if r.Header.Get("Authorization") == "" {
+		if token := service.authToken(); token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+
+	// Simulate a slow link if a bandwidth cap is configured
+	if service.BandwidthLimit > 0 {
+		w = throttle.NewWriter(r.Context(), w, service.BandwidthLimit)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// newProxy builds the reverse proxy from a service's host to targetHost:port
+func (s *Server) newProxy(service *Service, host, targetHost string, port int) *httputil.ReverseProxy {
+	proxy := httputil.NewSingleHostReverseProxy(targetURL(service.UseTLS, targetHost, port))
+	proxy.Transport = s.proxyTransport(service)
+	if s.metrics != nil {
+		proxy.Transport = &metrics.MetricsTransport{
+			Wrapped:     proxy.Transport,
+			ServiceName: service.Name,
+			Collector:   s.metrics,
+		}
+	}
+	proxy.FlushInterval = service.FlushInterval
+	// Record a summary of every response for the dashboard's recent view
+	recent := service.Recent
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		recordRecent(recent, resp.Request, resp.StatusCode)
+		return nil
+	}
+	// Custom error handler
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		log.Printf("Proxy error for %s: %v", host, err)
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			recordRecent(recent, r, http.StatusGatewayTimeout)
+			http.Error(w, fmt.Sprintf("Service %s timed out", host), http.StatusGatewayTimeout)
 			return
 		}
+		recordRecent(recent, r, http.StatusBadGateway)
+		http.Error(w, fmt.Sprintf("Service %s unavailable", host), http.StatusBadGateway)
+	}
+	return proxy
+}
 
-		service.Proxy = httputil.NewSingleHostReverseProxy(target)
-		if service.UseTLS {
-			service.Proxy.Transport = &http.Transport{
-				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-			}
+// targetURL is the backend URL proxied to. IPv6 hosts are bracketed, and the
+// URL is built rather than parsed so zones (fe80::1%eth0) survive.
+func targetURL(useTLS bool, host string, port int) *url.URL {
+	scheme := "http"
+	if useTLS {
+		scheme = "https"
+	}
+	return &url.URL{Scheme: scheme, Host: net.JoinHostPort(host, strconv.Itoa(port))}
+}
+
+// expireOverride drops a service's expired override, in memory and in the
+// store, so the original target is proxied again
+func (s *Server) expireOverride(service *Service) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if service.Override == nil {
+		return
+	}
+	log.Printf("Override of %s to %s expired", service.Name, net.JoinHostPort(service.Override.Host, strconv.Itoa(service.Override.Port)))
+	service.Override = nil
+	service.overrideProxy = nil
+	if record, ok := s.store.Get(service.ID); ok && record.Override != nil {
+		record.Override = nil
+		if err := s.store.Save(record); err != nil {
+			log.Printf("Failed to clear override of %s: %v", service.Name, err)
+		}
+	}
+}
+
+// proxyTransport builds the backend transport for a service. It returns nil
+// (http.DefaultTransport) when the service needs neither TLS, a timeout nor
+// a PROXY protocol header.
+func (s *Server) proxyTransport(service *Service) http.RoundTripper {
+	timeout := service.UpstreamTimeout
+	if timeout == 0 {
+		timeout = s.upstreamTimeout
+	}
+	if !service.UseTLS && timeout == 0 && service.ProxyProtocol == "" {
+		return nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = timeout
+	if service.UseTLS {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	if service.ProxyProtocol != "" {
+		// The header describes a single client, so connections are not
+		// shared between requests
+		transport.DisableKeepAlives = true
+		transport.DialContext = proxyProtocolDialer(service.ProxyProtocol)
+	}
+	return transport
+}
+
+// clientAddrKey is the context key holding the address of the client whose
+// request is being proxied.
+type clientAddrKey struct{}
+
+// proxyProtocolDialer returns a DialContext that writes a PROXY protocol
+// header for the proxied request's client before any other traffic (and
+// before the TLS handshake for HTTPS backends).
+func proxyProtocolDialer(version string) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
 		}
-		// Custom error handler
-		service.Proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
-			log.Printf("Proxy error for %s: %v", host, err)
-			http.Error(w, fmt.Sprintf("Service %s unavailable", host), http.StatusBadGateway)
+		src, _ := ctx.Value(clientAddrKey{}).(*net.TCPAddr)
+		dst, _ := ctx.Value(http.LocalAddrContextKey).(*net.TCPAddr)
+		if err := proxyproto.WriteHeader(conn, version, src, dst); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("writing PROXY header: %w", err)
 		}
+		return conn, nil
 	}
+}
 
-	// Update Host header to match the backend
-	r.Header.Set("X-Forwarded-Host", r.Host)
-	r.Host = fmt.Sprintf("%s:%d", service.TargetHost, service.Port)
+// requestStartKey is the context key holding the time a proxied request arrived.
+type requestStartKey struct{}
 
-	service.Proxy.ServeHTTP(w, r)
+// recordRecent adds a summary of a proxied request to the service's recent buffer.
+func recordRecent(recent *metrics.RecentRequests, r *http.Request, status int) {
+	if recent == nil {
+		return
+	}
+	summary := metrics.RequestSummary{
+		Time:   time.Now(),
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Status: status,
+	}
+	if start, ok := r.Context().Value(requestStartKey{}).(time.Time); ok {
+		summary.Time = start
+		summary.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+	}
+	recent.Add(summary)
 }
 
-// serviceURL returns the URL for a service based on current port config and TLS status.
+// serviceURL returns the URL for a service based on current port config, TLS
+// status and the service's preferred scheme. It takes s.mu, so callers must
+// not hold it.
 func (s *Server) serviceURL(name string) string {
-	if s.tlsEnabled {
+	s.mu.RLock()
+	preferred := ""
+	if svc, ok := s.services[name]; ok {
+		preferred = svc.PreferredScheme
+	}
+	s.mu.RUnlock()
+
+	if s.tlsEnabled && preferred != storage.SchemeHTTP {
 		if s.httpsPort == 443 {
 			return fmt.Sprintf("https://%s", name)
 		}
@@ -581,6 +1855,55 @@ func (s *Server) dashboardURL() string {
 	return fmt.Sprintf("http://localhost:%d", s.httpPort)
 }
 
+// routes returns the daemon's HTTP handler: the dashboard and its API, and
+// the proxy for every other host
+func (s *Server) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleRequest)
+	mux.HandleFunc("/api/services", s.handleAPIServices)
+	mux.HandleFunc("/api/services/", s.dashboardOnly(s.handleAPIServiceRecent))
+	mux.HandleFunc("/api/rename", s.handleAPIRename)
+	mux.HandleFunc("/api/blacklist", s.handleAPIBlacklist)
+	mux.HandleFunc("/api/keep", s.handleAPIKeep)
+	mux.HandleFunc("/api/records", s.dashboardOnly(s.handleAPIRecords))
+	mux.HandleFunc("/api/reload", s.dashboardOnly(s.handleAPIReload))
+	mux.HandleFunc("/api/rules/reload", s.dashboardOnly(s.handleAPIRulesReload))
+	mux.HandleFunc("/api/rules/suggestions", s.dashboardOnly(s.handleAPIRulesSuggestions))
+	mux.HandleFunc("/api/rules/apply", s.dashboardOnly(s.handleAPIRulesApply))
+	mux.HandleFunc("/api/metrics", s.dashboardOnly(s.handleAPIMetrics))
+	mux.HandleFunc("/api/metrics/prometheus", s.dashboardOnly(s.handleAPIMetricsPrometheus))
+	mux.HandleFunc("/api/debug/stats", s.dashboardOnly(s.handleAPIDebugStats))
+	mux.HandleFunc("/api/tls/rotate", s.dashboardOnly(s.handleAPITLSRotate))
+	return mux
+}
+
+// dashboardOnly serves h on the dashboard's hosts only. Anywhere else the
+// request is proxied as usual, so a service keeps its own /api/ paths.
+func (s *Server) dashboardOnly(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.isDashboardRequest(r) {
+			s.handleRequest(w, r)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// isDashboardRequest reports whether r is addressed to the dashboard: by IP,
+// plain localhost or the dashboard's own name
+func (s *Server) isDashboardRequest(r *http.Request) bool {
+	host := r.Host
+	if i := strings.LastIndex(host, ":"); i != -1 {
+		host = host[:i]
+	}
+	return host == "localhost" || host == "127.0.0.1" || host == "" || s.isDashboardHost(host)
+}
+
+// isDashboardHost reports whether host is the reserved dashboard name
+func (s *Server) isDashboardHost(host string) bool {
+	return s.dashboardName != "" && strings.EqualFold(host, s.dashboardName)
+}
+
 // findService looks up a service by hostname. It first tries an exact match,
 // then tries the full hostname as a service name (for subdomain-style names
 // like "api.ollama.localhost" which are stored as the full name).
@@ -593,6 +1916,29 @@ func (s *Server) findService(host string) *Service {
 	return nil
 }
 
+// serveStatic serves the embedded dashboard assets and reports whether r was
+// one of them. Only called for the dashboard host and unknown hosts, so a
+// service's own /favicon.ico and /static/ are still proxied.
+func (s *Server) serveStatic(w http.ResponseWriter, r *http.Request) bool {
+	path := r.URL.Path
+	if path == "/favicon.ico" {
+		path = "/static/favicon.ico"
+	}
+	if !strings.HasPrefix(path, "/static/") {
+		return false
+	}
+
+	data, err := fs.ReadFile(staticFiles, strings.TrimPrefix(path, "/"))
+	if err != nil {
+		http.NotFound(w, r)
+		return true
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	http.ServeContent(w, r, filepath.Base(path), time.Time{}, bytes.NewReader(data))
+	return true
+}
+
 // serveDashboard renders the admin dashboard HTML
 func (s *Server) serveDashboard(w http.ResponseWriter, r *http.Request) {
 	s.serveDashboardWithError(w, r, "")
@@ -601,7 +1947,7 @@ func (s *Server) serveDashboard(w http.ResponseWriter, r *http.Request) {
 // serviceGroup returns the effective group for a service
 func serviceGroup(svc *Service) string {
 	if svc.Group != "" {
-		return svc.Group
+		return naming.GroupFor(svc.Name, svc.Group)
 	}
 	return naming.ExtractGroupFromExe(svc.ExePath, svc.Name)
 }
@@ -622,7 +1968,7 @@ func (s *Server) serveDashboardWithError(w http.ResponseWriter, r *http.Request,
 		if gi != gj {
 			return gi < gj
 		}
-		return services[i].Name < services[j].Name
+		return naming.GroupedLess(services[i].Name, services[j].Name, gi)
 	})
 
 	// Build groups for display
@@ -638,20 +1984,39 @@ func (s *Server) serveDashboardWithError(w http.ResponseWriter, r *http.Request,
 
 	groups := make([]ServiceGroup, 0, len(groupOrder))
 	for _, name := range groupOrder {
-		groups = append(groups, ServiceGroup{
+		members := groupMap[name]
+		nested := len(members) > 1
+		for _, svc := range members {
+			if svc.Subdomain() != "" {
+				nested = true
+			}
+		}
+		group := ServiceGroup{
 			Name:     name,
-			Services: groupMap[name],
-		})
+			Services: members,
+			Nested:   nested,
+		}
+		for _, svc := range members {
+			if group.Color == "" {
+				group.Color = svc.Color
+			}
+			if group.Icon == "" {
+				group.Icon = svc.Icon
+			}
+		}
+		groups = append(groups, group)
 	}
 
 	data := struct {
-		Services   []*Service
-		Groups     []ServiceGroup
-		ErrorMsg   string
-		Hostname   string
-		TLSEnabled bool
-		HTTPPort   int
-		HTTPSPort  int
+		Services    []*Service
+		Groups      []ServiceGroup
+		ErrorMsg    string
+		Hostname    string
+		TLSEnabled  bool
+		TLSExpiry   string
+		TLSFailures []metrics.HandshakeFailure
+		HTTPPort    int
+		HTTPSPort   int
 	}{
 		Services:   services,
 		Groups:     groups,
@@ -661,6 +2026,10 @@ func (s *Server) serveDashboardWithError(w http.ResponseWriter, r *http.Request,
 		HTTPPort:   s.httpPort,
 		HTTPSPort:  s.httpsPort,
 	}
+	if s.tlsEnabled {
+		data.TLSExpiry = s.tlsCA.InterCert.NotAfter.Format("2006-01-02")
+		data.TLSFailures = s.recentHandshakeFailures()
+	}
 
 	tmpl := template.Must(template.New("dashboard").Parse(dashboardHTML))
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
@@ -677,67 +2046,83 @@ func (s *Server) handleAPIServices(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Encode copies: discovery and the health checker keep updating the
+	// shared services
 	s.mu.RLock()
-	services := make([]*Service, 0, len(s.services))
+	services := make([]Service, 0, len(s.services))
+	targets := make([]probe.HealthTarget, 0, len(s.services))
 	for _, svc := range s.services {
-		services = append(services, svc)
+		services = append(services, *svc)
+		targets = append(targets, s.healthTarget(svc))
 	}
 	s.mu.RUnlock()
 
-	// Check health of each service
+	// Health comes from the shared cache; only services the background
+	// checker has not seen yet (or not recently) are checked now. HTTP/3
+	// availability is noted; the service is still proxied over HTTP/1.1 or
+	// HTTP/2.
 	type ServiceWithHealth struct {
-		*Service
+		Service
 		Healthy    bool   `json:"healthy"`
 		StatusCode int    `json:"status_code"`
 		StatusText string `json:"status_text"`
 		Protocol   string `json:"protocol"`
+		HTTP3      bool   `json:"HTTP3Advertised"`
 	}
 
 	result := make([]ServiceWithHealth, 0, len(services))
-	for _, svc := range services {
+	for i, svc := range services {
+		st := s.health.Status(targets[i])
+
 		proto := "http"
-		if svc.UseTLS {
+		if targets[i].TLS {
 			proto = "https"
 		}
-		swh := ServiceWithHealth{
+		result = append(result, ServiceWithHealth{
 			Service:    svc,
-			Healthy:    false,
-			StatusCode: 0,
-			StatusText: "unknown",
+			Healthy:    st.Healthy,
+			StatusCode: st.StatusCode,
+			StatusText: st.StatusText,
 			Protocol:   proto,
-		}
+			HTTP3:      st.HTTP3,
+		})
+	}
 
-		// Quick health check
-		client := &http.Client{Timeout: 2 * time.Second}
-		if svc.UseTLS {
-			client.Transport = &http.Transport{
-				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-			}
-		}
-		targetHost := svc.TargetHost
-		if targetHost == "" {
-			targetHost = "127.0.0.1"
-		}
-		scheme := "http"
-		if svc.UseTLS {
-			scheme = "https"
-		}
-		resp, err := client.Get(fmt.Sprintf("%s://%s:%d", scheme, targetHost, svc.Port))
-		if err != nil {
-			swh.StatusText = "offline"
-		} else {
-			resp.Body.Close()
-			swh.StatusCode = resp.StatusCode
-			swh.StatusText = resp.Status
-			// Consider healthy if status is 2xx or 3xx
-			swh.Healthy = resp.StatusCode >= 200 && resp.StatusCode < 400
-		}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// handleAPIServiceRecent returns the recent requests for a service at
+// /api/services/{name}/recent
+func (s *Server) handleAPIServiceRecent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	rest := strings.TrimPrefix(r.URL.Path, "/api/services/")
+	name, ok := strings.CutSuffix(rest, "/recent")
+	if !ok || name == "" || strings.Contains(name, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.mu.RLock()
+	service := s.findService(name)
+	s.mu.RUnlock()
+
+	if service == nil {
+		http.Error(w, "Service not found", http.StatusNotFound)
+		return
+	}
 
-		result = append(result, swh)
+	entries := []metrics.RequestSummary{}
+	if service.Recent != nil {
+		entries = service.Recent.Entries()
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(result)
+	json.NewEncoder(w).Encode(entries)
 }
 
 // handleAPIRename handles rename requests
@@ -746,6 +2131,10 @@ func (s *Server) handleAPIRename(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	if !s.allowMutation(r) {
+		http.Error(w, "Forbidden: read-only for remote clients", http.StatusForbidden)
+		return
+	}
 
 	var req struct {
 		OldName string `json:"oldName"`
@@ -757,9 +2146,16 @@ func (s *Server) handleAPIRename(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Ensure .localhost suffix
-	if !strings.HasSuffix(req.NewName, ".localhost") {
-		req.NewName = req.NewName + ".localhost"
+	// Normalize to a valid .localhost name
+	newName, err := naming.NormalizeName(req.NewName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.NewName = newName
+	if s.isDashboardHost(req.NewName) {
+		http.Error(w, fmt.Sprintf("%s is reserved for the dashboard", req.NewName), http.StatusConflict)
+		return
 	}
 
 	// Find service by old name
@@ -792,6 +2188,7 @@ func (s *Server) handleAPIRename(w http.ResponseWriter, r *http.Request) {
 	s.services[service.Name] = service
 
 	log.Printf("Renamed %s -> %s", req.OldName, req.NewName)
+	go s.writeExport()
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
@@ -803,6 +2200,10 @@ func (s *Server) handleAPIBlacklist(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	if !s.allowMutation(r) {
+		http.Error(w, "Forbidden: read-only for remote clients", http.StatusForbidden)
+		return
+	}
 
 	var req struct {
 		Type  string `json:"type"` // "pid", "path", "pattern"
@@ -822,10 +2223,17 @@ func (s *Server) handleAPIBlacklist(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("Blacklist added: [%s] %s = %s", entry.ID, entry.Type, entry.Value)
 
+	// Stop proxying matching services right away instead of on the next scan
+	removed := s.removeMatchingServices(entry)
+	if len(removed) > 0 {
+		go s.writeExport()
+	}
+
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"status":  "ok",
 		"id":      entry.ID,
+		"removed": removed,
 		"message": fmt.Sprintf("Blacklisted %s: %s", req.Type, req.Value),
 	})
 }
@@ -836,6 +2244,10 @@ func (s *Server) handleAPIKeep(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	if !s.allowMutation(r) {
+		http.Error(w, "Forbidden: read-only for remote clients", http.StatusForbidden)
+		return
+	}
 
 	var req struct {
 		Name string `json:"name"`
@@ -878,6 +2290,294 @@ func (s *Server) handleAPIKeep(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
 
+// handleAPIRecords returns the daemon's in-memory service records, as used by
+// `nameport diff` to detect drift from the store on disk
+func (s *Server) handleAPIRecords(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	records := s.store.List()
+	redacted := make([]*storage.ServiceRecord, 0, len(records))
+	for _, r := range records {
+		redacted = append(redacted, r.Redacted())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(redacted)
+}
+
+// handleAPIReload re-reads the store and blacklist from disk
+func (s *Server) handleAPIReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.allowMutation(r) {
+		http.Error(w, "Forbidden: read-only for remote clients", http.StatusForbidden)
+		return
+	}
+
+	if err := s.reload(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.mu.RLock()
+	count := len(s.services)
+	s.mu.RUnlock()
+
+	log.Printf("Reloaded %d services from disk", count)
+	go s.writeExport()
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":   "ok",
+		"services": count,
+	})
+}
+
+// handleAPIRulesReload re-reads the naming rules
+func (s *Server) handleAPIRulesReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.allowMutation(r) {
+		http.Error(w, "Forbidden: read-only for remote clients", http.StatusForbidden)
+		return
+	}
+
+	count, err := s.reloadRules()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "ok",
+		"rules":  count,
+	})
+}
+
+// handleAPIRulesSuggestions lists the services the current naming rules
+// would rename
+func (s *Server) handleAPIRulesSuggestions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mu.RLock()
+	suggestions := s.nameSuggestionsLocked()
+	s.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(suggestions)
+}
+
+// handleAPIRulesApply renames the services listed by
+// /api/rules/suggestions
+func (s *Server) handleAPIRulesApply(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.allowMutation(r) {
+		http.Error(w, "Forbidden: read-only for remote clients", http.StatusForbidden)
+		return
+	}
+
+	applied := s.applyNameSuggestions()
+	if len(applied) > 0 {
+		go s.writeExport()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(applied)
+}
+
+// handleAPIMetrics returns traffic metrics for every service that has been
+// proxied since the daemon started
+func (s *Server) handleAPIMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	snapshots := make([]*metrics.MetricsSnapshot, 0)
+	if s.metrics != nil {
+		for name := range s.metrics.GetAllMetrics() {
+			if snap := s.metrics.Snapshot(name); snap != nil {
+				if s.handshakes != nil {
+					if f, ok := s.handshakes.Failure(name); ok {
+						snap.TLSHandshakeFailures = f.Count
+					}
+				}
+				snapshots = append(snapshots, snap)
+			}
+		}
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].ServiceName < snapshots[j].ServiceName
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshots)
+}
+
+// handleAPIMetricsPrometheus serves the same traffic metrics, plus response
+// time histograms, in the Prometheus text format
+func (s *Server) handleAPIMetricsPrometheus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", metrics.PrometheusContentType)
+	if s.metrics != nil {
+		metrics.WritePrometheus(w, s.metrics)
+	}
+}
+
+// handshakeWarnWindow is how recent a failed TLS handshake must be for the
+// dashboard to warn about it
+const handshakeWarnWindow = 10 * time.Minute
+
+// recentHandshakeFailures returns the server names with TLS handshake
+// failures inside handshakeWarnWindow
+func (s *Server) recentHandshakeFailures() []metrics.HandshakeFailure {
+	if s.handshakes == nil {
+		return nil
+	}
+	var recent []metrics.HandshakeFailure
+	for _, f := range s.handshakes.Failures() {
+		if time.Since(f.LastSeen) < handshakeWarnWindow {
+			recent = append(recent, f)
+		}
+	}
+	return recent
+}
+
+// handleAPIDebugStats returns daemon internals useful when troubleshooting,
+// including failed TLS handshakes per server name
+func (s *Server) handleAPIDebugStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mu.RLock()
+	services := len(s.services)
+	s.mu.RUnlock()
+
+	stats := struct {
+		Version              string                     `json:"version"`
+		Services             int                        `json:"services"`
+		Goroutines           int                        `json:"goroutines"`
+		HTTPPort             int                        `json:"http_port"`
+		HTTPSPort            int                        `json:"https_port"`
+		TLSEnabled           bool                       `json:"tls_enabled"`
+		TLSHandshakeFailures []metrics.HandshakeFailure `json:"tls_handshake_failures"`
+	}{
+		Version:              version.String(),
+		Services:             services,
+		Goroutines:           runtime.NumGoroutine(),
+		HTTPPort:             s.httpPort,
+		HTTPSPort:            s.httpsPort,
+		TLSEnabled:           s.tlsEnabled,
+		TLSHandshakeFailures: []metrics.HandshakeFailure{},
+	}
+	if s.handshakes != nil {
+		stats.TLSHandshakeFailures = s.handshakes.Failures()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// allowMutation reports whether r may change the daemon's state. With
+// --remote-read-only only loopback clients may; others can still view the
+// dashboard and /api/services.
+func (s *Server) allowMutation(r *http.Request) bool {
+	return !s.remoteReadOnly || isLoopbackAddr(r.RemoteAddr)
+}
+
+// isLoopbackAddr reports whether remoteAddr (host:port) is a loopback address
+func isLoopbackAddr(remoteAddr string) bool {
+	addr, err := netip.ParseAddrPort(remoteAddr)
+	return err == nil && addr.Addr().Unmap().IsLoopback()
+}
+
+// authorized reports whether r carries the daemon's API token, either as a
+// bearer token or in the X-Nameport-Token header.
+func (s *Server) authorized(r *http.Request) bool {
+	if s.apiToken == "" {
+		return false
+	}
+	token := r.Header.Get("X-Nameport-Token")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.apiToken)) == 1
+}
+
+// fromLocalDashboard reports whether r is a same-origin request made by the
+// dashboard from this machine. The dashboard never sees the API token, so its
+// privileged actions are accepted on that basis instead. The request must be
+// addressed to a dashboard host, since pages of proxied services share the
+// .localhost origins, and the Origin check keeps other sites open in the same
+// browser from posting to them.
+func (s *Server) fromLocalDashboard(r *http.Request) bool {
+	if !isLoopbackAddr(r.RemoteAddr) || !s.isDashboardRequest(r) {
+		return false
+	}
+	if site := r.Header.Get("Sec-Fetch-Site"); site != "" && site != "same-origin" {
+		return false
+	}
+	origin, err := url.Parse(r.Header.Get("Origin"))
+	return err == nil && origin.Host != "" && origin.Host == r.Host
+}
+
+// handleAPITLSRotate rotates the intermediate CA of the running daemon and
+// drops cached leaf certificates so new ones chain to it
+func (s *Server) handleAPITLSRotate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.allowMutation(r) {
+		http.Error(w, "Forbidden: read-only for remote clients", http.StatusForbidden)
+		return
+	}
+	if !s.authorized(r) && !s.fromLocalDashboard(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !s.tlsEnabled {
+		http.Error(w, "TLS is not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	if err := s.tlsIssuer.Rotate(); err != nil {
+		log.Printf("Intermediate CA rotation failed: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	inter := s.tlsCA.InterCert
+	log.Printf("Intermediate CA rotated (serial %x, expires %s)", inter.SerialNumber, inter.NotAfter.Format("2006-01-02"))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":              "ok",
+		"intermediate_serial": fmt.Sprintf("%x", inter.SerialNumber),
+		"intermediate_expiry": inter.NotAfter,
+	})
+}
+
 // dashboardHTML is the admin dashboard template
 const dashboardHTML = `<!DOCTYPE html>
 <html lang="en">
@@ -885,6 +2585,7 @@ const dashboardHTML = `<!DOCTYPE html>
     <meta charset="UTF-8">
     <meta name="viewport" content="width=device-width, initial-scale=1.0">
     <title>nameport</title>
+    <link rel="icon" type="image/png" href="/static/favicon.png">
     <style>
         * { box-sizing: border-box; margin: 0; padding: 0; }
         body {
@@ -986,6 +2687,9 @@ const dashboardHTML = `<!DOCTYPE html>
         tr.group-member td:first-child {
             padding-left: 32px;
         }
+        tr.group-member.subdomain td:first-child {
+            padding-left: 52px;
+        }
         .group-count {
             font-weight: normal;
             color: #888;
@@ -1080,6 +2784,36 @@ const dashboardHTML = `<!DOCTYPE html>
             white-space: nowrap;
             display: block;
         }
+        tr.recent-row td {
+            background: #fafbfc;
+            padding: 6px 12px 12px 32px;
+        }
+        .recent-table {
+            width: 100%;
+            font-family: 'Monaco', 'Menlo', 'Courier New', monospace;
+            font-size: 0.75em;
+        }
+        .recent-table td {
+            padding: 2px 8px;
+            border-bottom: none;
+        }
+        .recent-empty {
+            color: #888;
+            font-size: 0.85em;
+        }
+        .service-icon {
+            font-size: 1.1em;
+            margin-right: 4px;
+        }
+        .source-badge {
+            display: inline-block;
+            margin-top: 3px;
+            padding: 1px 6px;
+            font-size: 0.7em;
+            color: #666;
+            background: #eef1f5;
+            border-radius: 3px;
+        }
         .keep-checkbox {
             display: flex;
             align-items: center;
@@ -1167,6 +2901,21 @@ const dashboardHTML = `<!DOCTYPE html>
             outline: none;
             border-color: #2196f3;
         }
+        .tls-panel {
+            margin-top: 24px;
+        }
+        .tls-body {
+            display: flex;
+            align-items: center;
+            justify-content: space-between;
+            padding: 16px 24px;
+            font-size: 0.9em;
+        }
+        .tls-warning {
+            padding: 8px 24px 16px;
+            font-size: 0.9em;
+            color: #e65100;
+        }
         .modal-actions {
             display: flex;
             gap: 10px;
@@ -1208,31 +2957,39 @@ const dashboardHTML = `<!DOCTYPE html>
                 </thead>
                 <tbody>
                     {{range .Groups}}
-                    {{if gt (len .Services) 1}}
+                    {{if .Nested}}
                     <tr class="group-header" onclick="toggleGroup('{{.Name}}')">
-                        <td colspan="7">
+                        <td colspan="7"{{if .Color}} style="border-left: 4px solid {{.Color}}"{{end}}>
                             <span class="group-toggle" id="toggle-{{.Name}}">&#9660;</span>
+                            {{if .Icon}}<span class="service-icon">{{.Icon}}</span>{{end}}
                             {{.Name}}
                             <span class="group-count">({{len .Services}} services)</span>
                         </td>
                     </tr>
                     {{end}}
                     {{$groupName := .Name}}
-                    {{$groupSize := len .Services}}
+                    {{$nested := .Nested}}
                     {{range .Services}}
-                    <tr data-name="{{.Name}}" data-group="{{$groupName}}" id="row-{{.Name}}" class="{{if gt $groupSize 1}}group-member{{end}}">
-                        <td>
+                    <tr data-name="{{.Name}}" data-group="{{$groupName}}" id="row-{{.Name}}" class="{{if $nested}}group-member{{if .Subdomain}} subdomain{{end}}{{end}}">
+                        <td{{if .Color}} style="border-left: 4px solid {{.Color}}"{{end}}>
                             <div class="name-cell">
                                 <span class="status-dot ok" title="Origin: {{if .UseTLS}}HTTPS{{else}}HTTP{{end}}"></span>
-                                {{if $.TLSEnabled}}
+                                {{if .Icon}}<span class="service-icon">{{.Icon}}</span>{{end}}
+                                {{if and $.TLSEnabled (ne .PreferredScheme "http")}}
                                 <div class="service-links">
                                     {{if eq $.HTTPSPort 443}}<a href="https://{{.Name}}" class="service-link" target="_blank" id="link-{{.Name}}">&#x1f512; https://{{.Name}}</a>{{else}}<a href="https://{{.Name}}:{{$.HTTPSPort}}" class="service-link" target="_blank" id="link-{{.Name}}">&#x1f512; https://{{.Name}}:{{$.HTTPSPort}}</a>{{end}}
-                                    {{if eq $.HTTPPort 80}}<a href="http://{{.Name}}" class="service-link-secondary" target="_blank">http://{{.Name}}</a>{{else}}<a href="http://{{.Name}}:{{$.HTTPPort}}" class="service-link-secondary" target="_blank">http://{{.Name}}:{{$.HTTPPort}}</a>{{end}}
+                                    {{if ne .PreferredScheme "https"}}{{if eq $.HTTPPort 80}}<a href="http://{{.Name}}" class="service-link-secondary" target="_blank">http://{{.Name}}</a>{{else}}<a href="http://{{.Name}}:{{$.HTTPPort}}" class="service-link-secondary" target="_blank">http://{{.Name}}:{{$.HTTPPort}}</a>{{end}}{{end}}
+                                </div>
+                                {{else if $.TLSEnabled}}
+                                <div class="service-links">
+                                    {{if eq $.HTTPPort 80}}<a href="http://{{.Name}}" class="service-link" target="_blank" id="link-{{.Name}}">http://{{.Name}}</a>{{else}}<a href="http://{{.Name}}:{{$.HTTPPort}}" class="service-link" target="_blank" id="link-{{.Name}}">http://{{.Name}}:{{$.HTTPPort}}</a>{{end}}
+                                    {{if eq $.HTTPSPort 443}}<a href="https://{{.Name}}" class="service-link-secondary" target="_blank">&#x1f512; https://{{.Name}}</a>{{else}}<a href="https://{{.Name}}:{{$.HTTPSPort}}" class="service-link-secondary" target="_blank">&#x1f512; https://{{.Name}}:{{$.HTTPSPort}}</a>{{end}}
                                 </div>
                                 {{else}}
                                 {{if eq $.HTTPPort 80}}<a href="http://{{.Name}}" class="service-link" target="_blank" id="link-{{.Name}}">http://{{.Name}}</a>{{else}}<a href="http://{{.Name}}:{{$.HTTPPort}}" class="service-link" target="_blank" id="link-{{.Name}}">http://{{.Name}}:{{$.HTTPPort}}</a>{{end}}
                                 {{end}}
                                 <button class="btn-icon" onclick="openRenameModal('{{.Name}}')" title="Rename">Edit</button>
+                                <button class="btn-icon" onclick="toggleRecent('{{.Name}}')" title="Show recent requests">Recent</button>
                             </div>
                         </td>
                         <td>
@@ -1240,7 +2997,7 @@ const dashboardHTML = `<!DOCTYPE html>
                         </td>
                         <td>{{.Port}}</td>
                         <td>{{.PID}}</td>
-                        <td><pre class="command">{{.ExePath}}</pre></td>
+                        <td><pre class="command">{{.ExePath}}</pre>{{if .Source}}<span class="source-badge" title="Source">{{.Source}}</span>{{end}}{{if .HTTP3Advertised}}<span class="source-badge" title="Advertises HTTP/3 via Alt-Svc">h3</span>{{end}}</td>
                         <td>
                             <label class="keep-checkbox">
                                 <input type="checkbox" id="keep-{{.Name}}" onchange="toggleKeep('{{.Name}}')">
@@ -1251,6 +3008,9 @@ const dashboardHTML = `<!DOCTYPE html>
                             <button class="btn btn-danger" onclick="openBlacklistModal('{{.Name}}', {{.PID}}, '{{.ExePath}}')">Blacklist</button>
                         </td>
                     </tr>
+                    <tr class="recent-row" data-group="{{$groupName}}" id="recent-{{.Name}}" style="display:none">
+                        <td colspan="7"><div class="recent-empty">Loading...</div></td>
+                    </tr>
                     {{end}}
                     {{end}}
                 </tbody>
@@ -1262,6 +3022,21 @@ const dashboardHTML = `<!DOCTYPE html>
             </div>
             {{end}}
         </div>
+
+        {{if .TLSEnabled}}
+        <div class="card tls-panel">
+            <div class="card-header">
+                <h2>TLS</h2>
+            </div>
+            <div class="tls-body">
+                <span>Intermediate CA expires <strong id="tlsExpiry">{{.TLSExpiry}}</strong></span>
+                <button class="btn" onclick="rotateCA()">Rotate CA</button>
+            </div>
+            {{range .TLSFailures}}
+            <div class="tls-warning">&#9888; TLS handshakes failing for <strong>{{if .ServerName}}{{.ServerName}}{{else}}clients without SNI{{end}}</strong>: {{.Count}} failed, last: {{.LastError}}</div>
+            {{end}}
+        </div>
+        {{end}}
     </div>
 
     <!-- Rename Modal -->
@@ -1344,6 +3119,11 @@ const dashboardHTML = `<!DOCTYPE html>
             members.forEach(row => {
                 row.style.display = collapsed ? 'none' : '';
             });
+            if (collapsed) {
+                document.querySelectorAll('tr.recent-row[data-group="' + groupName + '"]').forEach(row => {
+                    row.style.display = 'none';
+                });
+            }
             if (toggle) {
                 if (collapsed) {
                     toggle.classList.add('collapsed');
@@ -1353,6 +3133,36 @@ const dashboardHTML = `<!DOCTYPE html>
             }
         }
 
+        async function toggleRecent(name) {
+            const row = document.getElementById('recent-' + name);
+            if (!row) return;
+            if (row.style.display !== 'none') {
+                row.style.display = 'none';
+                return;
+            }
+            row.style.display = '';
+            const cell = row.querySelector('td');
+            try {
+                const response = await fetch('/api/services/' + encodeURIComponent(name) + '/recent');
+                const entries = await response.json();
+                if (!entries.length) {
+                    cell.innerHTML = '<div class="recent-empty">No requests yet.</div>';
+                    return;
+                }
+                const table = document.createElement('table');
+                table.className = 'recent-table';
+                entries.slice().reverse().forEach(e => {
+                    const tr = table.insertRow();
+                    [new Date(e.time).toLocaleTimeString(), e.method, e.path, e.status, e.duration_ms.toFixed(1) + ' ms']
+                        .forEach(v => { tr.insertCell().textContent = v; });
+                });
+                cell.innerHTML = '';
+                cell.appendChild(table);
+            } catch (err) {
+                cell.innerHTML = '<div class="recent-empty">Failed to load recent requests.</div>';
+            }
+        }
+
         function openRenameModal(name) {
             currentService.oldName = name;
             document.getElementById('currentName').value = name;
@@ -1408,6 +3218,23 @@ const dashboardHTML = `<!DOCTYPE html>
             localStorage.setItem('keptServices', JSON.stringify(keptServices));
         }
 
+        async function rotateCA() {
+            if (!confirm('Rotate the intermediate CA? Existing connections keep working; new certificates will chain to the new intermediate.')) return;
+            try {
+                const response = await fetch('/api/tls/rotate', {
+                    method: 'POST'
+                });
+                if (response.ok) {
+                    const result = await response.json();
+                    document.getElementById('tlsExpiry').textContent = result.intermediate_expiry.substring(0, 10);
+                } else {
+                    alert('Failed to rotate CA: ' + await response.text());
+                }
+            } catch (err) {
+                alert('Error: ' + err.message);
+            }
+        }
+
         async function confirmRename() {
             const newName = document.getElementById('newName').value;
             if (!newName) return;
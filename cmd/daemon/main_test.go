@@ -0,0 +1,2020 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"nameport/internal/metrics"
+	"nameport/internal/naming"
+	"nameport/internal/notify"
+	"nameport/internal/portscan"
+	"nameport/internal/probe"
+	"nameport/internal/proxyproto"
+	"nameport/internal/storage"
+	"nameport/internal/tls/ca"
+	"nameport/internal/tls/issuer"
+	"nameport/internal/tls/policy"
+)
+
+// newTestServer creates a Server backed by temporary stores.
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	dir := t.TempDir()
+
+	store, err := storage.NewStore(filepath.Join(dir, "services.json"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	blacklistStore, err := storage.NewBlacklistStore(filepath.Join(dir, "blacklist.json"))
+	if err != nil {
+		t.Fatalf("NewBlacklistStore: %v", err)
+	}
+
+	return &Server{
+		store:          store,
+		blacklistStore: blacklistStore,
+		generator:      naming.NewGeneratorWithEngine(naming.NewRuleEngineFromRules(nil)),
+		notifyManager:  notify.NewManager(notify.Config{Enabled: false}, nil),
+		probeCache:     probe.NewProbeCache(probe.DefaultCacheTTL),
+		services:       make(map[string]*Service),
+		rejected:       make(map[string]bool),
+		pollInterval:   time.Second,
+		httpPort:       8080,
+		httpsPort:      8443,
+		metrics:        metrics.NewCollector(),
+		handshakes:     metrics.NewHandshakeTracker(),
+		health:         probe.NewHealthCache(0),
+	}
+}
+
+// addTestService registers a service named name that proxies to backendURL.
+func addTestService(t *testing.T, srv *Server, name, backendURL string) *Service {
+	t.Helper()
+	u, err := url.Parse(backendURL)
+	if err != nil {
+		t.Fatalf("parse backend URL: %v", err)
+	}
+	host, portStr, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		t.Fatalf("split backend host: %v", err)
+	}
+	port, _ := strconv.Atoi(portStr)
+
+	svc := &Service{
+		ID:         "test-" + name,
+		Name:       name,
+		Port:       port,
+		TargetHost: host,
+		UseTLS:     u.Scheme == "https",
+		Recent:     metrics.NewRecentRequests(),
+	}
+	srv.services[name] = svc
+	return svc
+}
+
+// proxyGet sends a GET for path to the named service through handleRequest.
+func proxyGet(srv *Server, name, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "http://"+name+path, nil)
+	req.Host = name
+	rec := httptest.NewRecorder()
+	srv.handleRequest(rec, req)
+	return rec
+}
+
+func TestRecentRequests_RecordedInOrder(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case "/boom":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer backend.Close()
+
+	srv := newTestServer(t)
+	addTestService(t, srv, "app.localhost", backend.URL)
+
+	paths := []string{"/", "/missing", "/boom", "/ok"}
+	for _, p := range paths {
+		proxyGet(srv, "app.localhost", p)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/services/app.localhost/recent", nil)
+	rec := httptest.NewRecorder()
+	srv.handleAPIServiceRecent(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+
+	var entries []metrics.RequestSummary
+	if err := json.NewDecoder(rec.Body).Decode(&entries); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(entries) != len(paths) {
+		t.Fatalf("got %d entries, want %d", len(entries), len(paths))
+	}
+
+	wantStatus := []int{200, 404, 500, 200}
+	for i, e := range entries {
+		if e.Path != paths[i] {
+			t.Errorf("entries[%d].Path = %s, want %s", i, e.Path, paths[i])
+		}
+		if e.Status != wantStatus[i] {
+			t.Errorf("entries[%d].Status = %d, want %d", i, e.Status, wantStatus[i])
+		}
+		if e.Method != http.MethodGet {
+			t.Errorf("entries[%d].Method = %s, want GET", i, e.Method)
+		}
+	}
+}
+
+func TestRecentRequests_UnknownService(t *testing.T) {
+	srv := newTestServer(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/services/nope.localhost/recent", nil)
+	rec := httptest.NewRecorder()
+	srv.handleAPIServiceRecent(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", rec.Code)
+	}
+}
+
+func TestUpstreamTimeout_PerService(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	srv := newTestServer(t)
+	impatient := addTestService(t, srv, "impatient.localhost", backend.URL)
+	impatient.UpstreamTimeout = 50 * time.Millisecond
+	addTestService(t, srv, "patient.localhost", backend.URL)
+
+	start := time.Now()
+	rec := proxyGet(srv, "impatient.localhost", "/")
+	elapsed := time.Since(start)
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("impatient status = %d, want %d", rec.Code, http.StatusGatewayTimeout)
+	}
+	if elapsed >= 300*time.Millisecond {
+		t.Errorf("impatient request took %v, expected to fail before the backend answered", elapsed)
+	}
+
+	rec = proxyGet(srv, "patient.localhost", "/")
+	if rec.Code != http.StatusOK {
+		t.Errorf("patient status = %d, want 200", rec.Code)
+	}
+}
+
+func TestUpstreamTimeout_ServerDefault(t *testing.T) {
+	srv := newTestServer(t)
+	srv.upstreamTimeout = time.Minute
+
+	svc := &Service{}
+	tr, ok := srv.proxyTransport(svc).(*http.Transport)
+	if !ok || tr.ResponseHeaderTimeout != time.Minute {
+		t.Fatalf("expected server default timeout, got %+v", tr)
+	}
+
+	svc.UpstreamTimeout = 5 * time.Second
+	tr = srv.proxyTransport(svc).(*http.Transport)
+	if tr.ResponseHeaderTimeout != 5*time.Second {
+		t.Errorf("ResponseHeaderTimeout = %v, want 5s", tr.ResponseHeaderTimeout)
+	}
+}
+
+func TestAPITLSRotate(t *testing.T) {
+	srv := newTestServer(t)
+	srv.apiToken = "secret"
+
+	c, err := ca.NewCA(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewCA: %v", err)
+	}
+	if err := c.Init(); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	srv.tlsCA = c
+	srv.tlsIssuer = issuer.NewIssuer(c, policy.NewPolicy())
+	srv.tlsEnabled = true
+
+	if _, err := srv.tlsIssuer.GetCertificate(&tls.ClientHelloInfo{ServerName: "app.localhost"}); err != nil {
+		t.Fatalf("GetCertificate: %v", err)
+	}
+	oldSerial := fmt.Sprintf("%x", c.InterCert.SerialNumber)
+
+	// Without the token the CA must not be touched.
+	req := httptest.NewRequest(http.MethodPost, "/api/tls/rotate", nil)
+	rec := httptest.NewRecorder()
+	srv.handleAPITLSRotate(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("unauthenticated status = %d, want 401", rec.Code)
+	}
+	if srv.tlsIssuer.Len() != 1 {
+		t.Fatal("unauthenticated request cleared the cache")
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/tls/rotate", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	srv.handleAPITLSRotate(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp struct {
+		Serial string    `json:"intermediate_serial"`
+		Expiry time.Time `json:"intermediate_expiry"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Serial == oldSerial {
+		t.Error("intermediate serial did not change")
+	}
+	if !resp.Expiry.Equal(c.InterCert.NotAfter) {
+		t.Errorf("expiry = %v, want %v", resp.Expiry, c.InterCert.NotAfter)
+	}
+	if srv.tlsIssuer.Len() != 0 {
+		t.Errorf("issuer cache has %d entries after rotation, want 0", srv.tlsIssuer.Len())
+	}
+}
+
+func TestLoadOrCreateAPIToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nameport", "api-token")
+
+	token, err := loadOrCreateAPIToken(path)
+	if err != nil {
+		t.Fatalf("loadOrCreateAPIToken: %v", err)
+	}
+	if len(token) != 64 {
+		t.Errorf("token length = %d, want 64", len(token))
+	}
+
+	again, err := loadOrCreateAPIToken(path)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if again != token {
+		t.Error("token should persist across loads")
+	}
+}
+
+func TestServeDashboard_TLSPanel(t *testing.T) {
+	srv := newTestServer(t)
+	srv.apiToken = "secret"
+	addTestService(t, srv, "app.localhost", "http://127.0.0.1:3000")
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/", nil)
+	rec := httptest.NewRecorder()
+	srv.serveDashboard(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if strings.Contains(rec.Body.String(), "Rotate CA") {
+		t.Error("TLS panel should be hidden when TLS is disabled")
+	}
+
+	c, err := ca.NewCA(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewCA: %v", err)
+	}
+	if err := c.Init(); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	srv.tlsCA = c
+	srv.tlsEnabled = true
+
+	rec = httptest.NewRecorder()
+	srv.serveDashboard(rec, req)
+	if !strings.Contains(rec.Body.String(), "Rotate CA") {
+		t.Error("expected TLS panel with rotate button")
+	}
+	if strings.Contains(rec.Body.String(), srv.apiToken) {
+		t.Error("dashboard HTML reveals the API token")
+	}
+}
+
+func TestAPITLSRotate_FromDashboard(t *testing.T) {
+	srv := newTestServer(t)
+	srv.apiToken = "secret"
+	c, err := ca.NewCA(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewCA: %v", err)
+	}
+	if err := c.Init(); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	srv.tlsCA = c
+	srv.tlsIssuer = issuer.NewIssuer(c, policy.NewPolicy())
+	srv.tlsEnabled = true
+
+	srv.dashboardName = DefaultDashboardName
+
+	tests := []struct {
+		name       string
+		host       string
+		remoteAddr string
+		origin     string
+		fetchSite  string
+		want       int
+	}{
+		{"same origin", "nameport.localhost", "127.0.0.1:5000", "http://nameport.localhost", "same-origin", http.StatusOK},
+		{"same origin without fetch metadata", "nameport.localhost", "[::1]:5000", "http://nameport.localhost", "", http.StatusOK},
+		{"plain localhost", "localhost:8080", "127.0.0.1:5000", "http://localhost:8080", "same-origin", http.StatusOK},
+		{"no origin", "nameport.localhost", "127.0.0.1:5000", "", "", http.StatusUnauthorized},
+		{"cross origin", "nameport.localhost", "127.0.0.1:5000", "http://evil.example", "cross-site", http.StatusUnauthorized},
+		{"same site", "nameport.localhost", "127.0.0.1:5000", "http://nameport.localhost", "same-site", http.StatusUnauthorized},
+		{"remote client", "nameport.localhost", "192.0.2.1:5000", "http://nameport.localhost", "same-origin", http.StatusUnauthorized},
+		{"proxied service page", "app.localhost", "127.0.0.1:5000", "http://app.localhost", "same-origin", http.StatusUnauthorized},
+		{"rebound name", "evil.example", "127.0.0.1:5000", "http://evil.example", "same-origin", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "http://"+tt.host+"/api/tls/rotate", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.fetchSite != "" {
+				req.Header.Set("Sec-Fetch-Site", tt.fetchSite)
+			}
+			rec := httptest.NewRecorder()
+			srv.handleAPITLSRotate(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+}
+
+// backendPort starts an HTTP backend and returns its port.
+func backendPort(t *testing.T) int {
+	t.Helper()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(backend.Close)
+	return backend.Listener.Addr().(*net.TCPAddr).Port
+}
+
+// readExport decodes the export file at path.
+func readExport(t *testing.T, path string) []ExportedService {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read export file: %v", err)
+	}
+	var snapshot struct {
+		Services []ExportedService `json:"services"`
+	}
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		t.Fatalf("decode export file: %v", err)
+	}
+	return snapshot.Services
+}
+
+func TestExportFile_RewrittenOnDiscoveryChange(t *testing.T) {
+	srv := newTestServer(t)
+	srv.exportFile = filepath.Join(t.TempDir(), "export", "services.json")
+
+	alphaPort := backendPort(t)
+	betaPort := backendPort(t)
+
+	listeners := []portscan.Listener{
+		{Port: alphaPort, PID: 100, ExePath: "/opt/alpha/bin/alpha", Args: []string{"alpha"}},
+	}
+	srv.scan = func() ([]portscan.Listener, error) { return listeners, nil }
+
+	srv.discover()
+	exported := readExport(t, srv.exportFile)
+	if len(exported) != 1 {
+		t.Fatalf("got %d exported services, want 1: %+v", len(exported), exported)
+	}
+	if want := fmt.Sprintf("127.0.0.1:%d", alphaPort); exported[0].Target != want || exported[0].Scheme != "http" {
+		t.Errorf("exported[0] = %+v, want http target %s", exported[0], want)
+	}
+
+	// A new service appears.
+	listeners = append(listeners, portscan.Listener{Port: betaPort, PID: 200, ExePath: "/opt/beta/bin/beta", Args: []string{"beta"}})
+	srv.discover()
+
+	exported = readExport(t, srv.exportFile)
+	if len(exported) != 2 {
+		t.Fatalf("got %d exported services after change, want 2: %+v", len(exported), exported)
+	}
+	targets := map[string]bool{}
+	for _, e := range exported {
+		targets[e.Target] = true
+		if e.Name == "" || e.Group == "" {
+			t.Errorf("incomplete export entry: %+v", e)
+		}
+	}
+	if !targets[fmt.Sprintf("127.0.0.1:%d", betaPort)] {
+		t.Errorf("new service missing from export: %+v", exported)
+	}
+
+	// No temp files are left behind.
+	entries, _ := os.ReadDir(filepath.Dir(srv.exportFile))
+	if len(entries) != 1 {
+		t.Errorf("export directory has %d entries, want 1", len(entries))
+	}
+}
+
+func TestDiscover_SetsDiscoveredSource(t *testing.T) {
+	srv := newTestServer(t)
+	port := backendPort(t)
+	srv.scan = func() ([]portscan.Listener, error) {
+		return []portscan.Listener{{Port: port, PID: 100, ExePath: "/opt/alpha/bin/alpha", Args: []string{"alpha"}}}, nil
+	}
+
+	srv.discover()
+
+	records := srv.store.List()
+	if len(records) != 1 {
+		t.Fatalf("got %d records, want 1", len(records))
+	}
+	if records[0].Source != storage.SourceDiscovered {
+		t.Errorf("Source = %q, want %q", records[0].Source, storage.SourceDiscovered)
+	}
+	if svc := srv.services[records[0].Name]; svc == nil || svc.Source != storage.SourceDiscovered {
+		t.Errorf("runtime service source not set: %+v", svc)
+	}
+}
+
+func TestAPIRecords_ConcurrentWithDiscovery(t *testing.T) {
+	srv := newTestServer(t)
+	port := backendPort(t)
+	var pid int32 = 100
+	srv.scan = func() ([]portscan.Listener, error) {
+		// A new PID every scan makes discover save the record each time
+		return []portscan.Listener{{Port: port, PID: int(atomic.AddInt32(&pid, 1)), ExePath: "/opt/alpha/bin/alpha", Args: []string{"alpha"}}}, nil
+	}
+	srv.discover()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			srv.discover()
+		}
+	}()
+	for {
+		select {
+		case <-done:
+		default:
+			srv.handleAPIRecords(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/records", nil))
+			continue
+		}
+		break
+	}
+
+	if n := len(srv.store.List()); n != 1 {
+		t.Errorf("store has %d records, want 1", n)
+	}
+}
+
+func TestLoadServices_ReservesExistingNames(t *testing.T) {
+	srv := newTestServer(t)
+	// A service the user renamed: its generated name would be "alpha"
+	srv.store.Save(&storage.ServiceRecord{ID: "id1", Name: "api.localhost", Port: 3000, ExePath: "/opt/alpha/bin/alpha", UserDefined: true})
+	srv.loadServices()
+
+	port := backendPort(t)
+	srv.scan = func() ([]portscan.Listener, error) {
+		return []portscan.Listener{{Port: port, PID: 100, ExePath: "/opt/api/bin/api", Args: []string{"api"}}}, nil
+	}
+	srv.discover()
+
+	for _, r := range srv.store.List() {
+		if r.ID != "id1" && r.Name == "api.localhost" {
+			t.Errorf("new service took the existing name %s", r.Name)
+		}
+	}
+	if svc := srv.services["api.localhost"]; svc == nil || svc.ID != "id1" {
+		t.Errorf("api.localhost = %+v, want the existing service", svc)
+	}
+}
+
+func TestDiscover_ForgetsRejectedListenersThatStop(t *testing.T) {
+	srv := newTestServer(t)
+	srv.generator.SetPolicy(naming.NamePolicy{DenySubstrings: []string{"alpha"}})
+	rejected := portscan.Listener{Port: backendPort(t), PID: 100, ExePath: "/opt/alpha/bin/alpha", Args: []string{"alpha"}}
+	listeners := []portscan.Listener{rejected}
+	srv.scan = func() ([]portscan.Listener, error) { return listeners, nil }
+
+	srv.discover()
+	if len(srv.services) != 0 || !srv.rejected[srv.identityFor(rejected)] {
+		t.Fatalf("services = %v, rejected = %v; want the listener rejected", srv.services, srv.rejected)
+	}
+
+	listeners = nil
+	srv.discover()
+	if len(srv.rejected) != 0 {
+		t.Errorf("rejected = %v after the listener stopped, want empty", srv.rejected)
+	}
+}
+
+func TestAPIBlacklist_RemovesActiveServiceImmediately(t *testing.T) {
+	srv := newTestServer(t)
+	port := backendPort(t)
+	srv.scan = func() ([]portscan.Listener, error) {
+		return []portscan.Listener{{Port: port, PID: 100, ExePath: "/opt/alpha/bin/alpha", Args: []string{"alpha"}}}, nil
+	}
+	srv.discover()
+	if len(srv.services) != 1 {
+		t.Fatalf("got %d services after discover, want 1", len(srv.services))
+	}
+
+	body := strings.NewReader(`{"type":"path","value":"/opt/alpha"}`)
+	rec := httptest.NewRecorder()
+	srv.handleAPIBlacklist(rec, httptest.NewRequest(http.MethodPost, "/api/blacklist", body))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp struct {
+		Removed []string `json:"removed"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(resp.Removed) != 1 {
+		t.Errorf("removed = %v, want one service", resp.Removed)
+	}
+
+	// Gone without waiting for another scan.
+	if len(srv.services) != 0 {
+		t.Errorf("services = %v, want none", srv.services)
+	}
+	if n := len(srv.store.List()); n != 0 {
+		t.Errorf("store has %d records, want 0", n)
+	}
+}
+
+func TestDiscover_DropsNewlyBlacklistedService(t *testing.T) {
+	srv := newTestServer(t)
+	port := backendPort(t)
+	srv.scan = func() ([]portscan.Listener, error) {
+		return []portscan.Listener{{Port: port, PID: 100, ExePath: "/opt/alpha/bin/alpha", Args: []string{"alpha"}}}, nil
+	}
+	srv.discover()
+	if len(srv.services) != 1 {
+		t.Fatalf("got %d services after discover, want 1", len(srv.services))
+	}
+
+	// Added behind the daemon's back, e.g. by the CLI with no daemon running.
+	if _, err := srv.blacklistStore.Add("pid", "100"); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	srv.discover()
+
+	if len(srv.services) != 0 {
+		t.Errorf("services = %v, want none", srv.services)
+	}
+	if n := len(srv.store.List()); n != 0 {
+		t.Errorf("store has %d records, want 0", n)
+	}
+}
+
+func TestFavicon_ServesImageNotDashboard(t *testing.T) {
+	srv := newTestServer(t)
+
+	for _, host := range []string{"localhost", "unknown.localhost"} {
+		req := httptest.NewRequest(http.MethodGet, "/favicon.ico", nil)
+		req.Host = host
+		rec := httptest.NewRecorder()
+		srv.handleRequest(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want 200", host, rec.Code)
+		}
+		if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "image/") {
+			t.Errorf("%s: Content-Type = %q, want an image", host, ct)
+		}
+		if strings.Contains(rec.Body.String(), "<html") {
+			t.Errorf("%s: got dashboard HTML for /favicon.ico", host)
+		}
+	}
+}
+
+func TestFavicon_ProxiedForKnownService(t *testing.T) {
+	srv := newTestServer(t)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "backend icon")
+	}))
+	defer backend.Close()
+	addTestService(t, srv, "app.localhost", backend.URL)
+
+	rec := proxyGet(srv, "app.localhost", "/favicon.ico")
+	if body := rec.Body.String(); body != "backend icon" {
+		t.Errorf("body = %q, want the backend's favicon", body)
+	}
+}
+
+func TestFlushInterval_ImmediateStreamsFirstChunk(t *testing.T) {
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "first\n")
+		w.(http.Flusher).Flush()
+		<-release
+		fmt.Fprint(w, "second\n")
+	}))
+	defer backend.Close()
+	defer close(release)
+
+	srv := newTestServer(t)
+	addTestService(t, srv, "stream.localhost", backend.URL).FlushInterval = -1
+
+	front := httptest.NewServer(http.HandlerFunc(srv.handleRequest))
+	defer front.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, front.URL+"/", nil)
+	req.Host = "stream.localhost"
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// The backend is still blocked, so this only succeeds if the proxy
+	// flushed the first chunk through.
+	got := make(chan string, 1)
+	go func() {
+		buf := make([]byte, len("first\n"))
+		n, _ := io.ReadFull(resp.Body, buf)
+		got <- string(buf[:n])
+	}()
+	select {
+	case chunk := <-got:
+		if chunk != "first\n" {
+			t.Errorf("first chunk = %q, want %q", chunk, "first\n")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("first chunk not delivered while the backend was still writing")
+	}
+	if fi := srv.services["stream.localhost"].Proxy.FlushInterval; fi != -1 {
+		t.Errorf("proxy FlushInterval = %v, want -1", fi)
+	}
+}
+
+func TestLoadServices_ManualHTTPSRecordProxiesOverTLS(t *testing.T) {
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil {
+			t.Error("backend request arrived without TLS")
+		}
+		io.WriteString(w, "secure")
+	}))
+	defer backend.Close()
+	port := backend.Listener.Addr().(*net.TCPAddr).Port
+
+	srv := newTestServer(t)
+	record, err := srv.store.AddManualService("api.localhost", port, "")
+	if err != nil {
+		t.Fatalf("AddManualService: %v", err)
+	}
+	record.UseTLS = true
+	srv.store.Save(record)
+	srv.loadServices()
+
+	rec := proxyGet(srv, "api.localhost", "/")
+	if rec.Code != http.StatusOK || rec.Body.String() != "secure" {
+		t.Fatalf("proxy = %d %q, want 200 \"secure\"", rec.Code, rec.Body.String())
+	}
+}
+
+func TestAPIReload_CLIEditSurvivesDaemonSave(t *testing.T) {
+	srv := newTestServer(t)
+	path := filepath.Join(t.TempDir(), "services.json")
+	store, err := storage.NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	srv.store = store
+	port := backendPort(t)
+	pid := 100
+	srv.scan = func() ([]portscan.Listener, error) {
+		return []portscan.Listener{{Port: port, PID: pid, ExePath: "/opt/alpha/bin/alpha", Args: []string{"alpha"}}}, nil
+	}
+	srv.discover()
+	name := srv.store.List()[0].Name
+
+	// The CLI changes a setting, then asks the daemon to reload
+	cli, _ := storage.NewStore(path)
+	record, _ := cli.GetByName(name)
+	record.BandwidthLimit = 125000
+	cli.Save(record)
+	rec := httptest.NewRecorder()
+	srv.handleAPIReload(rec, httptest.NewRequest(http.MethodPost, "/api/reload", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body.String())
+	}
+
+	// A restart makes the daemon write the whole store again
+	pid = 101
+	srv.discover()
+
+	onDisk, _ := storage.NewStore(path)
+	got, ok := onDisk.GetByName(name)
+	if !ok {
+		t.Fatalf("%s missing from the store", name)
+	}
+	if got.PID != 101 {
+		t.Errorf("PID = %d, want the daemon's update to 101", got.PID)
+	}
+	if got.BandwidthLimit != 125000 {
+		t.Errorf("BandwidthLimit = %d, want the CLI's 125000 kept", got.BandwidthLimit)
+	}
+}
+
+func TestAPIReload_AppliesStoreChangesFromDisk(t *testing.T) {
+	srv := newTestServer(t)
+	path := filepath.Join(t.TempDir(), "services.json")
+	store, err := storage.NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	store.Save(&storage.ServiceRecord{ID: "id1", Name: "app.localhost", Port: 3000})
+	srv.store = store
+	srv.loadServices()
+
+	// The CLI edits the same file while the daemon is running.
+	cli, _ := storage.NewStore(path)
+	cli.UpdateName("id1", "renamed.localhost")
+	record, _ := cli.Get("id1")
+	record.UpstreamTimeout = 5 * time.Second
+	cli.Save(record)
+
+	rec := httptest.NewRecorder()
+	srv.handleAPIReload(rec, httptest.NewRequest(http.MethodPost, "/api/reload", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body.String())
+	}
+
+	if _, ok := srv.services["app.localhost"]; ok {
+		t.Error("old name still registered after reload")
+	}
+	svc, ok := srv.services["renamed.localhost"]
+	if !ok {
+		t.Fatalf("services = %v, want renamed.localhost", srv.services)
+	}
+	if svc.UpstreamTimeout != 5*time.Second {
+		t.Errorf("UpstreamTimeout = %v, want 5s", svc.UpstreamTimeout)
+	}
+}
+
+func TestAPIMetrics_CountsProxiedRequests(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	defer backend.Close()
+
+	srv := newTestServer(t)
+	addTestService(t, srv, "app.localhost", backend.URL)
+	for i := 0; i < 3; i++ {
+		proxyGet(srv, "app.localhost", "/")
+	}
+
+	rec := httptest.NewRecorder()
+	srv.handleAPIMetrics(rec, httptest.NewRequest(http.MethodGet, "/api/metrics", nil))
+
+	var snapshots []metrics.MetricsSnapshot
+	if err := json.NewDecoder(rec.Body).Decode(&snapshots); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(snapshots) != 1 {
+		t.Fatalf("got %d snapshots, want 1", len(snapshots))
+	}
+	if got := snapshots[0]; got.ServiceName != "app.localhost" || got.TotalRequests != 3 || got.StatusCodes[200] != 3 {
+		t.Errorf("snapshot = %+v, want 3 requests with status 200", got)
+	}
+}
+
+func TestAPIMetricsPrometheus_Histogram(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	defer backend.Close()
+
+	srv := newTestServer(t)
+	addTestService(t, srv, "app.localhost", backend.URL)
+	for i := 0; i < 3; i++ {
+		proxyGet(srv, "app.localhost", "/")
+	}
+
+	rec := httptest.NewRecorder()
+	srv.handleAPIMetricsPrometheus(rec, httptest.NewRequest(http.MethodGet, "/api/metrics/prometheus", nil))
+
+	if ct := rec.Header().Get("Content-Type"); ct != metrics.PrometheusContentType {
+		t.Errorf("Content-Type = %q, want %q", ct, metrics.PrometheusContentType)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		`nameport_response_seconds_bucket{service="app.localhost",status_class="2xx",le="+Inf"} 3`,
+		`nameport_response_seconds_count{service="app.localhost",status_class="2xx"} 3`,
+		`nameport_response_seconds_sum{service="app.localhost",status_class="2xx"} `,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("body missing %q\n%s", want, body)
+		}
+	}
+}
+
+func TestHostHeader_SentToBackend(t *testing.T) {
+	var mu sync.Mutex
+	var seen string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seen = r.Host
+		mu.Unlock()
+	}))
+	defer backend.Close()
+
+	srv := newTestServer(t)
+	svc := addTestService(t, srv, "app.localhost", backend.URL)
+	backendHost := strings.TrimPrefix(backend.URL, "http://")
+
+	tests := []struct {
+		hostHeader   string
+		preserveHost bool
+		want         string
+	}{
+		{"", false, backendHost},
+		{"allowed.example.test", false, "allowed.example.test"},
+		{"other.example.test", false, "other.example.test"},
+		{"", true, "app.localhost"},
+	}
+	for _, tt := range tests {
+		svc.HostHeader = tt.hostHeader
+		svc.PreserveHost = tt.preserveHost
+		proxyGet(srv, "app.localhost", "/")
+
+		mu.Lock()
+		got := seen
+		mu.Unlock()
+		if got != tt.want {
+			t.Errorf("HostHeader=%q PreserveHost=%v: backend saw Host %q, want %q",
+				tt.hostHeader, tt.preserveHost, got, tt.want)
+		}
+	}
+}
+
+func TestDiscover_ProbeChangedOnlySkipsUnchangedListeners(t *testing.T) {
+	probed := make(map[int]int) // port -> dials
+	var mu sync.Mutex
+	dial := func(network, address string, timeout time.Duration) (net.Conn, error) {
+		_, portStr, _ := net.SplitHostPort(address)
+		port, _ := strconv.Atoi(portStr)
+		mu.Lock()
+		probed[port]++
+		mu.Unlock()
+		return net.DialTimeout(network, address, timeout)
+	}
+
+	srv := newTestServer(t)
+	// What --probe-changed-only sets up
+	srv.probeCache = probe.NewProbeCacheWithDialer(probe.NoExpiry, dial)
+
+	stable := portscan.Listener{Port: backendPort(t), PID: 100, ExePath: "/opt/alpha/bin/alpha", Args: []string{"alpha"}}
+	listeners := []portscan.Listener{stable}
+	srv.scan = func() ([]portscan.Listener, error) { return listeners, nil }
+
+	srv.discover()
+	if probed[stable.Port] == 0 {
+		t.Fatal("first cycle did not probe the new listener")
+	}
+	before := probed[stable.Port]
+
+	added := portscan.Listener{Port: backendPort(t), PID: 200, ExePath: "/opt/beta/bin/beta", Args: []string{"beta"}}
+	listeners = []portscan.Listener{stable, added}
+	srv.discover()
+
+	if probed[stable.Port] != before {
+		t.Errorf("unchanged listener probed again: %d dials, want %d", probed[stable.Port], before)
+	}
+	if probed[added.Port] == 0 {
+		t.Error("new listener was not probed")
+	}
+	if len(srv.services) != 2 {
+		t.Errorf("got %d services, want 2", len(srv.services))
+	}
+
+	// A restart (new PID) is probed again.
+	stable.PID = 101
+	listeners = []portscan.Listener{stable, added}
+	srv.discover()
+	if probed[stable.Port] == before {
+		t.Error("listener with a new PID was not re-probed")
+	}
+
+	// So is a listener whose health path was changed
+	before = probed[added.Port]
+	record, _ := srv.store.Get(srv.identityFor(added))
+	record.HealthPath = "/app"
+	srv.store.Save(record)
+	srv.discover()
+	if probed[added.Port] == before {
+		t.Error("listener with a new health path was not re-probed")
+	}
+}
+
+func TestServeDashboard_ColorAndIcon(t *testing.T) {
+	srv := newTestServer(t)
+	root := addTestService(t, srv, "ollama.localhost", "http://127.0.0.1:3000")
+	root.Color = "#ff0000"
+	root.Icon = "🚀"
+	addTestService(t, srv, "api.ollama.localhost", "http://127.0.0.1:3001")
+	addTestService(t, srv, "plain.localhost", "http://127.0.0.1:3002")
+
+	rec := httptest.NewRecorder()
+	srv.serveDashboard(rec, httptest.NewRequest(http.MethodGet, "http://localhost/", nil))
+	body := rec.Body.String()
+
+	if got := strings.Count(body, "border-left: 4px solid #ff0000"); got != 2 {
+		t.Errorf("color appears %d times, want 2 (group header and service row)", got)
+	}
+	if got := strings.Count(body, `<span class="service-icon">🚀</span>`); got != 2 {
+		t.Errorf("icon appears %d times, want 2 (group header and service row)", got)
+	}
+}
+
+func TestAuthInjection(t *testing.T) {
+	var mu sync.Mutex
+	var seen string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seen = r.Header.Get("Authorization")
+		mu.Unlock()
+	}))
+	defer backend.Close()
+
+	srv := newTestServer(t)
+	svc := addTestService(t, srv, "api.localhost", backend.URL)
+	svc.AuthToken = "configured"
+
+	backendSaw := func(auth string) string {
+		req := httptest.NewRequest(http.MethodGet, "http://api.localhost/", nil)
+		req.Host = "api.localhost"
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		srv.handleRequest(httptest.NewRecorder(), req)
+		mu.Lock()
+		defer mu.Unlock()
+		return seen
+	}
+
+	if got := backendSaw(""); got != "Bearer configured" {
+		t.Errorf("Authorization = %q, want the configured token", got)
+	}
+	if got := backendSaw("Basic dXNlcjpwYXNz"); got != "Basic dXNlcjpwYXNz" {
+		t.Errorf("Authorization = %q, want the client's header preserved", got)
+	}
+
+	svc.AuthTokenEnv = "NAMEPORT_TEST_TOKEN"
+	t.Setenv("NAMEPORT_TEST_TOKEN", "from-env")
+	if got := backendSaw(""); got != "Bearer from-env" {
+		t.Errorf("Authorization = %q, want the token from the environment", got)
+	}
+}
+
+func TestAPIRecords_RedactsAuthToken(t *testing.T) {
+	srv := newTestServer(t)
+	srv.store.Save(&storage.ServiceRecord{ID: "id1", Name: "api.localhost", Port: 3000, AuthToken: "secret"})
+
+	rec := httptest.NewRecorder()
+	srv.handleAPIRecords(rec, httptest.NewRequest(http.MethodGet, "/api/records", nil))
+	if strings.Contains(rec.Body.String(), "secret") {
+		t.Errorf("token leaked in /api/records: %s", rec.Body.String())
+	}
+	if r, _ := srv.store.Get("id1"); r.AuthToken != "secret" {
+		t.Error("redaction modified the stored record")
+	}
+}
+
+func TestSetupTLS_Disabled(t *testing.T) {
+	srv := newTestServer(t)
+	srv.httpPort = 8080
+	srv.httpsPort = 8443
+
+	// An initialized CA is ignored when TLS is turned off
+	caDir := t.TempDir()
+	c, err := ca.NewCA(caDir)
+	if err != nil {
+		t.Fatalf("NewCA: %v", err)
+	}
+	if err := c.Init(); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+
+	srv.setupTLS(tlsOptions{disabled: true, caStorePath: caDir})
+
+	if srv.tlsEnabled || srv.tlsIssuer != nil || srv.tlsTrustor != nil {
+		t.Fatalf("TLS set up despite --no-tls (enabled=%v)", srv.tlsEnabled)
+	}
+	if https := srv.newHTTPSServer(":8443", http.NewServeMux()); https != nil {
+		t.Error("HTTPS server created despite --no-tls")
+	}
+	if got := srv.serviceURL("app.localhost"); got != "http://app.localhost:8080" {
+		t.Errorf("serviceURL = %q, want http://app.localhost:8080", got)
+	}
+}
+
+func TestNewHTTPSServer_Enabled(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := ca.NewCA(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewCA: %v", err)
+	}
+	if err := c.Init(); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	srv.tlsIssuer = issuer.NewIssuer(c, policy.NewPolicy())
+	srv.tlsEnabled = true
+
+	https := srv.newHTTPSServer(":8443", http.NewServeMux())
+	if https == nil || https.TLSConfig == nil || https.TLSConfig.GetCertificate == nil {
+		t.Fatalf("expected an HTTPS server with dynamic certificates, got %+v", https)
+	}
+}
+
+// proxyProtocolBackend is a raw TCP backend that reports the first line of
+// every connection before answering it as HTTP
+func proxyProtocolBackend(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	lines := make(chan string, 4)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				br := bufio.NewReader(conn)
+				first, err := br.ReadString('\n')
+				if err != nil {
+					return
+				}
+				lines <- first
+				// After a PROXY line the HTTP request follows on the same conn
+				if strings.HasPrefix(first, "PROXY ") {
+					if _, err := http.ReadRequest(br); err != nil {
+						return
+					}
+				}
+				io.WriteString(conn, "HTTP/1.1 200 OK\r\nContent-Length: 2\r\nConnection: close\r\n\r\nok")
+			}()
+		}
+	}()
+	return "http://" + ln.Addr().String(), lines
+}
+
+func TestProxyProtocol_V1Header(t *testing.T) {
+	backendURL, lines := proxyProtocolBackend(t)
+	srv := newTestServer(t)
+	svc := addTestService(t, srv, "lb.localhost", backendURL)
+
+	send := func() string {
+		req := httptest.NewRequest(http.MethodGet, "http://lb.localhost/", nil)
+		req.Host = "lb.localhost"
+		req.RemoteAddr = "192.0.2.7:51234"
+		req = req.WithContext(context.WithValue(req.Context(), http.LocalAddrContextKey,
+			&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 80}))
+		rec := httptest.NewRecorder()
+		srv.handleRequest(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200", rec.Code)
+		}
+		select {
+		case line := <-lines:
+			return line
+		case <-time.After(5 * time.Second):
+			t.Fatal("backend saw no connection")
+			return ""
+		}
+	}
+
+	// Disabled: the connection starts with the HTTP request line
+	if got := send(); !strings.HasPrefix(got, "GET / HTTP/1.1") {
+		t.Errorf("first line = %q, want the request line without a PROXY header", got)
+	}
+
+	svc.ProxyProtocol = proxyproto.V1
+	svc.Proxy = nil
+	if got, want := send(), "PROXY TCP4 192.0.2.7 127.0.0.1 51234 80\r\n"; got != want {
+		t.Errorf("first line = %q, want %q", got, want)
+	}
+}
+
+func TestDiscover_ResetMetricsOnRestart(t *testing.T) {
+	srv := newTestServer(t)
+	srv.resetMetricsOnRestart = true
+
+	alpha := portscan.Listener{Port: backendPort(t), PID: 100, ExePath: "/opt/alpha/bin/alpha", Args: []string{"alpha"}}
+	beta := portscan.Listener{Port: backendPort(t), PID: 200, ExePath: "/opt/beta/bin/beta", Args: []string{"beta"}}
+	listeners := []portscan.Listener{alpha, beta}
+	srv.scan = func() ([]portscan.Listener, error) { return listeners, nil }
+	srv.discover()
+
+	names := make(map[int]string) // PID -> service name
+	for name, svc := range srv.services {
+		names[svc.PID] = name
+	}
+	if len(names) != 2 {
+		t.Fatalf("expected 2 services, got %v", names)
+	}
+	for _, name := range names {
+		srv.metrics.RecordRequest(name, 500, 10, 10, time.Millisecond)
+	}
+
+	// alpha restarts; beta keeps running
+	alphaName, betaName := names[100], names[200]
+	alpha.PID = 101
+	listeners = []portscan.Listener{alpha, beta}
+	srv.discover()
+
+	if snap := srv.metrics.Snapshot(alphaName); snap == nil || snap.TotalRequests != 0 || len(snap.StatusCodes) != 0 {
+		t.Errorf("restarted service metrics = %+v, want cleared", snap)
+	}
+	if snap := srv.metrics.Snapshot(betaName); snap == nil || snap.TotalRequests != 1 {
+		t.Errorf("other service metrics = %+v, want untouched", snap)
+	}
+}
+
+// tlsBackendPort starts an HTTPS backend and returns its port. Every such
+// backend presents the same httptest certificate.
+func tlsBackendPort(t *testing.T) int {
+	t.Helper()
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(backend.Close)
+	return backend.Listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestDiscover_MatchesByCertFingerprint(t *testing.T) {
+	srv := newTestServer(t)
+
+	v1 := portscan.Listener{Port: tlsBackendPort(t), PID: 100, ExePath: "/opt/app/bin/app", Args: []string{"app", "--build", "1"}}
+	listeners := []portscan.Listener{v1}
+	srv.scan = func() ([]portscan.Listener, error) { return listeners, nil }
+	srv.discover()
+	if len(srv.services) != 1 {
+		t.Fatalf("expected 1 service, got %d", len(srv.services))
+	}
+	var name string
+	for n := range srv.services {
+		name = n
+	}
+
+	// Restarted with different arguments (a new identity) on a new port and
+	// PID, presenting the same certificate
+	v2 := portscan.Listener{Port: tlsBackendPort(t), PID: 200, ExePath: "/opt/app/bin/app", Args: []string{"app", "--build", "2"}}
+	listeners = []portscan.Listener{v2}
+	srv.discover()
+
+	if len(srv.services) != 1 || len(srv.store.List()) != 1 {
+		t.Fatalf("got %d services and %d records, want the existing one reused", len(srv.services), len(srv.store.List()))
+	}
+	svc := srv.services[name]
+	if svc == nil || svc.Port != v2.Port || svc.PID != 200 {
+		t.Fatalf("service %s = %+v, want it on port %d with PID 200", name, svc, v2.Port)
+	}
+	record, ok := srv.store.GetByName(name)
+	if !ok || record.ID != srv.identityFor(v2) || record.ID != svc.ID {
+		t.Errorf("record = %+v, want it moved to the new identity", record)
+	}
+
+	// Another process with the same certificate while the app is still
+	// listening gets its own record
+	other := portscan.Listener{Port: tlsBackendPort(t), PID: 300, ExePath: "/opt/other/bin/other", Args: []string{"other"}}
+	listeners = []portscan.Listener{v2, other}
+	srv.discover()
+	if len(srv.store.List()) != 2 {
+		t.Errorf("got %d records, want a separate record for the other process", len(srv.store.List()))
+	}
+}
+
+func TestDiscover_CertFingerprintMatchProxiesToNewPort(t *testing.T) {
+	srv := newTestServer(t)
+	backend := func(body string) *httptest.Server {
+		b := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, body)
+		}))
+		t.Cleanup(b.Close)
+		return b
+	}
+	port := func(b *httptest.Server) int { return b.Listener.Addr().(*net.TCPAddr).Port }
+
+	old := backend("v1")
+	listeners := []portscan.Listener{{Port: port(old), PID: 100, ExePath: "/opt/app/bin/app", Args: []string{"app", "--build", "1"}}}
+	srv.scan = func() ([]portscan.Listener, error) { return listeners, nil }
+	srv.discover()
+	if rec := proxyGet(srv, "app.localhost", "/"); rec.Body.String() != "v1" {
+		t.Fatalf("before the move: %d %q, want v1", rec.Code, rec.Body.String())
+	}
+
+	// The app comes back with new arguments on another port, same certificate
+	old.Close()
+	moved := backend("v2")
+	listeners = []portscan.Listener{{Port: port(moved), PID: 200, ExePath: "/opt/app/bin/app", Args: []string{"app", "--build", "2"}}}
+	srv.discover()
+
+	if rec := proxyGet(srv, "app.localhost", "/"); rec.Body.String() != "v2" {
+		t.Errorf("after the move: %d %q, want v2 from the new port", rec.Code, rec.Body.String())
+	}
+}
+
+func TestDiscover_KeepsMetricsOnRestartByDefault(t *testing.T) {
+	srv := newTestServer(t)
+
+	alpha := portscan.Listener{Port: backendPort(t), PID: 100, ExePath: "/opt/alpha/bin/alpha", Args: []string{"alpha"}}
+	srv.scan = func() ([]portscan.Listener, error) { return []portscan.Listener{alpha}, nil }
+	srv.discover()
+
+	var name string
+	for n := range srv.services {
+		name = n
+	}
+	srv.metrics.RecordRequest(name, 200, 1, 1, time.Millisecond)
+
+	alpha.PID = 101
+	srv.discover()
+	if snap := srv.metrics.Snapshot(name); snap == nil || snap.TotalRequests != 1 {
+		t.Errorf("metrics = %+v, want kept without --reset-metrics-on-restart", snap)
+	}
+}
+
+func TestAPIRename_NormalizesAndValidates(t *testing.T) {
+	srv := newTestServer(t)
+	srv.store.Save(&storage.ServiceRecord{ID: "id1", Name: "app.localhost", Port: 3000})
+	srv.loadServices()
+
+	rename := func(oldName, newName string) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"oldName":%q,"newName":%q}`, oldName, newName)
+		rec := httptest.NewRecorder()
+		srv.handleAPIRename(rec, httptest.NewRequest(http.MethodPost, "/api/rename", strings.NewReader(body)))
+		return rec
+	}
+
+	for _, bad := range []string{"api..app", "!!!", ".localhost"} {
+		if rec := rename("app.localhost", bad); rec.Code != http.StatusBadRequest {
+			t.Errorf("rename to %q: status = %d, want 400", bad, rec.Code)
+		}
+	}
+	if _, ok := srv.services["app.localhost"]; !ok {
+		t.Fatal("rejected rename changed the service")
+	}
+
+	if rec := rename("app.localhost", "My App"); rec.Code != http.StatusOK {
+		t.Fatalf("rename to %q: status = %d: %s", "My App", rec.Code, rec.Body.String())
+	}
+	if _, ok := srv.services["my-app.localhost"]; !ok {
+		t.Fatalf("services = %v, want my-app.localhost", srv.services)
+	}
+
+	if rec := rename("my-app.localhost", "api.app.localhost"); rec.Code != http.StatusOK {
+		t.Fatalf("rename to subdomain name: status = %d: %s", rec.Code, rec.Body.String())
+	}
+	if r, ok := srv.store.GetByName("api.app.localhost"); !ok || r.ID != "id1" {
+		t.Errorf("store not updated to api.app.localhost")
+	}
+}
+
+func TestHTTPSServer_CountsHandshakeFailures(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := ca.NewCA(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewCA: %v", err)
+	}
+	if err := c.Init(); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	srv.tlsIssuer = issuer.NewIssuer(c, policy.NewPolicy())
+	srv.tlsEnabled = true
+
+	https := srv.newHTTPSServer("127.0.0.1:0", http.NewServeMux())
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go https.ServeTLS(ln, "", "")
+	t.Cleanup(func() { https.Close() })
+
+	// The server requires TLS 1.2; a client offering only TLS 1.0/1.1 fails
+	conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{
+		ServerName:         "app.localhost",
+		InsecureSkipVerify: true,
+		MinVersion:         tls.VersionTLS10,
+		MaxVersion:         tls.VersionTLS11,
+	})
+	if err == nil {
+		conn.Close()
+		t.Fatal("handshake with TLS 1.1 succeeded")
+	}
+
+	var failure metrics.HandshakeFailure
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		var ok bool
+		if failure, ok = srv.handshakes.Failure("app.localhost"); ok {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if failure.Count != 1 {
+		t.Fatalf("failures for app.localhost = %+v, want 1", failure)
+	}
+	if failure.LastError == "" {
+		t.Error("expected the handshake error to be recorded")
+	}
+
+	rec := httptest.NewRecorder()
+	srv.handleAPIDebugStats(rec, httptest.NewRequest(http.MethodGet, "/api/debug/stats", nil))
+	var stats struct {
+		TLSHandshakeFailures []metrics.HandshakeFailure `json:"tls_handshake_failures"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("decode stats: %v", err)
+	}
+	if len(stats.TLSHandshakeFailures) != 1 || stats.TLSHandshakeFailures[0].ServerName != "app.localhost" {
+		t.Errorf("debug stats failures = %+v", stats.TLSHandshakeFailures)
+	}
+}
+
+func TestDiscover_PortRangesFilterListeners(t *testing.T) {
+	srv := newTestServer(t)
+
+	inside := portscan.Listener{Port: backendPort(t), PID: 100, ExePath: "/opt/alpha/bin/alpha", Args: []string{"alpha"}}
+	outside := portscan.Listener{Port: backendPort(t), PID: 200, ExePath: "/opt/beta/bin/beta", Args: []string{"beta"}}
+	srv.portRanges = []portRange{{Start: inside.Port, End: inside.Port}, {Start: 1, End: 2}}
+	srv.scan = func() ([]portscan.Listener, error) {
+		return []portscan.Listener{inside, outside}, nil
+	}
+	srv.discover()
+
+	if len(srv.services) != 1 {
+		t.Fatalf("expected 1 service, got %d", len(srv.services))
+	}
+	for name, svc := range srv.services {
+		if svc.Port != inside.Port {
+			t.Errorf("registered %s on port %d, outside the configured ranges", name, svc.Port)
+		}
+	}
+}
+
+func TestDiscover_WarnsAboutListenerOnOwnPort(t *testing.T) {
+	srv := newTestServer(t)
+	srv.httpPort = backendPort(t)
+	srv.httpsPort = 1
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	clash := portscan.Listener{Port: srv.httpPort, PID: 100, ExePath: "/opt/alpha/bin/alpha", Args: []string{"alpha"}}
+	self := portscan.Listener{Port: srv.httpPort, PID: os.Getpid(), ExePath: "/usr/local/bin/nameport"}
+	srv.scan = func() ([]portscan.Listener, error) {
+		return []portscan.Listener{clash, self}, nil
+	}
+	srv.discover()
+
+	if len(srv.services) != 0 {
+		t.Fatalf("expected no services, got %d", len(srv.services))
+	}
+	out := logs.String()
+	if !strings.Contains(out, "skipping alpha (PID 100)") || !strings.Contains(out, "--http-port") {
+		t.Errorf("missing conflict warning in log: %q", out)
+	}
+	if strings.Contains(out, "nameport (PID") {
+		t.Errorf("warned about the daemon's own listener: %q", out)
+	}
+
+	// The conflict is logged once, not on every scan
+	logs.Reset()
+	srv.discover()
+	if strings.Contains(logs.String(), "skipping alpha") {
+		t.Errorf("warning repeated on the next scan: %q", logs.String())
+	}
+}
+
+func TestParsePortRange(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    portRange
+		wantErr bool
+	}{
+		{in: "3000-9999", want: portRange{3000, 9999}},
+		{in: "8080", want: portRange{8080, 8080}},
+		{in: "9999-3000", wantErr: true},
+		{in: "0-100", wantErr: true},
+		{in: "3000-70000", wantErr: true},
+		{in: "dev", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parsePortRange(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parsePortRange(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("parsePortRange(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestHandleRequest_DashboardName(t *testing.T) {
+	srv := newTestServer(t)
+	srv.dashboardName = "dash.localhost"
+
+	// A stale service with the reserved name must never be proxied
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request to the dashboard name reached a backend")
+	}))
+	defer backend.Close()
+	addTestService(t, srv, "dash.localhost", backend.URL)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Host = "Dash.localhost:8080"
+	rec := httptest.NewRecorder()
+	srv.handleRequest(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, "<html") {
+		t.Error("expected the dashboard")
+	}
+	if strings.Contains(body, "No service found") {
+		t.Error("dashboard name was looked up as a service")
+	}
+}
+
+func TestRoutes_APIOnlyOnDashboardHosts(t *testing.T) {
+	srv := newTestServer(t)
+	srv.dashboardName = DefaultDashboardName
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "backend "+r.URL.Path)
+	}))
+	defer backend.Close()
+	addTestService(t, srv, "app.localhost", backend.URL)
+	mux := srv.routes()
+
+	for _, path := range []string{
+		"/api/records",
+		"/api/rules/reload",
+		"/api/rules/suggestions",
+		"/api/rules/apply",
+		"/api/tls/rotate",
+		"/api/metrics/prometheus",
+		"/api/debug/stats",
+		"/api/metrics",
+		"/api/reload",
+		"/api/services/app.localhost/recent",
+	} {
+		t.Run(path, func(t *testing.T) {
+			// A service's own /api/ paths are proxied to it
+			req := httptest.NewRequest(http.MethodGet, "http://app.localhost"+path, nil)
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			if got := rec.Body.String(); got != "backend "+path {
+				t.Errorf("app.localhost%s = %d %q, want the backend's response", path, rec.Code, got)
+			}
+
+			// The dashboard hosts still get the daemon API
+			for _, host := range []string{"localhost", "127.0.0.1:8080", DefaultDashboardName} {
+				req := httptest.NewRequest(http.MethodGet, "http://"+host+path, nil)
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, req)
+				if strings.HasPrefix(rec.Body.String(), "backend") {
+					t.Errorf("%s%s reached the backend, want the daemon API", host, path)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleAPIRename_RejectsDashboardName(t *testing.T) {
+	srv := newTestServer(t)
+	srv.dashboardName = DefaultDashboardName
+	addTestService(t, srv, "app.localhost", "http://127.0.0.1:3000")
+
+	body := strings.NewReader(`{"oldName": "app.localhost", "newName": "nameport"}`)
+	rec := httptest.NewRecorder()
+	srv.handleAPIRename(rec, httptest.NewRequest(http.MethodPost, "/api/rename", body))
+
+	if rec.Code != http.StatusConflict {
+		t.Errorf("status = %d, want 409", rec.Code)
+	}
+	if _, ok := srv.services["app.localhost"]; !ok {
+		t.Error("service was renamed to the dashboard name")
+	}
+}
+
+func TestHandleAPIServices_HTTP3Advertised(t *testing.T) {
+	srv := newTestServer(t)
+	h3 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Alt-Svc", `h3=":443"; ma=86400`)
+	}))
+	defer h3.Close()
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer plain.Close()
+	addTestService(t, srv, "h3.localhost", h3.URL)
+	addTestService(t, srv, "plain.localhost", plain.URL)
+
+	rec := httptest.NewRecorder()
+	srv.handleAPIServices(rec, httptest.NewRequest(http.MethodGet, "/api/services", nil))
+
+	var services []struct {
+		Name            string
+		Healthy         bool `json:"healthy"`
+		HTTP3Advertised bool
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &services); err != nil {
+		t.Fatalf("decode services: %v", err)
+	}
+	got := make(map[string]bool)
+	for _, svc := range services {
+		if !svc.Healthy {
+			t.Errorf("%s: not healthy", svc.Name)
+		}
+		got[svc.Name] = svc.HTTP3Advertised
+	}
+	if !got["h3.localhost"] {
+		t.Error("h3.localhost: HTTP3Advertised not set despite Alt-Svc")
+	}
+	if got["plain.localhost"] {
+		t.Error("plain.localhost: HTTP3Advertised set without Alt-Svc")
+	}
+	if srv.services["h3.localhost"].HTTP3Advertised {
+		t.Error("GET /api/services changed the shared service")
+	}
+}
+
+func TestHandleAPIServices_ConcurrentWithHealthRefresh(t *testing.T) {
+	srv := newTestServer(t)
+	h3 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Alt-Svc", `h3=":443"; ma=86400`)
+	}))
+	defer h3.Close()
+	addTestService(t, srv, "h3.localhost", h3.URL)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			srv.refreshHealth()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			rec := httptest.NewRecorder()
+			srv.handleAPIServices(rec, httptest.NewRequest(http.MethodGet, "/api/services", nil))
+		}
+	}()
+	wg.Wait()
+}
+
+func TestHandleAPIServices_HealthCached(t *testing.T) {
+	var hits int64
+	var status int64 = http.StatusOK
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&hits, 1)
+		w.WriteHeader(int(atomic.LoadInt64(&status)))
+	}))
+	defer backend.Close()
+
+	srv := newTestServer(t)
+	srv.health = probe.NewHealthCache(time.Minute)
+	addTestService(t, srv, "app.localhost", backend.URL)
+
+	healthy := func() bool {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		srv.handleAPIServices(rec, httptest.NewRequest(http.MethodGet, "/api/services", nil))
+		var services []struct {
+			Healthy bool `json:"healthy"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &services); err != nil || len(services) != 1 {
+			t.Fatalf("decode services: %v (%s)", err, rec.Body.String())
+		}
+		return services[0].Healthy
+	}
+
+	for i := 0; i < 3; i++ {
+		if !healthy() {
+			t.Fatalf("poll %d: not healthy", i)
+		}
+	}
+	if n := atomic.LoadInt64(&hits); n != 1 {
+		t.Errorf("backend checked %d times for 3 polls within the TTL, want 1", n)
+	}
+
+	// The background checker picks up the change; polls then see it
+	// without checking again
+	atomic.StoreInt64(&status, http.StatusServiceUnavailable)
+	srv.refreshHealth()
+	if healthy() {
+		t.Error("still healthy after the background refresh saw a 503")
+	}
+	if n := atomic.LoadInt64(&hits); n != 2 {
+		t.Errorf("backend checked %d times, want 2", n)
+	}
+}
+
+func TestPreferredScheme_HTTPS(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := ca.NewCA(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewCA: %v", err)
+	}
+	if err := c.Init(); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	srv.tlsCA = c
+	srv.tlsEnabled = true
+
+	addTestService(t, srv, "secure.localhost", "http://127.0.0.1:3000").PreferredScheme = storage.SchemeHTTPS
+	addTestService(t, srv, "plain.localhost", "http://127.0.0.1:3001").PreferredScheme = storage.SchemeHTTP
+
+	if got, want := srv.serviceURL("secure.localhost"), "https://secure.localhost:8443"; got != want {
+		t.Errorf("serviceURL(secure) = %q, want %q", got, want)
+	}
+	if got, want := srv.serviceURL("plain.localhost"), "http://plain.localhost:8080"; got != want {
+		t.Errorf("serviceURL(plain) = %q, want %q", got, want)
+	}
+
+	rec := httptest.NewRecorder()
+	srv.serveDashboard(rec, httptest.NewRequest(http.MethodGet, "http://localhost/", nil))
+	body := rec.Body.String()
+
+	// The https link is primary and the http one is gone
+	if !strings.Contains(body, `<a href="https://secure.localhost:8443" class="service-link" target="_blank" id="link-secure.localhost">`) {
+		t.Error("expected the https link as primary for secure.localhost")
+	}
+	if strings.Contains(body, `href="http://secure.localhost:8080"`) {
+		t.Error("http link shown for an https-preferred service")
+	}
+	// An http-preferred service keeps https as the secondary link
+	if !strings.Contains(body, `<a href="http://plain.localhost:8080" class="service-link" target="_blank" id="link-plain.localhost">`) {
+		t.Error("expected the http link as primary for plain.localhost")
+	}
+	if !strings.Contains(body, `<a href="https://plain.localhost:8443" class="service-link-secondary"`) {
+		t.Error("expected a secondary https link for plain.localhost")
+	}
+}
+
+func TestHandleRequest_Override(t *testing.T) {
+	backend := func(body string) *httptest.Server {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, body)
+		}))
+		t.Cleanup(ts.Close)
+		return ts
+	}
+	original, replacement := backend("original"), backend("override")
+
+	srv := newTestServer(t)
+	svc := addTestService(t, srv, "app.localhost", original.URL)
+	record := &storage.ServiceRecord{ID: svc.ID, Name: svc.Name, Port: svc.Port, TargetHost: svc.TargetHost}
+
+	u, _ := url.Parse(replacement.URL)
+	host, portStr, _ := net.SplitHostPort(u.Host)
+	port, _ := strconv.Atoi(portStr)
+	record.Override = &storage.TargetOverride{Host: host, Port: port, Expires: time.Now().Add(time.Hour)}
+	if err := srv.store.Save(record); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	svc.Override = record.Override
+
+	if got := proxyGet(srv, "app.localhost", "/").Body.String(); got != "override" {
+		t.Errorf("while the override is valid got %q, want %q", got, "override")
+	}
+
+	svc.Override.Expires = time.Now().Add(-time.Second)
+	if got := proxyGet(srv, "app.localhost", "/").Body.String(); got != "original" {
+		t.Errorf("after expiry got %q, want %q", got, "original")
+	}
+	if svc.Override != nil {
+		t.Error("expired override still set on the service")
+	}
+	if r, _ := srv.store.Get(svc.ID); r.Override != nil {
+		t.Error("expired override still saved in the store")
+	}
+}
+
+func TestTargetURL_IPv6(t *testing.T) {
+	tests := []struct {
+		useTLS bool
+		host   string
+		port   int
+		want   string
+	}{
+		{false, "127.0.0.1", 3000, "http://127.0.0.1:3000"},
+		{false, "::1", 8080, "http://[::1]:8080"},
+		{true, "fe80::1%eth0", 8443, "https://[fe80::1%25eth0]:8443"},
+	}
+	for _, tt := range tests {
+		if got := targetURL(tt.useTLS, tt.host, tt.port).String(); got != tt.want {
+			t.Errorf("targetURL(%v, %q, %d) = %q, want %q", tt.useTLS, tt.host, tt.port, got, tt.want)
+		}
+	}
+
+	svc := &Service{TargetHost: "::1", Port: 8080}
+	if got := svc.upstreamHost("app.localhost"); got != "[::1]:8080" {
+		t.Errorf("upstreamHost = %q, want [::1]:8080", got)
+	}
+}
+
+func TestRemoteReadOnly(t *testing.T) {
+	srv := newTestServer(t)
+	srv.remoteReadOnly = true
+	svc := addTestService(t, srv, "app.localhost", "http://127.0.0.1:3000")
+	srv.store.Save(&storage.ServiceRecord{ID: svc.ID, Name: svc.Name, Port: svc.Port})
+
+	request := func(method, path, body, remoteAddr string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		switch path {
+		case "/api/services":
+			srv.handleAPIServices(rec, req)
+		case "/api/rename":
+			srv.handleAPIRename(rec, req)
+		}
+		return rec.Code
+	}
+	rename := `{"oldName": "app.localhost", "newName": "web.localhost"}`
+
+	if code := request(http.MethodGet, "/api/services", "", "192.168.1.20:50000"); code != http.StatusOK {
+		t.Errorf("remote GET /api/services = %d, want 200", code)
+	}
+	if code := request(http.MethodPost, "/api/rename", rename, "192.168.1.20:50000"); code != http.StatusForbidden {
+		t.Errorf("remote POST /api/rename = %d, want 403", code)
+	}
+	if _, ok := srv.services["app.localhost"]; !ok {
+		t.Fatal("remote rename was applied")
+	}
+	if code := request(http.MethodPost, "/api/rename", rename, "[::1]:50000"); code != http.StatusOK {
+		t.Errorf("loopback POST /api/rename = %d, want 200", code)
+	}
+}
+
+func TestIsLoopbackAddr(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"127.0.0.1:80":          true,
+		"[::1]:80":              true,
+		"[::ffff:127.0.0.1]:80": true,
+		"192.168.1.20:80":       false,
+		"[fe80::1]:80":          false,
+		"garbage":               false,
+	} {
+		if got := isLoopbackAddr(addr); got != want {
+			t.Errorf("isLoopbackAddr(%q) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+// writeUserRules writes naming rules to the user rules file under a
+// temporary HOME
+func writeUserRules(t *testing.T, rules string) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	path := naming.UserRulesPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(rules), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// serviceByPID returns the registered service with the given PID, or nil
+func serviceByPID(srv *Server, pid int) *Service {
+	for _, svc := range srv.services {
+		if svc.PID == pid {
+			return svc
+		}
+	}
+	return nil
+}
+
+func TestReloadRules_NewServicesUseNewRules(t *testing.T) {
+	writeUserRules(t, `[]`)
+	srv := newTestServer(t)
+
+	server := portscan.Listener{Port: backendPort(t), PID: 100, ExePath: "/opt/acme/bin/server", Args: []string{"server"}}
+	listeners := []portscan.Listener{server}
+	srv.scan = func() ([]portscan.Listener, error) { return listeners, nil }
+	srv.discover()
+	before := serviceByPID(srv, 100)
+	if before == nil || before.Name == "acme.localhost" {
+		t.Fatalf("service before the rule change = %+v", before)
+	}
+	oldName := before.Name
+
+	writeUserRules(t, `[{"id": "acme", "priority": 1, "exe_pattern": "^/opt/acme/", "name_source": "static", "static_name": "acme"}]`)
+	rec := httptest.NewRecorder()
+	srv.handleAPIRulesReload(rec, httptest.NewRequest(http.MethodPost, "/api/rules/reload", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("reload = %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// The running service is only offered the new name
+	rec = httptest.NewRecorder()
+	srv.handleAPIRulesSuggestions(rec, httptest.NewRequest(http.MethodGet, "/api/rules/suggestions", nil))
+	var suggestions []NameSuggestion
+	json.NewDecoder(rec.Body).Decode(&suggestions)
+	if want := []NameSuggestion{{Name: oldName, Suggested: "acme.localhost"}}; !reflect.DeepEqual(suggestions, want) {
+		t.Errorf("suggestions = %+v, want %+v", suggestions, want)
+	}
+	if serviceByPID(srv, 100).Name != oldName {
+		t.Error("existing service renamed by the reload alone")
+	}
+
+	// A service discovered afterwards is named by the new rules
+	worker := portscan.Listener{Port: backendPort(t), PID: 200, ExePath: "/opt/acme/bin/worker", Args: []string{"worker"}}
+	listeners = []portscan.Listener{server, worker}
+	srv.discover()
+	if svc := serviceByPID(srv, 200); svc == nil || svc.Name != "acme.localhost" {
+		t.Errorf("new service = %+v, want acme.localhost", svc)
+	}
+}
+
+func TestApplyNameSuggestions(t *testing.T) {
+	writeUserRules(t, `[]`)
+	srv := newTestServer(t)
+
+	listeners := []portscan.Listener{
+		{Port: backendPort(t), PID: 100, ExePath: "/opt/acme/bin/server", Args: []string{"server"}},
+	}
+	srv.scan = func() ([]portscan.Listener, error) { return listeners, nil }
+	srv.discover()
+	oldName := serviceByPID(srv, 100).Name
+
+	writeUserRules(t, `[{"id": "acme", "priority": 1, "exe_pattern": "^/opt/acme/", "name_source": "static", "static_name": "acme"}]`)
+	if _, err := srv.reloadRules(); err != nil {
+		t.Fatalf("reloadRules: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	srv.handleAPIRulesApply(rec, httptest.NewRequest(http.MethodPost, "/api/rules/apply", nil))
+	var applied []NameSuggestion
+	json.NewDecoder(rec.Body).Decode(&applied)
+	if len(applied) != 1 || applied[0].Name != oldName || applied[0].Suggested != "acme.localhost" {
+		t.Fatalf("applied = %+v, want %s -> acme.localhost", applied, oldName)
+	}
+
+	if svc := srv.services["acme.localhost"]; svc == nil || svc.PID != 100 {
+		t.Errorf("service acme.localhost = %+v, want the renamed service", svc)
+	}
+	record, ok := srv.store.GetByName("acme.localhost")
+	if !ok || record.UserDefined {
+		t.Errorf("record = %+v, want it renamed and still rule-named", record)
+	}
+
+	// Nothing is left to suggest, and another scan keeps the new name
+	srv.discover()
+	srv.mu.RLock()
+	left := srv.nameSuggestionsLocked()
+	srv.mu.RUnlock()
+	if len(left) != 0 || srv.services["acme.localhost"] == nil {
+		t.Errorf("after apply: suggestions %+v, services %v", left, srv.services)
+	}
+}
+
+// loopTestServer returns a server whose background loops scan the listeners
+// given to the returned add function, and the path of its store.
+func loopTestServer(t *testing.T) (srv *Server, storePath string, add func(portscan.Listener)) {
+	t.Helper()
+	srv = newTestServer(t)
+	storePath = filepath.Join(t.TempDir(), "services.json")
+	store, err := storage.NewStore(storePath)
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	srv.store = store
+	srv.pollInterval = 10 * time.Millisecond
+	srv.healthInterval = 10 * time.Millisecond
+	srv.exportFile = filepath.Join(t.TempDir(), "export.json")
+
+	var mu sync.Mutex
+	var listeners []portscan.Listener
+	srv.scan = func() ([]portscan.Listener, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]portscan.Listener(nil), listeners...), nil
+	}
+	return srv, storePath, func(l portscan.Listener) {
+		mu.Lock()
+		defer mu.Unlock()
+		listeners = append(listeners, l)
+	}
+}
+
+// waitForRecord waits until the store has a record named name.
+func waitForRecord(t *testing.T, store *storage.Store, name string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, ok := store.GetByName(name); ok {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s was never registered", name)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestHandOver_NoStoreWritesAfterHandoff(t *testing.T) {
+	srv, storePath, addListener := loopTestServer(t)
+	addListener(portscan.Listener{Port: backendPort(t), PID: 100, ExePath: "/opt/alpha/bin/alpha", Args: []string{"alpha"}})
+	srv.startLoops()
+	waitForRecord(t, srv.store, "alpha.localhost")
+
+	var storeBefore, exportBefore []byte
+	err := srv.handOver(func() error {
+		storeBefore, _ = os.ReadFile(storePath)
+		exportBefore, _ = os.ReadFile(srv.exportFile)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("handOver: %v", err)
+	}
+
+	// A new listener and an API change after the handoff must not reach disk
+	addListener(portscan.Listener{Port: backendPort(t), PID: 200, ExePath: "/opt/beta/bin/beta", Args: []string{"beta"}})
+	time.Sleep(10 * srv.pollInterval)
+	record, _ := srv.store.GetByName("alpha.localhost")
+	record.Keep = true
+	if err := srv.store.Save(record); !errors.Is(err, storage.ErrReadOnly) {
+		t.Errorf("Save after handoff = %v, want ErrReadOnly", err)
+	}
+	srv.writeExport()
+
+	if _, ok := srv.store.GetByName("beta.localhost"); ok {
+		t.Error("discovery kept running after the handoff")
+	}
+	if storeAfter, _ := os.ReadFile(storePath); !bytes.Equal(storeAfter, storeBefore) {
+		t.Errorf("store file changed after the handoff:\n%s", storeAfter)
+	}
+	if exportAfter, _ := os.ReadFile(srv.exportFile); !bytes.Equal(exportAfter, exportBefore) {
+		t.Errorf("export file changed after the handoff:\n%s", exportAfter)
+	}
+}
+
+func TestHandOver_FailedRestartResumes(t *testing.T) {
+	srv, storePath, addListener := loopTestServer(t)
+	srv.startLoops()
+	t.Cleanup(srv.stopLoops)
+
+	if err := srv.handOver(func() error { return errors.New("exec failed") }); err == nil {
+		t.Fatal("handOver should return the restart error")
+	}
+
+	addListener(portscan.Listener{Port: backendPort(t), PID: 100, ExePath: "/opt/alpha/bin/alpha", Args: []string{"alpha"}})
+	waitForRecord(t, srv.store, "alpha.localhost")
+
+	reloaded, err := storage.NewStore(storePath)
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	if _, ok := reloaded.GetByName("alpha.localhost"); !ok {
+		t.Error("store writes did not resume after a failed restart")
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyRestart delivers the graceful restart signal (SIGUSR2) to c
+func notifyRestart(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGUSR2)
+}
@@ -0,0 +1,9 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// notifyRestart does nothing: Windows has no SIGUSR2, so the daemon cannot
+// be restarted in place there
+func notifyRestart(c chan<- os.Signal) {}
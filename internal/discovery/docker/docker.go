@@ -1,12 +1,16 @@
 package docker
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 const (
@@ -14,6 +18,13 @@ const (
 	apiVersion        = "v1.43"
 )
 
+// DefaultScanTimeout bounds a Scan so a hung Docker daemon cannot stall
+// discovery.
+const DefaultScanTimeout = 5 * time.Second
+
+// ErrTimeout is returned when the Docker daemon does not answer a scan in time.
+var ErrTimeout = errors.New("docker api timed out")
+
 // ContainerService represents a service discovered from a running Docker container.
 type ContainerService struct {
 	ContainerID    string
@@ -30,11 +41,12 @@ type ContainerService struct {
 type Discovery struct {
 	socketPath string
 	client     *http.Client
+	timeout    time.Duration
 }
 
 // NewDiscovery creates a Discovery that communicates with the Docker daemon
 // over the given Unix socket path. If socketPath is empty, the default
-// /var/run/docker.sock is used.
+// /var/run/docker.sock is used. Scans time out after DefaultScanTimeout.
 func NewDiscovery(socketPath string) *Discovery {
 	if socketPath == "" {
 		socketPath = defaultSocketPath
@@ -43,8 +55,20 @@ func NewDiscovery(socketPath string) *Discovery {
 		socketPath: socketPath,
 		client: &http.Client{
 			Transport: newUnixTransport(socketPath),
+			Timeout:   DefaultScanTimeout,
 		},
+		timeout: DefaultScanTimeout,
+	}
+}
+
+// SetTimeout changes how long a scan may take. Zero or negative disables
+// the limit, leaving cancellation to the context passed to ScanContext.
+func (d *Discovery) SetTimeout(timeout time.Duration) {
+	if timeout < 0 {
+		timeout = 0
 	}
+	d.timeout = timeout
+	d.client.Timeout = timeout
 }
 
 // Available reports whether the Docker socket exists and is accessible.
@@ -58,17 +82,34 @@ func (d *Discovery) Available() bool {
 }
 
 // Scan queries the Docker daemon for running containers and returns a
-// ContainerService for every exposed port it finds.
+// ContainerService for every exposed port it finds. It gives up after the
+// configured timeout.
 func (d *Discovery) Scan() ([]ContainerService, error) {
-	resp, err := d.client.Get("http://localhost/" + apiVersion + "/containers/json")
+	return d.ScanContext(context.Background())
+}
+
+// ScanContext is like Scan but also stops when ctx is done. A scan that
+// runs out of time returns an error wrapping ErrTimeout.
+func (d *Discovery) ScanContext(ctx context.Context) ([]ContainerService, error) {
+	if d.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/"+apiVersion+"/containers/json", nil)
 	if err != nil {
-		return nil, fmt.Errorf("docker api request failed: %w", err)
+		return nil, err
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, d.requestError(ctx, "docker api request failed", err)
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("reading docker response: %w", err)
+		return nil, d.requestError(ctx, "reading docker response", err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
@@ -83,6 +124,19 @@ func (d *Discovery) Scan() ([]ContainerService, error) {
 	return parseContainers(containers), nil
 }
 
+// requestError wraps a failed request, reporting deadline expiry (from ctx
+// or the client timeout) as ErrTimeout
+func (d *Discovery) requestError(ctx context.Context, what string, err error) error {
+	var netErr interface{ Timeout() bool }
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		if d.timeout > 0 {
+			return fmt.Errorf("%s: %w after %s", what, ErrTimeout, d.timeout)
+		}
+		return fmt.Errorf("%s: %w", what, ErrTimeout)
+	}
+	return fmt.Errorf("%s: %w", what, err)
+}
+
 // --- Docker Engine API JSON types (subset) ---
 
 type containerJSON struct {
@@ -117,7 +171,8 @@ func CleanContainerName(name string) string {
 }
 
 // parseContainers converts raw Docker API container data into ContainerService
-// entries. A container with multiple port mappings produces multiple entries.
+// entries. A container with multiple port mappings produces multiple entries,
+// unless a nameport.port label picks the one port to target.
 func parseContainers(containers []containerJSON) []ContainerService {
 	var services []ContainerService
 	for _, c := range containers {
@@ -126,43 +181,75 @@ func parseContainers(containers []containerJSON) []ContainerService {
 			name = CleanContainerName(c.Names[0])
 		}
 
-		composeProject := c.Labels["com.docker.compose.project"]
-		composeService := c.Labels["com.docker.compose.service"]
+		// Override name from label if present.
+		if labelName, ok := c.Labels["nameport.name"]; ok && labelName != "" {
+			name = labelName
+		}
 
 		bridgeIP := containerBridgeIP(c.NetworkSettings)
 
-		for _, p := range c.Ports {
-			if p.Type != "tcp" {
-				continue
-			}
-
-			host, port := resolveHostPort(p, bridgeIP)
-			if port == 0 {
-				continue
-			}
-
-			svc := ContainerService{
+		add := func(host string, port int) {
+			services = append(services, ContainerService{
 				ContainerID:    c.ID,
 				ContainerName:  name,
 				ImageName:      c.Image,
 				Port:           port,
 				TargetHost:     host,
 				Labels:         c.Labels,
-				ComposeProject: composeProject,
-				ComposeService: composeService,
+				ComposeProject: c.Labels["com.docker.compose.project"],
+				ComposeService: c.Labels["com.docker.compose.service"],
+			})
+		}
+
+		// An explicit app port also covers containers that publish nothing
+		if labelPort := portLabel(c.Labels); labelPort != 0 {
+			if host, port := resolveLabelPort(c.Ports, labelPort, bridgeIP); port != 0 {
+				add(host, port)
 			}
+			continue
+		}
 
-			// Override name from label if present.
-			if labelName, ok := c.Labels["nameport.name"]; ok && labelName != "" {
-				svc.ContainerName = labelName
+		for _, p := range c.Ports {
+			if p.Type != "tcp" {
+				continue
 			}
 
-			services = append(services, svc)
+			host, port := resolveHostPort(p, bridgeIP)
+			if port == 0 {
+				continue
+			}
+			add(host, port)
 		}
 	}
 	return services
 }
 
+// portLabel returns the container port named by the nameport.port label, or
+// 0 when the label is missing or not a valid port.
+func portLabel(labels map[string]string) int {
+	port, err := strconv.Atoi(strings.TrimSpace(labels["nameport.port"]))
+	if err != nil || port < 1 || port > 65535 {
+		return 0
+	}
+	return port
+}
+
+// resolveLabelPort determines the target for a container port chosen by
+// label. A host mapping of that port is preferred since it is reachable even
+// when the host is not attached to the container's network; otherwise the
+// container IP is used directly.
+func resolveLabelPort(ports []portMapping, labelPort int, bridgeIP string) (string, int) {
+	for _, p := range ports {
+		if p.Type == "tcp" && p.PrivatePort == labelPort && p.PublicPort != 0 {
+			return "127.0.0.1", p.PublicPort
+		}
+	}
+	if bridgeIP != "" {
+		return bridgeIP, labelPort
+	}
+	return "", 0
+}
+
 // resolveHostPort determines the target host and port for a container port
 // mapping. Host-mapped ports (PublicPort != 0) use 127.0.0.1; otherwise the
 // container's bridge network IP is used with the private port.
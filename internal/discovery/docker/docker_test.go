@@ -1,12 +1,15 @@
 package docker
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net"
 	"net/http"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 // ---------------------------------------------------------------------------
@@ -268,6 +271,135 @@ func TestParseContainers_NameLabel(t *testing.T) {
 	}
 }
 
+// ---------------------------------------------------------------------------
+// nameport.port label selects the target port
+// ---------------------------------------------------------------------------
+
+func TestParseContainers_PortLabelUnpublished(t *testing.T) {
+	// No published ports at all: the label port is reached on the bridge IP
+	raw := `[{
+		"Id": "port1",
+		"Names": ["/worker"],
+		"Image": "myimage",
+		"Labels": {"nameport.port": "3000"},
+		"Ports": [],
+		"NetworkSettings": {"Networks": {"appnet": {"IPAddress": "172.20.0.4"}}}
+	}]`
+
+	var containers []containerJSON
+	if err := json.Unmarshal([]byte(raw), &containers); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	services := parseContainers(containers)
+	if len(services) != 1 {
+		t.Fatalf("expected 1 service, got %d", len(services))
+	}
+	if services[0].TargetHost != "172.20.0.4" || services[0].Port != 3000 {
+		t.Errorf("target = %s:%d, want 172.20.0.4:3000", services[0].TargetHost, services[0].Port)
+	}
+}
+
+func TestParseContainers_PortLabelSelectsPort(t *testing.T) {
+	// Only the labelled port is registered, not every exposed one
+	raw := `[{
+		"Id": "port2",
+		"Names": ["/app"],
+		"Image": "myimage",
+		"Labels": {"nameport.port": "8080"},
+		"Ports": [
+			{"PrivatePort": 8080, "PublicPort": 0, "Type": "tcp"},
+			{"PrivatePort": 9229, "PublicPort": 0, "Type": "tcp"}
+		],
+		"NetworkSettings": {"Networks": {"bridge": {"IPAddress": "172.17.0.8"}}}
+	}]`
+
+	var containers []containerJSON
+	if err := json.Unmarshal([]byte(raw), &containers); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	services := parseContainers(containers)
+	if len(services) != 1 {
+		t.Fatalf("expected 1 service, got %d", len(services))
+	}
+	if services[0].TargetHost != "172.17.0.8" || services[0].Port != 8080 {
+		t.Errorf("target = %s:%d, want 172.17.0.8:8080", services[0].TargetHost, services[0].Port)
+	}
+}
+
+func TestParseContainers_PortLabelPrefersPublished(t *testing.T) {
+	raw := `[{
+		"Id": "port3",
+		"Names": ["/web"],
+		"Image": "nginx",
+		"Labels": {"nameport.port": "80"},
+		"Ports": [
+			{"IP": "0.0.0.0", "PrivatePort": 443, "PublicPort": 8443, "Type": "tcp"},
+			{"IP": "0.0.0.0", "PrivatePort": 80, "PublicPort": 8081, "Type": "tcp"}
+		],
+		"NetworkSettings": {"Networks": {"bridge": {"IPAddress": "172.17.0.9"}}}
+	}]`
+
+	var containers []containerJSON
+	if err := json.Unmarshal([]byte(raw), &containers); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	services := parseContainers(containers)
+	if len(services) != 1 {
+		t.Fatalf("expected 1 service, got %d", len(services))
+	}
+	if services[0].TargetHost != "127.0.0.1" || services[0].Port != 8081 {
+		t.Errorf("target = %s:%d, want published 127.0.0.1:8081", services[0].TargetHost, services[0].Port)
+	}
+}
+
+func TestParseContainers_PortLabelInvalid(t *testing.T) {
+	// A bad label is ignored and the usual port mapping applies
+	raw := `[{
+		"Id": "port4",
+		"Names": ["/web"],
+		"Image": "nginx",
+		"Labels": {"nameport.port": "http"},
+		"Ports": [{"IP": "0.0.0.0", "PrivatePort": 80, "PublicPort": 8082, "Type": "tcp"}],
+		"NetworkSettings": {"Networks": {"bridge": {"IPAddress": "172.17.0.10"}}}
+	}]`
+
+	var containers []containerJSON
+	if err := json.Unmarshal([]byte(raw), &containers); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	services := parseContainers(containers)
+	if len(services) != 1 {
+		t.Fatalf("expected 1 service, got %d", len(services))
+	}
+	if services[0].Port != 8082 {
+		t.Errorf("Port = %d, want 8082", services[0].Port)
+	}
+}
+
+func TestParseContainers_PortLabelUnreachable(t *testing.T) {
+	// Not published and no container IP: nothing to target
+	raw := `[{
+		"Id": "port5",
+		"Names": ["/isolated"],
+		"Image": "myimage",
+		"Labels": {"nameport.port": "3000"},
+		"Ports": []
+	}]`
+
+	var containers []containerJSON
+	if err := json.Unmarshal([]byte(raw), &containers); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	if services := parseContainers(containers); len(services) != 0 {
+		t.Errorf("expected 0 services, got %d", len(services))
+	}
+}
+
 // ---------------------------------------------------------------------------
 // Port mapping logic: resolveHostPort
 // ---------------------------------------------------------------------------
@@ -400,6 +532,91 @@ func TestScan_FakeDaemon(t *testing.T) {
 	}
 }
 
+// ---------------------------------------------------------------------------
+// Scan timeouts
+// ---------------------------------------------------------------------------
+
+// startSlowDaemon serves an empty container list over a Unix socket after
+// delay, or once the test ends
+func startSlowDaemon(t *testing.T, delay time.Duration) string {
+	t.Helper()
+	sockPath := filepath.Join(t.TempDir(), "docker.sock")
+	ln, err := net.Listen("unix", sockPath)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	done := make(chan struct{})
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(delay):
+		case <-done:
+		}
+		w.Write([]byte("[]"))
+	})}
+	go srv.Serve(ln)
+	t.Cleanup(func() {
+		close(done)
+		srv.Close()
+	})
+	return sockPath
+}
+
+func TestScan_Timeout(t *testing.T) {
+	d := NewDiscovery(startSlowDaemon(t, time.Minute))
+	d.SetTimeout(50 * time.Millisecond)
+
+	start := time.Now()
+	_, err := d.Scan()
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("Scan() error = %v, want ErrTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Scan() took %s, want it to stop at the timeout", elapsed)
+	}
+}
+
+func TestScanContext_Cancelled(t *testing.T) {
+	d := NewDiscovery(startSlowDaemon(t, time.Minute))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+
+	_, err := d.ScanContext(ctx)
+	if err == nil {
+		t.Fatal("ScanContext() succeeded after cancel")
+	}
+	if errors.Is(err, ErrTimeout) {
+		t.Errorf("ScanContext() error = %v, cancellation is not a timeout", err)
+	}
+}
+
+func TestScanContext_Deadline(t *testing.T) {
+	d := NewDiscovery(startSlowDaemon(t, time.Minute))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := d.ScanContext(ctx); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("ScanContext() error = %v, want ErrTimeout", err)
+	}
+}
+
+func TestScan_WithinTimeout(t *testing.T) {
+	d := NewDiscovery(startSlowDaemon(t, 10*time.Millisecond))
+	d.SetTimeout(5 * time.Second)
+
+	services, err := d.Scan()
+	if err != nil {
+		t.Fatalf("Scan() error: %v", err)
+	}
+	if len(services) != 0 {
+		t.Errorf("expected no services, got %d", len(services))
+	}
+}
+
 // ---------------------------------------------------------------------------
 // NewDiscovery default socket path
 // ---------------------------------------------------------------------------
@@ -0,0 +1,137 @@
+// Package handoff passes listening sockets from a running daemon to its
+// replacement, so that a graceful restart has no window in which the ports
+// are closed.
+//
+// The old process starts the new one with the listeners as extra files
+// (fd 3, 4, ...) and names them in the EnvVar environment variable. The new
+// process picks them up with Listen instead of binding again.
+package handoff
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// EnvVar names the inherited listeners, in file descriptor order starting at
+// fd 3, e.g. "http,https".
+const EnvVar = "NAMEPORT_LISTEN_FDS"
+
+// firstFD is the descriptor of the first entry of exec.Cmd.ExtraFiles
+const firstFD = 3
+
+var (
+	inheritOnce sync.Once
+	inherited   map[string]net.Listener
+	inheritErr  error
+)
+
+// Listen returns the listener named name inherited from the previous
+// process, or else a new TCP listener on addr.
+func Listen(name, addr string) (net.Listener, error) {
+	inheritOnce.Do(func() {
+		value := os.Getenv(EnvVar)
+		// Don't pass stale descriptors on to processes we start
+		os.Unsetenv(EnvVar)
+		inherited, inheritErr = inherit(value, func(fd int, name string) *os.File {
+			return os.NewFile(uintptr(fd), name)
+		})
+	})
+	if inheritErr != nil {
+		return nil, inheritErr
+	}
+	if ln, ok := inherited[name]; ok {
+		delete(inherited, name)
+		return ln, nil
+	}
+	return net.Listen("tcp", addr)
+}
+
+// inherit turns the descriptors named in value into listeners. newFile
+// returns the file for a descriptor (os.NewFile outside of tests).
+func inherit(value string, newFile func(fd int, name string) *os.File) (map[string]net.Listener, error) {
+	listeners := make(map[string]net.Listener)
+	if value == "" {
+		return listeners, nil
+	}
+	for i, name := range strings.Split(value, ",") {
+		f := newFile(firstFD+i, name)
+		if f == nil {
+			return nil, fmt.Errorf("handoff: invalid descriptor %d for %s", firstFD+i, name)
+		}
+		ln, err := net.FileListener(f)
+		f.Close() // FileListener holds its own copy
+		if err != nil {
+			return nil, fmt.Errorf("handoff: inherit %s listener: %w", name, err)
+		}
+		listeners[name] = ln
+	}
+	return listeners, nil
+}
+
+// Listener is a named listener to hand to the next process
+type Listener struct {
+	Name     string
+	Listener net.Listener
+}
+
+// files returns duplicates of the listeners' descriptors and the EnvVar
+// value naming them.
+func files(listeners []Listener) ([]*os.File, string, error) {
+	var fs []*os.File
+	var names []string
+	for _, l := range listeners {
+		fl, ok := l.Listener.(interface{ File() (*os.File, error) })
+		if !ok {
+			closeAll(fs)
+			return nil, "", fmt.Errorf("handoff: %s listener (%T) has no file descriptor", l.Name, l.Listener)
+		}
+		if strings.Contains(l.Name, ",") || l.Name == "" {
+			closeAll(fs)
+			return nil, "", fmt.Errorf("handoff: invalid listener name %q", l.Name)
+		}
+		f, err := fl.File()
+		if err != nil {
+			closeAll(fs)
+			return nil, "", fmt.Errorf("handoff: %s listener: %w", l.Name, err)
+		}
+		fs = append(fs, f)
+		names = append(names, l.Name)
+	}
+	return fs, strings.Join(names, ","), nil
+}
+
+func closeAll(fs []*os.File) {
+	for _, f := range fs {
+		f.Close()
+	}
+}
+
+// Restart starts path with args as the replacement process, handing it the
+// listeners. It returns once the process has started; the caller should
+// then stop accepting connections and drain.
+func Restart(path string, args []string, listeners []Listener) (*os.Process, error) {
+	if len(listeners) == 0 {
+		return nil, errors.New("handoff: no listeners to hand off")
+	}
+	fs, names, err := files(listeners)
+	if err != nil {
+		return nil, err
+	}
+	defer closeAll(fs) // The child has its own copies once started
+
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = fs
+	cmd.Env = append(os.Environ(), EnvVar+"="+names)
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("handoff: start %s: %w", path, err)
+	}
+	return cmd.Process, nil
+}
@@ -0,0 +1,106 @@
+package handoff
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"os"
+	"testing"
+)
+
+func TestFilesAndInherit_RoundTrip(t *testing.T) {
+	httpLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer httpLn.Close()
+	httpsLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer httpsLn.Close()
+
+	fs, names, err := files([]Listener{{"http", httpLn}, {"https", httpsLn}})
+	if err != nil {
+		t.Fatalf("files: %v", err)
+	}
+	if names != "http,https" {
+		t.Errorf("names = %q, want http,https", names)
+	}
+
+	// The new process sees the files as fd 3, 4, ...
+	got, err := inherit(names, func(fd int, name string) *os.File {
+		return fs[fd-firstFD]
+	})
+	if err != nil {
+		t.Fatalf("inherit: %v", err)
+	}
+	defer func() {
+		for _, ln := range got {
+			ln.Close()
+		}
+	}()
+
+	for name, orig := range map[string]net.Listener{"http": httpLn, "https": httpsLn} {
+		ln, ok := got[name]
+		if !ok {
+			t.Fatalf("%s listener not inherited", name)
+		}
+		if ln.Addr().String() != orig.Addr().String() {
+			t.Errorf("%s: inherited %s, want %s", name, ln.Addr(), orig.Addr())
+		}
+	}
+
+	// The inherited listener accepts on the same socket, so the old one can
+	// stop accepting without a gap
+	httpLn.Close()
+	go func() {
+		conn, err := got["http"].Accept()
+		if err != nil {
+			return
+		}
+		io.WriteString(conn, "hello\n")
+		conn.Close()
+	}()
+	conn, err := net.Dial("tcp", got["http"].Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil || line != "hello\n" {
+		t.Errorf("read %q, %v; want hello", line, err)
+	}
+}
+
+func TestInherit_Empty(t *testing.T) {
+	got, err := inherit("", func(int, string) *os.File {
+		t.Fatal("no descriptors should be opened")
+		return nil
+	})
+	if err != nil || len(got) != 0 {
+		t.Errorf("inherit(\"\") = %v, %v; want no listeners", got, err)
+	}
+}
+
+func TestFiles_RejectsBadNames(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	for _, name := range []string{"", "a,b"} {
+		if _, _, err := files([]Listener{{name, ln}}); err == nil {
+			t.Errorf("files accepted listener name %q", name)
+		}
+	}
+}
+
+func TestListen_FallsBackToNewListener(t *testing.T) {
+	ln, err := Listen("http", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	ln.Close()
+}
@@ -0,0 +1,69 @@
+//go:build integration
+
+package handoff
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+// childEnv makes the re-executed test binary act as the replacement daemon
+const childEnv = "HANDOFF_TEST_CHILD"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(childEnv) == "1" {
+		runChild()
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// runChild serves one connection on the inherited listener, then exits
+func runChild() {
+	ln, err := Listen("http", "127.0.0.1:0")
+	if err != nil {
+		os.Exit(2)
+	}
+	conn, err := ln.Accept()
+	if err != nil {
+		os.Exit(3)
+	}
+	io.WriteString(conn, "child\n")
+	conn.Close()
+}
+
+func TestRestart_ChildServesInheritedListener(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := ln.Addr().String()
+
+	t.Setenv(childEnv, "1")
+	proc, err := Restart(os.Args[0], nil, []Listener{{"http", ln}})
+	if err != nil {
+		t.Fatalf("Restart: %v", err)
+	}
+	// The old process stops accepting; the port stays open in the child
+	ln.Close()
+
+	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		t.Fatalf("dial after handoff: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil || line != "child\n" {
+		t.Errorf("read %q, %v; want the child's reply", line, err)
+	}
+
+	state, err := proc.Wait()
+	if err != nil || !state.Success() {
+		t.Errorf("child exited with %v, %v", state, err)
+	}
+}
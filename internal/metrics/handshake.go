@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxPendingHandshakes bounds the number of in-flight handshakes tracked.
+// Clients that connect and never finish are forgotten once it is reached.
+const maxPendingHandshakes = 1024
+
+// HandshakeFailure summarizes the failed TLS handshakes for one server name.
+// ServerName is empty for clients that sent no SNI.
+type HandshakeFailure struct {
+	ServerName string    `json:"server_name"`
+	Count      int64     `json:"count"`
+	LastError  string    `json:"last_error"`
+	LastSeen   time.Time `json:"last_seen"`
+}
+
+// HandshakeTracker counts failed TLS handshakes per requested server name.
+// The server name is only known mid-handshake, so Hello records it per
+// connection and Failed or Done later resolves it by remote address.
+type HandshakeTracker struct {
+	mu       sync.Mutex
+	pending  map[string]string // remote address -> server name
+	failures map[string]*HandshakeFailure
+}
+
+// NewHandshakeTracker creates an empty HandshakeTracker.
+func NewHandshakeTracker() *HandshakeTracker {
+	return &HandshakeTracker{
+		pending:  make(map[string]string),
+		failures: make(map[string]*HandshakeFailure),
+	}
+}
+
+// Hello records the server name a client asked for on the connection from
+// remoteAddr.
+func (t *HandshakeTracker) Hello(remoteAddr, serverName string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.pending) >= maxPendingHandshakes {
+		t.pending = make(map[string]string)
+	}
+	t.pending[remoteAddr] = serverName
+}
+
+// Done forgets the connection from remoteAddr, whether or not its handshake
+// succeeded.
+func (t *HandshakeTracker) Done(remoteAddr string) {
+	t.mu.Lock()
+	delete(t.pending, remoteAddr)
+	t.mu.Unlock()
+}
+
+// Failed counts a failed handshake on the connection from remoteAddr and
+// returns the server name it was attributed to.
+func (t *HandshakeTracker) Failed(remoteAddr, reason string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	name := t.pending[remoteAddr]
+	delete(t.pending, remoteAddr)
+
+	f, ok := t.failures[name]
+	if !ok {
+		f = &HandshakeFailure{ServerName: name}
+		t.failures[name] = f
+	}
+	f.Count++
+	f.LastError = reason
+	f.LastSeen = time.Now()
+	return name
+}
+
+// Failure returns the failures recorded for serverName, if any.
+func (t *HandshakeTracker) Failure(serverName string) (HandshakeFailure, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f, ok := t.failures[serverName]
+	if !ok {
+		return HandshakeFailure{}, false
+	}
+	return *f, true
+}
+
+// Failures returns all recorded failures, sorted by server name.
+func (t *HandshakeTracker) Failures() []HandshakeFailure {
+	t.mu.Lock()
+	out := make([]HandshakeFailure, 0, len(t.failures))
+	for _, f := range t.failures {
+		out = append(out, *f)
+	}
+	t.mu.Unlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].ServerName < out[j].ServerName
+	})
+	return out
+}
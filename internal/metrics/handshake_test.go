@@ -0,0 +1,33 @@
+package metrics
+
+import "testing"
+
+func TestHandshakeTracker_AttributesFailures(t *testing.T) {
+	tr := NewHandshakeTracker()
+
+	tr.Hello("127.0.0.1:1000", "app.localhost")
+	tr.Hello("127.0.0.1:1001", "app.localhost")
+	tr.Hello("127.0.0.1:1002", "ok.localhost")
+
+	if name := tr.Failed("127.0.0.1:1000", "bad version"); name != "app.localhost" {
+		t.Errorf("Failed attributed to %q, want app.localhost", name)
+	}
+	tr.Failed("127.0.0.1:1001", "bad certificate")
+	tr.Done("127.0.0.1:1002")
+
+	// A failure before the ClientHello was read has no server name
+	tr.Failed("127.0.0.1:1003", "EOF")
+
+	f, ok := tr.Failure("app.localhost")
+	if !ok || f.Count != 2 || f.LastError != "bad certificate" {
+		t.Errorf("app.localhost failure = %+v, %v", f, ok)
+	}
+	if _, ok := tr.Failure("ok.localhost"); ok {
+		t.Error("successful handshake counted as a failure")
+	}
+
+	all := tr.Failures()
+	if len(all) != 2 || all[0].ServerName != "" || all[1].ServerName != "app.localhost" {
+		t.Errorf("Failures = %+v", all)
+	}
+}
@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, of the response time
+// histogram buckets (the Prometheus client defaults).
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Histogram counts observations into buckets with fixed upper bounds. It is
+// safe for concurrent use.
+type Histogram struct {
+	mu     sync.Mutex
+	bounds []float64
+	counts []uint64 // counts[i] is the number of observations in bucket i (not cumulative); the last is +Inf
+	count  uint64
+	sum    float64
+}
+
+// NewHistogram creates a Histogram with the given sorted upper bounds. An
+// implicit +Inf bucket catches everything larger.
+func NewHistogram(bounds []float64) *Histogram {
+	return &Histogram{
+		bounds: bounds,
+		counts: make([]uint64, len(bounds)+1),
+	}
+}
+
+// Observe records one value.
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.bounds, v) // First bound >= v
+	h.mu.Lock()
+	h.counts[i]++
+	h.count++
+	h.sum += v
+	h.mu.Unlock()
+}
+
+// HistogramSnapshot is a point-in-time copy of a Histogram.
+type HistogramSnapshot struct {
+	Bounds     []float64 // Upper bounds, without +Inf
+	Cumulative []uint64  // Observations <= each bound, as Prometheus exposes them
+	Count      uint64
+	Sum        float64
+}
+
+// Snapshot returns the current bucket counts.
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	cumulative := make([]uint64, len(h.bounds))
+	var running uint64
+	for i := range h.bounds {
+		running += h.counts[i]
+		cumulative[i] = running
+	}
+	return HistogramSnapshot{
+		Bounds:     h.bounds,
+		Cumulative: cumulative,
+		Count:      h.count,
+		Sum:        h.sum,
+	}
+}
+
+// StatusClass groups a status code into the class used to label latency
+// histograms: "2xx", "4xx" and so on, or "other" for anything outside 100-599.
+func StatusClass(code int) string {
+	if code < 100 || code > 599 {
+		return "other"
+	}
+	return fmt.Sprintf("%dxx", code/100)
+}
+
+// ParseBuckets parses a comma-separated list of bucket bounds in seconds,
+// e.g. "0.01,0.1,1". The bounds must be positive and strictly increasing.
+func ParseBuckets(s string) ([]float64, error) {
+	var bounds []float64
+	for _, field := range strings.Split(s, ",") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil || v <= 0 {
+			return nil, fmt.Errorf("invalid bucket %q: want a positive number of seconds", field)
+		}
+		if len(bounds) > 0 && v <= bounds[len(bounds)-1] {
+			return nil, fmt.Errorf("buckets must be increasing: %g after %g", v, bounds[len(bounds)-1])
+		}
+		bounds = append(bounds, v)
+	}
+	return bounds, nil
+}
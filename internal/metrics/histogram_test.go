@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHistogram_Observe(t *testing.T) {
+	h := NewHistogram([]float64{0.1, 0.5, 1})
+	for _, v := range []float64{0.05, 0.1, 0.3, 0.7, 2} {
+		h.Observe(v)
+	}
+
+	snap := h.Snapshot()
+	// A value equal to a bound belongs to that bound's bucket
+	if want := []uint64{2, 3, 4}; !reflect.DeepEqual(snap.Cumulative, want) {
+		t.Errorf("Cumulative = %v, want %v", snap.Cumulative, want)
+	}
+	if snap.Count != 5 {
+		t.Errorf("Count = %d, want 5", snap.Count)
+	}
+	if snap.Sum < 3.149 || snap.Sum > 3.151 {
+		t.Errorf("Sum = %g, want 3.15", snap.Sum)
+	}
+}
+
+func TestCollector_LatencyByStatusClass(t *testing.T) {
+	c := NewCollectorWithBuckets([]float64{0.01, 0.1})
+	c.RecordRequest("web", 200, 0, 0, 5*time.Millisecond)
+	c.RecordRequest("web", 204, 0, 0, 50*time.Millisecond)
+	c.RecordRequest("web", 503, 0, 0, 500*time.Millisecond)
+
+	sm := c.GetMetrics("web")
+	sm.mu.Lock()
+	ok, failed := sm.Latency["2xx"], sm.Latency["5xx"]
+	sm.mu.Unlock()
+	if ok == nil || failed == nil {
+		t.Fatalf("Latency classes = %v, want 2xx and 5xx", sm.Latency)
+	}
+	if got := ok.Snapshot().Cumulative; !reflect.DeepEqual(got, []uint64{1, 2}) {
+		t.Errorf("2xx buckets = %v, want [1 2]", got)
+	}
+	if got := failed.Snapshot(); got.Count != 1 || !reflect.DeepEqual(got.Cumulative, []uint64{0, 0}) {
+		t.Errorf("5xx = %+v, want one observation above every bound", got)
+	}
+
+	c.Reset("web")
+	sm.mu.Lock()
+	n := len(sm.Latency)
+	sm.mu.Unlock()
+	if n != 0 {
+		t.Errorf("Reset left %d latency histograms", n)
+	}
+}
+
+func TestStatusClass(t *testing.T) {
+	for code, want := range map[int]string{200: "2xx", 302: "3xx", 404: "4xx", 599: "5xx", 0: "other", 600: "other"} {
+		if got := StatusClass(code); got != want {
+			t.Errorf("StatusClass(%d) = %q, want %q", code, got, want)
+		}
+	}
+}
+
+func TestParseBuckets(t *testing.T) {
+	got, err := ParseBuckets("0.01, 0.1,1")
+	if err != nil {
+		t.Fatalf("ParseBuckets: %v", err)
+	}
+	if want := []float64{0.01, 0.1, 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseBuckets = %v, want %v", got, want)
+	}
+
+	for _, bad := range []string{"", "0.1,abc", "0,1", "1,0.5", "0.1,0.1"} {
+		if _, err := ParseBuckets(bad); err == nil {
+			t.Errorf("ParseBuckets(%q) succeeded, want an error", bad)
+		}
+	}
+}
@@ -16,15 +16,22 @@ type ServiceMetrics struct {
 
 	mu          sync.Mutex
 	StatusCodes map[int]int64
+	Started     time.Time             // When counting started, for request rates; guarded by mu
+	Latency     map[string]*Histogram // Response times in seconds per status class ("2xx", ...); guarded by mu
 
-	ResponseTimes *RingBuffer
+	ResponseTimes *RingBuffer // Recent response times in ms, for the dashboard's percentiles
+
+	buckets []float64
 }
 
-func newServiceMetrics(name string) *ServiceMetrics {
+func newServiceMetrics(name string, buckets []float64) *ServiceMetrics {
 	return &ServiceMetrics{
 		ServiceName:   name,
 		StatusCodes:   make(map[int]int64),
+		Latency:       make(map[string]*Histogram),
 		ResponseTimes: NewRingBuffer(),
+		Started:       time.Now(),
+		buckets:       buckets,
 	}
 }
 
@@ -32,12 +39,20 @@ func newServiceMetrics(name string) *ServiceMetrics {
 type Collector struct {
 	mu       sync.RWMutex
 	services map[string]*ServiceMetrics
+	buckets  []float64 // Latency histogram bounds in seconds
 }
 
-// NewCollector creates a new, empty Collector.
+// NewCollector creates a new, empty Collector using DefaultBuckets.
 func NewCollector() *Collector {
+	return NewCollectorWithBuckets(DefaultBuckets)
+}
+
+// NewCollectorWithBuckets creates a new, empty Collector whose latency
+// histograms use the given increasing upper bounds in seconds.
+func NewCollectorWithBuckets(buckets []float64) *Collector {
 	return &Collector{
 		services: make(map[string]*ServiceMetrics),
+		buckets:  buckets,
 	}
 }
 
@@ -57,7 +72,7 @@ func (c *Collector) getOrCreate(name string) *ServiceMetrics {
 	if ok {
 		return sm
 	}
-	sm = newServiceMetrics(name)
+	sm = newServiceMetrics(name, c.buckets)
 	c.services[name] = sm
 	return sm
 }
@@ -69,10 +84,17 @@ func (c *Collector) RecordRequest(name string, statusCode int, bytesIn, bytesOut
 	atomic.AddInt64(&sm.TotalBytesIn, bytesIn)
 	atomic.AddInt64(&sm.TotalBytesOut, bytesOut)
 
+	class := StatusClass(statusCode)
 	sm.mu.Lock()
 	sm.StatusCodes[statusCode]++
+	hist, ok := sm.Latency[class]
+	if !ok {
+		hist = NewHistogram(sm.buckets)
+		sm.Latency[class] = hist
+	}
 	sm.mu.Unlock()
 
+	hist.Observe(duration.Seconds())
 	sm.ResponseTimes.Add(float64(duration.Milliseconds()))
 }
 
@@ -88,6 +110,28 @@ func (c *Collector) DecrementActiveConns(name string) {
 	atomic.AddInt64(&sm.ActiveConns, -1)
 }
 
+// Reset clears the named service's counters and response times, e.g. after
+// its backend restarted. Active connections are left alone since in-flight
+// requests still finish. It returns false if the service has not been seen.
+func (c *Collector) Reset(name string) bool {
+	sm := c.GetMetrics(name)
+	if sm == nil {
+		return false
+	}
+
+	sm.mu.Lock()
+	atomic.StoreInt64(&sm.TotalRequests, 0)
+	atomic.StoreInt64(&sm.TotalBytesIn, 0)
+	atomic.StoreInt64(&sm.TotalBytesOut, 0)
+	sm.StatusCodes = make(map[int]int64)
+	sm.Latency = make(map[string]*Histogram)
+	sm.Started = time.Now()
+	sm.mu.Unlock()
+
+	sm.ResponseTimes.Reset()
+	return true
+}
+
 // GetMetrics returns the ServiceMetrics for the given name, or nil if not found.
 func (c *Collector) GetMetrics(name string) *ServiceMetrics {
 	c.mu.RLock()
@@ -102,6 +102,9 @@ func TestCollector_Snapshot(t *testing.T) {
 	if snap.P95ResponseMs <= snap.P50ResponseMs {
 		t.Errorf("P95 (%f) should be > P50 (%f)", snap.P95ResponseMs, snap.P50ResponseMs)
 	}
+	if snap.RequestsPerSec <= 0 {
+		t.Errorf("RequestsPerSec should be > 0, got %f", snap.RequestsPerSec)
+	}
 }
 
 func TestCollector_Snapshot_Unknown(t *testing.T) {
@@ -155,3 +158,26 @@ func TestCollector_ConcurrentAccess(t *testing.T) {
 		t.Fatalf("total requests = %d, want 1000", total)
 	}
 }
+
+func TestCollector_Reset(t *testing.T) {
+	c := NewCollector()
+	c.RecordRequest("svc", 500, 10, 20, 5*time.Millisecond)
+	c.IncrementActiveConns("svc")
+
+	if !c.Reset("svc") {
+		t.Fatal("Reset returned false for a known service")
+	}
+	snap := c.Snapshot("svc")
+	if snap.TotalRequests != 0 || snap.TotalBytesIn != 0 || snap.TotalBytesOut != 0 {
+		t.Errorf("counters not cleared: %+v", snap)
+	}
+	if len(snap.StatusCodes) != 0 || snap.P95ResponseMs != 0 {
+		t.Errorf("status codes or latency not cleared: %+v", snap)
+	}
+	if snap.ActiveConns != 1 {
+		t.Errorf("ActiveConns = %d, want in-flight requests kept", snap.ActiveConns)
+	}
+	if c.Reset("unknown") {
+		t.Error("Reset returned true for an unknown service")
+	}
+}
@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// PrometheusContentType is the content type of WritePrometheus's output.
+const PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// WritePrometheus writes every service's metrics in the Prometheus text
+// exposition format: request, byte and connection counts, and the response
+// time histograms per status class.
+func WritePrometheus(w io.Writer, c *Collector) error {
+	all := c.GetAllMetrics()
+	names := make([]string, 0, len(all))
+	for name := range all {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	bw := bufio.NewWriter(w)
+
+	header(bw, "nameport_requests_total", "counter", "Proxied requests by service and status code.")
+	for _, name := range names {
+		sm := all[name]
+		sm.mu.Lock()
+		codes := make([]int, 0, len(sm.StatusCodes))
+		for code := range sm.StatusCodes {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+		for _, code := range codes {
+			fmt.Fprintf(bw, "nameport_requests_total{service=%s,code=\"%d\"} %d\n", quote(name), code, sm.StatusCodes[code])
+		}
+		sm.mu.Unlock()
+	}
+
+	header(bw, "nameport_active_connections", "gauge", "Requests currently in flight to the backend.")
+	for _, name := range names {
+		fmt.Fprintf(bw, "nameport_active_connections{service=%s} %d\n", quote(name), atomic.LoadInt64(&all[name].ActiveConns))
+	}
+
+	header(bw, "nameport_request_bytes_total", "counter", "Request body bytes sent to the backend.")
+	for _, name := range names {
+		fmt.Fprintf(bw, "nameport_request_bytes_total{service=%s} %d\n", quote(name), atomic.LoadInt64(&all[name].TotalBytesIn))
+	}
+
+	header(bw, "nameport_response_bytes_total", "counter", "Response body bytes read from the backend.")
+	for _, name := range names {
+		fmt.Fprintf(bw, "nameport_response_bytes_total{service=%s} %d\n", quote(name), atomic.LoadInt64(&all[name].TotalBytesOut))
+	}
+
+	header(bw, "nameport_response_seconds", "histogram", "Backend response time by service and status class.")
+	for _, name := range names {
+		sm := all[name]
+		sm.mu.Lock()
+		classes := make([]string, 0, len(sm.Latency))
+		for class := range sm.Latency {
+			classes = append(classes, class)
+		}
+		sort.Strings(classes)
+		hists := make([]*Histogram, len(classes))
+		for i, class := range classes {
+			hists[i] = sm.Latency[class]
+		}
+		sm.mu.Unlock()
+
+		for i, class := range classes {
+			snap := hists[i].Snapshot()
+			labels := fmt.Sprintf("service=%s,status_class=%s", quote(name), quote(class))
+			for j, bound := range snap.Bounds {
+				fmt.Fprintf(bw, "nameport_response_seconds_bucket{%s,le=\"%s\"} %d\n", labels, formatFloat(bound), snap.Cumulative[j])
+			}
+			fmt.Fprintf(bw, "nameport_response_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, snap.Count)
+			fmt.Fprintf(bw, "nameport_response_seconds_sum{%s} %s\n", labels, formatFloat(snap.Sum))
+			fmt.Fprintf(bw, "nameport_response_seconds_count{%s} %d\n", labels, snap.Count)
+		}
+	}
+
+	return bw.Flush()
+}
+
+// header writes a metric family's HELP and TYPE lines
+func header(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// labelEscaper escapes label values as the exposition format requires
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// quote returns v as a quoted label value
+func quote(v string) string {
+	return `"` + labelEscaper.Replace(v) + `"`
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
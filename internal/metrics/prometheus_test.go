@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	c := NewCollectorWithBuckets([]float64{0.1, 1})
+	c.RecordRequest("web", 200, 10, 100, 50*time.Millisecond)
+	c.RecordRequest("web", 200, 10, 100, 500*time.Millisecond)
+	c.RecordRequest("web", 404, 0, 20, 2*time.Second)
+
+	var b strings.Builder
+	if err := WritePrometheus(&b, c); err != nil {
+		t.Fatalf("WritePrometheus: %v", err)
+	}
+	out := b.String()
+
+	for _, want := range []string{
+		"# TYPE nameport_response_seconds histogram\n",
+		`nameport_requests_total{service="web",code="200"} 2` + "\n",
+		`nameport_requests_total{service="web",code="404"} 1` + "\n",
+		`nameport_response_bytes_total{service="web"} 220` + "\n",
+		`nameport_response_seconds_bucket{service="web",status_class="2xx",le="0.1"} 1` + "\n",
+		`nameport_response_seconds_bucket{service="web",status_class="2xx",le="1"} 2` + "\n",
+		`nameport_response_seconds_bucket{service="web",status_class="2xx",le="+Inf"} 2` + "\n",
+		`nameport_response_seconds_sum{service="web",status_class="2xx"} 0.55` + "\n",
+		`nameport_response_seconds_count{service="web",status_class="2xx"} 2` + "\n",
+		`nameport_response_seconds_bucket{service="web",status_class="4xx",le="1"} 0` + "\n",
+		`nameport_response_seconds_count{service="web",status_class="4xx"} 1` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q\n%s", want, out)
+		}
+	}
+}
+
+func TestWritePrometheus_EscapesLabels(t *testing.T) {
+	c := NewCollector()
+	c.RecordRequest(`we"ird\name`, 200, 0, 0, time.Millisecond)
+
+	var b strings.Builder
+	WritePrometheus(&b, c)
+	if want := `service="we\"ird\\name"`; !strings.Contains(b.String(), want) {
+		t.Errorf("output missing %s\n%s", want, b.String())
+	}
+}
@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+)
+
+const defaultRecentCapacity = 50
+
+// RequestSummary describes a single proxied request.
+type RequestSummary struct {
+	Time       time.Time `json:"time"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Status     int       `json:"status"`
+	DurationMs float64   `json:"duration_ms"`
+}
+
+// RecentRequests is a bounded, thread-safe buffer of the most recent request
+// summaries for a service. When full, new entries overwrite the oldest.
+type RecentRequests struct {
+	mu       sync.Mutex
+	data     []RequestSummary
+	pos      int
+	count    int
+	capacity int
+}
+
+// NewRecentRequests creates a RecentRequests buffer with the default capacity (50).
+func NewRecentRequests() *RecentRequests {
+	return NewRecentRequestsWithCapacity(defaultRecentCapacity)
+}
+
+// NewRecentRequestsWithCapacity creates a RecentRequests buffer with the specified capacity.
+func NewRecentRequestsWithCapacity(capacity int) *RecentRequests {
+	if capacity <= 0 {
+		capacity = defaultRecentCapacity
+	}
+	return &RecentRequests{
+		data:     make([]RequestSummary, capacity),
+		capacity: capacity,
+	}
+}
+
+// Add records a request summary, evicting the oldest one if the buffer is full.
+func (rr *RecentRequests) Add(s RequestSummary) {
+	rr.mu.Lock()
+	rr.data[rr.pos] = s
+	rr.pos = (rr.pos + 1) % rr.capacity
+	if rr.count < rr.capacity {
+		rr.count++
+	}
+	rr.mu.Unlock()
+}
+
+// Len returns the number of summaries currently stored.
+func (rr *RecentRequests) Len() int {
+	rr.mu.Lock()
+	n := rr.count
+	rr.mu.Unlock()
+	return n
+}
+
+// Entries returns a copy of the stored summaries, oldest first.
+func (rr *RecentRequests) Entries() []RequestSummary {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+
+	result := make([]RequestSummary, rr.count)
+	if rr.count < rr.capacity {
+		copy(result, rr.data[:rr.count])
+	} else {
+		n := copy(result, rr.data[rr.pos:])
+		copy(result[n:], rr.data[:rr.pos])
+	}
+	return result
+}
@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRecentRequests_Order(t *testing.T) {
+	rr := NewRecentRequests()
+	if got := rr.Entries(); len(got) != 0 {
+		t.Fatalf("expected no entries, got %d", len(got))
+	}
+
+	for i := 0; i < 3; i++ {
+		rr.Add(RequestSummary{Method: "GET", Path: fmt.Sprintf("/%d", i), Status: 200 + i})
+	}
+
+	entries := rr.Entries()
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+	for i, e := range entries {
+		if want := fmt.Sprintf("/%d", i); e.Path != want {
+			t.Errorf("entries[%d].Path = %s, want %s", i, e.Path, want)
+		}
+		if e.Status != 200+i {
+			t.Errorf("entries[%d].Status = %d, want %d", i, e.Status, 200+i)
+		}
+	}
+}
+
+func TestRecentRequests_Bounded(t *testing.T) {
+	rr := NewRecentRequestsWithCapacity(3)
+	for i := 0; i < 5; i++ {
+		rr.Add(RequestSummary{Path: fmt.Sprintf("/%d", i)})
+	}
+	if rr.Len() != 3 {
+		t.Fatalf("expected Len()=3 after overflow, got %d", rr.Len())
+	}
+
+	// Should contain [/2, /3, /4]
+	entries := rr.Entries()
+	for i, want := range []string{"/2", "/3", "/4"} {
+		if entries[i].Path != want {
+			t.Errorf("entries[%d].Path = %s, want %s", i, entries[i].Path, want)
+		}
+	}
+}
@@ -46,6 +46,14 @@ func (rb *RingBuffer) Add(v float64) {
 	rb.mu.Unlock()
 }
 
+// Reset discards all values.
+func (rb *RingBuffer) Reset() {
+	rb.mu.Lock()
+	rb.pos = 0
+	rb.count = 0
+	rb.mu.Unlock()
+}
+
 // Len returns the number of values currently stored in the buffer.
 func (rb *RingBuffer) Len() int {
 	rb.mu.Lock()
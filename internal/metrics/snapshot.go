@@ -1,6 +1,9 @@
 package metrics
 
-import "sync/atomic"
+import (
+	"sync/atomic"
+	"time"
+)
 
 // MetricsSnapshot is a point-in-time, JSON-serializable view of a service's metrics.
 type MetricsSnapshot struct {
@@ -13,6 +16,8 @@ type MetricsSnapshot struct {
 	P95ResponseMs  float64      `json:"p95_response_ms"`
 	P99ResponseMs  float64      `json:"p99_response_ms"`
 	StatusCodes    map[int]int64 `json:"status_codes"`
+	RequestsPerSec float64      `json:"requests_per_sec"` // Average since the service was first seen
+	TLSHandshakeFailures int64  `json:"tls_handshake_failures,omitempty"` // Filled in by the daemon
 }
 
 // Snapshot returns a MetricsSnapshot for the named service.
@@ -28,17 +33,25 @@ func (c *Collector) Snapshot(name string) *MetricsSnapshot {
 	for k, v := range sm.StatusCodes {
 		codes[k] = v
 	}
+	started := sm.Started
 	sm.mu.Unlock()
 
+	total := atomic.LoadInt64(&sm.TotalRequests)
+	rps := 0.0
+	if elapsed := time.Since(started).Seconds(); elapsed > 0 {
+		rps = float64(total) / elapsed
+	}
+
 	return &MetricsSnapshot{
 		ServiceName:    sm.ServiceName,
 		ActiveConns:    atomic.LoadInt64(&sm.ActiveConns),
-		TotalRequests:  atomic.LoadInt64(&sm.TotalRequests),
+		TotalRequests:  total,
 		TotalBytesIn:   atomic.LoadInt64(&sm.TotalBytesIn),
 		TotalBytesOut:  atomic.LoadInt64(&sm.TotalBytesOut),
 		P50ResponseMs:  sm.ResponseTimes.Percentile(0.50),
 		P95ResponseMs:  sm.ResponseTimes.Percentile(0.95),
 		P99ResponseMs:  sm.ResponseTimes.Percentile(0.99),
 		StatusCodes:    codes,
+		RequestsPerSec: rps,
 	}
 }
@@ -0,0 +1,52 @@
+package naming
+
+import "strings"
+
+// SplitSubdomain splits a subdomain-style name such as "api.ollama.localhost"
+// into its subdomain ("api") and group ("ollama"), the rightmost label before
+// .localhost. Flat names like "ollama.localhost" report ok=false.
+func SplitSubdomain(name string) (sub, group string, ok bool) {
+	base := strings.TrimSuffix(name, ".localhost")
+	idx := strings.LastIndex(base, ".")
+	if idx <= 0 || idx == len(base)-1 {
+		return "", "", false
+	}
+	return base[:idx], base[idx+1:], true
+}
+
+// GroupFor returns the display group for name. Subdomain-style names are
+// always grouped under their rightmost label; other names use fallback (for
+// example a stored or exe-derived group), or ExtractGroup if fallback is empty.
+func GroupFor(name, fallback string) string {
+	if _, group, ok := SplitSubdomain(name); ok {
+		return group
+	}
+	if fallback != "" {
+		return fallback
+	}
+	return ExtractGroup(name)
+}
+
+// IsGroupRoot reports whether name is the group's own name, e.g.
+// "ollama.localhost" for group "ollama". Roots are listed before subdomains.
+func IsGroupRoot(name, group string) bool {
+	return strings.TrimSuffix(name, ".localhost") == group
+}
+
+// GroupedLess orders names within a group: the group root first, then
+// flat names, then subdomains, each alphabetically.
+func GroupedLess(a, b, group string) bool {
+	rank := func(name string) int {
+		if IsGroupRoot(name, group) {
+			return 0
+		}
+		if _, _, ok := SplitSubdomain(name); ok {
+			return 2
+		}
+		return 1
+	}
+	if ra, rb := rank(a), rank(b); ra != rb {
+		return ra < rb
+	}
+	return a < b
+}
@@ -0,0 +1,65 @@
+package naming
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestSplitSubdomain(t *testing.T) {
+	tests := []struct {
+		name      string
+		wantSub   string
+		wantGroup string
+		wantOK    bool
+	}{
+		{"api.ollama.localhost", "api", "ollama", true},
+		{"v1.api.ollama.localhost", "v1.api", "ollama", true},
+		{"ollama.localhost", "", "", false},
+		{"ollama-1.localhost", "", "", false},
+		{"myapp", "", "", false},
+	}
+
+	for _, tt := range tests {
+		sub, group, ok := SplitSubdomain(tt.name)
+		if sub != tt.wantSub || group != tt.wantGroup || ok != tt.wantOK {
+			t.Errorf("SplitSubdomain(%q) = (%q, %q, %v), want (%q, %q, %v)",
+				tt.name, sub, group, ok, tt.wantSub, tt.wantGroup, tt.wantOK)
+		}
+	}
+}
+
+func TestGroupFor_SubdomainsGroupedTogether(t *testing.T) {
+	for _, name := range []string{"api.ollama.localhost", "web.ollama.localhost", "v2.api.ollama.localhost"} {
+		// A stored group must not override an explicit subdomain shape.
+		if got := GroupFor(name, "something-else"); got != "ollama" {
+			t.Errorf("GroupFor(%q) = %q, want ollama", name, got)
+		}
+	}
+	if got := GroupFor("ollama.localhost", ""); got != "ollama" {
+		t.Errorf("GroupFor(ollama.localhost) = %q, want ollama", got)
+	}
+}
+
+func TestGroupFor_FlatNamesUngrouped(t *testing.T) {
+	if got := GroupFor("myapp.localhost", ""); got != "myapp" {
+		t.Errorf("GroupFor(myapp.localhost) = %q, want myapp", got)
+	}
+	if got := GroupFor("other.localhost", ""); got != "other" {
+		t.Errorf("GroupFor(other.localhost) = %q, want other", got)
+	}
+	if got := GroupFor("myapp.localhost", "bundle"); got != "bundle" {
+		t.Errorf("flat name should keep its fallback group, got %q", got)
+	}
+}
+
+func TestGroupedLess_RootFirstThenSubdomains(t *testing.T) {
+	names := []string{"web.ollama.localhost", "ollama-1.localhost", "api.ollama.localhost", "ollama.localhost"}
+	sort.Slice(names, func(i, j int) bool { return GroupedLess(names[i], names[j], "ollama") })
+
+	want := []string{"ollama.localhost", "ollama-1.localhost", "api.ollama.localhost", "web.ollama.localhost"}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("order = %v, want %v", names, want)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package naming
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// IdentityStrategy selects which process attributes make up a service's
+// identity. Launches with the same identity share one stored record.
+type IdentityStrategy string
+
+const (
+	// IdentityExeArgs identifies a service by executable path and arguments (default)
+	IdentityExeArgs IdentityStrategy = "exe+args"
+	// IdentityExeOnly ignores arguments, for tools whose args change every run
+	IdentityExeOnly IdentityStrategy = "exe-only"
+	// IdentityExePort identifies a service by executable path and listening port
+	IdentityExePort IdentityStrategy = "exe+port"
+)
+
+// DefaultIdentityStrategy is used when neither a flag nor a rule picks one
+const DefaultIdentityStrategy = IdentityExeArgs
+
+// ParseIdentityStrategy validates s. The empty string selects the default.
+func ParseIdentityStrategy(s string) (IdentityStrategy, error) {
+	switch st := IdentityStrategy(strings.ToLower(strings.TrimSpace(s))); st {
+	case "":
+		return DefaultIdentityStrategy, nil
+	case IdentityExeArgs, IdentityExeOnly, IdentityExePort:
+		return st, nil
+	default:
+		return "", fmt.Errorf("unknown identity strategy %q (want exe+args, exe-only or exe+port)", s)
+	}
+}
+
+// ComputeIdentity returns the identity hash of a listener under strategy.
+// exe+args gives the same hash as ComputeIdentityHash, so existing records
+// keep their IDs.
+func ComputeIdentity(strategy IdentityStrategy, exePath string, args []string, port int) string {
+	switch strategy {
+	case IdentityExeOnly:
+		return ComputeIdentityHash(exePath, nil)
+	case IdentityExePort:
+		h := sha256.New()
+		h.Write([]byte(exePath))
+		h.Write([]byte("\x00port\x00"))
+		h.Write([]byte(strconv.Itoa(port)))
+		return fmt.Sprintf("%x", h.Sum(nil))
+	default:
+		return ComputeIdentityHash(exePath, args)
+	}
+}
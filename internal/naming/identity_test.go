@@ -0,0 +1,95 @@
+package naming
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestComputeIdentity_ExeOnlyIgnoresArgs(t *testing.T) {
+	exe := "/usr/local/bin/devtool"
+	a := ComputeIdentity(IdentityExeOnly, exe, []string{"devtool", "--tmp", "/tmp/run-8f3a"}, 4000)
+	b := ComputeIdentity(IdentityExeOnly, exe, []string{"devtool", "--tmp", "/tmp/run-c19e"}, 4001)
+	if a != b {
+		t.Errorf("exe-only identities differ for launches with different args: %s vs %s", a, b)
+	}
+
+	if other := ComputeIdentity(IdentityExeOnly, "/usr/local/bin/othertool", nil, 4000); other == a {
+		t.Error("exe-only identity should still depend on the executable")
+	}
+}
+
+func TestComputeIdentity_ExeArgsIsDefault(t *testing.T) {
+	exe := "/usr/bin/python3"
+	args := []string{"python3", "app.py"}
+
+	if got, want := ComputeIdentity(DefaultIdentityStrategy, exe, args, 8000), ComputeIdentityHash(exe, args); got != want {
+		t.Errorf("exe+args identity = %s, want ComputeIdentityHash %s", got, want)
+	}
+	if ComputeIdentity(IdentityExeArgs, exe, args, 8000) == ComputeIdentity(IdentityExeArgs, exe, []string{"python3", "other.py"}, 8000) {
+		t.Error("exe+args identity should depend on the arguments")
+	}
+}
+
+func TestComputeIdentity_ExePort(t *testing.T) {
+	exe := "/usr/local/bin/devtool"
+	a := ComputeIdentity(IdentityExePort, exe, []string{"devtool", "--seed", "1"}, 4000)
+	b := ComputeIdentity(IdentityExePort, exe, []string{"devtool", "--seed", "2"}, 4000)
+	c := ComputeIdentity(IdentityExePort, exe, []string{"devtool", "--seed", "1"}, 4001)
+	if a != b {
+		t.Error("exe+port identity should ignore the arguments")
+	}
+	if a == c {
+		t.Error("exe+port identity should depend on the port")
+	}
+}
+
+func TestParseIdentityStrategy(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    IdentityStrategy
+		wantErr bool
+	}{
+		{"", IdentityExeArgs, false},
+		{"exe+args", IdentityExeArgs, false},
+		{"EXE-ONLY", IdentityExeOnly, false},
+		{" exe+port ", IdentityExePort, false},
+		{"args", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseIdentityStrategy(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseIdentityStrategy(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseIdentityStrategy(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRuleEngineIdentity(t *testing.T) {
+	engine := NewRuleEngineFromRules([]NamingRule{
+		{ID: "devtool-name", Priority: 1, ExePattern: "devtool$", NameSource: "static", StaticName: "dev"},
+		{ID: "devtool-identity", Priority: 2, ExePattern: "devtool$", NameSource: "exe", Identity: "exe-only"},
+	})
+
+	got, ok := engine.Identity("/usr/local/bin/devtool", "/tmp", []string{"devtool", "--x"}, 4000)
+	if !ok || got != IdentityExeOnly {
+		t.Errorf("Identity(devtool) = %q, %v; want %q, true", got, ok, IdentityExeOnly)
+	}
+	if got, ok := engine.Identity("/usr/bin/node", "/tmp", nil, 3000); ok {
+		t.Errorf("Identity(node) = %q, true; want no strategy", got)
+	}
+}
+
+func TestLoadUserRulesRejectsUnknownIdentity(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	data := `[{"id": "bad", "priority": 1, "name_source": "exe", "identity": "pid"}]`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadUserRules(path); err == nil {
+		t.Error("expected error for unknown identity strategy")
+	}
+}
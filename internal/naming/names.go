@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 )
 
 // ExtractBaseName extracts the best possible name from an executable path and CWD
@@ -149,10 +150,13 @@ func isGenericDir(name string) bool {
 	return false
 }
 
-// Generator creates stable names from process information
+// Generator creates stable names from process information. It is safe for
+// concurrent use, so the rules can be swapped while discovery runs.
 type Generator struct {
+	mu         sync.Mutex
 	usedNames  map[string]bool // Tracks which names are in use
 	ruleEngine *RuleEngine     // Data-driven naming rules
+	policy     NamePolicy      // Restrictions applied to generated names
 }
 
 // NewGenerator creates a new name generator with a RuleEngine
@@ -173,13 +177,61 @@ func NewGeneratorWithEngine(engine *RuleEngine) *Generator {
 
 // RuleEngine returns the generator's rule engine
 func (g *Generator) RuleEngine() *RuleEngine {
+	g.mu.Lock()
+	defer g.mu.Unlock()
 	return g.ruleEngine
 }
 
+// SetRuleEngine replaces the generator's rule engine, e.g. after the user
+// rules changed. Names already handed out are kept.
+func (g *Generator) SetRuleEngine(engine *RuleEngine) {
+	g.mu.Lock()
+	g.ruleEngine = engine
+	g.mu.Unlock()
+}
+
+// SetPolicy sets the policy that generated names must satisfy
+func (g *Generator) SetPolicy(p NamePolicy) {
+	g.mu.Lock()
+	g.policy = p
+	g.mu.Unlock()
+}
+
+// Policy returns the generator's name policy
+func (g *Generator) Policy() NamePolicy {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.policy
+}
+
 // GenerateName creates a .localhost name from an executable path.
 // On collision, uses subdomain grouping: <differentiator>.<base>.localhost
 // The differentiator is derived from the port, working directory, or a numeric suffix.
-func (g *Generator) GenerateName(exePath string, cwd string, args []string) string {
+// Names that violate the generator's policy are not reserved and an error
+// wrapping ErrNameRejected is returned.
+func (g *Generator) GenerateName(exePath string, cwd string, args []string) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	name := g.generateName(exePath, cwd, args)
+	if err := g.policy.Check(name); err != nil {
+		delete(g.usedNames, strings.TrimSuffix(name, ".localhost"))
+		return "", err
+	}
+	return name, nil
+}
+
+// SuggestName returns the name the current rules give a process, without
+// collision handling or reserving it. The policy is not applied.
+func (g *Generator) SuggestName(exePath string, cwd string, args []string) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.baseName(exePath, cwd, args) + ".localhost"
+}
+
+// baseName is the sanitized name the rules (or the fallback heuristics) give
+// a process. g.mu must be held.
+func (g *Generator) baseName(exePath string, cwd string, args []string) string {
 	// Try data-driven rules first
 	baseName := ""
 	if g.ruleEngine != nil {
@@ -191,7 +243,13 @@ func (g *Generator) GenerateName(exePath string, cwd string, args []string) stri
 		baseName = ExtractBaseName(exePath, cwd, args)
 	}
 
-	cleaned := SanitizeName(baseName)
+	return SanitizeName(baseName)
+}
+
+// generateName picks and reserves a name without applying the policy. g.mu
+// must be held.
+func (g *Generator) generateName(exePath string, cwd string, args []string) string {
+	cleaned := g.baseName(exePath, cwd, args)
 
 	// Try the base name first
 	if !g.usedNames[cleaned] {
@@ -227,11 +285,21 @@ func (g *Generator) GenerateName(exePath string, cwd string, args []string) stri
 	return fmt.Sprintf("%s.%s.localhost", shortHash, cleaned)
 }
 
+// Reserve marks name as permanently in use, so that it is never generated
+// for a service (e.g. the dashboard's own hostname)
+func (g *Generator) Reserve(name string) {
+	g.mu.Lock()
+	g.usedNames[strings.TrimSuffix(name, ".localhost")] = true
+	g.mu.Unlock()
+}
+
 // ReleaseName marks a name as no longer in use
 func (g *Generator) ReleaseName(name string) {
 	// Remove .localhost suffix if present
 	key := strings.TrimSuffix(name, ".localhost")
+	g.mu.Lock()
 	delete(g.usedNames, key)
+	g.mu.Unlock()
 }
 
 // SanitizeName converts to lowercase and keeps only alphanumeric characters
@@ -259,6 +327,32 @@ func SanitizeName(name string) string {
 	return name
 }
 
+// NormalizeName turns a user-supplied service name into a .localhost name
+// whose labels are valid DNS labels. Each dot-separated label is cleaned
+// with SanitizeName (lowercased, other characters collapsed to hyphens), so
+// "My App" becomes "my-app.localhost" and "api.app" stays a subdomain name.
+// Names with empty labels, labels with no letters or digits, or labels
+// longer than SanitizeName keeps (50 characters) are rejected.
+func NormalizeName(name string) (string, error) {
+	base := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".localhost")
+	if base == "" {
+		return "", fmt.Errorf("invalid name %q: empty", name)
+	}
+
+	labels := strings.Split(base, ".")
+	for i, label := range labels {
+		if !strings.ContainsAny(label, "abcdefghijklmnopqrstuvwxyz0123456789") {
+			return "", fmt.Errorf("invalid name %q: label %q needs a letter or digit", name, label)
+		}
+		if len(label) > 50 {
+			return "", fmt.Errorf("invalid name %q: label %q is longer than 50 characters", name, label)
+		}
+		labels[i] = SanitizeName(label)
+	}
+
+	return strings.Join(labels, ".") + ".localhost", nil
+}
+
 // computeHash creates a stable hash of the executable path
 func computeHash(exePath string) string {
 	h := sha256.New()
@@ -286,11 +380,16 @@ func ExtractGroup(name string) string {
 	return re.ReplaceAllString(base, "")
 }
 
-// ExtractGroupFromExe returns the group name for a service, preferring
-// the macOS .app bundle name when available. This ensures that all binaries
+// ExtractGroupFromExe returns the group name for a service. Subdomain-style
+// names use their rightmost label; otherwise the macOS .app bundle name is
+// preferred when available. This ensures that all binaries
 // inside the same .app bundle (e.g. Contents/MacOS/Ollama and
 // Contents/Resources/ollama) are grouped together.
 func ExtractGroupFromExe(exePath string, name string) string {
+	// An explicit sub.group.localhost name always wins
+	if _, group, ok := SplitSubdomain(name); ok {
+		return group
+	}
 	if appName := extractAppBundleName(exePath); appName != "" {
 		return SanitizeName(appName)
 	}
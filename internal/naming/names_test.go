@@ -0,0 +1,71 @@
+package naming
+
+import "testing"
+
+func TestNormalizeName(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"myapp", "myapp.localhost"},
+		{"myapp.localhost", "myapp.localhost"},
+		{"My App", "my-app.localhost"},
+		{"  API_Server  ", "api-server.localhost"},
+		{"api.app.localhost", "api.app.localhost"},
+		{"V1.API.App", "v1.api.app.localhost"},
+		{"-edge-.app", "edge.app.localhost"},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeName(tt.in)
+		if err != nil {
+			t.Errorf("NormalizeName(%q) error: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("NormalizeName(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeName_Invalid(t *testing.T) {
+	long := ""
+	for i := 0; i < 51; i++ {
+		long += "a"
+	}
+	for _, in := range []string{"", ".localhost", "   ", "api..app", ".app", "app.", "!!!", "api.***.localhost", long} {
+		if got, err := NormalizeName(in); err == nil {
+			t.Errorf("NormalizeName(%q) = %q, want an error", in, got)
+		}
+	}
+}
+
+func TestGenerator_Reserve(t *testing.T) {
+	g := NewGeneratorWithEngine(NewRuleEngineFromRules(nil))
+	g.Reserve("nameport.localhost")
+
+	name, err := g.GenerateName("/usr/local/bin/nameport", "", nil)
+	if err != nil {
+		t.Fatalf("GenerateName: %v", err)
+	}
+	if name == "nameport.localhost" {
+		t.Error("generated the reserved name")
+	}
+}
+
+func TestGenerator_SetRuleEngine(t *testing.T) {
+	g := NewGeneratorWithEngine(NewRuleEngineFromRules(nil))
+	if got := g.SuggestName("/opt/tool/bin/server", "", nil); got != "server.localhost" {
+		t.Fatalf("SuggestName before = %q, want server.localhost", got)
+	}
+
+	g.SetRuleEngine(NewRuleEngineFromRules([]NamingRule{
+		{ID: "tool", Priority: 1, ExePattern: "^/opt/tool/", NameSource: "static", StaticName: "tool"},
+	}))
+	if got := g.SuggestName("/opt/tool/bin/server", "", nil); got != "tool.localhost" {
+		t.Errorf("SuggestName after = %q, want tool.localhost", got)
+	}
+	// Suggesting does not reserve
+	if name, _ := g.GenerateName("/opt/tool/bin/server", "", nil); name != "tool.localhost" {
+		t.Errorf("GenerateName = %q, want tool.localhost", name)
+	}
+}
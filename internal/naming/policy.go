@@ -0,0 +1,118 @@
+package naming
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ErrNameRejected is returned (wrapped) when a generated name violates the NamePolicy
+var ErrNameRejected = errors.New("name rejected by policy")
+
+// NamePolicy restricts which generated names may be registered. The zero value
+// is permissive and accepts every name SanitizeName can produce.
+type NamePolicy struct {
+	AllowedChars   string   `json:"allowed_chars,omitempty"`   // regex character class body per label, e.g. "a-z0-9-"
+	MaxLabels      int      `json:"max_labels,omitempty"`      // max labels before .localhost (0 = unlimited)
+	DenySubstrings []string `json:"deny_substrings,omitempty"` // reject names containing any of these
+
+	allowed *regexp.Regexp // AllowedChars compiled by LoadNamePolicy
+}
+
+// DefaultNamePolicy returns the permissive default policy
+func DefaultNamePolicy() NamePolicy {
+	return NamePolicy{}
+}
+
+// Validate checks that the policy itself is well-formed
+func (p NamePolicy) Validate() error {
+	return p.prepare()
+}
+
+// prepare validates the policy and compiles AllowedChars, so Check does not
+// compile it on every call
+func (p *NamePolicy) prepare() error {
+	if p.MaxLabels < 0 {
+		return fmt.Errorf("max_labels must not be negative")
+	}
+	p.allowed = nil
+	if p.AllowedChars != "" {
+		re, err := allowedCharsPattern(p.AllowedChars)
+		if err != nil {
+			return fmt.Errorf("invalid allowed_chars: %w", err)
+		}
+		p.allowed = re
+	}
+	return nil
+}
+
+// allowedCharsPattern compiles the per-label pattern for an allowed_chars value
+func allowedCharsPattern(chars string) (*regexp.Regexp, error) {
+	return regexp.Compile("^[" + chars + "]+$")
+}
+
+// Check reports whether name (with or without the .localhost suffix) is
+// allowed by the policy. The returned error wraps ErrNameRejected.
+func (p NamePolicy) Check(name string) error {
+	base := strings.TrimSuffix(name, ".localhost")
+	labels := strings.Split(base, ".")
+
+	if p.MaxLabels > 0 && len(labels) > p.MaxLabels {
+		return fmt.Errorf("%w: %s has %d labels (max %d)", ErrNameRejected, name, len(labels), p.MaxLabels)
+	}
+
+	if p.AllowedChars != "" {
+		// Policies built in code rather than loaded are compiled here
+		re := p.allowed
+		if re == nil {
+			var err error
+			if re, err = allowedCharsPattern(p.AllowedChars); err != nil {
+				return fmt.Errorf("%w: invalid allowed_chars: %v", ErrNameRejected, err)
+			}
+		}
+		for _, label := range labels {
+			if !re.MatchString(label) {
+				return fmt.Errorf("%w: %s contains characters outside [%s]", ErrNameRejected, name, p.AllowedChars)
+			}
+		}
+	}
+
+	lower := strings.ToLower(base)
+	for _, deny := range p.DenySubstrings {
+		if deny != "" && strings.Contains(lower, strings.ToLower(deny)) {
+			return fmt.Errorf("%w: %s contains denied substring %q", ErrNameRejected, name, deny)
+		}
+	}
+
+	return nil
+}
+
+// LoadNamePolicy reads a NamePolicy from a JSON file
+func LoadNamePolicy(path string) (NamePolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return NamePolicy{}, err
+	}
+
+	var p NamePolicy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return NamePolicy{}, fmt.Errorf("failed to parse name policy from %s: %w", path, err)
+	}
+	if err := p.prepare(); err != nil {
+		return NamePolicy{}, fmt.Errorf("invalid name policy %s: %w", path, err)
+	}
+	return p, nil
+}
+
+// NamePolicyPath returns the path of the user name policy file
+func NamePolicyPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = "."
+	}
+	return filepath.Join(home, ".config", "nameport", "name-policy.json")
+}
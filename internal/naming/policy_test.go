@@ -0,0 +1,111 @@
+package naming
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNamePolicy_DefaultIsPermissive(t *testing.T) {
+	p := DefaultNamePolicy()
+	for _, name := range []string{"myapp.localhost", "api.myapp.localhost", "2.a.b.c.localhost"} {
+		if err := p.Check(name); err != nil {
+			t.Errorf("default policy rejected %q: %v", name, err)
+		}
+	}
+}
+
+func TestNamePolicy_DenySubstring(t *testing.T) {
+	p := NamePolicy{DenySubstrings: []string{"paypal", "google"}}
+
+	err := p.Check("paypal-login.localhost")
+	if err == nil {
+		t.Fatal("expected name containing a denied substring to be rejected")
+	}
+	if !errors.Is(err, ErrNameRejected) {
+		t.Errorf("error should wrap ErrNameRejected, got %v", err)
+	}
+
+	if err := p.Check("myapp.localhost"); err != nil {
+		t.Errorf("normal name rejected: %v", err)
+	}
+}
+
+func TestNamePolicy_MaxLabels(t *testing.T) {
+	p := NamePolicy{MaxLabels: 2}
+	if err := p.Check("api.myapp.localhost"); err != nil {
+		t.Errorf("two-label name rejected: %v", err)
+	}
+	if err := p.Check("v1.api.myapp.localhost"); err == nil {
+		t.Error("three-label name should be rejected with MaxLabels=2")
+	}
+}
+
+func TestNamePolicy_AllowedChars(t *testing.T) {
+	p := NamePolicy{AllowedChars: "a-z-"}
+	if err := p.Check("my-app.localhost"); err != nil {
+		t.Errorf("name within charset rejected: %v", err)
+	}
+	if err := p.Check("app2.localhost"); err == nil {
+		t.Error("name with digits should be rejected by charset a-z-")
+	}
+}
+
+func TestGenerateName_PolicyRejects(t *testing.T) {
+	g := NewGeneratorWithEngine(NewRuleEngineFromRules(nil))
+	g.SetPolicy(NamePolicy{DenySubstrings: []string{"paypal"}})
+
+	name, err := g.GenerateName("/home/user/paypal/server", "", nil)
+	if err == nil {
+		t.Fatalf("expected rejection, got name %q", name)
+	}
+	if !errors.Is(err, ErrNameRejected) {
+		t.Errorf("error should wrap ErrNameRejected, got %v", err)
+	}
+
+	// A rejected name must not stay reserved.
+	if g.usedNames["paypal"] {
+		t.Error("rejected name should not remain reserved")
+	}
+
+	name, err = g.GenerateName("/home/user/myapp/server", "", nil)
+	if err != nil {
+		t.Fatalf("normal name rejected: %v", err)
+	}
+	if name != "myapp.localhost" {
+		t.Errorf("name = %q, want myapp.localhost", name)
+	}
+}
+
+func TestLoadNamePolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "name-policy.json")
+	data := `{"allowed_chars": "a-z0-9-", "max_labels": 3, "deny_substrings": ["bank"]}`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := LoadNamePolicy(path)
+	if err != nil {
+		t.Fatalf("LoadNamePolicy: %v", err)
+	}
+	if p.MaxLabels != 3 || p.AllowedChars != "a-z0-9-" || len(p.DenySubstrings) != 1 {
+		t.Errorf("unexpected policy: %+v", p)
+	}
+	if p.allowed == nil {
+		t.Error("allowed_chars not compiled on load")
+	}
+	if err := p.Check("app_1.localhost"); err == nil {
+		t.Error("loaded policy accepted a name outside allowed_chars")
+	}
+}
+
+func TestLoadNamePolicy_InvalidCharset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "name-policy.json")
+	if err := os.WriteFile(path, []byte(`{"allowed_chars": "z-a"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadNamePolicy(path); err == nil {
+		t.Error("expected error for invalid charset")
+	}
+}
@@ -31,6 +31,10 @@ type NamingRule struct {
 	NameSource string `json:"name_source"`            // "exe", "cwd", "arg", "parent_dir", "app_bundle", "static"
 	NameRegex  string `json:"name_regex,omitempty"`    // capture group 1 = name
 	StaticName string `json:"static_name,omitempty"`   // when name_source = "static"
+
+	// Identity overrides the identity strategy ("exe+args", "exe-only",
+	// "exe+port") for matching processes
+	Identity string `json:"identity,omitempty"`
 }
 
 // RuleEngine applies naming rules in priority order
@@ -46,6 +50,17 @@ func NewRuleEngine() *RuleEngine {
 	return &RuleEngine{rules: merged}
 }
 
+// LoadRuleEngine creates a RuleEngine from the built-in rules and the user
+// rules at path. Unlike NewRuleEngine it reports an unreadable or invalid
+// user rules file; a missing one is not an error.
+func LoadRuleEngine(path string) (*RuleEngine, error) {
+	userRules, err := LoadUserRules(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return &RuleEngine{rules: MergeRules(LoadBuiltinRules(), userRules)}, nil
+}
+
 // NewRuleEngineFromRules creates a RuleEngine from the given rules (for testing)
 func NewRuleEngineFromRules(rules []NamingRule) *RuleEngine {
 	sort.Slice(rules, func(i, j int) bool {
@@ -85,6 +100,11 @@ func LoadUserRules(path string) ([]NamingRule, error) {
 	if err := json.Unmarshal(data, &rules); err != nil {
 		return nil, fmt.Errorf("failed to parse user rules from %s: %w", path, err)
 	}
+	for _, r := range rules {
+		if _, err := ParseIdentityStrategy(r.Identity); err != nil {
+			return nil, fmt.Errorf("rule %s in %s: %w", r.ID, path, err)
+		}
+	}
 
 	return rules, nil
 }
@@ -115,6 +135,68 @@ func MergeRules(builtin, user []NamingRule) []NamingRule {
 	return merged
 }
 
+// ImportSummary describes what a set of user rules changes relative to the
+// builtin rules
+type ImportSummary struct {
+	Total     int      // User rules
+	Overrides []string // IDs of builtin rules replaced by a user rule with the same ID
+	New       []string // IDs of user rules that add to the builtins
+	// Shadowed lists the builtin rules ordered after a user rule that matches
+	// every process they match, so they only apply when that rule yields no name
+	Shadowed []string
+}
+
+// SummarizeUserRules compares user rules against the builtin rules the way
+// MergeRules would combine them
+func SummarizeUserRules(builtin, user []NamingRule) ImportSummary {
+	summary := ImportSummary{Total: len(user)}
+
+	builtinIDs := make(map[string]bool, len(builtin))
+	for _, r := range builtin {
+		builtinIDs[r.ID] = true
+	}
+	userIDs := make(map[string]bool, len(user))
+	for _, r := range user {
+		userIDs[r.ID] = true
+		if builtinIDs[r.ID] {
+			summary.Overrides = append(summary.Overrides, r.ID)
+		} else {
+			summary.New = append(summary.New, r.ID)
+		}
+	}
+
+	for _, b := range builtin {
+		if userIDs[b.ID] {
+			continue
+		}
+		for _, u := range user {
+			if rulePrecedes(u, b) && matchesSuperset(u, b) {
+				summary.Shadowed = append(summary.Shadowed, b.ID)
+				break
+			}
+		}
+	}
+	return summary
+}
+
+// rulePrecedes reports whether a is tried before b in merged rule order
+func rulePrecedes(a, b NamingRule) bool {
+	if a.Priority == b.Priority {
+		return a.ID < b.ID
+	}
+	return a.Priority < b.Priority
+}
+
+// matchesSuperset reports whether a matches at least every process b does:
+// each condition a sets, b sets identically
+func matchesSuperset(a, b NamingRule) bool {
+	covers := func(pa, pb string) bool { return pa == "" || pa == pb }
+	return covers(a.ExePattern, b.ExePattern) &&
+		covers(a.ArgPattern, b.ArgPattern) &&
+		covers(a.CwdPattern, b.CwdPattern) &&
+		covers(a.PortPattern, b.PortPattern)
+}
+
 // Match tries rules in priority order and returns the first matching name, or ""
 func (re *RuleEngine) Match(exePath, cwd string, args []string, port int) string {
 	joinedArgs := strings.Join(args, " ")
@@ -134,6 +216,24 @@ func (re *RuleEngine) Match(exePath, cwd string, args []string, port int) string
 	return ""
 }
 
+// Identity returns the identity strategy of the first matching rule that sets
+// one, or false if none does
+func (re *RuleEngine) Identity(exePath, cwd string, args []string, port int) (IdentityStrategy, bool) {
+	joinedArgs := strings.Join(args, " ")
+	portStr := strconv.Itoa(port)
+
+	for _, rule := range re.rules {
+		if rule.Identity == "" || !ruleMatches(rule, exePath, joinedArgs, cwd, portStr) {
+			continue
+		}
+		if strategy, err := ParseIdentityStrategy(rule.Identity); err == nil {
+			return strategy, true
+		}
+	}
+
+	return "", false
+}
+
 // ruleMatches checks if all specified patterns in a rule match the inputs
 func ruleMatches(rule NamingRule, exePath, joinedArgs, cwd, portStr string) bool {
 	if rule.ExePattern != "" {
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
 )
 
@@ -334,3 +335,61 @@ func TestEmptyCwdReturnsEmpty(t *testing.T) {
 		t.Errorf("empty cwd should return empty, got %q", got)
 	}
 }
+
+func TestSummarizeUserRules(t *testing.T) {
+	builtin := []NamingRule{
+		{ID: "node-script", Priority: 20, ExePattern: "node$", NameSource: "arg"},
+		{ID: "python-script", Priority: 20, ExePattern: "python$", NameSource: "arg"},
+		{ID: "cwd-tools", Priority: 30, ExePattern: "tool$", CwdPattern: "src", NameSource: "cwd"},
+		{ID: "parent-dir", Priority: 90, NameSource: "parent_dir"},
+	}
+	user := []NamingRule{
+		{ID: "node-script", Priority: 20, ExePattern: "node$", NameSource: "cwd"},
+		{ID: "my-tool", Priority: 25, ExePattern: "tool$", NameSource: "static", StaticName: "tool"},
+		{ID: "late-catch-all", Priority: 95, NameSource: "static", StaticName: "misc"},
+	}
+
+	got := SummarizeUserRules(builtin, user)
+
+	if got.Total != 3 {
+		t.Errorf("Total = %d, want 3", got.Total)
+	}
+	if !reflect.DeepEqual(got.Overrides, []string{"node-script"}) {
+		t.Errorf("Overrides = %v, want [node-script]", got.Overrides)
+	}
+	if !reflect.DeepEqual(got.New, []string{"my-tool", "late-catch-all"}) {
+		t.Errorf("New = %v, want [my-tool late-catch-all]", got.New)
+	}
+	// my-tool comes first and matches every tool that cwd-tools does; the
+	// catch-all comes after parent-dir, and python-script is untouched
+	if !reflect.DeepEqual(got.Shadowed, []string{"cwd-tools"}) {
+		t.Errorf("Shadowed = %v, want [cwd-tools]", got.Shadowed)
+	}
+}
+
+func TestLoadRuleEngine(t *testing.T) {
+	dir := t.TempDir()
+
+	engine, err := LoadRuleEngine(filepath.Join(dir, "missing.json"))
+	if err != nil {
+		t.Fatalf("LoadRuleEngine with no user rules: %v", err)
+	}
+	if len(engine.Rules()) != len(LoadBuiltinRules()) {
+		t.Errorf("got %d rules, want only the builtins", len(engine.Rules()))
+	}
+
+	path := filepath.Join(dir, "rules.json")
+	os.WriteFile(path, []byte(`[{"id": "mine", "priority": 1, "name_source": "static", "static_name": "mine"}]`), 0644)
+	engine, err = LoadRuleEngine(path)
+	if err != nil {
+		t.Fatalf("LoadRuleEngine: %v", err)
+	}
+	if got := engine.Match("/usr/local/bin/anything", "", nil, 0); got != "mine" {
+		t.Errorf("Match = %q, want the user rule's name", got)
+	}
+
+	os.WriteFile(path, []byte(`not json`), 0644)
+	if _, err := LoadRuleEngine(path); err == nil {
+		t.Error("LoadRuleEngine with an invalid file succeeded, want an error")
+	}
+}
@@ -0,0 +1,50 @@
+package portscan
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// parseProcArgs2 extracts argv from a macOS KERN_PROCARGS2 sysctl buffer.
+// The layout is a native-endian int32 argc, the executable path, NUL
+// padding, then argc NUL-terminated arguments followed by the environment.
+// Arguments keep their embedded spaces, unlike the output of ps.
+func parseProcArgs2(buf []byte) ([]string, error) {
+	if len(buf) < 4 {
+		return nil, errors.New("portscan: procargs buffer too short")
+	}
+	argc := int(int32(binary.LittleEndian.Uint32(buf)))
+	if argc < 0 {
+		return nil, errors.New("portscan: procargs has a negative argc")
+	}
+	rest := buf[4:]
+
+	// Skip the executable path and the NULs padding it
+	end := bytes.IndexByte(rest, 0)
+	if end < 0 {
+		return nil, errors.New("portscan: procargs executable path is not terminated")
+	}
+	rest = rest[end:]
+	for len(rest) > 0 && rest[0] == 0 {
+		rest = rest[1:]
+	}
+
+	args := make([]string, 0, argc)
+	for len(args) < argc {
+		end := bytes.IndexByte(rest, 0)
+		if end < 0 {
+			// The kernel may cut off the last argument of a huge command line
+			if len(rest) > 0 {
+				args = append(args, string(rest))
+			}
+			break
+		}
+		args = append(args, string(rest[:end]))
+		rest = rest[end+1:]
+	}
+	if len(args) == 0 {
+		return nil, errors.New("portscan: procargs has no arguments")
+	}
+	return args, nil
+}
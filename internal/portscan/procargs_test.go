@@ -0,0 +1,51 @@
+package portscan
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestParseProcArgs2_Fixture(t *testing.T) {
+	// KERN_PROCARGS2 output for a node process whose script path and title
+	// contain spaces
+	buf, err := os.ReadFile("testdata/procargs2_node.bin")
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+
+	args, err := parseProcArgs2(buf)
+	if err != nil {
+		t.Fatalf("parseProcArgs2: %v", err)
+	}
+	want := []string{"node", "/Users/dev/My Projects/web app/server.js", "--port", "3000", "--title=Dev Server"}
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("args = %q, want %q", args, want)
+	}
+}
+
+func TestParseProcArgs2_Truncated(t *testing.T) {
+	buf := []byte{2, 0, 0, 0}
+	buf = append(buf, "/bin/sleep\x00\x00\x00sleep\x0010"...)
+
+	args, err := parseProcArgs2(buf)
+	if err != nil {
+		t.Fatalf("parseProcArgs2: %v", err)
+	}
+	if want := []string{"sleep", "10"}; !reflect.DeepEqual(args, want) {
+		t.Errorf("args = %q, want %q", args, want)
+	}
+}
+
+func TestParseProcArgs2_Invalid(t *testing.T) {
+	for _, buf := range [][]byte{
+		nil,
+		{1, 0},
+		append([]byte{1, 0, 0, 0}, "/bin/unterminated"...),
+		append([]byte{0, 0, 0, 0}, "/bin/true\x00\x00"...),
+	} {
+		if args, err := parseProcArgs2(buf); err == nil {
+			t.Errorf("parseProcArgs2(%q) = %q, want an error", buf, args)
+		}
+	}
+}
@@ -9,14 +9,50 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"syscall"
+	"unsafe"
 )
 
+// lookPath resolves external commands
+var lookPath = exec.LookPath
+
+// Commands the macOS scanner runs. Both ship with macOS, but a trimmed PATH
+// (launchd, minimal shells) can hide them.
+var (
+	lsofTool = tool{
+		name:      "lsof",
+		fallbacks: []string{"/usr/sbin/lsof"},
+		hint:      "nameport needs lsof to find listening ports; add /usr/sbin to PATH or reinstall it (e.g. brew install lsof)",
+	}
+	psTool = tool{
+		name:      "ps",
+		fallbacks: []string{"/bin/ps"},
+		hint:      "nameport needs ps to read process command lines; add /bin to PATH",
+	}
+)
+
+// Check reports whether Scan can work on this system, returning a
+// *MissingToolError naming the first command that cannot be found
+func Check() error {
+	for _, t := range []tool{lsofTool, psTool} {
+		if _, err := findTool(lookPath, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Scan discovers all listening TCP sockets and their owning processes on macOS
 func Scan() ([]Listener, error) {
+	lsof, err := findTool(lookPath, lsofTool)
+	if err != nil {
+		return nil, err
+	}
+
 	// Use lsof to find listening TCP sockets
 	// lsof -nP -iTCP -sTCP:LISTEN -F pn
 	// Output format: p<pid>\nn<address:port>\n...
-	cmd := exec.Command("lsof", "-nP", "-iTCP", "-sTCP:LISTEN", "-F", "pn")
+	cmd := exec.Command(lsof, "-nP", "-iTCP", "-sTCP:LISTEN", "-F", "pn")
 	output, err := cmd.Output()
 	if err != nil {
 		return nil, fmt.Errorf("lsof failed: %w", err)
@@ -59,7 +95,7 @@ func Scan() ([]Listener, error) {
 	// Build listener list
 	var listeners []Listener
 	for port, pid := range portToPID {
-		exePath, cwd, args, err := getProcessInfo(pid)
+		exePath, cwd, args, err := getProcessInfo(lsof, pid)
 		if err != nil {
 			// Process may have exited, skip
 			continue
@@ -102,10 +138,10 @@ func parsePort(addr string) int {
 }
 
 // getProcessInfo gets the executable path, cwd and command line for a PID on macOS
-func getProcessInfo(pid int) (string, string, []string, error) {
+func getProcessInfo(lsof string, pid int) (string, string, []string, error) {
 	// Use lsof to get executable path and cwd
 	// lsof -p <pid> -F n
-	cmd := exec.Command("lsof", "-p", strconv.Itoa(pid), "-F", "n")
+	cmd := exec.Command(lsof, "-p", strconv.Itoa(pid), "-F", "n")
 	output, err := cmd.Output()
 	if err != nil {
 		return "", "", nil, fmt.Errorf("lsof failed for pid %d: %w", pid, err)
@@ -145,8 +181,13 @@ func getCommandFromPS(pid int) string {
 	return strings.TrimSpace(string(output))
 }
 
-// getCommandLine gets the full command line for a process
+// getCommandLine gets the full command line for a process, preferring the
+// kernel's argv over ps, whose output loses spaces inside arguments
 func getCommandLine(pid int) []string {
+	if args, err := procArgs(pid); err == nil {
+		return args
+	}
+
 	cmd := exec.Command("ps", "-p", strconv.Itoa(pid), "-o", "args=")
 	output, err := cmd.Output()
 	if err != nil {
@@ -162,6 +203,41 @@ func getCommandLine(pid int) []string {
 	return strings.Fields(args)
 }
 
+// sysctl MIB for a process's arguments (sys/sysctl.h)
+const (
+	ctlKern       = 1
+	kernProcArgs2 = 49
+)
+
+// procArgs reads the argv of pid with the KERN_PROCARGS2 sysctl
+func procArgs(pid int) ([]string, error) {
+	mib := [3]int32{ctlKern, kernProcArgs2, int32(pid)}
+
+	// The first call reports the buffer size, the second fills it
+	var size uintptr
+	if err := sysctl(mib[:], nil, &size); err != nil {
+		return nil, err
+	}
+	if size == 0 {
+		return nil, fmt.Errorf("no arguments for pid %d", pid)
+	}
+	buf := make([]byte, size)
+	if err := sysctl(mib[:], &buf[0], &size); err != nil {
+		return nil, err
+	}
+	return parseProcArgs2(buf[:size])
+}
+
+func sysctl(mib []int32, old *byte, oldlen *uintptr) error {
+	_, _, errno := syscall.Syscall6(syscall.SYS___SYSCTL,
+		uintptr(unsafe.Pointer(&mib[0])), uintptr(len(mib)),
+		uintptr(unsafe.Pointer(old)), uintptr(unsafe.Pointer(oldlen)), 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
 // ResolveExecutablePath attempts to get the absolute path to the executable
 // On macOS, this resolves symlinks and finds the real binary
 func ResolveExecutablePath(cmd string) string {
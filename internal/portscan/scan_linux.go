@@ -9,28 +9,27 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"syscall"
 )
 
+// Check reports whether Scan can work on this system. Linux needs no
+// external tools, only a mounted /proc.
+func Check() error {
+	if _, err := os.Stat("/proc/net/tcp"); err != nil {
+		return fmt.Errorf("/proc is not available: %w", err)
+	}
+	return nil
+}
+
 // Scan discovers all listening TCP sockets and their owning processes
 func Scan() ([]Listener, error) {
-	// Parse /proc/net/tcp to get socket inodes
-	inodes, err := parseTCPFile("/proc/net/tcp")
+	sockets, err := listeningSockets()
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse /proc/net/tcp: %w", err)
-	}
-
-	// Also check IPv6
-	ipv6Inodes, err := parseTCPFile("/proc/net/tcp6")
-	if err == nil {
-		for port, inode := range ipv6Inodes {
-			if _, exists := inodes[port]; !exists {
-				inodes[port] = inode
-			}
-		}
+		return nil, err
 	}
 
 	// Map inodes to PIDs
-	pidMap, err := mapInodesToPIDs(inodes)
+	pidMap, err := mapSocketsToPIDs("/proc", sockets)
 	if err != nil {
 		return nil, fmt.Errorf("failed to map inodes to PIDs: %w", err)
 	}
@@ -56,16 +55,54 @@ func Scan() ([]Listener, error) {
 	return listeners, nil
 }
 
-// parseTCPFile parses /proc/net/tcp or /proc/net/tcp6
-// Returns map of port -> inode
-func parseTCPFile(path string) (map[int]uint64, error) {
+// listeningSockets returns one listening socket per port, preferring IPv4.
+// It asks the kernel over netlink and falls back to /proc/net/tcp when
+// netlink is unavailable.
+func listeningSockets() ([]socketInfo, error) {
+	sockets, err := netlinkListeningSockets()
+	if err != nil {
+		sockets, err = procListeningSockets()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	seen := make(map[int]bool)
+	unique := sockets[:0]
+	for _, s := range sockets {
+		if !seen[s.Port] {
+			seen[s.Port] = true
+			unique = append(unique, s)
+		}
+	}
+	return unique, nil
+}
+
+// procListeningSockets reads listening sockets from /proc/net/tcp and tcp6
+func procListeningSockets() ([]socketInfo, error) {
+	sockets, err := parseTCPFile("/proc/net/tcp")
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse /proc/net/tcp: %w", err)
+	}
+
+	// Also check IPv6
+	if ipv6, err := parseTCPFile("/proc/net/tcp6"); err == nil {
+		sockets = append(sockets, ipv6...)
+	}
+
+	return sockets, nil
+}
+
+// parseTCPFile parses /proc/net/tcp or /proc/net/tcp6 and returns its
+// listening sockets
+func parseTCPFile(path string) ([]socketInfo, error) {
 	file, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
 
-	result := make(map[int]uint64)
+	var result []socketInfo
 	scanner := bufio.NewScanner(file)
 
 	// Skip header line
@@ -109,72 +146,101 @@ func parseTCPFile(path string) (map[int]uint64, error) {
 			continue
 		}
 
-		result[int(port)] = inode
+		// Parse uid (field 7)
+		uid, _ := strconv.ParseUint(fields[7], 10, 32)
+
+		result = append(result, socketInfo{Port: int(port), Inode: inode, UID: uint32(uid)})
 	}
 
 	return result, scanner.Err()
 }
 
-// mapInodesToPIDs scans /proc to find which PIDs own the given inodes
-func mapInodesToPIDs(inodes map[int]uint64) (map[int]int, error) {
+// mapSocketsToPIDs scans procRoot to find which PIDs own the given sockets
+// and returns a map of port -> PID. Processes owned by a socket's UID are
+// scanned first, and the scan stops once every socket has been matched; the
+// remaining processes are only read for sockets whose owner changed user
+// after binding.
+func mapSocketsToPIDs(procRoot string, sockets []socketInfo) (map[int]int, error) {
 	result := make(map[int]int)
 
+	ports := make(map[uint64]int, len(sockets)) // inode -> port
+	uids := make(map[uint32]bool)
+	for _, s := range sockets {
+		ports[s.Inode] = s.Port
+		uids[s.UID] = true
+	}
+
 	// Scan /proc for all processes
-	entries, err := os.ReadDir("/proc")
+	entries, err := os.ReadDir(procRoot)
 	if err != nil {
 		return nil, err
 	}
 
+	var likely, others []string
 	for _, entry := range entries {
 		if !entry.IsDir() {
 			continue
 		}
-
-		pid, err := strconv.Atoi(entry.Name())
-		if err != nil {
+		if _, err := strconv.Atoi(entry.Name()); err != nil {
 			continue // Not a PID directory
 		}
-
-		// Scan /proc/<pid>/fd/ for socket symlinks
-		fdDir := filepath.Join("/proc", entry.Name(), "fd")
-		fdEntries, err := os.ReadDir(fdDir)
-		if err != nil {
-			continue // Can't read, probably permission denied
-		}
-
-		for _, fdEntry := range fdEntries {
-			fdPath := filepath.Join(fdDir, fdEntry.Name())
-			link, err := os.Readlink(fdPath)
-			if err != nil {
-				continue
-			}
-
-			// Check if it's a socket
-			if !strings.HasPrefix(link, "socket:[") {
-				continue
-			}
-
-			// Extract inode from "socket:[12345]"
-			inodeStr := strings.TrimPrefix(link, "socket:[")
-			inodeStr = strings.TrimSuffix(inodeStr, "]")
-			inode, err := strconv.ParseUint(inodeStr, 10, 64)
-			if err != nil {
+		if info, err := entry.Info(); err == nil {
+			if st, ok := info.Sys().(*syscall.Stat_t); ok && !uids[st.Uid] {
+				others = append(others, entry.Name())
 				continue
 			}
+		}
+		likely = append(likely, entry.Name())
+	}
 
-			// Check if this inode matches any of our listening sockets
-			for port, listenInode := range inodes {
-				if inode == listenInode {
-					result[port] = pid
-					break
-				}
+	for _, pidDirs := range [][]string{likely, others} {
+		for _, name := range pidDirs {
+			if len(ports) == 0 {
+				return result, nil
 			}
+			pid, _ := strconv.Atoi(name)
+			scanProcessSockets(filepath.Join(procRoot, name, "fd"), pid, ports, result)
 		}
 	}
 
 	return result, nil
 }
 
+// scanProcessSockets matches the socket fds in fdDir against ports, moving
+// matches into result
+func scanProcessSockets(fdDir string, pid int, ports map[uint64]int, result map[int]int) {
+	fdEntries, err := os.ReadDir(fdDir)
+	if err != nil {
+		return // Can't read, probably permission denied
+	}
+
+	for _, fdEntry := range fdEntries {
+		link, err := os.Readlink(filepath.Join(fdDir, fdEntry.Name()))
+		if err != nil {
+			continue
+		}
+
+		// Check if it's a socket
+		if !strings.HasPrefix(link, "socket:[") {
+			continue
+		}
+
+		// Extract inode from "socket:[12345]"
+		inodeStr := strings.TrimPrefix(link, "socket:[")
+		inodeStr = strings.TrimSuffix(inodeStr, "]")
+		inode, err := strconv.ParseUint(inodeStr, 10, 64)
+		if err != nil {
+			continue
+		}
+
+		// Check if this inode matches any of our listening sockets
+		if port, ok := ports[inode]; ok {
+			result[port] = pid
+			delete(ports, inode)
+		}
+	}
+}
+
 // getProcessInfo reads /proc/<pid>/exe, /proc/<pid>/cwd and /proc/<pid>/cmdline
 func getProcessInfo(pid int) (string, string, []string, error) {
 	pidStr := strconv.Itoa(pid)
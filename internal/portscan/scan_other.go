@@ -0,0 +1,19 @@
+//go:build !darwin && !linux
+
+package portscan
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Check reports whether Scan can work on this system. Port scanning is only
+// implemented for macOS and Linux.
+func Check() error {
+	return fmt.Errorf("portscan: listing listening sockets is not supported on %s/%s", runtime.GOOS, runtime.GOARCH)
+}
+
+// Scan always fails on unsupported platforms
+func Scan() ([]Listener, error) {
+	return nil, Check()
+}
@@ -0,0 +1,155 @@
+//go:build linux
+
+package portscan
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// Netlink sock_diag constants (linux/sock_diag.h, linux/inet_diag.h)
+const (
+	netlinkSockDiag   = 4  // NETLINK_SOCK_DIAG
+	sockDiagByFamily  = 20 // SOCK_DIAG_BY_FAMILY
+	tcpListenState    = 10 // TCP_LISTEN
+	nlmsgHeaderLen    = 16
+	inetDiagReqLen    = 56 // struct inet_diag_req_v2
+	inetDiagMsgLen    = 72 // struct inet_diag_msg
+	inetDiagSockIDLen = 48 // struct inet_diag_sockid
+)
+
+// socketInfo is a listening TCP socket
+type socketInfo struct {
+	Port  int
+	Inode uint64
+	UID   uint32 // Owner of the socket, used to find its process faster
+}
+
+// errNetlinkTruncated is returned for a sock_diag reply that ends mid-message
+var errNetlinkTruncated = errors.New("truncated netlink message")
+
+// netlinkListeningSockets lists listening TCP sockets (IPv4 then IPv6)
+// through a NETLINK_SOCK_DIAG dump, avoiding /proc/net/tcp text parsing.
+// It fails where netlink is unavailable, e.g. in restricted sandboxes.
+func netlinkListeningSockets() ([]socketInfo, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, netlinkSockDiag)
+	if err != nil {
+		return nil, fmt.Errorf("netlink socket: %w", err)
+	}
+	defer syscall.Close(fd)
+
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return nil, fmt.Errorf("netlink bind: %w", err)
+	}
+
+	var sockets []socketInfo
+	for seq, family := range []uint8{syscall.AF_INET, syscall.AF_INET6} {
+		req := buildDiagRequest(family, uint32(seq+1))
+		if err := syscall.Sendto(fd, req, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+			return nil, fmt.Errorf("netlink send: %w", err)
+		}
+
+		buf := make([]byte, os.Getpagesize()*8)
+		for done := false; !done; {
+			n, _, err := syscall.Recvfrom(fd, buf, 0)
+			if err != nil {
+				return nil, fmt.Errorf("netlink receive: %w", err)
+			}
+			var batch []socketInfo
+			batch, done, err = parseDiagMessages(buf[:n])
+			if err != nil {
+				return nil, err
+			}
+			sockets = append(sockets, batch...)
+		}
+	}
+
+	return sockets, nil
+}
+
+// buildDiagRequest encodes a SOCK_DIAG_BY_FAMILY dump request for listening
+// TCP sockets of the given address family
+func buildDiagRequest(family uint8, seq uint32) []byte {
+	msg := make([]byte, nlmsgHeaderLen+inetDiagReqLen)
+	ne := binary.NativeEndian // Netlink headers use host byte order
+
+	// struct nlmsghdr
+	ne.PutUint32(msg[0:4], uint32(len(msg)))
+	ne.PutUint16(msg[4:6], sockDiagByFamily)
+	ne.PutUint16(msg[6:8], syscall.NLM_F_REQUEST|syscall.NLM_F_DUMP)
+	ne.PutUint32(msg[8:12], seq)
+
+	// struct inet_diag_req_v2; the zero socket id matches everything
+	req := msg[nlmsgHeaderLen:]
+	req[0] = family
+	req[1] = syscall.IPPROTO_TCP
+	ne.PutUint32(req[4:8], 1<<tcpListenState)
+
+	return msg
+}
+
+// parseDiagMessages decodes a sock_diag reply buffer. done reports whether
+// the dump is complete (NLMSG_DONE seen).
+func parseDiagMessages(data []byte) (sockets []socketInfo, done bool, err error) {
+	ne := binary.NativeEndian
+
+	for len(data) >= nlmsgHeaderLen {
+		msgLen := int(ne.Uint32(data[0:4]))
+		msgType := ne.Uint16(data[4:6])
+		if msgLen < nlmsgHeaderLen || msgLen > len(data) {
+			return nil, false, errNetlinkTruncated
+		}
+		body := data[nlmsgHeaderLen:msgLen]
+
+		switch msgType {
+		case syscall.NLMSG_DONE:
+			return sockets, true, nil
+		case syscall.NLMSG_ERROR:
+			if len(body) >= 4 {
+				if errno := int32(ne.Uint32(body[0:4])); errno != 0 {
+					return nil, false, fmt.Errorf("netlink: %w", syscall.Errno(-errno))
+				}
+			}
+			return sockets, true, nil
+		case sockDiagByFamily:
+			if len(body) < inetDiagMsgLen {
+				return nil, false, errNetlinkTruncated
+			}
+			if s, ok := parseDiagMsg(body); ok {
+				sockets = append(sockets, s)
+			}
+		}
+
+		// Messages are padded to 4-byte boundaries
+		next := (msgLen + 3) &^ 3
+		if next > len(data) {
+			break
+		}
+		data = data[next:]
+	}
+
+	return sockets, false, nil
+}
+
+// parseDiagMsg decodes one struct inet_diag_msg
+func parseDiagMsg(b []byte) (socketInfo, bool) {
+	if b[1] != tcpListenState {
+		return socketInfo{}, false
+	}
+
+	// idiag_sport is the first field of the socket id, in network byte order
+	id := b[4 : 4+inetDiagSockIDLen]
+	port := int(binary.BigEndian.Uint16(id[0:2]))
+
+	rest := b[4+inetDiagSockIDLen:]
+	uid := binary.NativeEndian.Uint32(rest[12:16])
+	inode := binary.NativeEndian.Uint32(rest[16:20])
+	if inode == 0 {
+		return socketInfo{}, false
+	}
+
+	return socketInfo{Port: port, Inode: uint64(inode), UID: uid}, true
+}
@@ -0,0 +1,197 @@
+//go:build linux
+
+package portscan
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// Captured from a SOCK_DIAG_BY_FAMILY dump (AF_INET, listening TCP) on x86_64
+// with sockets on 127.0.0.1:48271 (uid 65534), 127.0.0.1:8080 and 0.0.0.0:2024.
+const diagDumpFixture = "7c00000014000200010000006f750000020a0000bc8f00007f00000100000000000000000000000000000000000000000000000000000000000000000100000000000000000000000000000005000000feff000013040000050008000000000008000f00000000000c00150001000000000000000600160052000000" +
+	"7c00000014000200010000006f750000020a00001f9000007f00000100000000000000000000000000000000000000000000000000000000000000000200000000000000000000000000000000100000000000002bae0100050008000000000008000f00000000000c00150001000000000000000600160052000000" +
+	"7c00000014000200010000006f750000020a000007e8000000000000000000000000000000000000000000000000000000000000000000000000000003000000000000000000000000000000800000000000000096020000050008000000000008000f00000000000c00150001000000000000000600160052000000"
+
+// The NLMSG_DONE message ending the same dump.
+const diagDoneFixture = "1400000003000200010000006f75000000000000"
+
+func decodeFixture(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("bad fixture: %v", err)
+	}
+	return b
+}
+
+func TestParseDiagMessages(t *testing.T) {
+	if binary.NativeEndian.Uint16([]byte{1, 0}) != 1 {
+		t.Skip("fixtures were captured on a little-endian host")
+	}
+
+	sockets, done, err := parseDiagMessages(decodeFixture(t, diagDumpFixture))
+	if err != nil {
+		t.Fatalf("parseDiagMessages: %v", err)
+	}
+	if done {
+		t.Error("done = true before NLMSG_DONE")
+	}
+
+	want := []socketInfo{
+		{Port: 48271, Inode: 1043, UID: 65534},
+		{Port: 8080, Inode: 110123, UID: 0},
+		{Port: 2024, Inode: 662, UID: 0},
+	}
+	if len(sockets) != len(want) {
+		t.Fatalf("got %d sockets, want %d: %+v", len(sockets), len(want), sockets)
+	}
+	for i := range want {
+		if sockets[i] != want[i] {
+			t.Errorf("socket %d = %+v, want %+v", i, sockets[i], want[i])
+		}
+	}
+
+	sockets, done, err = parseDiagMessages(decodeFixture(t, diagDoneFixture))
+	if err != nil || !done || len(sockets) != 0 {
+		t.Errorf("done message = (%v, %v, %v), want (none, true, nil)", sockets, done, err)
+	}
+}
+
+func TestParseDiagMessages_Truncated(t *testing.T) {
+	data := decodeFixture(t, diagDumpFixture)
+	if _, _, err := parseDiagMessages(data[:100]); !errors.Is(err, errNetlinkTruncated) {
+		t.Errorf("err = %v, want errNetlinkTruncated", err)
+	}
+}
+
+func TestParseDiagMessages_Error(t *testing.T) {
+	msg := make([]byte, nlmsgHeaderLen+4)
+	binary.NativeEndian.PutUint32(msg[0:4], uint32(len(msg)))
+	binary.NativeEndian.PutUint16(msg[4:6], syscall.NLMSG_ERROR)
+	errno := int32(-int32(syscall.EPERM))
+	binary.NativeEndian.PutUint32(msg[16:20], uint32(errno))
+
+	if _, _, err := parseDiagMessages(msg); !errors.Is(err, syscall.EPERM) {
+		t.Errorf("err = %v, want EPERM", err)
+	}
+}
+
+func TestBuildDiagRequest(t *testing.T) {
+	msg := buildDiagRequest(syscall.AF_INET6, 7)
+	ne := binary.NativeEndian
+
+	if got := ne.Uint32(msg[0:4]); int(got) != len(msg) || len(msg) != nlmsgHeaderLen+inetDiagReqLen {
+		t.Errorf("length = %d (buffer %d), want %d", got, len(msg), nlmsgHeaderLen+inetDiagReqLen)
+	}
+	if got := ne.Uint16(msg[4:6]); got != sockDiagByFamily {
+		t.Errorf("type = %d, want %d", got, sockDiagByFamily)
+	}
+	if got := ne.Uint16(msg[6:8]); got != syscall.NLM_F_REQUEST|syscall.NLM_F_DUMP {
+		t.Errorf("flags = %#x, want request|dump", got)
+	}
+	if got := ne.Uint32(msg[8:12]); got != 7 {
+		t.Errorf("seq = %d, want 7", got)
+	}
+	if msg[16] != syscall.AF_INET6 || msg[17] != syscall.IPPROTO_TCP {
+		t.Errorf("family/protocol = %d/%d", msg[16], msg[17])
+	}
+	if got := ne.Uint32(msg[20:24]); got != 1<<tcpListenState {
+		t.Errorf("states = %#x, want LISTEN only", got)
+	}
+}
+
+func TestParseTCPFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tcp")
+	data := "  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n" +
+		"   0: 0100007F:BC8F 00000000:0000 0A 00000000:00000000 00:00000000 00000000 65534        0 1043 1 0000000000000000 100 0 0 10 0\n" +
+		"   1: 0100007F:8EA7 0100007F:B5F4 06 00000000:00000000 03:00000E7D 00000000     0        0 0 3 0000000000000000\n" +
+		"   2: 00000000:07E8 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 662 1 0000000000000000 100 0 0 10 0\n"
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sockets, err := parseTCPFile(path)
+	if err != nil {
+		t.Fatalf("parseTCPFile: %v", err)
+	}
+	want := []socketInfo{{Port: 48271, Inode: 1043, UID: 65534}, {Port: 2024, Inode: 662, UID: 0}}
+	if len(sockets) != len(want) || sockets[0] != want[0] || sockets[1] != want[1] {
+		t.Errorf("sockets = %+v, want %+v", sockets, want)
+	}
+}
+
+func TestMapSocketsToPIDs(t *testing.T) {
+	root := t.TempDir()
+	fds := map[string]map[string]string{
+		"100":  {"0": "/dev/null", "3": "socket:[1043]"},
+		"200":  {"4": "socket:[999]", "5": "socket:[662]"},
+		"self": {"3": "socket:[1043]"}, // Not a PID directory
+	}
+	for pid, links := range fds {
+		dir := filepath.Join(root, pid, "fd")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		for fd, target := range links {
+			if err := os.Symlink(target, filepath.Join(dir, fd)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	got, err := mapSocketsToPIDs(root, []socketInfo{
+		{Port: 48271, Inode: 1043, UID: 65534},
+		{Port: 2024, Inode: 662},
+		{Port: 9000, Inode: 5555}, // Owner not visible
+	})
+	if err != nil {
+		t.Fatalf("mapSocketsToPIDs: %v", err)
+	}
+	if len(got) != 2 || got[48271] != 100 || got[2024] != 200 {
+		t.Errorf("ports = %v, want 48271->100, 2024->200", got)
+	}
+}
+
+func TestNetlinkMatchesProc(t *testing.T) {
+	fromNetlink, err := netlinkListeningSockets()
+	if err != nil {
+		t.Skipf("netlink unavailable: %v", err)
+	}
+	fromProc, err := procListeningSockets()
+	if err != nil {
+		t.Skipf("/proc/net/tcp unavailable: %v", err)
+	}
+
+	inodes := make(map[uint64]bool)
+	for _, s := range fromProc {
+		inodes[s.Inode] = true
+	}
+	for _, s := range fromNetlink {
+		if !inodes[s.Inode] {
+			t.Errorf("netlink socket %+v not in /proc/net/tcp", s)
+		}
+	}
+}
+
+func BenchmarkScanNetlink(b *testing.B) {
+	if _, err := netlinkListeningSockets(); err != nil {
+		b.Skipf("netlink unavailable: %v", err)
+	}
+	for i := 0; i < b.N; i++ {
+		sockets, _ := netlinkListeningSockets()
+		mapSocketsToPIDs("/proc", sockets)
+	}
+}
+
+func BenchmarkScanProcNet(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		sockets, _ := procListeningSockets()
+		mapSocketsToPIDs("/proc", sockets)
+	}
+}
@@ -0,0 +1,35 @@
+package portscan
+
+import "fmt"
+
+// MissingToolError reports an external command the scanner needs but
+// cannot find
+type MissingToolError struct {
+	Tool string
+	Hint string // How to fix it
+}
+
+func (e *MissingToolError) Error() string {
+	return fmt.Sprintf("%s not found in PATH: %s", e.Tool, e.Hint)
+}
+
+// tool is an external command used by the scanner
+type tool struct {
+	name      string
+	fallbacks []string // Absolute paths tried when name is not in PATH
+	hint      string
+}
+
+// findTool resolves a tool through lookPath, first by name and then by its
+// fallback paths, so a minimal PATH (e.g. under launchd) still works
+func findTool(lookPath func(string) (string, error), t tool) (string, error) {
+	if path, err := lookPath(t.name); err == nil {
+		return path, nil
+	}
+	for _, p := range t.fallbacks {
+		if path, err := lookPath(p); err == nil {
+			return path, nil
+		}
+	}
+	return "", &MissingToolError{Tool: t.name, Hint: t.hint}
+}
@@ -0,0 +1,53 @@
+package portscan
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+)
+
+// fakeLookPath finds only the given paths
+func fakeLookPath(found ...string) func(string) (string, error) {
+	return func(file string) (string, error) {
+		for _, f := range found {
+			if f == file {
+				return "/resolved/" + file, nil
+			}
+		}
+		return "", exec.ErrNotFound
+	}
+}
+
+var testLsof = tool{name: "lsof", fallbacks: []string{"/usr/sbin/lsof"}, hint: "install lsof"}
+
+func TestFindTool_InPath(t *testing.T) {
+	path, err := findTool(fakeLookPath("lsof", "/usr/sbin/lsof"), testLsof)
+	if err != nil {
+		t.Fatalf("findTool: %v", err)
+	}
+	if path != "/resolved/lsof" {
+		t.Errorf("path = %q, want the PATH match", path)
+	}
+}
+
+func TestFindTool_Fallback(t *testing.T) {
+	path, err := findTool(fakeLookPath("/usr/sbin/lsof"), testLsof)
+	if err != nil {
+		t.Fatalf("findTool: %v", err)
+	}
+	if path != "/resolved//usr/sbin/lsof" {
+		t.Errorf("path = %q, want the fallback path", path)
+	}
+}
+
+func TestFindTool_Missing(t *testing.T) {
+	_, err := findTool(fakeLookPath(), testLsof)
+
+	var missing *MissingToolError
+	if !errors.As(err, &missing) {
+		t.Fatalf("err = %v, want *MissingToolError", err)
+	}
+	if missing.Tool != "lsof" || missing.Hint != "install lsof" {
+		t.Errorf("missing = %+v", missing)
+	}
+}
@@ -0,0 +1,27 @@
+package probe
+
+import "strings"
+
+// AdvertisesHTTP3 reports whether the Alt-Svc header values advertise an
+// HTTP/3 endpoint ("h3" or a draft such as "h3-29"). The special value
+// "clear" withdraws all alternatives.
+func AdvertisesHTTP3(altSvc []string) bool {
+	for _, value := range altSvc {
+		for _, entry := range strings.Split(value, ",") {
+			entry = strings.TrimSpace(entry)
+			if entry == "clear" {
+				return false
+			}
+			// entry is protocol-id="authority" followed by parameters
+			protocol, _, ok := strings.Cut(entry, "=")
+			if !ok {
+				continue
+			}
+			protocol = strings.TrimSpace(protocol)
+			if protocol == "h3" || strings.HasPrefix(protocol, "h3-") {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,23 @@
+package probe
+
+import "testing"
+
+func TestAdvertisesHTTP3(t *testing.T) {
+	tests := []struct {
+		altSvc []string
+		want   bool
+	}{
+		{nil, false},
+		{[]string{`h3=":443"; ma=86400`}, true},
+		{[]string{`h2=":8443", h3-29=":8443"; ma=3600`}, true},
+		{[]string{`h2=":8443"`}, false},
+		{[]string{`h2=":8443"`, `h3=":8443"`}, true},
+		{[]string{"clear"}, false},
+		{[]string{"h3"}, false}, // no authority: malformed
+	}
+	for _, tt := range tests {
+		if got := AdvertisesHTTP3(tt.altSvc); got != tt.want {
+			t.Errorf("AdvertisesHTTP3(%q) = %v, want %v", tt.altSvc, got, tt.want)
+		}
+	}
+}
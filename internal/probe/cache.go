@@ -0,0 +1,130 @@
+package probe
+
+import (
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCacheTTL is how long a detected protocol is trusted before the
+// backend is probed again.
+const DefaultCacheTTL = 30 * time.Second
+
+// NoExpiry is a TTL that keeps results until the owning PID changes, the
+// entry is invalidated or Sweep finds the process gone.
+const NoExpiry = time.Duration(math.MaxInt64)
+
+// cacheKey identifies a cached result: the probed address and the candidate
+// paths tried, since another set of paths can give another answer
+type cacheKey struct {
+	addr  string
+	paths string
+}
+
+// cacheEntry is a cached protocol detection result
+type cacheEntry struct {
+	detection Detection
+	pid       int
+	checked   time.Time
+}
+
+// ProbeCache caches DetectProtocolPaths results per host:port and candidate
+// paths so that stable services are not re-dialed on every discovery cycle.
+// An entry is re-probed once its TTL expires or when the owning PID changes
+// (i.e. the backend was restarted or the port was taken over by another
+// process). Failed detections are not cached, so a server that is still
+// starting is picked up on the next cycle.
+type ProbeCache struct {
+	ttl     time.Duration
+	dial    DialFunc
+	now     func() time.Time
+	mu      sync.Mutex
+	entries map[cacheKey]cacheEntry
+}
+
+// NewProbeCache creates a ProbeCache with the given TTL using real network dials.
+func NewProbeCache(ttl time.Duration) *ProbeCache {
+	return NewProbeCacheWithDialer(ttl, net.DialTimeout)
+}
+
+// NewProbeCacheWithDialer creates a ProbeCache that probes through dial.
+func NewProbeCacheWithDialer(ttl time.Duration, dial DialFunc) *ProbeCache {
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+	return &ProbeCache{
+		ttl:     ttl,
+		dial:    dial,
+		now:     time.Now,
+		entries: make(map[cacheKey]cacheEntry),
+	}
+}
+
+// Detect returns the protocol spoken on host:port, probing only if there is
+// no fresh cached result for the same PID.
+func (c *ProbeCache) Detect(host string, port int, pid int) Protocol {
+	return c.DetectPaths(host, port, pid, DefaultCandidatePaths).Protocol
+}
+
+// DetectPaths is like Detect but probes the given candidate paths and also
+// reports which one answered.
+func (c *ProbeCache) DetectPaths(host string, port int, pid int, paths []string) Detection {
+	key := cacheKey{addr: net.JoinHostPort(host, strconv.Itoa(port)), paths: strings.Join(paths, "\x00")}
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+
+	if ok && entry.pid == pid && c.now().Sub(entry.checked) < c.ttl {
+		return entry.detection
+	}
+
+	d := detect(c.dial, host, port, paths)
+
+	c.mu.Lock()
+	if d.Protocol == ProtoNone {
+		delete(c.entries, key)
+	} else {
+		c.entries[key] = cacheEntry{detection: d, pid: pid, checked: c.now()}
+	}
+	c.mu.Unlock()
+
+	return d
+}
+
+// Sweep drops expired entries and those whose PID is not in live, so the
+// cache only holds processes that are still listening.
+func (c *ProbeCache) Sweep(live map[int]bool) {
+	now := c.now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, entry := range c.entries {
+		if !live[entry.pid] || now.Sub(entry.checked) >= c.ttl {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// Invalidate drops the cached results for host:port so the next Detect probes again.
+func (c *ProbeCache) Invalidate(host string, port int) {
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+
+	c.mu.Lock()
+	for key := range c.entries {
+		if key.addr == addr {
+			delete(c.entries, key)
+		}
+	}
+	c.mu.Unlock()
+}
+
+// Len returns the number of cached entries.
+func (c *ProbeCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
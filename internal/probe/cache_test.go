@@ -0,0 +1,223 @@
+package probe
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// startHTTPServer starts a plain HTTP server on a random port and returns the port.
+func startHTTPServer(t *testing.T) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to create listener: %v", err)
+	}
+
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprintln(w, "hello")
+		}),
+	}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// countingDialer returns a DialFunc that counts its invocations.
+func countingDialer(count *int64) DialFunc {
+	return func(network, address string, timeout time.Duration) (net.Conn, error) {
+		atomic.AddInt64(count, 1)
+		return net.DialTimeout(network, address, timeout)
+	}
+}
+
+func TestProbeCache_RepeatWithinTTL(t *testing.T) {
+	port := startHTTPServer(t)
+
+	var dials int64
+	cache := NewProbeCacheWithDialer(time.Minute, countingDialer(&dials))
+
+	if proto := cache.Detect("127.0.0.1", port, 100); proto != ProtoHTTP {
+		t.Fatalf("first Detect = %v, want http", proto)
+	}
+	first := atomic.LoadInt64(&dials)
+	if first == 0 {
+		t.Fatal("expected the first Detect to dial")
+	}
+
+	for i := 0; i < 3; i++ {
+		if proto := cache.Detect("127.0.0.1", port, 100); proto != ProtoHTTP {
+			t.Fatalf("cached Detect = %v, want http", proto)
+		}
+	}
+	if got := atomic.LoadInt64(&dials); got != first {
+		t.Errorf("dials = %d after cached lookups, want %d", got, first)
+	}
+}
+
+func TestProbeCache_PIDChangeReprobes(t *testing.T) {
+	port := startHTTPServer(t)
+
+	var dials int64
+	cache := NewProbeCacheWithDialer(time.Minute, countingDialer(&dials))
+
+	cache.Detect("127.0.0.1", port, 100)
+	first := atomic.LoadInt64(&dials)
+
+	cache.Detect("127.0.0.1", port, 200)
+	if got := atomic.LoadInt64(&dials); got <= first {
+		t.Errorf("expected a re-probe after PID change, dials = %d", got)
+	}
+}
+
+func TestProbeCache_ChangedBackendReprobed(t *testing.T) {
+	// Start with nothing listening on the port.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to create listener: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	var dials int64
+	cache := NewProbeCacheWithDialer(time.Minute, countingDialer(&dials))
+	if proto := cache.Detect("127.0.0.1", port, 100); proto != ProtoNone {
+		t.Fatalf("Detect on closed port = %v, want none", proto)
+	}
+
+	// A new HTTP backend takes over the port under a different PID.
+	listener, err = net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Skipf("could not rebind port %d: %v", port, err)
+	}
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}),
+	}
+	go server.Serve(listener)
+	defer server.Close()
+
+	if proto := cache.Detect("127.0.0.1", port, 101); proto != ProtoHTTP {
+		t.Errorf("Detect after backend change = %v, want http", proto)
+	}
+}
+
+func TestProbeCache_TTLExpiry(t *testing.T) {
+	port := startHTTPServer(t)
+
+	var dials int64
+	cache := NewProbeCacheWithDialer(time.Minute, countingDialer(&dials))
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	cache.Detect("127.0.0.1", port, 100)
+	first := atomic.LoadInt64(&dials)
+
+	now = now.Add(2 * time.Minute)
+	cache.Detect("127.0.0.1", port, 100)
+	if got := atomic.LoadInt64(&dials); got <= first {
+		t.Errorf("expected a re-probe after TTL expiry, dials = %d", got)
+	}
+}
+
+func TestProbeCache_Invalidate(t *testing.T) {
+	port := startHTTPServer(t)
+
+	var dials int64
+	cache := NewProbeCacheWithDialer(time.Minute, countingDialer(&dials))
+
+	cache.Detect("127.0.0.1", port, 100)
+	first := atomic.LoadInt64(&dials)
+
+	cache.Invalidate("127.0.0.1", port)
+	if cache.Len() != 0 {
+		t.Errorf("Len() = %d after Invalidate, want 0", cache.Len())
+	}
+
+	cache.Detect("127.0.0.1", port, 100)
+	if got := atomic.LoadInt64(&dials); got <= first {
+		t.Errorf("expected a re-probe after Invalidate, dials = %d", got)
+	}
+}
+
+func TestProbeCache_FailureNotCached(t *testing.T) {
+	// Nothing listens yet, as with a server that is still starting
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to create listener: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	cache := NewProbeCacheWithDialer(time.Minute, net.DialTimeout)
+	if proto := cache.Detect("127.0.0.1", port, 100); proto != ProtoNone {
+		t.Fatalf("Detect on closed port = %v, want none", proto)
+	}
+	if cache.Len() != 0 {
+		t.Errorf("Len() = %d after a failed probe, want 0", cache.Len())
+	}
+
+	// The same process starts answering
+	listener, err = net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Skipf("could not rebind port %d: %v", port, err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	if proto := cache.Detect("127.0.0.1", port, 100); proto != ProtoHTTP {
+		t.Errorf("Detect once the server is up = %v, want http", proto)
+	}
+}
+
+func TestProbeCache_PathsPartOfKey(t *testing.T) {
+	port := startHTTPServer(t)
+
+	var dials int64
+	cache := NewProbeCacheWithDialer(time.Minute, countingDialer(&dials))
+
+	cache.DetectPaths("127.0.0.1", port, 100, CandidatePaths(""))
+	first := atomic.LoadInt64(&dials)
+
+	cache.DetectPaths("127.0.0.1", port, 100, CandidatePaths("/app"))
+	if got := atomic.LoadInt64(&dials); got <= first {
+		t.Errorf("expected a re-probe with other candidate paths, dials = %d", got)
+	}
+
+	cache.Invalidate("127.0.0.1", port)
+	if cache.Len() != 0 {
+		t.Errorf("Len() = %d after Invalidate, want 0", cache.Len())
+	}
+}
+
+func TestProbeCache_Sweep(t *testing.T) {
+	port1, port2, port3 := startHTTPServer(t), startHTTPServer(t), startHTTPServer(t)
+
+	cache := NewProbeCacheWithDialer(time.Minute, net.DialTimeout)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	cache.Detect("127.0.0.1", port1, 100) // Expires
+	now = now.Add(45 * time.Second)
+	cache.Detect("127.0.0.1", port2, 200) // Process gone
+	cache.Detect("127.0.0.1", port3, 300) // Kept
+	now = now.Add(30 * time.Second)
+
+	cache.Sweep(map[int]bool{100: true, 300: true})
+	if cache.Len() != 1 {
+		t.Fatalf("Len() = %d after Sweep, want 1", cache.Len())
+	}
+	for key, entry := range cache.entries {
+		if entry.pid != 300 {
+			t.Errorf("kept %v (PID %d), want only PID 300", key, entry.pid)
+		}
+	}
+}
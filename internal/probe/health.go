@@ -0,0 +1,198 @@
+package probe
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultHealthInterval is how often the daemon re-checks service health in
+// the background.
+const DefaultHealthInterval = 5 * time.Second
+
+// healthConcurrency bounds the number of health checks Refresh runs at once
+const healthConcurrency = 8
+
+// HealthTarget is a backend to health-check. A changed port, scheme or path
+// is a different target, so stale results are never served for it.
+type HealthTarget struct {
+	Host     string
+	Port     int
+	TLS      bool
+	Path     string
+	HostName string // Host header to send (the service name by default)
+}
+
+// HealthStatus is the result of one health check
+type HealthStatus struct {
+	Healthy    bool
+	StatusCode int
+	StatusText string
+	HTTP3      bool // The response advertised HTTP/3 via Alt-Svc
+	CheckedAt  time.Time
+}
+
+// HealthCheckFunc checks a target. CheckHealth outside of tests.
+type HealthCheckFunc func(HealthTarget) HealthStatus
+
+// CheckHealth sends a GET to the target and reports it healthy on a 2xx or
+// 3xx response.
+func CheckHealth(t HealthTarget) HealthStatus {
+	st := HealthStatus{StatusText: "offline", CheckedAt: time.Now()}
+
+	client := &http.Client{Timeout: 2 * time.Second}
+	scheme := "http"
+	if t.TLS {
+		scheme = "https"
+		client.Transport = &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		}
+	}
+	// Built rather than parsed, so IPv6 zones (fe80::1%eth0) survive
+	target := &url.URL{Scheme: scheme, Host: net.JoinHostPort(t.Host, strconv.Itoa(t.Port)), Path: t.Path}
+	req, err := http.NewRequest(http.MethodGet, target.String(), nil)
+	if err != nil {
+		return st
+	}
+	if t.HostName != "" {
+		req.Host = t.HostName
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return st
+	}
+	resp.Body.Close()
+
+	st.StatusCode = resp.StatusCode
+	st.StatusText = resp.Status
+	st.Healthy = resp.StatusCode >= 200 && resp.StatusCode < 400
+	st.HTTP3 = AdvertisesHTTP3(resp.Header.Values("Alt-Svc"))
+	return st
+}
+
+// healthCall is a check in flight; later callers wait for its result
+type healthCall struct {
+	done   chan struct{}
+	status HealthStatus
+}
+
+// HealthCache shares health results between the dashboard API and the
+// background checker, so polling the dashboard does not hit every backend
+// on every request. Concurrent checks of the same target are coalesced.
+type HealthCache struct {
+	ttl      time.Duration
+	check    HealthCheckFunc
+	now      func() time.Time
+	mu       sync.Mutex
+	entries  map[HealthTarget]HealthStatus
+	inflight map[HealthTarget]*healthCall
+}
+
+// NewHealthCache creates a HealthCache whose results stay fresh for ttl.
+func NewHealthCache(ttl time.Duration) *HealthCache {
+	return NewHealthCacheWithChecker(ttl, CheckHealth)
+}
+
+// NewHealthCacheWithChecker creates a HealthCache that checks through check.
+func NewHealthCacheWithChecker(ttl time.Duration, check HealthCheckFunc) *HealthCache {
+	if ttl <= 0 {
+		ttl = 2 * DefaultHealthInterval
+	}
+	return &HealthCache{
+		ttl:      ttl,
+		check:    check,
+		now:      time.Now,
+		entries:  make(map[HealthTarget]HealthStatus),
+		inflight: make(map[HealthTarget]*healthCall),
+	}
+}
+
+// Status returns the cached status of t, checking it first if there is no
+// result younger than the TTL.
+func (c *HealthCache) Status(t HealthTarget) HealthStatus {
+	c.mu.Lock()
+	if st, ok := c.entries[t]; ok && c.now().Sub(st.CheckedAt) < c.ttl {
+		c.mu.Unlock()
+		return st
+	}
+	c.mu.Unlock()
+	return c.run(t)
+}
+
+// Cached returns the last status of t without checking it.
+func (c *HealthCache) Cached(t HealthTarget) (HealthStatus, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st, ok := c.entries[t]
+	return st, ok
+}
+
+// Refresh checks all targets, a few at a time, and forgets any other
+// cached targets.
+func (c *HealthCache) Refresh(targets []HealthTarget) {
+	keep := make(map[HealthTarget]bool, len(targets))
+	sem := make(chan struct{}, healthConcurrency)
+	var wg sync.WaitGroup
+	for _, t := range targets {
+		if keep[t] {
+			continue
+		}
+		keep[t] = true
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(t HealthTarget) {
+			defer wg.Done()
+			c.run(t)
+			<-sem
+		}(t)
+	}
+	wg.Wait()
+
+	c.mu.Lock()
+	for t := range c.entries {
+		if !keep[t] {
+			delete(c.entries, t)
+		}
+	}
+	c.mu.Unlock()
+}
+
+// Invalidate drops cached results for host:port so the next Status checks again.
+func (c *HealthCache) Invalidate(host string, port int) {
+	c.mu.Lock()
+	for t := range c.entries {
+		if t.Host == host && t.Port == port {
+			delete(c.entries, t)
+		}
+	}
+	c.mu.Unlock()
+}
+
+// run checks t, or waits for a check of t that is already in flight
+func (c *HealthCache) run(t HealthTarget) HealthStatus {
+	c.mu.Lock()
+	if call, ok := c.inflight[t]; ok {
+		c.mu.Unlock()
+		<-call.done
+		return call.status
+	}
+	call := &healthCall{done: make(chan struct{})}
+	c.inflight[t] = call
+	c.mu.Unlock()
+
+	st := c.check(t)
+	st.CheckedAt = c.now()
+
+	c.mu.Lock()
+	c.entries[t] = st
+	delete(c.inflight, t)
+	c.mu.Unlock()
+
+	call.status = st
+	close(call.done)
+	return st
+}
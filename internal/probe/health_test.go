@@ -0,0 +1,142 @@
+package probe
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingChecker returns a HealthCheckFunc that counts its invocations and
+// reports status.
+func countingChecker(count *int64, status *int64) HealthCheckFunc {
+	return func(HealthTarget) HealthStatus {
+		atomic.AddInt64(count, 1)
+		code := int(atomic.LoadInt64(status))
+		return HealthStatus{Healthy: code < 400, StatusCode: code}
+	}
+}
+
+func TestHealthCache_CachedWithinTTL(t *testing.T) {
+	var checks, status int64 = 0, 200
+	c := NewHealthCacheWithChecker(time.Minute, countingChecker(&checks, &status))
+	target := HealthTarget{Host: "127.0.0.1", Port: 3000, Path: "/"}
+
+	for i := 0; i < 3; i++ {
+		if st := c.Status(target); !st.Healthy {
+			t.Fatalf("Status #%d: not healthy", i)
+		}
+	}
+	if checks != 1 {
+		t.Errorf("checks = %d, want 1 within the TTL", checks)
+	}
+}
+
+func TestHealthCache_ExpiresAfterTTL(t *testing.T) {
+	var checks, status int64 = 0, 200
+	c := NewHealthCacheWithChecker(time.Minute, countingChecker(&checks, &status))
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	target := HealthTarget{Host: "127.0.0.1", Port: 3000}
+
+	c.Status(target)
+	now = now.Add(2 * time.Minute)
+	c.Status(target)
+	if checks != 2 {
+		t.Errorf("checks = %d, want 2 after the TTL expired", checks)
+	}
+}
+
+func TestHealthCache_RefreshUpdatesAndPrunes(t *testing.T) {
+	var checks, status int64 = 0, 200
+	c := NewHealthCacheWithChecker(time.Minute, countingChecker(&checks, &status))
+	a := HealthTarget{Host: "127.0.0.1", Port: 3000}
+	b := HealthTarget{Host: "127.0.0.1", Port: 4000}
+
+	c.Refresh([]HealthTarget{a, b})
+	if st := c.Status(a); !st.Healthy {
+		t.Fatal("a: not healthy after first refresh")
+	}
+
+	atomic.StoreInt64(&status, 503)
+	c.Refresh([]HealthTarget{a})
+	st, ok := c.Cached(a)
+	if !ok || st.Healthy || st.StatusCode != 503 {
+		t.Errorf("a after refresh = %+v, %v; want cached 503", st, ok)
+	}
+	if _, ok := c.Cached(b); ok {
+		t.Error("b: still cached after a refresh without it")
+	}
+	if checks != 3 {
+		t.Errorf("checks = %d, want 3", checks)
+	}
+}
+
+func TestHealthCache_CoalescesConcurrentChecks(t *testing.T) {
+	var checks int64
+	release := make(chan struct{})
+	c := NewHealthCacheWithChecker(time.Minute, func(HealthTarget) HealthStatus {
+		atomic.AddInt64(&checks, 1)
+		<-release
+		return HealthStatus{Healthy: true}
+	})
+	target := HealthTarget{Host: "127.0.0.1", Port: 3000}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Status(target)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if checks != 1 {
+		t.Errorf("checks = %d, want 1 for concurrent callers", checks)
+	}
+}
+
+func TestHealthCache_Invalidate(t *testing.T) {
+	var checks, status int64 = 0, 200
+	c := NewHealthCacheWithChecker(time.Minute, countingChecker(&checks, &status))
+	target := HealthTarget{Host: "127.0.0.1", Port: 3000}
+
+	c.Status(target)
+	c.Invalidate("127.0.0.1", 3000)
+	c.Status(target)
+	if checks != 2 {
+		t.Errorf("checks = %d, want 2 after Invalidate", checks)
+	}
+}
+
+func TestCheckHealth(t *testing.T) {
+	var gotHost string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHost = r.Host
+		w.Header().Set("Alt-Svc", `h3=":443"`)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	port, _ := strconv.Atoi(u.Port())
+
+	st := CheckHealth(HealthTarget{Host: u.Hostname(), Port: port, Path: "/", HostName: "app.localhost"})
+	if !st.Healthy || st.StatusCode != http.StatusNoContent || !st.HTTP3 {
+		t.Errorf("CheckHealth = %+v, want healthy 204 with HTTP/3", st)
+	}
+	if gotHost != "app.localhost" {
+		t.Errorf("Host header = %q, want app.localhost", gotHost)
+	}
+
+	srv.Close()
+	if st := CheckHealth(HealthTarget{Host: u.Hostname(), Port: port}); st.Healthy || st.StatusText != "offline" {
+		t.Errorf("CheckHealth(closed) = %+v, want offline", st)
+	}
+}
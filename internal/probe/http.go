@@ -2,7 +2,10 @@ package probe
 
 import (
 	"bufio"
+	"crypto/sha256"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
 	"net"
 	"strconv"
 	"strings"
@@ -30,94 +33,188 @@ func (p Protocol) String() string {
 	}
 }
 
-// IsHTTP checks if the service on the given host:port speaks HTTP
-// Sends a simple GET request and checks for HTTP response
-func IsHTTP(host string, port int) bool {
-	addr := net.JoinHostPort(host, strconv.Itoa(port))
+// DialFunc opens a network connection with a timeout. It matches the
+// signature of net.DialTimeout so probes can be redirected in tests.
+type DialFunc func(network, address string, timeout time.Duration) (net.Conn, error)
 
-	// Try to connect with timeout
-	conn, err := net.DialTimeout("tcp", addr, 500*time.Millisecond)
-	if err != nil {
-		return false
+// DefaultCandidatePaths are the paths tried, in order, when detecting whether
+// a service speaks HTTP. Some dev servers only answer under a health or base
+// path and drop requests for anything else.
+var DefaultCandidatePaths = []string{"/", "/healthz", "/health"}
+
+// CandidatePaths returns DefaultCandidatePaths followed by healthPath, if set.
+func CandidatePaths(healthPath string) []string {
+	paths := append([]string(nil), DefaultCandidatePaths...)
+	if healthPath == "" {
+		return paths
 	}
-	defer conn.Close()
+	if !strings.HasPrefix(healthPath, "/") {
+		healthPath = "/" + healthPath
+	}
+	for _, p := range paths {
+		if p == healthPath {
+			return paths
+		}
+	}
+	return append(paths, healthPath)
+}
 
-	// Set read/write timeout
-	conn.SetDeadline(time.Now().Add(500 * time.Millisecond))
+// Detection is the result of probing a service over a set of candidate paths.
+type Detection struct {
+	Protocol        Protocol
+	Path            string // Candidate path that answered (empty for ProtoNone)
+	CertFingerprint string // Fingerprint of the backend's leaf certificate (ProtoHTTPS only)
+}
 
-	// Send a simple HTTP request
-	request := "GET / HTTP/1.0\r\n\r\n"
-	_, err = conn.Write([]byte(request))
-	if err != nil {
-		return false
-	}
+// CertFingerprint returns the hex SHA-256 of a certificate's DER encoding
+func CertFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
 
-	// Read response
-	reader := bufio.NewReader(conn)
-	line, err := reader.ReadString('\n')
-	if err != nil {
-		return false
-	}
+// IsHTTP checks if the service on the given host:port speaks HTTP
+// Sends a simple GET request and checks for HTTP response
+func IsHTTP(host string, port int) bool {
+	return isHTTP(net.DialTimeout, host, port)
+}
 
-	// Check if response starts with "HTTP/"
-	return strings.HasPrefix(strings.ToUpper(strings.TrimSpace(line)), "HTTP/")
+// isHTTP implements IsHTTP using the given dialer
+func isHTTP(dial DialFunc, host string, port int) bool {
+	line, _, _ := statusLine(dial, host, port, false, "/")
+	return isHTTPStatusLine(line)
 }
 
 // IsHTTPS checks if the service on the given host:port speaks HTTPS
 // Attempts a TLS handshake and sends an HTTP request over TLS
 func IsHTTPS(host string, port int) bool {
+	return isHTTPS(net.DialTimeout, host, port)
+}
+
+// isHTTPS implements IsHTTPS using the given dialer
+func isHTTPS(dial DialFunc, host string, port int) bool {
+	line, _, _ := statusLine(dial, host, port, true, "/")
+	return isHTTPStatusLine(line)
+}
+
+// statusLine sends "GET path" to host:port (over TLS if useTLS) and returns
+// the first response line, and over TLS the fingerprint of the backend's
+// certificate. retry reports whether another path may be worth trying: it is
+// false when the connection or TLS handshake failed or the backend let the
+// request time out, so silent non-HTTP services cost one probe.
+func statusLine(dial DialFunc, host string, port int, useTLS bool, path string) (line, fingerprint string, retry bool) {
 	addr := net.JoinHostPort(host, strconv.Itoa(port))
 
 	// Try to connect with timeout
-	rawConn, err := net.DialTimeout("tcp", addr, 500*time.Millisecond)
+	rawConn, err := dial("tcp", addr, 500*time.Millisecond)
 	if err != nil {
-		return false
+		return "", "", false
 	}
 	defer rawConn.Close()
 
-	// Set deadline for the entire TLS handshake + request
+	// Set deadline for the entire (TLS handshake +) request
 	rawConn.SetDeadline(time.Now().Add(500 * time.Millisecond))
 
-	// Attempt TLS handshake (skip verify since these are local services)
-	tlsConn := tls.Client(rawConn, &tls.Config{
-		InsecureSkipVerify: true,
-	})
-	if err := tlsConn.Handshake(); err != nil {
-		return false
+	conn := rawConn
+	if useTLS {
+		// Attempt TLS handshake (skip verify since these are local services)
+		tlsConn := tls.Client(rawConn, &tls.Config{
+			InsecureSkipVerify: true,
+		})
+		if err := tlsConn.Handshake(); err != nil {
+			return "", "", false
+		}
+		if certs := tlsConn.ConnectionState().PeerCertificates; len(certs) > 0 {
+			fingerprint = CertFingerprint(certs[0])
+		}
+		conn = tlsConn
 	}
 
-	// Send a simple HTTP request over TLS
-	request := "GET / HTTP/1.0\r\n\r\n"
-	_, err = tlsConn.Write([]byte(request))
-	if err != nil {
-		return false
+	// Send a simple HTTP request
+	request := "GET " + path + " HTTP/1.0\r\n\r\n"
+	if _, err := conn.Write([]byte(request)); err != nil {
+		return "", fingerprint, true
 	}
 
 	// Read response
-	reader := bufio.NewReader(tlsConn)
-	line, err := reader.ReadString('\n')
+	reader := bufio.NewReader(conn)
+	line, err = reader.ReadString('\n')
 	if err != nil {
-		return false
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			return "", fingerprint, false
+		}
+		return "", fingerprint, true
 	}
+	return strings.TrimSpace(line), fingerprint, true
+}
 
-	// Check if response starts with "HTTP/"
-	return strings.HasPrefix(strings.ToUpper(strings.TrimSpace(line)), "HTTP/")
+// isHTTPStatusLine reports whether line looks like an HTTP response line
+func isHTTPStatusLine(line string) bool {
+	return strings.HasPrefix(strings.ToUpper(line), "HTTP/")
+}
+
+// statusOK reports whether an HTTP response line carries a 2xx or 3xx status
+func statusOK(line string) bool {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return false
+	}
+	code, err := strconv.Atoi(fields[1])
+	return err == nil && code >= 200 && code < 400
 }
 
 // DetectProtocol attempts to detect the protocol of a service.
 // It first tries HTTPS (TLS handshake), then falls back to plain HTTP.
 func DetectProtocol(host string, port int) Protocol {
-	// Try HTTPS first
-	if IsHTTPS(host, port) {
-		return ProtoHTTPS
+	return detectProtocol(net.DialTimeout, host, port)
+}
+
+// DetectProtocolPaths is like DetectProtocol but tries each of paths in turn,
+// reporting which one answered. A path returning a 2xx/3xx status is
+// preferred; otherwise the first path that produced any HTTP response wins.
+func DetectProtocolPaths(host string, port int, paths []string) Detection {
+	return detect(net.DialTimeout, host, port, paths)
+}
+
+// detectProtocol implements DetectProtocol using the given dialer
+func detectProtocol(dial DialFunc, host string, port int) Protocol {
+	return detect(dial, host, port, DefaultCandidatePaths).Protocol
+}
+
+// detect implements DetectProtocolPaths using the given dialer
+func detect(dial DialFunc, host string, port int, paths []string) Detection {
+	if len(paths) == 0 {
+		paths = DefaultCandidatePaths
 	}
 
-	// Fall back to plain HTTP
-	if IsHTTP(host, port) {
-		return ProtoHTTP
+	// Try HTTPS first, then fall back to plain HTTP
+	for _, c := range []struct {
+		useTLS bool
+		proto  Protocol
+	}{{true, ProtoHTTPS}, {false, ProtoHTTP}} {
+		answered, answeredFingerprint := "", ""
+		for _, path := range paths {
+			line, fingerprint, retry := statusLine(dial, host, port, c.useTLS, path)
+			if !isHTTPStatusLine(line) {
+				// Another path won't help a backend that timed out or
+				// answered in a different protocol
+				if !retry || line != "" {
+					break
+				}
+				continue
+			}
+			if statusOK(line) {
+				return Detection{Protocol: c.proto, Path: path, CertFingerprint: fingerprint}
+			}
+			if answered == "" {
+				answered, answeredFingerprint = path, fingerprint
+			}
+		}
+		if answered != "" {
+			return Detection{Protocol: c.proto, Path: answered, CertFingerprint: answeredFingerprint}
+		}
 	}
 
-	return ProtoNone
+	return Detection{Protocol: ProtoNone}
 }
 
 // ProbeResult contains detailed information about an HTTP probe
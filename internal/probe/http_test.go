@@ -1,9 +1,14 @@
 package probe
 
 import (
+	"bufio"
 	"fmt"
 	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -111,3 +116,106 @@ func TestProtocol_String(t *testing.T) {
 		}
 	}
 }
+
+// startPrefixOnlyServer starts a raw TCP server that only answers requests for
+// prefix and drops the connection for every other path. It returns the port.
+func startPrefixOnlyServer(t *testing.T, prefix string) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to create listener: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				line, err := bufio.NewReader(conn).ReadString('\n')
+				if err != nil {
+					return
+				}
+				fields := strings.Fields(line)
+				if len(fields) >= 2 && fields[0] == "GET" && strings.HasPrefix(fields[1], prefix) {
+					conn.Write([]byte("HTTP/1.0 200 OK\r\nContent-Length: 2\r\n\r\nok"))
+				}
+			}(conn)
+		}
+	}()
+
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestDetectProtocolPaths_PrefixOnlyBackend(t *testing.T) {
+	port := startPrefixOnlyServer(t, "/app")
+
+	if proto := DetectProtocol("127.0.0.1", port); proto != ProtoNone {
+		t.Fatalf("DetectProtocol without /app = %v, want none", proto)
+	}
+
+	d := DetectProtocolPaths("127.0.0.1", port, CandidatePaths("/app"))
+	if d.Protocol != ProtoHTTP {
+		t.Fatalf("Protocol = %v, want http", d.Protocol)
+	}
+	if d.Path != "/app" {
+		t.Errorf("Path = %q, want /app", d.Path)
+	}
+}
+
+func TestDetectProtocolPaths_PrefersSuccessfulStatus(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to create listener: %v", err)
+	}
+	defer listener.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/healthz" {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			http.NotFound(w, r)
+		}),
+	}
+	go server.Serve(listener)
+	defer server.Close()
+
+	d := DetectProtocolPaths("127.0.0.1", port, nil)
+	if d.Protocol != ProtoHTTP || d.Path != "/healthz" {
+		t.Errorf("Detection = %+v, want http at /healthz", d)
+	}
+}
+
+func TestDetectProtocolPaths_CertFingerprint(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	port, _ := strconv.Atoi(u.Port())
+
+	d := DetectProtocolPaths("127.0.0.1", port, nil)
+	if d.Protocol != ProtoHTTPS {
+		t.Fatalf("Protocol = %v, want https", d.Protocol)
+	}
+	if want := CertFingerprint(server.Certificate()); d.CertFingerprint != want {
+		t.Errorf("CertFingerprint = %q, want %q", d.CertFingerprint, want)
+	}
+}
+
+func TestCandidatePaths(t *testing.T) {
+	if got := CandidatePaths(""); len(got) != len(DefaultCandidatePaths) {
+		t.Errorf("CandidatePaths(\"\") = %v", got)
+	}
+	got := CandidatePaths("app")
+	if got[len(got)-1] != "/app" {
+		t.Errorf("CandidatePaths(\"app\") = %v, want /app last", got)
+	}
+	if got := CandidatePaths("/healthz"); len(got) != len(DefaultCandidatePaths) {
+		t.Errorf("duplicate candidate added: %v", got)
+	}
+}
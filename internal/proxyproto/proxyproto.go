@@ -0,0 +1,100 @@
+// Package proxyproto writes HAProxy PROXY protocol headers, which tell a
+// backend the original client address of a proxied connection.
+package proxyproto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+)
+
+// Supported header versions
+const (
+	V1 = "v1" // Human-readable text line
+	V2 = "v2" // Binary header
+)
+
+// v2Signature starts every version 2 header
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// Valid reports whether version is a supported header version
+func Valid(version string) bool {
+	return version == V1 || version == V2
+}
+
+// Header encodes a PROXY header for a TCP connection from src to dst. When
+// either address is missing or the families differ the header declares the
+// connection as unknown (v1) or local (v2), which backends accept without
+// trusting any address.
+func Header(version string, src, dst *net.TCPAddr) ([]byte, error) {
+	switch version {
+	case V1:
+		return headerV1(src, dst), nil
+	case V2:
+		return headerV2(src, dst), nil
+	}
+	return nil, fmt.Errorf("unsupported PROXY protocol version %q", version)
+}
+
+// WriteHeader writes the PROXY header for src and dst to w
+func WriteHeader(w io.Writer, version string, src, dst *net.TCPAddr) error {
+	header, err := Header(version, src, dst)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(header)
+	return err
+}
+
+// addrFamily returns the 4- or 16-byte forms of both addresses, or nils
+// when they cannot share one header
+func addrFamily(src, dst *net.TCPAddr) (srcIP, dstIP net.IP) {
+	if src == nil || dst == nil {
+		return nil, nil
+	}
+	if s4, d4 := src.IP.To4(), dst.IP.To4(); s4 != nil && d4 != nil {
+		return s4, d4
+	}
+	if src.IP.To4() == nil && dst.IP.To4() == nil && len(src.IP) == net.IPv6len && len(dst.IP) == net.IPv6len {
+		return src.IP, dst.IP
+	}
+	return nil, nil
+}
+
+func headerV1(src, dst *net.TCPAddr) []byte {
+	srcIP, dstIP := addrFamily(src, dst)
+	if srcIP == nil {
+		return []byte("PROXY UNKNOWN\r\n")
+	}
+	proto := "TCP4"
+	if len(srcIP) == net.IPv6len {
+		proto = "TCP6"
+	}
+	return []byte(fmt.Sprintf("PROXY %s %s %s %d %d\r\n", proto, srcIP, dstIP, src.Port, dst.Port))
+}
+
+func headerV2(src, dst *net.TCPAddr) []byte {
+	var buf bytes.Buffer
+	buf.Write(v2Signature)
+
+	srcIP, dstIP := addrFamily(src, dst)
+	if srcIP == nil {
+		// LOCAL command, unspecified family, no addresses
+		buf.Write([]byte{0x20, 0x00, 0x00, 0x00})
+		return buf.Bytes()
+	}
+
+	family := byte(0x11) // TCP over IPv4
+	if len(srcIP) == net.IPv6len {
+		family = 0x21 // TCP over IPv6
+	}
+	buf.Write([]byte{0x21, family}) // Version 2, PROXY command
+	binary.Write(&buf, binary.BigEndian, uint16(2*len(srcIP)+4))
+	buf.Write(srcIP)
+	buf.Write(dstIP)
+	binary.Write(&buf, binary.BigEndian, uint16(src.Port))
+	binary.Write(&buf, binary.BigEndian, uint16(dst.Port))
+	return buf.Bytes()
+}
@@ -0,0 +1,82 @@
+package proxyproto
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+func tcpAddr(ip string, port int) *net.TCPAddr {
+	return &net.TCPAddr{IP: net.ParseIP(ip), Port: port}
+}
+
+func TestHeaderV1(t *testing.T) {
+	tests := []struct {
+		name     string
+		src, dst *net.TCPAddr
+		want     string
+	}{
+		{"ipv4", tcpAddr("192.168.1.10", 51234), tcpAddr("127.0.0.1", 80), "PROXY TCP4 192.168.1.10 127.0.0.1 51234 80\r\n"},
+		{"ipv6", tcpAddr("::1", 51234), tcpAddr("::1", 443), "PROXY TCP6 ::1 ::1 51234 443\r\n"},
+		{"mixed families", tcpAddr("10.0.0.1", 1), tcpAddr("::1", 80), "PROXY UNKNOWN\r\n"},
+		{"missing source", nil, tcpAddr("127.0.0.1", 80), "PROXY UNKNOWN\r\n"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Header(V1, tc.src, tc.dst)
+			if err != nil {
+				t.Fatalf("Header: %v", err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("Header = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestHeaderV2_IPv4(t *testing.T) {
+	got, err := Header(V2, tcpAddr("192.168.1.10", 51234), tcpAddr("127.0.0.1", 80))
+	if err != nil {
+		t.Fatalf("Header: %v", err)
+	}
+
+	want := append([]byte{}, v2Signature...)
+	want = append(want, 0x21, 0x11, 0x00, 0x0c) // v2 PROXY, TCP4, 12 address bytes
+	want = append(want, 192, 168, 1, 10, 127, 0, 0, 1)
+	want = append(want, 0xc8, 0x22, 0x00, 0x50) // 51234, 80
+	if !bytes.Equal(got, want) {
+		t.Errorf("Header =\n%x\nwant\n%x", got, want)
+	}
+}
+
+func TestHeaderV2_IPv6(t *testing.T) {
+	got, err := Header(V2, tcpAddr("::1", 1), tcpAddr("::1", 2))
+	if err != nil {
+		t.Fatalf("Header: %v", err)
+	}
+	if len(got) != 16+36 {
+		t.Fatalf("len = %d, want 52", len(got))
+	}
+	if got[13] != 0x21 {
+		t.Errorf("family = %#x, want 0x21 (TCP6)", got[13])
+	}
+}
+
+func TestHeaderV2_Local(t *testing.T) {
+	got, err := Header(V2, nil, nil)
+	if err != nil {
+		t.Fatalf("Header: %v", err)
+	}
+	if !bytes.HasPrefix(got, v2Signature) || !bytes.Equal(got[12:], []byte{0x20, 0x00, 0x00, 0x00}) {
+		t.Errorf("Header = %x, want a LOCAL header", got)
+	}
+}
+
+func TestHeader_UnknownVersion(t *testing.T) {
+	if _, err := Header("v3", nil, nil); err == nil {
+		t.Error("expected an error for an unknown version")
+	}
+	if Valid("v3") || !Valid(V1) || !Valid(V2) {
+		t.Error("Valid disagrees with the supported versions")
+	}
+}
@@ -187,31 +187,40 @@ checkUserRules:
 	defer bs.mu.RUnlock()
 
 	for _, entry := range bs.entries {
-		switch entry.Type {
-		case "pid":
-			// PID-based blacklisting is checked at the caller level
-			// since we don't have PID info here; skip
+		// PID-based blacklisting is checked at the caller level
+		// since we don't have PID info here; skip
+		if entry.Type == "pid" {
 			continue
-		case "path":
-			if exePath == entry.Value || strings.HasPrefix(exePath, entry.Value) {
-				return true
-			}
-		case "pattern":
-			matched, err := regexp.MatchString(entry.Value, exePath)
+		}
+		if entry.Matches(0, exePath, args) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Matches reports whether this single entry matches a process. Unlike
+// IsBlacklisted it ignores the built-in rules.
+func (e *BlacklistEntry) Matches(pid int, exePath string, args []string) bool {
+	switch e.Type {
+	case "pid":
+		return pid != 0 && e.Value == strconv.Itoa(pid)
+	case "path":
+		return exePath == e.Value || strings.HasPrefix(exePath, e.Value)
+	case "pattern":
+		matched, err := regexp.MatchString(e.Value, exePath)
+		if err == nil && matched {
+			return true
+		}
+		// Also check against args joined
+		if len(args) > 0 {
+			matched, err = regexp.MatchString(e.Value, strings.Join(args, " "))
 			if err == nil && matched {
 				return true
 			}
-			// Also check against args joined
-			if len(args) > 0 {
-				argsJoined := strings.Join(args, " ")
-				matched, err = regexp.MatchString(entry.Value, argsJoined)
-				if err == nil && matched {
-					return true
-				}
-			}
 		}
 	}
-
 	return false
 }
 
@@ -238,6 +247,18 @@ func DefaultBlacklistPath() string {
 	return filepath.Join(home, ".config", "nameport", "blacklist.json")
 }
 
+// Reload reads the blacklist from disk again, replacing in-memory entries
+func (bs *BlacklistStore) Reload() error {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	bs.entries = make([]*BlacklistEntry, 0)
+	if err := bs.load(); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to load blacklist: %w", err)
+	}
+	return nil
+}
+
 // load reads blacklist entries from disk
 func (bs *BlacklistStore) load() error {
 	data, err := os.ReadFile(bs.path)
@@ -319,3 +319,27 @@ func TestIsBlacklistedPatternOnArgs(t *testing.T) {
 		t.Error("expected pattern matching args to be blacklisted")
 	}
 }
+
+func TestBlacklistEntryMatches(t *testing.T) {
+	tests := []struct {
+		entry   BlacklistEntry
+		pid     int
+		exePath string
+		args    []string
+		want    bool
+	}{
+		{BlacklistEntry{Type: "pid", Value: "42"}, 42, "/bin/app", nil, true},
+		{BlacklistEntry{Type: "pid", Value: "42"}, 43, "/bin/app", nil, false},
+		{BlacklistEntry{Type: "path", Value: "/opt/tools/"}, 1, "/opt/tools/server", nil, true},
+		{BlacklistEntry{Type: "path", Value: "/opt/tools/"}, 1, "/home/u/server", nil, false},
+		{BlacklistEntry{Type: "pattern", Value: "webpack"}, 1, "/usr/bin/node", []string{"node", "webpack-dev-server"}, true},
+		{BlacklistEntry{Type: "pattern", Value: "webpack"}, 1, "/usr/bin/node", []string{"node", "vite"}, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.entry.Matches(tt.pid, tt.exePath, tt.args); got != tt.want {
+			t.Errorf("%s=%s Matches(%d, %s, %v) = %v, want %v",
+				tt.entry.Type, tt.entry.Value, tt.pid, tt.exePath, tt.args, got, tt.want)
+		}
+	}
+}
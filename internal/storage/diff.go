@@ -0,0 +1,75 @@
+package storage
+
+import "sort"
+
+// DiffKind describes how a record differs between two record sets
+type DiffKind string
+
+const (
+	DiffOnlyRunning DiffKind = "only_running" // Record exists only in the running daemon
+	DiffOnlyStored  DiffKind = "only_stored"  // Record exists only in the store on disk
+	DiffChanged     DiffKind = "changed"      // Record exists in both but fields differ
+)
+
+// RecordDiff is a single difference between the daemon's in-memory records
+// and the records persisted on disk
+type RecordDiff struct {
+	ID      string
+	Name    string
+	Kind    DiffKind
+	Running *ServiceRecord
+	Stored  *ServiceRecord
+	Fields  []string // Differing fields when Kind is DiffChanged
+}
+
+// DiffRecords compares the records known to a running daemon against the
+// records stored on disk, matching them by ID. Only the user-visible fields
+// (name, port, keep) are compared; runtime fields like PID are ignored.
+// Results are sorted by name.
+func DiffRecords(running, stored []*ServiceRecord) []RecordDiff {
+	storedByID := make(map[string]*ServiceRecord, len(stored))
+	for _, r := range stored {
+		storedByID[r.ID] = r
+	}
+
+	var diffs []RecordDiff
+	seen := make(map[string]bool, len(running))
+
+	for _, r := range running {
+		seen[r.ID] = true
+		s, ok := storedByID[r.ID]
+		if !ok {
+			diffs = append(diffs, RecordDiff{ID: r.ID, Name: r.Name, Kind: DiffOnlyRunning, Running: r})
+			continue
+		}
+
+		var fields []string
+		if r.Name != s.Name {
+			fields = append(fields, "name")
+		}
+		if r.Port != s.Port {
+			fields = append(fields, "port")
+		}
+		if r.Keep != s.Keep {
+			fields = append(fields, "keep")
+		}
+		if len(fields) > 0 {
+			diffs = append(diffs, RecordDiff{ID: r.ID, Name: r.Name, Kind: DiffChanged, Running: r, Stored: s, Fields: fields})
+		}
+	}
+
+	for _, s := range stored {
+		if !seen[s.ID] {
+			diffs = append(diffs, RecordDiff{ID: s.ID, Name: s.Name, Kind: DiffOnlyStored, Stored: s})
+		}
+	}
+
+	sort.Slice(diffs, func(i, j int) bool {
+		if diffs[i].Name != diffs[j].Name {
+			return diffs[i].Name < diffs[j].Name
+		}
+		return diffs[i].ID < diffs[j].ID
+	})
+
+	return diffs
+}
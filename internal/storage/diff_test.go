@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffRecords(t *testing.T) {
+	running := []*ServiceRecord{
+		{ID: "same", Name: "same.localhost", Port: 3000, PID: 10},
+		{ID: "renamed", Name: "old.localhost", Port: 4000},
+		{ID: "moved", Name: "moved.localhost", Port: 5000, Keep: true},
+		{ID: "mem-only", Name: "mem.localhost", Port: 6000},
+	}
+	stored := []*ServiceRecord{
+		{ID: "same", Name: "same.localhost", Port: 3000, PID: 99}, // PID differences are ignored
+		{ID: "renamed", Name: "new.localhost", Port: 4000},
+		{ID: "moved", Name: "moved.localhost", Port: 5001, Keep: false},
+		{ID: "disk-only", Name: "disk.localhost", Port: 7000},
+	}
+
+	diffs := DiffRecords(running, stored)
+	if len(diffs) != 4 {
+		t.Fatalf("expected 4 diffs, got %d: %+v", len(diffs), diffs)
+	}
+
+	want := []struct {
+		id     string
+		kind   DiffKind
+		fields []string
+	}{
+		{"disk-only", DiffOnlyStored, nil},
+		{"mem-only", DiffOnlyRunning, nil},
+		{"moved", DiffChanged, []string{"port", "keep"}},
+		{"renamed", DiffChanged, []string{"name"}},
+	}
+
+	for i, w := range want {
+		d := diffs[i]
+		if d.ID != w.id {
+			t.Errorf("diff[%d].ID = %q, want %q", i, d.ID, w.id)
+		}
+		if d.Kind != w.kind {
+			t.Errorf("diff[%d].Kind = %q, want %q", i, d.Kind, w.kind)
+		}
+		if !reflect.DeepEqual(d.Fields, w.fields) {
+			t.Errorf("diff[%d].Fields = %v, want %v", i, d.Fields, w.fields)
+		}
+	}
+}
+
+func TestDiffRecordsIdentical(t *testing.T) {
+	records := []*ServiceRecord{
+		{ID: "a", Name: "a.localhost", Port: 3000},
+		{ID: "b", Name: "b.localhost", Port: 4000, Keep: true},
+	}
+	if diffs := DiffRecords(records, records); len(diffs) != 0 {
+		t.Errorf("expected no diffs, got %+v", diffs)
+	}
+}
@@ -2,10 +2,33 @@ package storage
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Record sources, describing how a ServiceRecord was created
+const (
+	SourceDiscovered = "discovered" // Found by the daemon's port scanner
+	SourceManual     = "manual"     // Added with `nameport add`
+	SourceCompose    = "compose"    // Imported from a compose file
+	SourceDocker     = "docker"     // Found through the Docker API
+)
+
+// Preferred schemes for a service's dashboard link
+const (
+	SchemeHTTPS = "https" // Always link over HTTPS; the HTTP link is hidden
+	SchemeHTTP  = "http"  // Link over HTTP first, even when TLS is enabled
 )
 
 // ServiceRecord represents a persisted service mapping
@@ -23,6 +46,156 @@ type ServiceRecord struct {
 	Keep        bool      `json:"keep"`                  // Whether to keep even when inactive
 	Group       string    `json:"group,omitempty"`       // Service group (e.g. "ollama" for ollama.localhost and ollama-1.localhost)
 	UseTLS      bool      `json:"use_tls,omitempty"`     // Whether backend uses TLS/HTTPS
+	Source      string    `json:"source,omitempty"`      // How the record was created (discovered, manual, compose, docker)
+
+	BandwidthLimit  int64           `json:"bandwidth_limit,omitempty"`  // Response bandwidth cap in bytes/sec (0 = unlimited)
+	UpstreamTimeout time.Duration   `json:"upstream_timeout,omitempty"` // Max wait for backend response headers (0 = global default), stored as a duration string such as "90s"
+	HealthPath      string          `json:"health_path,omitempty"`      // Extra path tried when probing (e.g. "/app")
+	ProbePath       string          `json:"probe_path,omitempty"`       // Path that answered the last successful probe
+	FlushInterval   time.Duration   `json:"flush_interval,omitempty"`   // Proxy response flush interval (0 = default buffering, -1 = flush every write)
+	HostHeader      string          `json:"host_header,omitempty"`      // Fixed Host header sent to the backend (overrides PreserveHost)
+	PreserveHost    bool            `json:"preserve_host,omitempty"`    // Send the original .localhost Host instead of target:port
+	Color           string          `json:"color,omitempty"`            // Dashboard accent color (#rgb or #rrggbb)
+	Icon            string          `json:"icon,omitempty"`             // Dashboard icon, usually a single emoji
+	AuthToken       string          `json:"auth_token,omitempty"`       // Bearer token injected into proxied requests (stored in plaintext)
+	AuthTokenEnv    string          `json:"auth_token_env,omitempty"`   // Daemon environment variable holding the bearer token instead
+	ProxyProtocol   string          `json:"proxy_protocol,omitempty"`   // PROXY protocol header sent on backend connections ("v1", "v2" or empty)
+	PreferredScheme string          `json:"preferred_scheme,omitempty"` // Scheme of the primary dashboard link (SchemeHTTPS, SchemeHTTP or empty = follow TLS)
+	Override        *TargetOverride `json:"override,omitempty"`         // Temporary target used instead of TargetHost:Port until it expires
+	CertFingerprint string          `json:"cert_fingerprint,omitempty"` // SHA-256 of the backend's TLS certificate, matching it across restarts that change its identity
+}
+
+// recordJSON has ServiceRecord's fields without its JSON methods
+type recordJSON ServiceRecord
+
+// MarshalJSON writes UpstreamTimeout as a duration string (e.g. "1m30s")
+// rather than nanoseconds, so the store stays readable when edited by hand
+func (r ServiceRecord) MarshalJSON() ([]byte, error) {
+	out := struct {
+		*recordJSON
+		UpstreamTimeout string `json:"upstream_timeout,omitempty"`
+	}{recordJSON: (*recordJSON)(&r)}
+	if r.UpstreamTimeout != 0 {
+		out.UpstreamTimeout = r.UpstreamTimeout.String()
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON reads UpstreamTimeout as a duration string, or as a number
+// of nanoseconds as written by earlier versions
+func (r *ServiceRecord) UnmarshalJSON(data []byte) error {
+	in := struct {
+		*recordJSON
+		UpstreamTimeout json.RawMessage `json:"upstream_timeout,omitempty"`
+	}{recordJSON: (*recordJSON)(r)}
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+
+	r.UpstreamTimeout = 0
+	if len(in.UpstreamTimeout) == 0 || string(in.UpstreamTimeout) == "null" {
+		return nil
+	}
+	var text string
+	if err := json.Unmarshal(in.UpstreamTimeout, &text); err == nil {
+		d, err := time.ParseDuration(text)
+		if err != nil || d < 0 {
+			return fmt.Errorf("invalid upstream_timeout %q: use a duration such as \"90s\"", text)
+		}
+		r.UpstreamTimeout = d
+		return nil
+	}
+	var nanos int64
+	if err := json.Unmarshal(in.UpstreamTimeout, &nanos); err != nil {
+		return fmt.Errorf("invalid upstream_timeout %s: use a duration such as \"90s\"", in.UpstreamTimeout)
+	}
+	r.UpstreamTimeout = time.Duration(nanos)
+	return nil
+}
+
+// TargetOverride points a service at another backend for a limited time
+type TargetOverride struct {
+	Host    string    `json:"host"`
+	Port    int       `json:"port"`
+	Expires time.Time `json:"expires"`
+}
+
+// Active reports whether the override is set and has not expired at now
+func (o *TargetOverride) Active(now time.Time) bool {
+	return o != nil && now.Before(o.Expires)
+}
+
+// InferSource guesses the source of a record created before Source existed
+func InferSource(r *ServiceRecord) string {
+	switch {
+	case r.ExePath == "manual" || strings.HasPrefix(r.ID, "manual-"):
+		return SourceManual
+	case strings.HasPrefix(r.ID, "compose-"):
+		return SourceCompose
+	case strings.HasPrefix(r.ID, "docker-") || strings.HasPrefix(r.ExePath, "docker:"):
+		return SourceDocker
+	default:
+		return SourceDiscovered
+	}
+}
+
+// MaxIconRunes is the longest icon accepted, enough for multi-codepoint
+// emoji such as flags or ZWJ sequences
+const MaxIconRunes = 8
+
+// colorPattern matches the hex colors accepted for ServiceRecord.Color
+var colorPattern = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// ValidateColor checks that color is a #rgb or #rrggbb hex color
+func ValidateColor(color string) error {
+	if !colorPattern.MatchString(color) {
+		return fmt.Errorf("invalid color %q: use #rgb or #rrggbb", color)
+	}
+	return nil
+}
+
+// ValidateIcon checks that icon is a short run of printable, non-space
+// characters, such as an emoji
+func ValidateIcon(icon string) error {
+	if icon == "" || !utf8.ValidString(icon) {
+		return fmt.Errorf("invalid icon %q", icon)
+	}
+	if n := utf8.RuneCountInString(icon); n > MaxIconRunes {
+		return fmt.Errorf("icon %q is too long (%d characters, max %d)", icon, n, MaxIconRunes)
+	}
+	for _, r := range icon {
+		// Allow the zero-width joiner used by emoji sequences
+		if r == '\u200d' {
+			continue
+		}
+		if unicode.IsSpace(r) || !unicode.IsPrint(r) {
+			return fmt.Errorf("invalid icon %q: must not contain spaces or control characters", icon)
+		}
+	}
+	return nil
+}
+
+// Redacted returns a copy of r safe to expose over the API, with secrets
+// such as AuthToken masked
+func (r *ServiceRecord) Redacted() *ServiceRecord {
+	c := *r
+	if c.AuthToken != "" {
+		c.AuthToken = "********"
+	}
+	return &c
+}
+
+// clone returns a copy of r that shares no mutable state with it
+func (r *ServiceRecord) clone() *ServiceRecord {
+	c := *r
+	if r.Args != nil {
+		c.Args = append(make([]string, 0, len(r.Args)), r.Args...)
+	}
+	if r.Override != nil {
+		o := *r.Override
+		c.Override = &o
+	}
+	return &c
 }
 
 // EffectiveTargetHost returns the target host, defaulting to 127.0.0.1
@@ -33,11 +206,33 @@ func (r *ServiceRecord) EffectiveTargetHost() string {
 	return r.TargetHost
 }
 
-// Store manages persistence of service name mappings
+// TargetAddr returns the target as host:port, bracketing IPv6 hosts
+func (r *ServiceRecord) TargetAddr() string {
+	return net.JoinHostPort(r.EffectiveTargetHost(), strconv.Itoa(r.Port))
+}
+
+// Store manages persistence of service name mappings. It is safe for
+// concurrent use: records are copied in and out, so callers change a record
+// by modifying the copy they got and passing it to Save.
 type Store struct {
 	path    string
 	records map[string]*ServiceRecord // key = ID
 	names   map[string]string         // name -> ID mapping
+	mu      sync.RWMutex
+
+	readOnly bool // Set by SetReadOnly; persist refuses to write
+}
+
+// ErrReadOnly is returned by changes that could not be written because the
+// store is read-only. They are kept in memory only.
+var ErrReadOnly = errors.New("store is read-only")
+
+// SetReadOnly stops (or resumes) writing the store to disk. A daemon handing
+// its listeners to a new process sets it so the two never write at once.
+func (s *Store) SetReadOnly(readOnly bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.readOnly = readOnly
 }
 
 // NewStore creates a new store with the given file path
@@ -62,29 +257,50 @@ func NewStore(path string) (*Store, error) {
 	return s, nil
 }
 
-// Get returns a record by ID
+// Get returns a copy of a record by ID
 func (s *Store) Get(id string) (*ServiceRecord, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	r, ok := s.records[id]
-	return r, ok
+	if !ok {
+		return nil, false
+	}
+	return r.clone(), true
 }
 
-// GetByName returns a record by its assigned name
+// GetByName returns a copy of a record by its assigned name
 func (s *Store) GetByName(name string) (*ServiceRecord, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	id, ok := s.names[name]
 	if !ok {
 		return nil, false
 	}
-	return s.Get(id)
+	r, ok := s.records[id]
+	if !ok {
+		return nil, false
+	}
+	return r.clone(), true
 }
 
 // Save stores or updates a record
 func (s *Store) Save(record *ServiceRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.save(record)
+}
+
+// save stores or updates a record. s.mu must be held.
+func (s *Store) save(record *ServiceRecord) error {
 	// Remove old name mapping if exists
 	if old, ok := s.records[record.ID]; ok {
 		delete(s.names, old.Name)
 	}
 
-	s.records[record.ID] = record
+	s.records[record.ID] = record.clone()
 	s.names[record.Name] = record.ID
 
 	return s.persist()
@@ -92,6 +308,9 @@ func (s *Store) Save(record *ServiceRecord) error {
 
 // UpdateName changes the name of a service
 func (s *Store) UpdateName(id string, newName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	record, ok := s.records[id]
 	if !ok {
 		return fmt.Errorf("record not found: %s", id)
@@ -113,23 +332,123 @@ func (s *Store) UpdateName(id string, newName string) error {
 	return s.persist()
 }
 
-// List returns all records
+// List returns copies of all records
 func (s *Store) List() []*ServiceRecord {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.list()
+}
+
+// list returns copies of all records. s.mu must be held.
+func (s *Store) list() []*ServiceRecord {
 	result := make([]*ServiceRecord, 0, len(s.records))
 	for _, r := range s.records {
-		result = append(result, r)
+		result = append(result, r.clone())
+	}
+	return result
+}
+
+// ListBySource returns all records created from the given source
+func (s *Store) ListBySource(source string) []*ServiceRecord {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]*ServiceRecord, 0)
+	for _, r := range s.records {
+		if r.Source == source {
+			result = append(result, r.clone())
+		}
+	}
+	return result
+}
+
+// FindByTarget returns the records that proxy to host:port, sorted by name.
+// An empty host and "localhost" both mean 127.0.0.1.
+func (s *Store) FindByTarget(host string, port int) []*ServiceRecord {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	host = normalizeTargetHost(host)
+	result := make([]*ServiceRecord, 0)
+	for _, r := range s.records {
+		if r.Port == port && normalizeTargetHost(r.TargetHost) == host {
+			result = append(result, r.clone())
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// FindByCertFingerprint returns the records whose backend presented the TLS
+// certificate with the given fingerprint, sorted by name
+func (s *Store) FindByCertFingerprint(fingerprint string) []*ServiceRecord {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]*ServiceRecord, 0)
+	if fingerprint == "" {
+		return result
+	}
+	for _, r := range s.records {
+		if r.CertFingerprint == fingerprint {
+			result = append(result, r.clone())
+		}
 	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
 	return result
 }
 
+// ChangeID moves a record to a new identity hash, keeping its name and
+// settings
+func (s *Store) ChangeID(oldID, newID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.records[oldID]
+	if !ok {
+		return fmt.Errorf("record not found: %s", oldID)
+	}
+	if _, exists := s.records[newID]; exists {
+		return fmt.Errorf("record %s already exists", newID)
+	}
+
+	delete(s.records, oldID)
+	record.ID = newID
+	s.records[newID] = record
+	s.names[record.Name] = newID
+
+	return s.persist()
+}
+
+// normalizeTargetHost maps the spellings of the default target to 127.0.0.1
+func normalizeTargetHost(host string) string {
+	switch h := strings.ToLower(host); h {
+	case "", "localhost":
+		return "127.0.0.1"
+	default:
+		return h
+	}
+}
+
 // IsNameAvailable checks if a name is not in use
 func (s *Store) IsNameAvailable(name string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	_, exists := s.names[name]
 	return !exists
 }
 
 // UpdateKeep changes the keep status of a service
 func (s *Store) UpdateKeep(id string, keep bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	record, ok := s.records[id]
 	if !ok {
 		return fmt.Errorf("record not found: %s", id)
@@ -141,6 +460,14 @@ func (s *Store) UpdateKeep(id string, keep bool) error {
 
 // Remove deletes a record by ID
 func (s *Store) Remove(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.remove(id)
+}
+
+// remove deletes a record by ID. s.mu must be held.
+func (s *Store) remove(id string) error {
 	record, ok := s.records[id]
 	if !ok {
 		return fmt.Errorf("record not found: %s", id)
@@ -154,11 +481,14 @@ func (s *Store) Remove(id string) error {
 
 // RemoveByName deletes a record by its assigned name
 func (s *Store) RemoveByName(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	id, ok := s.names[name]
 	if !ok {
 		return fmt.Errorf("service not found: %s", name)
 	}
-	return s.Remove(id)
+	return s.remove(id)
 }
 
 // AddManualService adds a service manually (for services not currently running)
@@ -170,6 +500,9 @@ func (s *Store) AddManualService(name string, port int, targetHost string) (*Ser
 	// Generate a unique ID for this manual entry
 	id := fmt.Sprintf("manual-%s-%s-%d", name, targetHost, port)
 
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	// Check if name is available
 	if _, exists := s.names[name]; exists {
 		return nil, fmt.Errorf("name %s is already in use", name)
@@ -183,48 +516,103 @@ func (s *Store) AddManualService(name string, port int, targetHost string) (*Ser
 		PID:         0,
 		ExePath:     "manual",
 		Args:        []string{},
+		Source:      SourceManual,
 		UserDefined: true,
 		IsActive:    false,
 		Keep:        true, // Manual entries are automatically kept
 		LastSeen:    time.Now(),
 	}
 
-	if err := s.Save(record); err != nil {
+	if err := s.save(record); err != nil {
 		return nil, err
 	}
 
 	return record, nil
 }
 
-// load reads the store from disk
+// Reload discards in-memory records and reads the store from disk again, so
+// edits made by another process (such as the CLI) are picked up. The
+// in-memory records are kept if the file cannot be read.
+func (s *Store) Reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to load store: %w", err)
+	}
+	return nil
+}
+
+// load replaces the in-memory records with the store on disk. A missing
+// file leaves an empty store. s.mu must be held once the store is shared.
 func (s *Store) load() error {
+	records := make(map[string]*ServiceRecord)
+	names := make(map[string]string)
+
 	data, err := os.ReadFile(s.path)
 	if err != nil {
+		if os.IsNotExist(err) {
+			s.records, s.names = records, names
+		}
 		return err
 	}
 
-	var records []*ServiceRecord
-	if err := json.Unmarshal(data, &records); err != nil {
+	var list []*ServiceRecord
+	if err := json.Unmarshal(data, &list); err != nil {
 		return err
 	}
 
-	for _, r := range records {
-		s.records[r.ID] = r
-		s.names[r.Name] = r.ID
+	for _, r := range list {
+		// Backfill records written before Source existed
+		if r.Source == "" {
+			r.Source = InferSource(r)
+		}
+		records[r.ID] = r
+		names[r.Name] = r.ID
 	}
 
+	s.records, s.names = records, names
 	return nil
 }
 
-// persist writes the store to disk
+// persist writes the store to disk through a temp file renamed into place,
+// so a concurrent reader (such as the CLI) never sees a partial file. s.mu
+// must be held.
 func (s *Store) persist() error {
-	records := s.List()
-	data, err := json.MarshalIndent(records, "", "  ")
+	if s.readOnly {
+		return ErrReadOnly
+	}
+
+	data, err := json.MarshalIndent(s.list(), "", "  ")
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(s.path, data, 0666)
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), "services-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpPath := tmp.Name()
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to chmod temp file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to close temp file: %w", err)
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to rename temp file: %w", err)
+	}
+	return nil
 }
 
 // DefaultStorePath returns the default storage path
@@ -2,8 +2,12 @@ package storage
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -79,6 +83,25 @@ func TestGetFound(t *testing.T) {
 	}
 }
 
+func TestGetReturnsCopy(t *testing.T) {
+	store, _ := NewStore(tempStorePath(t))
+	record := &ServiceRecord{ID: "id1", Name: "app.localhost", Port: 3000, Args: []string{"serve"}}
+	store.Save(record)
+	record.Port = 4000
+
+	got, _ := store.Get("id1")
+	if got.Port != 3000 {
+		t.Errorf("Save kept the caller's record: port = %d, want 3000", got.Port)
+	}
+	got.Port = 5000
+	got.Args[0] = "changed"
+	for _, r := range store.List() {
+		if r.Port != 3000 || r.Args[0] != "serve" {
+			t.Errorf("changing a returned record changed the store: %+v", r)
+		}
+	}
+}
+
 func TestGetNotFound(t *testing.T) {
 	store, _ := NewStore(tempStorePath(t))
 
@@ -317,6 +340,9 @@ func TestAddManualService(t *testing.T) {
 	if !record.Keep {
 		t.Error("expected Keep to be true for manual service")
 	}
+	if record.Source != SourceManual {
+		t.Errorf("expected source %s, got %s", SourceManual, record.Source)
+	}
 }
 
 func TestAddManualServiceDefaultHost(t *testing.T) {
@@ -341,6 +367,76 @@ func TestAddManualServiceConflict(t *testing.T) {
 	}
 }
 
+func TestFindByTarget(t *testing.T) {
+	store, _ := NewStore(tempStorePath(t))
+	store.AddManualService("web.localhost", 3000, "")
+	store.AddManualService("remote.localhost", 3000, "10.0.0.1")
+	store.Save(&ServiceRecord{ID: "id1", Name: "app.localhost", Port: 3000})
+
+	found := store.FindByTarget("localhost", 3000)
+	if len(found) != 2 || found[0].Name != "app.localhost" || found[1].Name != "web.localhost" {
+		t.Errorf("FindByTarget(localhost, 3000) = %v, want app and web", recordNames(found))
+	}
+	if found := store.FindByTarget("10.0.0.1", 3000); len(found) != 1 || found[0].Name != "remote.localhost" {
+		t.Errorf("FindByTarget(10.0.0.1, 3000) = %v, want remote", recordNames(found))
+	}
+	if found := store.FindByTarget("127.0.0.1", 4000); len(found) != 0 {
+		t.Errorf("FindByTarget(127.0.0.1, 4000) = %v, want none", recordNames(found))
+	}
+}
+
+func TestChangeID(t *testing.T) {
+	path := tempStorePath(t)
+	store, _ := NewStore(path)
+	store.Save(&ServiceRecord{ID: "old", Name: "app.localhost", Port: 3000, Keep: true, CertFingerprint: "ab12"})
+	store.Save(&ServiceRecord{ID: "other", Name: "other.localhost", Port: 4000})
+
+	if found := store.FindByCertFingerprint("ab12"); len(found) != 1 || found[0].ID != "old" {
+		t.Fatalf("FindByCertFingerprint = %v, want app", recordNames(found))
+	}
+	if err := store.ChangeID("old", "other"); err == nil {
+		t.Error("ChangeID onto an existing ID succeeded, want an error")
+	}
+	if err := store.ChangeID("old", "new"); err != nil {
+		t.Fatalf("ChangeID: %v", err)
+	}
+
+	reloaded, _ := NewStore(path)
+	if _, ok := reloaded.Get("old"); ok {
+		t.Error("record still stored under the old ID")
+	}
+	r, ok := reloaded.GetByName("app.localhost")
+	if !ok || r.ID != "new" || !r.Keep {
+		t.Errorf("GetByName(app.localhost) = %+v, want the kept record under ID new", r)
+	}
+}
+
+func recordNames(records []*ServiceRecord) []string {
+	names := make([]string, len(records))
+	for i, r := range records {
+		names[i] = r.Name
+	}
+	return names
+}
+
+func TestTargetAddr(t *testing.T) {
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"", "127.0.0.1:8080"},
+		{"192.168.1.10", "192.168.1.10:8080"},
+		{"::1", "[::1]:8080"},
+		{"fe80::1%eth0", "[fe80::1%eth0]:8080"},
+	}
+	for _, tt := range tests {
+		r := &ServiceRecord{TargetHost: tt.host, Port: 8080}
+		if got := r.TargetAddr(); got != tt.want {
+			t.Errorf("TargetAddr() with host %q = %q, want %q", tt.host, got, tt.want)
+		}
+	}
+}
+
 func TestEffectiveTargetHost(t *testing.T) {
 	r := &ServiceRecord{TargetHost: ""}
 	if r.EffectiveTargetHost() != "127.0.0.1" {
@@ -390,3 +486,263 @@ func TestPersistenceRoundTrip(t *testing.T) {
 		t.Errorf("expected 3 args, got %d", len(r.Args))
 	}
 }
+
+func TestUpstreamTimeoutRoundTrip(t *testing.T) {
+	path := tempStorePath(t)
+
+	store1, _ := NewStore(path)
+	store1.Save(&ServiceRecord{ID: "slow", Name: "slow.localhost", Port: 3000, UpstreamTimeout: 90 * time.Second})
+	store1.Save(&ServiceRecord{ID: "fast", Name: "fast.localhost", Port: 3001})
+
+	store2, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore reload failed: %v", err)
+	}
+
+	slow, ok := store2.Get("slow")
+	if !ok {
+		t.Fatal("expected slow record after reload")
+	}
+	if slow.UpstreamTimeout != 90*time.Second {
+		t.Errorf("UpstreamTimeout = %v, want 90s", slow.UpstreamTimeout)
+	}
+
+	fast, _ := store2.Get("fast")
+	if fast.UpstreamTimeout != 0 {
+		t.Errorf("UpstreamTimeout = %v, want 0 (global default)", fast.UpstreamTimeout)
+	}
+}
+
+func TestUpstreamTimeoutStoredAsDuration(t *testing.T) {
+	path := tempStorePath(t)
+	store, _ := NewStore(path)
+	store.Save(&ServiceRecord{ID: "slow", Name: "slow.localhost", Port: 3000, UpstreamTimeout: 90 * time.Second})
+
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), `"upstream_timeout": "1m30s"`) {
+		t.Errorf("store file does not hold a duration string:\n%s", data)
+	}
+
+	// Earlier versions wrote nanoseconds; hand edits use duration strings
+	legacy := `[{"id":"old","name":"old.localhost","port":3000,"upstream_timeout":5000000000},
+		{"id":"edited","name":"edited.localhost","port":3001,"upstream_timeout":"2m"}]`
+	if err := os.WriteFile(path, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if r, _ := store.Get("old"); r.UpstreamTimeout != 5*time.Second {
+		t.Errorf("legacy UpstreamTimeout = %v, want 5s", r.UpstreamTimeout)
+	}
+	if r, _ := store.Get("edited"); r.UpstreamTimeout != 2*time.Minute {
+		t.Errorf("edited UpstreamTimeout = %v, want 2m", r.UpstreamTimeout)
+	}
+
+	os.WriteFile(path, []byte(`[{"id":"bad","name":"bad.localhost","upstream_timeout":"soon"}]`), 0644)
+	if err := store.Reload(); err == nil {
+		t.Error("Reload should reject an invalid upstream_timeout")
+	}
+}
+
+func TestLoadBackfillsSource(t *testing.T) {
+	path := tempStorePath(t)
+	legacy := `[
+  {"id": "abc123", "name": "app.localhost", "port": 3000, "exe_path": "/usr/bin/node"},
+  {"id": "manual-api.localhost-127.0.0.1-8080", "name": "api.localhost", "port": 8080, "exe_path": "manual"},
+  {"id": "docker-4f2a", "name": "db.localhost", "port": 5432, "exe_path": "docker:postgres"},
+  {"id": "xyz", "name": "web.localhost", "port": 4000, "exe_path": "/bin/web", "source": "compose"}
+]`
+	if err := os.WriteFile(path, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore failed: %v", err)
+	}
+
+	want := map[string]string{
+		"app.localhost": SourceDiscovered,
+		"api.localhost": SourceManual,
+		"db.localhost":  SourceDocker,
+		"web.localhost": SourceCompose, // explicit source is kept
+	}
+	for name, source := range want {
+		r, ok := store.GetByName(name)
+		if !ok {
+			t.Fatalf("record %s missing", name)
+		}
+		if r.Source != source {
+			t.Errorf("%s: source = %s, want %s", name, r.Source, source)
+		}
+	}
+}
+
+func TestListBySource(t *testing.T) {
+	store, _ := NewStore(tempStorePath(t))
+	store.Save(&ServiceRecord{ID: "d1", Name: "one.localhost", Port: 3000, Source: SourceDiscovered})
+	store.Save(&ServiceRecord{ID: "d2", Name: "two.localhost", Port: 3001, Source: SourceDiscovered})
+	store.AddManualService("manual.localhost", 8080, "")
+
+	if got := store.ListBySource(SourceDiscovered); len(got) != 2 {
+		t.Errorf("expected 2 discovered records, got %d", len(got))
+	}
+	manual := store.ListBySource(SourceManual)
+	if len(manual) != 1 || manual[0].Name != "manual.localhost" {
+		t.Errorf("expected only manual.localhost, got %v", manual)
+	}
+	if got := store.ListBySource(SourceDocker); len(got) != 0 {
+		t.Errorf("expected no docker records, got %d", len(got))
+	}
+}
+
+func TestReloadPicksUpExternalChanges(t *testing.T) {
+	path := tempStorePath(t)
+	daemon, _ := NewStore(path)
+	daemon.Save(&ServiceRecord{ID: "id1", Name: "app.localhost", Port: 3000})
+
+	cli, _ := NewStore(path)
+	cli.UpdateName("id1", "renamed.localhost")
+
+	if err := daemon.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if _, ok := daemon.GetByName("app.localhost"); ok {
+		t.Error("old name should be gone after reload")
+	}
+	if _, ok := daemon.GetByName("renamed.localhost"); !ok {
+		t.Error("new name should be present after reload")
+	}
+}
+
+func TestReloadConcurrentWithSave(t *testing.T) {
+	path := tempStorePath(t)
+	store, _ := NewStore(path)
+	store.Save(&ServiceRecord{ID: "id0", Name: "app0.localhost", Port: 3000})
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		for i := 1; i <= 50; i++ {
+			store.Save(&ServiceRecord{ID: fmt.Sprintf("id%d", i), Name: fmt.Sprintf("app%d.localhost", i), Port: 3000 + i})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			if err := store.Reload(); err != nil {
+				t.Errorf("Reload failed: %v", err)
+				return
+			}
+			store.List()
+			store.GetByName("app0.localhost")
+		}
+	}()
+	go func() {
+		// Another process reading the file must never see a partial write
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Errorf("ReadFile failed: %v", err)
+				return
+			}
+			var records []*ServiceRecord
+			if err := json.Unmarshal(data, &records); err != nil {
+				t.Errorf("store file is not valid JSON: %v", err)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+
+	if err := store.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if got := len(store.List()); got != 51 {
+		t.Errorf("got %d records after the saves, want 51", got)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	for _, e := range entries {
+		if filepath.Ext(e.Name()) == ".tmp" {
+			t.Errorf("temp file %s left behind", e.Name())
+		}
+	}
+}
+
+func TestSetReadOnly(t *testing.T) {
+	path := tempStorePath(t)
+	store, _ := NewStore(path)
+	store.Save(&ServiceRecord{ID: "id1", Name: "app.localhost", Port: 3000})
+	before, _ := os.ReadFile(path)
+
+	store.SetReadOnly(true)
+	if err := store.Save(&ServiceRecord{ID: "id2", Name: "api.localhost", Port: 3001}); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Save = %v, want ErrReadOnly", err)
+	}
+	if err := store.Remove("id1"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Remove = %v, want ErrReadOnly", err)
+	}
+	if after, _ := os.ReadFile(path); string(after) != string(before) {
+		t.Errorf("file changed while read-only:\n%s", after)
+	}
+
+	store.SetReadOnly(false)
+	if err := store.UpdateKeep("id2", true); err != nil {
+		t.Fatalf("UpdateKeep: %v", err)
+	}
+	reloaded, _ := NewStore(path)
+	if _, ok := reloaded.Get("id2"); !ok {
+		t.Error("changes kept in memory should be written once writable again")
+	}
+}
+
+func TestColorIconRoundTrip(t *testing.T) {
+	path := tempStorePath(t)
+
+	store1, _ := NewStore(path)
+	store1.Save(&ServiceRecord{ID: "id1", Name: "app.localhost", Port: 3000, Color: "#ff0000", Icon: "🚀"})
+	store1.Save(&ServiceRecord{ID: "id2", Name: "plain.localhost", Port: 3001})
+
+	store2, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore reload failed: %v", err)
+	}
+
+	app, _ := store2.Get("id1")
+	if app.Color != "#ff0000" || app.Icon != "🚀" {
+		t.Errorf("Color, Icon = %q, %q, want #ff0000, 🚀", app.Color, app.Icon)
+	}
+	plain, _ := store2.Get("id2")
+	if plain.Color != "" || plain.Icon != "" {
+		t.Errorf("Color, Icon = %q, %q, want empty", plain.Color, plain.Icon)
+	}
+}
+
+func TestValidateColor(t *testing.T) {
+	for _, c := range []string{"#f00", "#FF0000", "#1a2b3c"} {
+		if err := ValidateColor(c); err != nil {
+			t.Errorf("ValidateColor(%q) = %v, want nil", c, err)
+		}
+	}
+	for _, c := range []string{"", "red", "ff0000", "#ff00", "#gggggg", "#ff0000;background:url(x)"} {
+		if err := ValidateColor(c); err == nil {
+			t.Errorf("ValidateColor(%q) = nil, want error", c)
+		}
+	}
+}
+
+func TestValidateIcon(t *testing.T) {
+	for _, icon := range []string{"🚀", "⚙️", "👩‍💻", "🇫🇷", "DB"} {
+		if err := ValidateIcon(icon); err != nil {
+			t.Errorf("ValidateIcon(%q) = %v, want nil", icon, err)
+		}
+	}
+	for _, icon := range []string{"", "a b", "tab\t", "much-too-long-icon", "\x00"} {
+		if err := ValidateIcon(icon); err == nil {
+			t.Errorf("ValidateIcon(%q) = nil, want error", icon)
+		}
+	}
+}
@@ -2,8 +2,16 @@
 
 package system
 
+import "errors"
+
 // NewServiceManager returns a platform-appropriate ServiceManager.
 // On macOS, this returns a LaunchdManager.
 func NewServiceManager() ServiceManager {
 	return &LaunchdManager{}
 }
+
+// NewUserServiceManager returns a ServiceManager for a rootless, per-user
+// daemon. This is not supported on macOS yet.
+func NewUserServiceManager() (ServiceManager, error) {
+	return nil, errors.New("per-user services are only supported with systemd")
+}
@@ -7,3 +7,9 @@ package system
 func NewServiceManager() ServiceManager {
 	return &SystemdManager{}
 }
+
+// NewUserServiceManager returns a ServiceManager for a rootless, per-user
+// daemon. On Linux, this is a SystemdManager driving `systemctl --user`.
+func NewUserServiceManager() (ServiceManager, error) {
+	return &SystemdManager{User: true}, nil
+}
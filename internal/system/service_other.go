@@ -0,0 +1,46 @@
+//go:build !darwin && !linux
+
+package system
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// NewServiceManager returns a platform-appropriate ServiceManager. On
+// platforms without launchd or systemd support every operation fails.
+func NewServiceManager() ServiceManager {
+	return &unsupportedManager{}
+}
+
+// NewUserServiceManager returns a ServiceManager for a rootless, per-user
+// daemon. This is not supported on this platform.
+func NewUserServiceManager() (ServiceManager, error) {
+	return nil, errUnsupported()
+}
+
+type unsupportedManager struct{}
+
+func errUnsupported() error {
+	return fmt.Errorf("system services are not supported on %s/%s", runtime.GOOS, runtime.GOARCH)
+}
+
+func (m *unsupportedManager) Install(daemonPath string) error {
+	return errUnsupported()
+}
+
+func (m *unsupportedManager) Uninstall() error {
+	return errUnsupported()
+}
+
+func (m *unsupportedManager) Status() (ServiceStatus, error) {
+	return ServiceStatus{}, errUnsupported()
+}
+
+func (m *unsupportedManager) Start() error {
+	return errUnsupported()
+}
+
+func (m *unsupportedManager) Stop() error {
+	return errUnsupported()
+}
@@ -16,13 +16,37 @@ const (
 )
 
 // SystemdManager manages the nameport daemon as a Linux systemd service.
-type SystemdManager struct{}
+// With User set it manages a rootless `systemctl --user` unit instead.
+type SystemdManager struct {
+	User bool
+}
 
 // UnitPath returns the full path to the systemd unit file.
 func (m *SystemdManager) UnitPath() string {
+	if m.User {
+		return filepath.Join(userUnitDir(), systemdUnitName)
+	}
 	return filepath.Join(systemdUnitDir, systemdUnitName)
 }
 
+// userUnitDir returns the systemd user unit directory,
+// $XDG_CONFIG_HOME/systemd/user or ~/.config/systemd/user.
+func userUnitDir() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "systemd", "user")
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".config", "systemd", "user")
+}
+
+// systemctl returns a systemctl command for the system or user manager.
+func (m *SystemdManager) systemctl(args ...string) *exec.Cmd {
+	if m.User {
+		args = append([]string{"--user"}, args...)
+	}
+	return exec.Command("systemctl", args...)
+}
+
 // GenerateUnit generates the systemd unit file content for the given daemon binary path.
 func GenerateUnit(daemonPath string) string {
 	return fmt.Sprintf(`[Unit]
@@ -40,6 +64,25 @@ WantedBy=multi-user.target
 `, daemonPath)
 }
 
+// GenerateUserUnit generates a unit for the systemd user manager. The
+// daemon runs in high-port mode since it has no root privileges, and the
+// unit starts with the user's session.
+func GenerateUserUnit(daemonPath string) string {
+	return fmt.Sprintf(`[Unit]
+Description=nameport daemon (user)
+After=network.target
+
+[Service]
+Type=simple
+ExecStart=%s --high-port
+Restart=always
+RestartSec=5
+
+[Install]
+WantedBy=default.target
+`, daemonPath)
+}
+
 // Install writes the unit file and enables the service.
 func (m *SystemdManager) Install(daemonPath string) error {
 	absPath, err := filepath.Abs(daemonPath)
@@ -48,20 +91,26 @@ func (m *SystemdManager) Install(daemonPath string) error {
 	}
 
 	unit := GenerateUnit(absPath)
+	if m.User {
+		unit = GenerateUserUnit(absPath)
+	}
 	unitPath := m.UnitPath()
 
+	if err := os.MkdirAll(filepath.Dir(unitPath), 0755); err != nil {
+		return fmt.Errorf("creating unit directory: %w", err)
+	}
 	if err := os.WriteFile(unitPath, []byte(unit), 0644); err != nil {
 		return fmt.Errorf("writing unit file to %s: %w", unitPath, err)
 	}
 
 	// Reload systemd to pick up the new unit
-	cmd := exec.Command("systemctl", "daemon-reload")
+	cmd := m.systemctl("daemon-reload")
 	if out, err := cmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("systemctl daemon-reload: %s: %w", string(out), err)
 	}
 
 	// Enable the service
-	cmd = exec.Command("systemctl", "enable", systemdUnitName)
+	cmd = m.systemctl("enable", systemdUnitName)
 	if out, err := cmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("systemctl enable: %s: %w", string(out), err)
 	}
@@ -75,7 +124,7 @@ func (m *SystemdManager) Uninstall() error {
 	_ = m.Stop()
 
 	// Disable the service
-	cmd := exec.Command("systemctl", "disable", systemdUnitName)
+	cmd := m.systemctl("disable", systemdUnitName)
 	if out, err := cmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("systemctl disable: %s: %w", string(out), err)
 	}
@@ -87,7 +136,7 @@ func (m *SystemdManager) Uninstall() error {
 	}
 
 	// Reload systemd
-	cmd = exec.Command("systemctl", "daemon-reload")
+	cmd = m.systemctl("daemon-reload")
 	if out, err := cmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("systemctl daemon-reload: %s: %w", string(out), err)
 	}
@@ -107,14 +156,14 @@ func (m *SystemdManager) Status() (ServiceStatus, error) {
 	}
 
 	// Check if service is active
-	cmd := exec.Command("systemctl", "is-active", systemdUnitName)
+	cmd := m.systemctl("is-active", systemdUnitName)
 	out, err := cmd.Output()
 	if err == nil && strings.TrimSpace(string(out)) == "active" {
 		status.Running = true
 	}
 
 	// Get main PID
-	cmd = exec.Command("systemctl", "show", "-p", "MainPID", systemdUnitName)
+	cmd = m.systemctl("show", "-p", "MainPID", systemdUnitName)
 	out, err = cmd.Output()
 	if err == nil {
 		line := strings.TrimSpace(string(out))
@@ -129,7 +178,7 @@ func (m *SystemdManager) Status() (ServiceStatus, error) {
 
 // Start starts the service via systemctl.
 func (m *SystemdManager) Start() error {
-	cmd := exec.Command("systemctl", "start", systemdUnitName)
+	cmd := m.systemctl("start", systemdUnitName)
 	if out, err := cmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("systemctl start: %s: %w", string(out), err)
 	}
@@ -138,7 +187,7 @@ func (m *SystemdManager) Start() error {
 
 // Stop stops the service via systemctl.
 func (m *SystemdManager) Stop() error {
-	cmd := exec.Command("systemctl", "stop", systemdUnitName)
+	cmd := m.systemctl("stop", systemdUnitName)
 	if out, err := cmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("systemctl stop: %s: %w", string(out), err)
 	}
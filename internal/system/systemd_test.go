@@ -3,6 +3,7 @@
 package system
 
 import (
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -74,3 +75,44 @@ func TestNewServiceManagerReturnSystemd(t *testing.T) {
 		t.Error("NewServiceManager() on linux should return *SystemdManager")
 	}
 }
+
+func TestGenerateUserUnit(t *testing.T) {
+	daemonPath := "/home/dev/go/bin/nameport-daemon"
+	unit := GenerateUserUnit(daemonPath)
+
+	if !strings.Contains(unit, "ExecStart="+daemonPath+" --high-port") {
+		t.Errorf("user unit should run the daemon in high-port mode:\n%s", unit)
+	}
+	if !strings.Contains(unit, "WantedBy=default.target") {
+		t.Error("user unit should contain WantedBy=default.target")
+	}
+	if strings.Contains(unit, "multi-user.target") {
+		t.Error("user unit should not reference multi-user.target")
+	}
+}
+
+func TestSystemdManagerUserUnitPath(t *testing.T) {
+	m := &SystemdManager{User: true}
+
+	t.Setenv("XDG_CONFIG_HOME", "/tmp/xdg")
+	if got, want := m.UnitPath(), "/tmp/xdg/systemd/user/nameport.service"; got != want {
+		t.Errorf("UnitPath() = %q, want %q", got, want)
+	}
+
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("HOME", "/home/dev")
+	if got, want := m.UnitPath(), filepath.Join("/home/dev", ".config", "systemd", "user", "nameport.service"); got != want {
+		t.Errorf("UnitPath() = %q, want %q", got, want)
+	}
+}
+
+func TestSystemdManagerSystemctlUser(t *testing.T) {
+	user := (&SystemdManager{User: true}).systemctl("start", systemdUnitName)
+	if got := strings.Join(user.Args, " "); got != "systemctl --user start nameport.service" {
+		t.Errorf("user command = %q", got)
+	}
+	system := (&SystemdManager{}).systemctl("start", systemdUnitName)
+	if got := strings.Join(system.Args, " "); got != "systemctl start nameport.service" {
+		t.Errorf("system command = %q", got)
+	}
+}
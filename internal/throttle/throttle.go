@@ -0,0 +1,165 @@
+// Package throttle provides a bandwidth-limited http.ResponseWriter used to
+// simulate slow network links for individual proxied services.
+package throttle
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Writer wraps an http.ResponseWriter and caps the rate at which the response
+// body is written. Data is written in small chunks and flushed after each one
+// so that streaming responses still reach the client progressively.
+type Writer struct {
+	http.ResponseWriter
+	ctx         context.Context
+	bytesPerSec int64
+	chunkSize   int
+	start       time.Time
+	written     int64
+}
+
+// NewWriter returns a Writer limiting w to bytesPerSec. The context is used to
+// abort pacing delays when the client goes away.
+func NewWriter(ctx context.Context, w http.ResponseWriter, bytesPerSec int64) *Writer {
+	// Write roughly ten chunks per second so pacing stays smooth.
+	chunk := int(bytesPerSec / 10)
+	if chunk < 1 {
+		chunk = 1
+	}
+	return &Writer{
+		ResponseWriter: w,
+		ctx:            ctx,
+		bytesPerSec:    bytesPerSec,
+		chunkSize:      chunk,
+	}
+}
+
+// Write writes p to the underlying writer, sleeping between chunks so that the
+// overall throughput does not exceed the configured rate.
+func (tw *Writer) Write(p []byte) (int, error) {
+	if tw.start.IsZero() {
+		tw.start = time.Now()
+	}
+
+	total := 0
+	for len(p) > 0 {
+		n := len(p)
+		if n > tw.chunkSize {
+			n = tw.chunkSize
+		}
+		written, err := tw.ResponseWriter.Write(p[:n])
+		total += written
+		tw.written += int64(written)
+		if err != nil {
+			return total, err
+		}
+		p = p[n:]
+
+		tw.Flush()
+		if err := tw.wait(); err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// wait sleeps until the elapsed time matches the number of bytes written at
+// the configured rate.
+func (tw *Writer) wait() error {
+	expected := time.Duration(float64(tw.written) / float64(tw.bytesPerSec) * float64(time.Second))
+	delay := expected - time.Since(tw.start)
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-tw.ctx.Done():
+		return tw.ctx.Err()
+	}
+}
+
+// Flush sends any buffered data to the client if the underlying writer
+// supports it.
+func (tw *Writer) Flush() {
+	if f, ok := tw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying ResponseWriter so http.ResponseController can
+// reach optional interfaces (e.g. Hijacker for WebSocket upgrades).
+func (tw *Writer) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
+
+// maxRate bounds the rates ParseRate accepts, in bytes per second, so the
+// value in bits per second still fits an int64.
+const maxRate = math.MaxInt64 / 8
+
+// ParseRate parses a bandwidth string such as "256kbps", "1.5mbps" or
+// "8000bps" (bits per second) and returns the equivalent bytes per second.
+// "off", "none" and "0" return 0, meaning unlimited.
+func ParseRate(s string) (int64, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch s {
+	case "off", "none", "0", "":
+		return 0, nil
+	}
+
+	units := []struct {
+		suffix string
+		bits   float64
+	}{
+		{"gbps", 1e9},
+		{"mbps", 1e6},
+		{"kbps", 1e3},
+		{"bps", 1},
+	}
+
+	for _, u := range units {
+		if !strings.HasSuffix(s, u.suffix) {
+			continue
+		}
+		value, err := strconv.ParseFloat(strings.TrimSuffix(s, u.suffix), 64)
+		if err != nil || math.IsNaN(value) || math.IsInf(value, 0) || value <= 0 {
+			return 0, fmt.Errorf("invalid rate: %s", s)
+		}
+		bytes := value * u.bits / 8
+		if bytes >= maxRate {
+			return 0, fmt.Errorf("rate too high: %s", s)
+		}
+		bytesPerSec := int64(bytes)
+		if bytesPerSec < 1 {
+			return 0, fmt.Errorf("rate too low: %s", s)
+		}
+		return bytesPerSec, nil
+	}
+
+	return 0, fmt.Errorf("invalid rate %q (expected e.g. 256kbps, 1mbps)", s)
+}
+
+// FormatRate renders a bytes-per-second value in the same units ParseRate
+// accepts.
+func FormatRate(bytesPerSec int64) string {
+	bits := float64(bytesPerSec * 8)
+	switch {
+	case bits >= 1e9:
+		return strconv.FormatFloat(bits/1e9, 'f', -1, 64) + "gbps"
+	case bits >= 1e6:
+		return strconv.FormatFloat(bits/1e6, 'f', -1, 64) + "mbps"
+	case bits >= 1e3:
+		return strconv.FormatFloat(bits/1e3, 'f', -1, 64) + "kbps"
+	default:
+		return strconv.FormatFloat(bits, 'f', -1, 64) + "bps"
+	}
+}
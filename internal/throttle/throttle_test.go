@@ -0,0 +1,130 @@
+package throttle
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWriter_MinimumDuration(t *testing.T) {
+	const rate = 32000 // bytes per second
+	body := bytes.Repeat([]byte("x"), 16000)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tw := NewWriter(r.Context(), w, rate)
+		tw.Write(body)
+	}))
+	defer server.Close()
+
+	start := time.Now()
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	elapsed := time.Since(start)
+
+	if err != nil {
+		t.Fatalf("reading body: %v", err)
+	}
+	if len(data) != len(body) {
+		t.Fatalf("body length = %d, want %d", len(data), len(body))
+	}
+
+	minimum := time.Duration(float64(len(body)) / rate * float64(time.Second))
+	if elapsed < minimum {
+		t.Errorf("throttled response took %v, want at least %v", elapsed, minimum)
+	}
+}
+
+func TestWriter_Streams(t *testing.T) {
+	firstChunk := make(chan struct{})
+	release := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tw := NewWriter(r.Context(), w, 1000000)
+		tw.Write([]byte("first\n"))
+		close(firstChunk)
+		<-release
+		tw.Write([]byte("second\n"))
+	}))
+	defer server.Close()
+	defer close(release)
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	<-firstChunk
+	buf := make([]byte, 6)
+	if _, err := io.ReadFull(resp.Body, buf); err != nil {
+		t.Fatalf("reading first chunk: %v", err)
+	}
+	if string(buf) != "first\n" {
+		t.Errorf("first chunk = %q, want %q", buf, "first\n")
+	}
+}
+
+func TestWriter_Unwrap(t *testing.T) {
+	rec := httptest.NewRecorder()
+	tw := NewWriter(context.Background(), rec, 1000)
+	if tw.Unwrap() != rec {
+		t.Error("Unwrap should return the underlying ResponseWriter")
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		input string
+		want  int64
+	}{
+		{"256kbps", 32000},
+		{"1mbps", 125000},
+		{"1.5Mbps", 187500},
+		{"8000bps", 1000},
+		{"1gbps", 125000000},
+		{"off", 0},
+		{"0", 0},
+	}
+	for _, tc := range tests {
+		got, err := ParseRate(tc.input)
+		if err != nil {
+			t.Errorf("ParseRate(%q) error: %v", tc.input, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("ParseRate(%q) = %d, want %d", tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestParseRate_Invalid(t *testing.T) {
+	for _, input := range []string{"fast", "-1kbps", "kbps", "4bps", "100", "infkbps", "+Infmbps", "nanbps", "1e300gbps", "9.3e18bps"} {
+		if _, err := ParseRate(input); err == nil {
+			t.Errorf("ParseRate(%q) should fail", input)
+		}
+	}
+}
+
+func TestFormatRate(t *testing.T) {
+	tests := []struct {
+		bytesPerSec int64
+		want        string
+	}{
+		{32000, "256kbps"},
+		{125000, "1mbps"},
+		{100, "800bps"},
+	}
+	for _, tc := range tests {
+		if got := FormatRate(tc.bytesPerSec); got != tc.want {
+			t.Errorf("FormatRate(%d) = %q, want %q", tc.bytesPerSec, got, tc.want)
+		}
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"encoding/pem"
 	"errors"
 	"fmt"
+	"io/fs"
 	"math/big"
 	"os"
 	"path/filepath"
@@ -35,7 +36,7 @@ func NewCA(storePath string) (*CA, error) {
 	ca := &CA{StorePath: storePath}
 
 	if err := os.MkdirAll(storePath, 0700); err != nil {
-		return nil, fmt.Errorf("ca: create store dir: %w", err)
+		return nil, classifyStoreErr("create", storePath, err, "create store dir")
 	}
 
 	rootCertPath := filepath.Join(storePath, "root_ca.pem")
@@ -49,6 +50,16 @@ func NewCA(storePath string) (*CA, error) {
 	interCertPEM, errIC := os.ReadFile(interCertPath)
 	interKeyPEM, errIK := os.ReadFile(interKeyPath)
 
+	// Existing but unreadable material must not be mistaken for an empty store.
+	for _, f := range []struct {
+		path string
+		err  error
+	}{{rootCertPath, errRC}, {rootKeyPath, errRK}, {interCertPath, errIC}, {interKeyPath, errIK}} {
+		if f.err != nil && errors.Is(f.err, fs.ErrPermission) {
+			return nil, classifyStoreErr("read", f.path, f.err, "read store")
+		}
+	}
+
 	if errRC != nil || errRK != nil || errIC != nil || errIK != nil {
 		// Not all files present – return uninitialised.
 		return ca, nil
@@ -332,7 +343,7 @@ func writeFileAtomic(path string, data []byte, mode os.FileMode) error {
 	dir := filepath.Dir(path)
 	tmp, err := os.CreateTemp(dir, ".tmp-*")
 	if err != nil {
-		return fmt.Errorf("ca: create temp file: %w", err)
+		return classifyStoreErr("write", path, err, "create temp file")
 	}
 	tmpName := tmp.Name()
 
@@ -351,7 +362,7 @@ func writeFileAtomic(path string, data []byte, mode os.FileMode) error {
 	}
 	if err := os.Rename(tmpName, path); err != nil {
 		os.Remove(tmpName)
-		return fmt.Errorf("ca: rename temp file: %w", err)
+		return classifyStoreErr("write", path, err, "rename temp file")
 	}
 	return nil
 }
@@ -0,0 +1,73 @@
+package ca
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"syscall"
+)
+
+// StoreError reports that the CA store could not be read or written because
+// of missing permissions or a read-only filesystem.
+type StoreError struct {
+	Op       string // "create", "read" or "write"
+	Path     string // file or directory that could not be accessed
+	ReadOnly bool   // the filesystem is mounted read-only
+	Err      error
+}
+
+func (e *StoreError) Error() string {
+	reason := "permission denied"
+	if e.ReadOnly {
+		reason = "read-only filesystem"
+	}
+	return fmt.Sprintf("ca: cannot %s %s: %s", e.Op, e.Path, reason)
+}
+
+func (e *StoreError) Unwrap() error {
+	return e.Err
+}
+
+// Remediation returns a human-readable hint describing how to fix the problem.
+func (e *StoreError) Remediation() string {
+	dir := e.Path
+	if e.Op != "create" {
+		dir = filepath.Dir(e.Path)
+	}
+	if e.ReadOnly {
+		return fmt.Sprintf("%s is on a read-only mount; remount it read-write or point the CA store at a writable location", dir)
+	}
+	switch e.Op {
+	case "read":
+		return fmt.Sprintf("the current user needs read permission on %s (it may have been created by root; try 'sudo chown -R $USER %s')", e.Path, dir)
+	default:
+		return fmt.Sprintf("the current user needs write permission on %s (try 'sudo chown -R $USER %s' or run with sudo)", dir, dir)
+	}
+}
+
+// IsStoreError reports whether err is (or wraps) a *StoreError.
+func IsStoreError(err error) bool {
+	var se *StoreError
+	return errors.As(err, &se)
+}
+
+// Remediation returns the remediation hint for err if it is a *StoreError,
+// or an empty string otherwise.
+func Remediation(err error) string {
+	var se *StoreError
+	if errors.As(err, &se) {
+		return se.Remediation()
+	}
+	return ""
+}
+
+// classifyStoreErr converts permission and read-only failures into a
+// *StoreError and wraps anything else with the given context message.
+func classifyStoreErr(op, path string, err error, context string) error {
+	readOnly := errors.Is(err, syscall.EROFS)
+	if readOnly || errors.Is(err, fs.ErrPermission) {
+		return &StoreError{Op: op, Path: path, ReadOnly: readOnly, Err: err}
+	}
+	return fmt.Errorf("ca: %s: %w", context, err)
+}
@@ -0,0 +1,105 @@
+package ca
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestClassifyStoreErr(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		wantKind bool
+		readOnly bool
+	}{
+		{"permission", &fs.PathError{Op: "open", Path: "/x", Err: syscall.EACCES}, true, false},
+		{"read-only", &fs.PathError{Op: "open", Path: "/x", Err: syscall.EROFS}, true, true},
+		{"other", &fs.PathError{Op: "open", Path: "/x", Err: syscall.ENOSPC}, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := classifyStoreErr("write", "/x/root_ca.pem", tt.err, "create temp file")
+			var se *StoreError
+			if got := errors.As(err, &se); got != tt.wantKind {
+				t.Fatalf("StoreError = %v, want %v (err: %v)", got, tt.wantKind, err)
+			}
+			if !errors.Is(err, tt.err.(*fs.PathError).Err) {
+				t.Errorf("classified error should wrap the original: %v", err)
+			}
+			if se != nil && se.ReadOnly != tt.readOnly {
+				t.Errorf("ReadOnly = %v, want %v", se.ReadOnly, tt.readOnly)
+			}
+		})
+	}
+}
+
+func TestStoreError_Remediation(t *testing.T) {
+	se := &StoreError{Op: "write", Path: "/home/u/.localtls/root_ca.pem", Err: fs.ErrPermission}
+	hint := se.Remediation()
+	if !strings.Contains(hint, "/home/u/.localtls") || !strings.Contains(hint, "write permission") {
+		t.Errorf("unexpected hint: %q", hint)
+	}
+
+	ro := &StoreError{Op: "create", Path: "/mnt/ro/.localtls", ReadOnly: true, Err: syscall.EROFS}
+	if hint := ro.Remediation(); !strings.Contains(hint, "read-only") {
+		t.Errorf("read-only hint should mention the mount: %q", hint)
+	}
+
+	if Remediation(errors.New("boom")) != "" {
+		t.Error("Remediation of an unrelated error should be empty")
+	}
+}
+
+func TestInit_ReadOnlyStore(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("permission checks are bypassed when running as root")
+	}
+
+	dir := filepath.Join(t.TempDir(), "store")
+	c, err := NewCA(dir)
+	if err != nil {
+		t.Fatalf("NewCA: %v", err)
+	}
+	if err := os.Chmod(dir, 0500); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(dir, 0700) })
+
+	err = c.Init()
+	if err == nil {
+		t.Fatal("expected Init to fail on a read-only store")
+	}
+	var se *StoreError
+	if !errors.As(err, &se) {
+		t.Fatalf("expected *StoreError, got %T: %v", err, err)
+	}
+	if se.Op != "write" || !strings.HasPrefix(se.Path, dir) {
+		t.Errorf("StoreError = %+v, want write under %s", se, dir)
+	}
+	if !strings.Contains(se.Remediation(), dir) {
+		t.Errorf("hint should name the store directory: %q", se.Remediation())
+	}
+}
+
+func TestNewCA_UncreatableStore(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("permission checks are bypassed when running as root")
+	}
+
+	parent := t.TempDir()
+	if err := os.Chmod(parent, 0500); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(parent, 0700) })
+
+	_, err := NewCA(filepath.Join(parent, "store"))
+	if !IsStoreError(err) {
+		t.Fatalf("expected a StoreError, got %v", err)
+	}
+}
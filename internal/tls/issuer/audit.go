@@ -0,0 +1,119 @@
+package issuer
+
+import (
+	"bufio"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// AuditFileName is the issuance audit log, kept in the CA store directory.
+const AuditFileName = "certs-audit.jsonl"
+
+// DefaultAuditMaxBytes is the size at which the audit log is rotated. The
+// previous log is kept as AuditFileName + ".1".
+const DefaultAuditMaxBytes = 1 << 20
+
+// AuditEntry records one issued leaf certificate.
+type AuditEntry struct {
+	Time      time.Time `json:"time"`
+	Serial    string    `json:"serial"` // Hex-encoded serial number
+	DNSNames  []string  `json:"dns_names,omitempty"`
+	IPs       []string  `json:"ips,omitempty"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+	Lifetime  string    `json:"lifetime"` // NotAfter - NotBefore, e.g. "24h0m0s"
+}
+
+// newAuditEntry describes a freshly issued leaf certificate.
+func newAuditEntry(leaf *x509.Certificate) AuditEntry {
+	entry := AuditEntry{
+		Time:      time.Now().UTC(),
+		Serial:    fmt.Sprintf("%x", leaf.SerialNumber),
+		DNSNames:  leaf.DNSNames,
+		NotBefore: leaf.NotBefore.UTC(),
+		NotAfter:  leaf.NotAfter.UTC(),
+		Lifetime:  leaf.NotAfter.Sub(leaf.NotBefore).String(),
+	}
+	for _, ip := range leaf.IPAddresses {
+		entry.IPs = append(entry.IPs, ip.String())
+	}
+	return entry
+}
+
+// AuditLog is an append-only JSON Lines log of issued certificates, rotated
+// once it grows past MaxBytes.
+type AuditLog struct {
+	Path     string
+	MaxBytes int64 // default: DefaultAuditMaxBytes
+
+	mu sync.Mutex
+}
+
+// NewAuditLog returns an AuditLog writing to path.
+func NewAuditLog(path string) *AuditLog {
+	return &AuditLog{Path: path, MaxBytes: DefaultAuditMaxBytes}
+}
+
+// Append writes entry as one line, first rotating the log if the line would
+// take it past MaxBytes.
+func (a *AuditLog) Append(entry AuditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if info, err := os.Stat(a.Path); err == nil && a.MaxBytes > 0 && info.Size()+int64(len(line)) > a.MaxBytes {
+		if err := os.Rename(a.Path, a.Path+".1"); err != nil {
+			return fmt.Errorf("issuer: rotate audit log: %w", err)
+		}
+	}
+
+	f, err := os.OpenFile(a.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("issuer: open audit log: %w", err)
+	}
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return fmt.Errorf("issuer: write audit log: %w", err)
+	}
+	return f.Close()
+}
+
+// ReadAudit returns the entries in the audit log at path, oldest first,
+// including the rotated previous log. Malformed lines are skipped. A missing
+// log yields no entries.
+func ReadAudit(path string) ([]AuditEntry, error) {
+	var entries []AuditEntry
+	for _, p := range []string{path + ".1", path} {
+		f, err := os.Open(p)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var e AuditEntry
+			if json.Unmarshal(scanner.Bytes(), &e) == nil {
+				entries = append(entries, e)
+			}
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("issuer: read audit log: %w", err)
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,125 @@
+package issuer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"nameport/internal/tls/policy"
+)
+
+func TestIssue_AppendsAuditEntry(t *testing.T) {
+	c := newTestCA(t)
+	iss := NewIssuer(c, policy.NewPolicy())
+	auditPath := filepath.Join(c.StorePath, AuditFileName)
+	iss.SetAuditLog(NewAuditLog(auditPath))
+
+	cc, err := iss.Issue(IssueRequest{
+		DNSNames: []string{"audit.localhost"},
+		IPs:      []net.IP{net.IPv4(127, 0, 0, 1)},
+		ValidFor: 2 * time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	// Each line is a standalone JSON object
+	data, err := os.ReadFile(auditPath)
+	if err != nil {
+		t.Fatalf("read audit log: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected 1 audit line, got %d", len(lines))
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &raw); err != nil {
+		t.Fatalf("audit line is not JSON: %v", err)
+	}
+	for _, key := range []string{"time", "serial", "dns_names", "ips", "not_before", "not_after", "lifetime"} {
+		if _, ok := raw[key]; !ok {
+			t.Errorf("audit entry missing %q: %s", key, lines[0])
+		}
+	}
+
+	entries, err := ReadAudit(auditPath)
+	if err != nil {
+		t.Fatalf("ReadAudit: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(entries))
+	}
+	e := entries[0]
+	if want := fmt.Sprintf("%x", cc.Cert.Leaf.SerialNumber); e.Serial != want {
+		t.Errorf("Serial = %q, want %q", e.Serial, want)
+	}
+	if len(e.DNSNames) != 1 || e.DNSNames[0] != "audit.localhost" {
+		t.Errorf("DNSNames = %v", e.DNSNames)
+	}
+	if len(e.IPs) != 1 || e.IPs[0] != "127.0.0.1" {
+		t.Errorf("IPs = %v", e.IPs)
+	}
+	if e.Lifetime != (2 * time.Hour).String() {
+		t.Errorf("Lifetime = %q, want %q", e.Lifetime, (2 * time.Hour).String())
+	}
+}
+
+func TestIssue_NoAuditByDefault(t *testing.T) {
+	c := newTestCA(t)
+	iss := NewIssuer(c, policy.NewPolicy())
+
+	if _, err := iss.Issue(IssueRequest{DNSNames: []string{"quiet.localhost"}}); err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(c.StorePath, AuditFileName)); !os.IsNotExist(err) {
+		t.Errorf("audit log written without SetAuditLog (stat err = %v)", err)
+	}
+}
+
+func TestAuditLog_Rotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), AuditFileName)
+	a := NewAuditLog(path)
+	a.MaxBytes = 400
+
+	for i := 0; i < 10; i++ {
+		if err := a.Append(AuditEntry{Serial: fmt.Sprintf("%02x", i), DNSNames: []string{"rotate.localhost"}}); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+
+	if _, err := os.Stat(path + ".1"); err != nil {
+		t.Fatalf("expected rotated log: %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() > a.MaxBytes {
+		t.Errorf("current log not bounded: %v, %v", info, err)
+	}
+
+	// Reading covers the rotated file first, and the newest entry is last
+	entries, err := ReadAudit(path)
+	if err != nil {
+		t.Fatalf("ReadAudit: %v", err)
+	}
+	if len(entries) == 0 || entries[len(entries)-1].Serial != "09" {
+		t.Errorf("last entry = %+v, want serial 09", entries)
+	}
+	for i := 1; i < len(entries); i++ {
+		if entries[i].Serial <= entries[i-1].Serial {
+			t.Errorf("entries out of order: %s before %s", entries[i-1].Serial, entries[i].Serial)
+		}
+	}
+}
+
+func TestReadAudit_Missing(t *testing.T) {
+	entries, err := ReadAudit(filepath.Join(t.TempDir(), AuditFileName))
+	if err != nil {
+		t.Fatalf("ReadAudit: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected no entries, got %d", len(entries))
+	}
+}
@@ -3,6 +3,7 @@
 package issuer
 
 import (
+	"context"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
@@ -12,7 +13,9 @@ import (
 	"encoding/pem"
 	"errors"
 	"fmt"
+	"log"
 	"net"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -24,9 +27,13 @@ import (
 // DefaultValidFor is the default leaf certificate lifetime.
 const DefaultValidFor = 24 * time.Hour
 
-// renewBefore is how far before expiry a cached certificate is considered
-// stale and will be reissued.
-const renewBefore = 1 * time.Hour
+// DefaultRenewBefore is how far before expiry a cached certificate is
+// considered stale and will be reissued, unless a proportional window is set.
+const DefaultRenewBefore = 1 * time.Hour
+
+// DefaultRenewInterval is how often RunRenewer looks for cached certificates
+// that are due for renewal.
+const DefaultRenewInterval = 10 * time.Minute
 
 // IssueRequest describes a leaf certificate to create.
 type IssueRequest struct {
@@ -44,25 +51,82 @@ type CachedCert struct {
 }
 
 // Issuer creates and caches leaf certificates signed by the local CA.
+// Certificates are cached by their SAN set and served for any name they
+// cover.
 type Issuer struct {
-	ca     *ca.CA
-	policy *policy.Policy
-	cache  map[string]*CachedCert
-	mu     sync.RWMutex
+	ca      *ca.CA
+	policy  *policy.Policy
+	cache   map[string]*CachedCert // key = sanKey
+	certDir string                 // optional on-disk copy of the cache
+	mu      sync.RWMutex
+	caMu    sync.RWMutex // guards use of the CA's intermediate against Rotate
+	audit   *AuditLog    // optional record of issued certificates
+
+	renewBefore   time.Duration // fixed renewal window
+	renewFraction float64       // if > 0, renew when this share of the lifetime remains
+	now           func() time.Time
 }
 
 // NewIssuer returns an Issuer backed by the given CA and domain policy.
 func NewIssuer(c *ca.CA, p *policy.Policy) *Issuer {
 	return &Issuer{
-		ca:     c,
-		policy: p,
-		cache:  make(map[string]*CachedCert),
+		ca:          c,
+		policy:      p,
+		cache:       make(map[string]*CachedCert),
+		renewBefore: DefaultRenewBefore,
+		now:         time.Now,
+	}
+}
+
+// SetRenewBefore makes GetCertificate reissue certificates that expire
+// within d, replacing any proportional window.
+func (i *Issuer) SetRenewBefore(d time.Duration) {
+	i.renewBefore = d
+	i.renewFraction = 0
+}
+
+// SetRenewFraction makes GetCertificate reissue certificates once less than
+// fraction (0 < fraction < 1) of their lifetime remains, so short-lived and
+// long-lived certificates both renew in proportion to how long they last.
+func (i *Issuer) SetRenewFraction(fraction float64) error {
+	if fraction <= 0 || fraction >= 1 {
+		return fmt.Errorf("issuer: renewal fraction %v must be between 0 and 1", fraction)
+	}
+	i.renewFraction = fraction
+	return nil
+}
+
+// ParseRenewWindow parses a renewal window given either as a duration
+// ("2h") or as a percentage of the certificate lifetime ("20%").
+func ParseRenewWindow(s string) (before time.Duration, fraction float64, err error) {
+	if pct, ok := strings.CutSuffix(s, "%"); ok {
+		v, err := strconv.ParseFloat(pct, 64)
+		if err != nil || v <= 0 || v >= 100 {
+			return 0, 0, fmt.Errorf("invalid renewal percentage %q", s)
+		}
+		return 0, v / 100, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, 0, fmt.Errorf("invalid renewal window %q", s)
+	}
+	return d, 0, nil
+}
+
+// needsRenewal reports whether a cached certificate is inside its renewal
+// window (or already expired)
+func (i *Issuer) needsRenewal(c *CachedCert) bool {
+	window := i.renewBefore
+	if i.renewFraction > 0 && c.Cert.Leaf != nil {
+		lifetime := c.Expiry.Sub(c.Cert.Leaf.NotBefore)
+		window = time.Duration(float64(lifetime) * i.renewFraction)
 	}
+	return !i.now().Before(c.Expiry.Add(-window))
 }
 
 // Issue creates a new leaf certificate with an ECDSA P-256 key, validates all
-// requested domains against the policy, and caches the result keyed by the
-// primary (first) DNS name.
+// requested domains against the policy, and caches the result keyed by its
+// SAN set (and stores it in the certificate directory, if set).
 func (i *Issuer) Issue(req IssueRequest) (*CachedCert, error) {
 	if len(req.DNSNames) == 0 && len(req.IPs) == 0 {
 		return nil, errors.New("issuer: at least one DNS name or IP address is required")
@@ -110,8 +174,12 @@ func (i *Issuer) Issue(req IssueRequest) (*CachedCert, error) {
 		template.Subject.CommonName = req.DNSNames[0]
 	}
 
-	// Sign via the CA (returns PEM).
+	// Sign via the CA (returns PEM). The intermediate must not change between
+	// signing and building the chain.
+	i.caMu.RLock()
 	certPEM, err := i.ca.SignCertificate(template, &ecKey.PublicKey)
+	interDER := i.ca.InterCert.Raw
+	i.caMu.RUnlock()
 	if err != nil {
 		return nil, fmt.Errorf("issuer: sign: %w", err)
 	}
@@ -140,11 +208,18 @@ func (i *Issuer) Issue(req IssueRequest) (*CachedCert, error) {
 
 	// Build the tls.Certificate with the intermediate in the chain.
 	tlsCert := tls.Certificate{
-		Certificate: [][]byte{leafDER, i.ca.InterCert.Raw},
+		Certificate: [][]byte{leafDER, interDER},
 		PrivateKey:  ecKey,
 		Leaf:        leafCert,
 	}
 
+	// A failed audit write does not block serving TLS.
+	if i.audit != nil {
+		if err := i.audit.Append(newAuditEntry(leafCert)); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+
 	cached := &CachedCert{
 		CertPEM: certPEM,
 		KeyPEM:  keyPEM,
@@ -152,19 +227,16 @@ func (i *Issuer) Issue(req IssueRequest) (*CachedCert, error) {
 		Expiry:  notAfter,
 	}
 
-	// Cache by primary DNS name.
-	if len(req.DNSNames) > 0 {
-		i.mu.Lock()
-		i.cache[req.DNSNames[0]] = cached
-		i.mu.Unlock()
-	}
+	i.add(cached)
+	i.persist(cached)
 
 	return cached, nil
 }
 
-// GetCertificate implements the tls.Config.GetCertificate callback. It looks
-// up a cached certificate for the requested server name, reissues if the cert
-// is within one hour of expiry, or issues a fresh one if none is cached.
+// GetCertificate implements the tls.Config.GetCertificate callback. It serves
+// a cached certificate covering the requested server name, reading the
+// certificate directory on a miss, and issues a fresh one if there is none
+// or all are within their renewal window.
 func (i *Issuer) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
 	serverName := hello.ServerName
 	if serverName == "" {
@@ -176,14 +248,15 @@ func (i *Issuer) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, e
 		return nil, fmt.Errorf("issuer: %w", err)
 	}
 
-	// Check cache.
-	i.mu.RLock()
-	cached, ok := i.cache[serverName]
-	i.mu.RUnlock()
-
-	if ok && time.Now().Before(cached.Expiry.Add(-renewBefore)) {
+	// Check the cache, then certificates stored by earlier runs or the CLI.
+	if cached := i.lookup(serverName); cached != nil {
 		return cached.Cert, nil
 	}
+	if i.loadDir() > 0 {
+		if cached := i.lookup(serverName); cached != nil {
+			return cached.Cert, nil
+		}
+	}
 
 	// Issue (or reissue) a certificate.
 	cc, err := i.Issue(IssueRequest{
@@ -195,3 +268,91 @@ func (i *Issuer) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, e
 
 	return cc.Cert, nil
 }
+
+// RenewDue reissues every cached certificate that is inside its renewal
+// window, for the same names, as GetCertificate would on the next request.
+// It returns how many were renewed.
+func (i *Issuer) RenewDue() (int, error) {
+	i.mu.RLock()
+	var due []*CachedCert
+	for _, c := range i.cache {
+		if i.needsRenewal(c) {
+			due = append(due, c)
+		}
+	}
+	i.mu.RUnlock()
+
+	renewed := 0
+	var errs []error
+	for _, c := range due {
+		leaf := c.Cert.Leaf
+		if leaf == nil {
+			continue
+		}
+		if _, err := i.Issue(IssueRequest{DNSNames: leaf.DNSNames, IPs: leaf.IPAddresses}); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		renewed++
+	}
+	return renewed, errors.Join(errs...)
+}
+
+// RunRenewer calls RenewDue every interval until ctx is done, so that
+// certificates of services nobody is visiting do not go stale.
+func (i *Issuer) RunRenewer(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultRenewInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := i.RenewDue()
+			if n > 0 {
+				log.Printf("Renewed %d leaf certificate(s) in the background", n)
+			}
+			if err != nil {
+				log.Printf("Warning: background certificate renewal: %v", err)
+			}
+		}
+	}
+}
+
+// Rotate replaces the CA's intermediate certificate and drops all cached
+// leaf certificates so that new ones chain to the new intermediate.
+func (i *Issuer) Rotate() error {
+	i.caMu.Lock()
+	err := i.ca.RotateIntermediate()
+	i.caMu.Unlock()
+	if err != nil {
+		return fmt.Errorf("issuer: rotate: %w", err)
+	}
+
+	i.ClearCache()
+	return nil
+}
+
+// ClearCache drops all cached leaf certificates.
+func (i *Issuer) ClearCache() {
+	i.mu.Lock()
+	i.cache = make(map[string]*CachedCert)
+	i.mu.Unlock()
+}
+
+// SetAuditLog makes Issue record every certificate it issues in a. A nil
+// AuditLog disables auditing.
+func (i *Issuer) SetAuditLog(a *AuditLog) {
+	i.audit = a
+}
+
+// Len returns the number of cached leaf certificates.
+func (i *Issuer) Len() int {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return len(i.cache)
+}
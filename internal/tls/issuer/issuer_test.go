@@ -1,11 +1,13 @@
 package issuer
 
 import (
+	"context"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/tls"
 	"crypto/x509"
 	"net"
+	"os"
 	"testing"
 	"time"
 
@@ -255,6 +257,70 @@ func TestGetCertificate_NearExpiryReissue(t *testing.T) {
 	}
 }
 
+func TestRenewDue_ReissuesOnlyNearExpiry(t *testing.T) {
+	iss := NewIssuer(newTestCA(t), policy.NewPolicy())
+
+	expiring, err := iss.Issue(IssueRequest{DNSNames: []string{"expiring.localhost"}, ValidFor: 30 * time.Minute})
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	fresh, err := iss.Issue(IssueRequest{DNSNames: []string{"fresh.localhost"}})
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	n, err := iss.RenewDue()
+	if err != nil {
+		t.Fatalf("RenewDue: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("renewed %d, want 1", n)
+	}
+
+	iss.mu.RLock()
+	renewed, kept := iss.cache["expiring.localhost"], iss.cache["fresh.localhost"]
+	iss.mu.RUnlock()
+	if renewed.Cert.Leaf.SerialNumber.Cmp(expiring.Cert.Leaf.SerialNumber) == 0 {
+		t.Error("near-expiry cert was not reissued")
+	}
+	if renewed.Cert.Leaf.DNSNames[0] != "expiring.localhost" {
+		t.Errorf("reissued for %v, want expiring.localhost", renewed.Cert.Leaf.DNSNames)
+	}
+	if kept != fresh {
+		t.Error("cert outside the renewal window was reissued")
+	}
+}
+
+func TestRunRenewer_ReissuesWithoutRequest(t *testing.T) {
+	iss := NewIssuer(newTestCA(t), policy.NewPolicy())
+	iss.SetRenewBefore(time.Minute)
+
+	cc, err := iss.Issue(IssueRequest{DNSNames: []string{"idle.localhost"}, ValidFor: 30 * time.Second})
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	original := cc.Cert.Leaf.SerialNumber
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go iss.RunRenewer(ctx, 10*time.Millisecond)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		iss.mu.RLock()
+		current := iss.cache["idle.localhost"]
+		iss.mu.RUnlock()
+		if current.Cert.Leaf.SerialNumber.Cmp(original) != 0 {
+			if remaining := time.Until(current.Expiry); remaining < 23*time.Hour {
+				t.Errorf("renewed cert expires in %v, want ~24h", remaining)
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("background renewer did not reissue the near-expiry cert")
+}
+
 func TestIssue_DefaultValidFor(t *testing.T) {
 	c := newTestCA(t)
 	p := policy.NewPolicy()
@@ -328,3 +394,220 @@ func TestIssue_PEMOutputs(t *testing.T) {
 		t.Fatalf("X509KeyPair: %v", err)
 	}
 }
+
+func TestRotate_ClearsCacheAndChainsToNewIntermediate(t *testing.T) {
+	c := newTestCA(t)
+	iss := NewIssuer(c, policy.NewPolicy())
+
+	hello := &tls.ClientHelloInfo{ServerName: "rotate.localhost"}
+	before, err := iss.GetCertificate(hello)
+	if err != nil {
+		t.Fatalf("GetCertificate: %v", err)
+	}
+	oldSerial := c.InterCert.SerialNumber
+
+	if err := iss.Rotate(); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	if c.InterCert.SerialNumber.Cmp(oldSerial) == 0 {
+		t.Error("intermediate serial did not change")
+	}
+	if iss.Len() != 0 {
+		t.Errorf("Len() = %d after Rotate, want 0", iss.Len())
+	}
+
+	after, err := iss.GetCertificate(hello)
+	if err != nil {
+		t.Fatalf("GetCertificate after rotate: %v", err)
+	}
+	if after == before {
+		t.Error("expected a fresh leaf after rotation")
+	}
+	if err := after.Leaf.CheckSignatureFrom(c.InterCert); err != nil {
+		t.Errorf("new leaf is not signed by the new intermediate: %v", err)
+	}
+}
+
+func TestGetCertificate_ProportionalRenewal(t *testing.T) {
+	c := newTestCA(t)
+	iss := NewIssuer(c, policy.NewPolicy())
+	if err := iss.SetRenewFraction(0.2); err != nil {
+		t.Fatalf("SetRenewFraction: %v", err)
+	}
+
+	// A 10 minute cert renews in its last 2 minutes
+	cc, err := iss.Issue(IssueRequest{DNSNames: []string{"short.localhost"}, ValidFor: 10 * time.Minute})
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	start := cc.Cert.Leaf.NotBefore
+	hello := &tls.ClientHelloInfo{ServerName: "short.localhost"}
+
+	iss.now = func() time.Time { return start.Add(7*time.Minute + 59*time.Second) }
+	got, err := iss.GetCertificate(hello)
+	if err != nil {
+		t.Fatalf("GetCertificate: %v", err)
+	}
+	if got != cc.Cert {
+		t.Fatal("cert reissued before the last 20% of its lifetime")
+	}
+
+	iss.now = func() time.Time { return start.Add(8*time.Minute + time.Second) }
+	got, err = iss.GetCertificate(hello)
+	if err != nil {
+		t.Fatalf("GetCertificate: %v", err)
+	}
+	if got == cc.Cert {
+		t.Fatal("cert not reissued inside the last 20% of its lifetime")
+	}
+}
+
+func TestGetCertificate_FixedRenewalDefault(t *testing.T) {
+	c := newTestCA(t)
+	iss := NewIssuer(c, policy.NewPolicy())
+
+	cc, err := iss.Issue(IssueRequest{DNSNames: []string{"daily.localhost"}})
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	hello := &tls.ClientHelloInfo{ServerName: "daily.localhost"}
+
+	iss.now = func() time.Time { return cc.Expiry.Add(-DefaultRenewBefore - time.Minute) }
+	if got, _ := iss.GetCertificate(hello); got != cc.Cert {
+		t.Error("cert reissued outside the default renewal window")
+	}
+	iss.now = func() time.Time { return cc.Expiry.Add(-DefaultRenewBefore + time.Minute) }
+	if got, _ := iss.GetCertificate(hello); got == cc.Cert {
+		t.Error("cert not reissued inside the default renewal window")
+	}
+}
+
+func TestParseRenewWindow(t *testing.T) {
+	tests := []struct {
+		in       string
+		before   time.Duration
+		fraction float64
+		wantErr  bool
+	}{
+		{"2h", 2 * time.Hour, 0, false},
+		{"20%", 0, 0.2, false},
+		{"0%", 0, 0, true},
+		{"100%", 0, 0, true},
+		{"soon", 0, 0, true},
+		{"-1h", 0, 0, true},
+	}
+	for _, tc := range tests {
+		before, fraction, err := ParseRenewWindow(tc.in)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("ParseRenewWindow(%q) error = %v, wantErr %v", tc.in, err, tc.wantErr)
+			continue
+		}
+		if before != tc.before || fraction != tc.fraction {
+			t.Errorf("ParseRenewWindow(%q) = %v, %v; want %v, %v", tc.in, before, fraction, tc.before, tc.fraction)
+		}
+	}
+}
+
+func TestGetCertificate_SecondarySANUsesMultiSANCert(t *testing.T) {
+	iss := NewIssuer(newTestCA(t), policy.NewPolicy())
+
+	multi, err := iss.Issue(IssueRequest{DNSNames: []string{"app.localhost", "api.app.localhost"}})
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	cert, err := iss.GetCertificate(&tls.ClientHelloInfo{ServerName: "api.app.localhost"})
+	if err != nil {
+		t.Fatalf("GetCertificate: %v", err)
+	}
+	if cert != multi.Cert {
+		t.Error("request for the secondary SAN was not served by the multi-SAN cert")
+	}
+	if iss.Len() != 1 {
+		t.Errorf("Len = %d, want 1 (no new cert issued)", iss.Len())
+	}
+}
+
+func TestGetCertificate_WildcardCoversSubdomain(t *testing.T) {
+	iss := NewIssuer(newTestCA(t), policy.NewPolicy())
+
+	wild, err := iss.Issue(IssueRequest{DNSNames: []string{"*.app.localhost", "app.localhost"}})
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	cert, err := iss.GetCertificate(&tls.ClientHelloInfo{ServerName: "web.app.localhost"})
+	if err != nil {
+		t.Fatalf("GetCertificate: %v", err)
+	}
+	if cert != wild.Cert {
+		t.Error("subdomain was not served by the wildcard cert")
+	}
+}
+
+func TestIssue_CacheKeyIgnoresSANOrder(t *testing.T) {
+	iss := NewIssuer(newTestCA(t), policy.NewPolicy())
+
+	iss.Issue(IssueRequest{DNSNames: []string{"b.localhost", "a.localhost"}})
+	iss.Issue(IssueRequest{DNSNames: []string{"a.localhost", "b.localhost"}})
+	iss.Issue(IssueRequest{DNSNames: []string{"a.localhost"}})
+	if iss.Len() != 2 {
+		t.Errorf("Len = %d, want 2 distinct SAN sets", iss.Len())
+	}
+}
+
+func TestGetCertificate_ReadsCertDir(t *testing.T) {
+	c := newTestCA(t)
+	dir := t.TempDir()
+
+	first := NewIssuer(c, policy.NewPolicy())
+	first.SetCertDir(dir)
+	issued, err := first.Issue(IssueRequest{DNSNames: []string{"app.localhost", "api.app.localhost"}})
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	if certPath, keyPath := CertFiles(dir, "app.localhost"); !fileExists(certPath) || !fileExists(keyPath) {
+		t.Fatalf("cert files not written to %s", dir)
+	}
+
+	// A restarted daemon serves the stored cert for any of its names
+	restarted := NewIssuer(c, policy.NewPolicy())
+	restarted.SetCertDir(dir)
+	cert, err := restarted.GetCertificate(&tls.ClientHelloInfo{ServerName: "api.app.localhost"})
+	if err != nil {
+		t.Fatalf("GetCertificate: %v", err)
+	}
+	if cert.Leaf.SerialNumber.Cmp(issued.Cert.Leaf.SerialNumber) != 0 {
+		t.Error("stored cert was not reused after a restart")
+	}
+	if len(cert.Certificate) != 2 {
+		t.Errorf("chain length = %d, want leaf and intermediate", len(cert.Certificate))
+	}
+}
+
+func TestGetCertificate_IgnoresStoredCertsAfterRotate(t *testing.T) {
+	c := newTestCA(t)
+	dir := t.TempDir()
+
+	iss := NewIssuer(c, policy.NewPolicy())
+	iss.SetCertDir(dir)
+	old, err := iss.Issue(IssueRequest{DNSNames: []string{"app.localhost"}})
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	if err := iss.Rotate(); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+
+	cert, err := iss.GetCertificate(&tls.ClientHelloInfo{ServerName: "app.localhost"})
+	if err != nil {
+		t.Fatalf("GetCertificate: %v", err)
+	}
+	if cert.Leaf.SerialNumber.Cmp(old.Cert.Leaf.SerialNumber) == 0 {
+		t.Error("served a stored cert signed by the rotated-out intermediate")
+	}
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,181 @@
+package issuer
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// CertsDirName is the directory of issued leaf certificates, kept in the CA
+// store directory.
+const CertsDirName = "certs"
+
+// CertFiles returns where the certificate and key whose primary name is name
+// are stored in dir.
+func CertFiles(dir, name string) (certPath, keyPath string) {
+	safeName := strings.ReplaceAll(strings.ReplaceAll(name, "*", "_wildcard"), "/", "_")
+	return filepath.Join(dir, safeName+".pem"), filepath.Join(dir, safeName+".key")
+}
+
+// sanKey is the cache key of a certificate: its sorted DNS names and IP
+// addresses
+func sanKey(dnsNames []string, ips []net.IP) string {
+	sans := make([]string, 0, len(dnsNames)+len(ips))
+	for _, name := range dnsNames {
+		sans = append(sans, strings.ToLower(name))
+	}
+	for _, ip := range ips {
+		sans = append(sans, ip.String())
+	}
+	sort.Strings(sans)
+	return strings.Join(sans, ",")
+}
+
+// primaryName is the name a certificate's files are stored under
+func primaryName(leaf *x509.Certificate) string {
+	if len(leaf.DNSNames) > 0 {
+		return leaf.DNSNames[0]
+	}
+	if len(leaf.IPAddresses) > 0 {
+		return leaf.IPAddresses[0].String()
+	}
+	return ""
+}
+
+// SetCertDir makes Issue write every certificate to dir, and GetCertificate
+// fall back to the certificates in dir (including those written by earlier
+// runs or by 'nameport tls ensure') before issuing a new one.
+func (i *Issuer) SetCertDir(dir string) {
+	i.mu.Lock()
+	i.certDir = dir
+	i.mu.Unlock()
+}
+
+// lookup returns the cached certificate with the most time left that covers
+// name and is not due for renewal, or nil
+func (i *Issuer) lookup(name string) *CachedCert {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	var best *CachedCert
+	for _, c := range i.cache {
+		if c.Cert.Leaf == nil || c.Cert.Leaf.VerifyHostname(name) != nil || i.needsRenewal(c) {
+			continue
+		}
+		if best == nil || c.Expiry.After(best.Expiry) {
+			best = c
+		}
+	}
+	return best
+}
+
+// add caches c under its SAN set, unless a certificate for the same names
+// that lasts longer is already cached
+func (i *Issuer) add(c *CachedCert) {
+	key := sanKey(c.Cert.Leaf.DNSNames, c.Cert.Leaf.IPAddresses)
+	i.mu.Lock()
+	if old, ok := i.cache[key]; !ok || !old.Expiry.After(c.Expiry) {
+		i.cache[key] = c
+	}
+	i.mu.Unlock()
+}
+
+// persist writes c to the certificate directory, if one is set. A failed
+// write does not block serving TLS.
+func (i *Issuer) persist(c *CachedCert) {
+	i.mu.RLock()
+	dir := i.certDir
+	i.mu.RUnlock()
+	if dir == "" {
+		return
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		log.Printf("Warning: issuer: create %s: %v", dir, err)
+		return
+	}
+	certPath, keyPath := CertFiles(dir, primaryName(c.Cert.Leaf))
+	if err := os.WriteFile(keyPath, c.KeyPEM, 0600); err != nil {
+		log.Printf("Warning: issuer: write %s: %v", keyPath, err)
+		return
+	}
+	if err := os.WriteFile(certPath, c.CertPEM, 0644); err != nil {
+		log.Printf("Warning: issuer: write %s: %v", certPath, err)
+	}
+}
+
+// loadDir caches the usable certificates in the certificate directory:
+// those with a matching key that were signed by the current intermediate.
+// It returns how many it read.
+func (i *Issuer) loadDir() int {
+	i.mu.RLock()
+	dir := i.certDir
+	i.mu.RUnlock()
+	if dir == "" {
+		return 0
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0
+	}
+
+	loaded := 0
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".pem") {
+			continue
+		}
+		certPath := filepath.Join(dir, e.Name())
+		keyPath := strings.TrimSuffix(certPath, ".pem") + ".key"
+		if c := i.loadCert(certPath, keyPath); c != nil {
+			i.add(c)
+			loaded++
+		}
+	}
+	return loaded
+}
+
+// loadCert reads one certificate and its key, or returns nil if they are
+// unusable
+func (i *Issuer) loadCert(certPath, keyPath string) *CachedCert {
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil
+	}
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil
+	}
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil
+	}
+
+	// Certificates from before an intermediate rotation no longer chain
+	i.caMu.RLock()
+	inter := i.ca.InterCert
+	i.caMu.RUnlock()
+	if leaf.CheckSignatureFrom(inter) != nil {
+		return nil
+	}
+
+	return &CachedCert{
+		CertPEM: certPEM,
+		KeyPEM:  keyPEM,
+		Cert: &tls.Certificate{
+			Certificate: [][]byte{leaf.Raw, inter.Raw},
+			PrivateKey:  pair.PrivateKey,
+			Leaf:        leaf,
+		},
+		Expiry: leaf.NotAfter,
+	}
+}
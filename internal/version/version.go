@@ -0,0 +1,40 @@
+// Package version reports which build of nameport is running.
+package version
+
+import "runtime/debug"
+
+// Version is set at build time, e.g.
+//
+//	go build -ldflags "-X nameport/internal/version.Version=v1.2.0" ./cmd/cli
+var Version = ""
+
+// String returns Version, or else the VCS revision the Go toolchain stamped
+// into the binary, or "dev".
+func String() string {
+	if Version != "" {
+		return Version
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "dev"
+	}
+	revision, modified := "", false
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			revision = s.Value
+		case "vcs.modified":
+			modified = s.Value == "true"
+		}
+	}
+	if revision == "" {
+		return "dev"
+	}
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	if modified {
+		revision += "-dirty"
+	}
+	return "dev-" + revision
+}